@@ -28,6 +28,32 @@ type (
 		EdgeKeySet bool
 	}
 
+	// ClusterMemberDetails is the representation of an agent inside a cluster along with its health,
+	// as observed by the local agent.
+	ClusterMemberDetails struct {
+		ClusterMember
+		// Status is the status of the member: alive, suspect, leaving, left or failed
+		Status string `json:"Status"`
+		// LastSeen is the last time the member was reached by the local agent (Unix timestamp), 0 when unknown
+		LastSeen     int64  `json:"LastSeen"`
+		AgentVersion string `json:"AgentVersion"`
+		// Platform is the operating system and architecture of the agent, e.g. linux/amd64
+		Platform string `json:"Platform"`
+		// Latency is the estimated round-trip time to the member in milliseconds, 0 when unknown
+		Latency      float64 `json:"Latency"`
+		DockerNodeID string  `json:"DockerNodeID,omitempty"`
+	}
+
+	// ClusterMemberEvent is a membership transition of an agent inside a cluster, as observed by the local agent
+	ClusterMemberEvent struct {
+		// Type is the type of the transition: join, leave, fail, update or reap
+		Type      string `json:"Type"`
+		NodeName  string `json:"NodeName"`
+		IPAddress string `json:"IPAddress"`
+		// Time is the time of the transition (Unix timestamp)
+		Time int64 `json:"Time"`
+	}
+
 	// ContainerPlatform represent the platform on which the agent is running (Docker, Kubernetes)
 	ContainerPlatform int
 
@@ -42,6 +68,26 @@ type (
 		EngineType DockerEngineType
 		Leader     bool
 		NodeRole   DockerNodeRole
+		NodeID     string
+	}
+
+	// SwarmTopology is the view of the Swarm cluster used to validate the members of the agent cluster
+	SwarmTopology struct {
+		// TaskHosts contains the address of the node running each task of the agent service, indexed by task IP address
+		TaskHosts map[string]string
+		// Nodes contains the nodes of the cluster indexed by hostname, they can only be listed on the managers
+		Nodes map[string]SwarmNode
+		// ManagerAddresses contains the addresses of the manager nodes
+		ManagerAddresses []string
+		// LocalNode is the node running the local agent
+		LocalNode SwarmNode
+	}
+
+	// SwarmNode is a node of the Swarm cluster
+	SwarmNode struct {
+		Hostname string
+		Role     DockerNodeRole
+		Address  string
 	}
 
 	// EdgeJobStatus represents an Edge job status
@@ -67,6 +113,13 @@ type (
 		} `json:"Agent"`
 	}
 
+	// ResourcesChangedEvent is broadcast to the agent cluster when Docker resources are modified on a node
+	ResourcesChangedEvent struct {
+		NodeName string `json:"NodeName"`
+		// Resources are the types of the modified resources: container, image, volume, network or builder
+		Resources []string `json:"Resources"`
+	}
+
 	EdgeMetaFields struct {
 		// EdgeGroupsIDs - Used for AEEC, the created environment will be added to these edge groups
 		EdgeGroupsIDs []int
@@ -83,9 +136,38 @@ type (
 		AgentServerAddr       string
 		AgentServerPort       string
 		AgentSecurityShutdown time.Duration
+		SignatureMaxSkew      time.Duration
+		SignatureStrict       bool
+		TLSCert               string
+		TLSKey                string
+		TLSClientCA           string
+		TLSRenewBefore        time.Duration
+		BrowseArchiveMaxSize  int64
+		BackupRetentionCount  int
+		BackupRetentionMaxAge time.Duration
+		BackupS3Endpoint      string
+		BackupS3Region        string
+		BackupS3Bucket        string
+		BackupS3AccessKeyID   string
+		BackupS3SecretKey     string
+		BackupS3Prefix        string
+		BackupS3PathStyle     bool
+		RecordingEnabled      bool
+		RecordingMaxAge       time.Duration
+		RecordingMaxSize      int64
+		WebsocketIdleTimeout  time.Duration
+		WebsocketMaxDuration  time.Duration
+		WebsocketMaxSessions  int
 		ClusterAddress        string
+		ClusterDiscovery      string
+		ClusterAdvertiseAddr  string
 		ClusterProbeTimeout   time.Duration
 		ClusterProbeInterval  time.Duration
+		ClusterKeyFile        string
+		ClusterKeyRollout     string
+		ClusterNodeTimeout    time.Duration
+		ClusterQuorum         string
+		ClusterCacheTTL       time.Duration
 		DataPath              string
 		SharedSecret          string
 		EdgeMode              bool
@@ -98,12 +180,16 @@ type (
 		EdgeInsecurePoll      bool
 		EdgeTunnel            bool
 		EdgeTunnelProxy       string
+		EdgeJobScheduler      string
+		EdgeFailoverThreshold int
+		EdgeFailbackInterval  time.Duration
 		EdgeMetaFields        EdgeMetaFields
 		LogLevel              string
 		LogMode               string
 		SSLCert               string
 		SSLKey                string
 		SSLCACert             string
+		RevocationHardFail    bool
 		CertRetryInterval     time.Duration
 		AWSClientCert         string
 		AWSClientKey          string
@@ -142,6 +228,24 @@ type (
 		Script         string
 		Version        int
 		CollectLogs    bool
+		// Timeout is the duration in seconds after which a run of the script is stopped, 0 means no timeout.
+		// Only supported by the agent scheduler.
+		Timeout int
+		// ConcurrencyPolicy defines what happens when the script is due while a previous run is still running,
+		// see the JobConcurrencyPolicy constants. Only supported by the agent scheduler.
+		ConcurrencyPolicy string
+	}
+
+	// TrustedKey is the representation of a Portainer public key trusted by the agent
+	TrustedKey struct {
+		// PublicKey is the hexadecimal encoded DER representation of the public key
+		PublicKey string `json:"PublicKey"`
+		// Fingerprint is the SHA-256 hash of the public key
+		Fingerprint string `json:"Fingerprint"`
+		// AssociatedAt is the unix timestamp at which the key was associated to the agent
+		AssociatedAt int64 `json:"AssociatedAt"`
+		// ExpiresAt is the unix timestamp after which the key will no longer be trusted, 0 if the key does not expire
+		ExpiresAt int64 `json:"ExpiresAt"`
 	}
 
 	// TunnelConfig contains all the required information for the agent to establish
@@ -160,18 +264,37 @@ type (
 	ClusterService interface {
 		Create(advertiseAddr string, joinAddr []string, probeTimeout, probeInterval time.Duration) error
 		Members() []ClusterMember
+		// MemberDetails returns every known member of the cluster along with its health, including the members
+		// that left or failed
+		MemberDetails() []ClusterMemberDetails
+		// MemberEvents returns the last membership transitions observed by the local agent, the oldest first
+		MemberEvents() []ClusterMemberEvent
 		Leave()
 		GetMemberByRole(role DockerNodeRole) *ClusterMember
 		GetMemberByNodeName(nodeName string) *ClusterMember
 		GetMemberWithEdgeKeySet() *ClusterMember
 		GetRuntimeConfiguration() *RuntimeConfig
 		UpdateRuntimeConfiguration(runtimeConfiguration *RuntimeConfig) error
+		// BroadcastEvent sends an event to every member of the cluster, including the local agent
+		BroadcastEvent(name string, payload []byte) error
+		// SubscribeEvents registers a handler called with the payload of each event named name
+		SubscribeEvents(name string, handler func(payload []byte))
 	}
 
 	// DigitalSignatureService is used to validate digital signatures.
 	DigitalSignatureService interface {
 		IsAssociated() bool
 		VerifySignature(signature, key string) (bool, error)
+		// VerifyRequestSignature verifies a signature created with the replay protected signature scheme,
+		// requestDigest is the canonical representation of the signed request
+		VerifyRequestSignature(signature, key, requestDigest string) (bool, error)
+		// RotateKey trusts newKey after verifying that it was signed by currentKey, currentKey
+		// will stop being trusted after the grace period
+		RotateKey(currentKey, newKey, newKeySignature string, gracePeriod time.Duration) error
+		// VerifyContentSignature verifies that content was signed by key: the signature is the base64 encoded
+		// ECDSA signature of the SHA-256 hash of content
+		VerifyContentSignature(signature, key, content string) (bool, error)
+		TrustedKeys() []TrustedKey
 	}
 
 	// DockerInfoService is used to retrieve information from a Docker environment.
@@ -179,6 +302,7 @@ type (
 		GetRuntimeConfigurationFromDockerEngine() (*RuntimeConfig, error)
 		GetContainerIpFromDockerEngine(containerName string, ignoreNonSwarmNetworks bool) (string, error)
 		GetServiceNameFromDockerEngine(containerName string) (string, error)
+		GetSwarmTopologyFromDockerEngine(containerName string) (*SwarmTopology, error)
 	}
 
 	Deployer interface {
@@ -255,7 +379,9 @@ const (
 
 const (
 	// APIVersion represents the version of the agent's API.
-	APIVersion = "2"
+	// Version 3 adds support for the replay protected request signature scheme,
+	// the routes are the same as in version 2.
+	APIVersion = "3"
 	// DefaultAgentAddr is the default address used by the Agent API server.
 	DefaultAgentAddr = "0.0.0.0"
 	// DefaultAgentPort is the default port exposed by the Agent API server.
@@ -264,6 +390,18 @@ const (
 	DefaultLogLevel = "INFO"
 	// DefaultAgentSecurityShutdown is the default time after which the API server will shut down if not associated with a Portainer instance
 	DefaultAgentSecurityShutdown = "72h"
+	// DefaultSignatureMaxSkew is the default maximum difference between the timestamp of a signed request and the agent clock
+	DefaultSignatureMaxSkew = "5m"
+	// DefaultTLSRenewBefore is the default duration before its expiry after which the self-signed TLS certificate is renewed
+	DefaultTLSRenewBefore = "720h"
+	// DefaultBrowseArchiveMaxSize is the default maximum size of the content of the archives created and extracted by the volume browser
+	DefaultBrowseArchiveMaxSize = "10GB"
+	// DefaultBackupRetentionCount is the default maximum number of backups kept for each volume
+	DefaultBackupRetentionCount = "5"
+	// DefaultRecordingMaxAge is the default duration after which the terminal session recordings are removed
+	DefaultRecordingMaxAge = "720h"
+	// DefaultRecordingMaxSize is the default maximum size of a terminal session recording
+	DefaultRecordingMaxSize = "100MB"
 	// DefaultEdgeSecurityShutdown is the default time after which the Edge server will shut down if no key is specified
 	DefaultEdgeSecurityShutdown = 15
 	// DefaultEdgeServerAddr is the default address used by the Edge server.
@@ -274,12 +412,30 @@ const (
 	DefaultEdgePollInterval = "5s"
 	// DefaultEdgeSleepInterval is the default interval after which the agent will close the tunnel if no activity.
 	DefaultEdgeSleepInterval = "5m"
+	// DefaultEdgeJobScheduler is the default scheduler used to run the Edge jobs, it uses the host cron when available.
+	DefaultEdgeJobScheduler = "auto"
+	// DefaultEdgeFailoverThreshold is the default number of consecutive poll failures after which the agent fails over
+	// to the next Portainer server of the Edge key.
+	DefaultEdgeFailoverThreshold = "3"
+	// DefaultEdgeFailbackInterval is the default interval used to check if the primary Portainer server is healthy again
+	// once the agent failed over to another server.
+	DefaultEdgeFailbackInterval = "1m"
 	// DefaultConfigCheckInterval is the default interval used to check if node config changed
 	DefaultConfigCheckInterval = "5s"
 	// DefaultClusterProbeTimeout is the default member list ping probe timeout.
 	DefaultClusterProbeTimeout = "500ms"
 	// DefaultClusterProbeInterval is the interval for repeating failed node checks.
 	DefaultClusterProbeInterval = "1s"
+	// DefaultClusterNodeTimeout is the default duration after which a node is considered failed during a cluster operation.
+	DefaultClusterNodeTimeout = "30s"
+	// DefaultClusterCacheTTL is the default duration during which the responses of the nodes to the cluster operations are cached.
+	DefaultClusterCacheTTL = "5s"
+	// ClusterEventResourcesChanged is the name of the cluster event broadcast when Docker resources are modified on a node.
+	ClusterEventResourcesChanged = "docker-resources-changed"
+	// ClusterEventEdgeKeyRotated is the name of the cluster event broadcast when the Edge key of a node is rotated.
+	ClusterEventEdgeKeyRotated = "edge-key-rotated"
+	// ClusterEventTrustedKeyRotated is the name of the cluster event broadcast when a node trusts a new Portainer public key.
+	ClusterEventTrustedKeyRotated = "trusted-key-rotated"
 	// HTTPTargetHeaderName is the name of the header used to specify a target node.
 	HTTPTargetHeaderName = "X-PortainerAgent-Target"
 	// HTTPEdgeIdentifierHeaderName is the name of the header used to specify the Docker identifier associated to
@@ -294,6 +450,28 @@ const (
 	// HTTPPublicKeyHeaderName is the name of the header containing the public key
 	// of a Portainer instance.
 	HTTPPublicKeyHeaderName = "X-PortainerAgent-PublicKey"
+	// HTTPSignatureTimestampHeaderName is the name of the header containing the unix timestamp
+	// at which a request was signed with the replay protected signature scheme.
+	HTTPSignatureTimestampHeaderName = "X-PortainerAgent-Timestamp"
+	// HTTPSignatureNonceHeaderName is the name of the header containing the unique nonce
+	// of a request signed with the replay protected signature scheme.
+	HTTPSignatureNonceHeaderName = "X-PortainerAgent-Nonce"
+	// HTTPSignatureBodyHashHeaderName is the name of the optional header containing the hexadecimal
+	// encoded SHA-256 hash of the body of a request signed with the replay protected signature scheme.
+	HTTPSignatureBodyHashHeaderName = "X-PortainerAgent-BodyHash"
+	// HTTPClusterQuorumHeaderName is the name of the header used to override the minimum number of nodes
+	// that must respond to a cluster operation: all, majority or a number of nodes.
+	HTTPClusterQuorumHeaderName = "X-PortainerAgent-Quorum"
+	// HTTPClusterEnvelopeHeaderName is the name of the header used to request the response of a cluster operation
+	// to be wrapped in an envelope containing the nodes that responded and the nodes that failed.
+	HTTPClusterEnvelopeHeaderName = "X-PortainerAgent-Envelope"
+	// HTTPClusterStreamHeaderName is the name of the header used to request the objects of each node to be written
+	// as soon as the node responds. It is ignored when a quorum or an envelope is requested.
+	HTTPClusterStreamHeaderName = "X-PortainerAgent-Stream"
+	// HTTPResponseClusterNodesHeaderName is the name of the header containing the JSON representation
+	// of the nodes that responded, the nodes served from the cache and the nodes that failed during a cluster
+	// operation. It is sent as a trailer when the response is streamed.
+	HTTPResponseClusterNodesHeaderName = "X-PortainerAgent-Cluster-Nodes"
 	// HTTPResponseAgentTimeZone is the name of the header containing the timezone
 	HTTPResponseAgentTimeZone = "X-PortainerAgent-TimeZone"
 	// HTTPResponseUpdateIDHeaderName is the name of the header that will have the update ID that started this container
@@ -320,6 +498,8 @@ const (
 	TLSCertPath = "cert.pem"
 	// TLSKeyPath is the default path to the TLS key file.
 	TLSKeyPath = "key.pem"
+	// DefaultTLSCheckInterval is the default interval used to check if the TLS certificates must be reloaded or renewed.
+	DefaultTLSCheckInterval = time.Minute
 	// HostRoot is the folder mapping to the underlying host filesystem that is mounted inside the container.
 	HostRoot = "/host"
 	// DefaultDataPath is the default folder where the data associated to the agent is persisted.
@@ -328,6 +508,16 @@ const (
 	ScheduleScriptDirectory = "/opt/portainer/scripts"
 	// EdgeKeyFile is the name of the file used to persist the Edge key associated to the agent.
 	EdgeKeyFile = "agent_edge_key"
+	// HostKeySaltFile is the name of the file containing the salt of the key used to encrypt the secrets persisted by the agent.
+	HostKeySaltFile = "agent_host_key_salt"
+	// TrustedKeysFile is the name of the file used to persist the Portainer public keys trusted by the agent.
+	TrustedKeysFile = "agent_trusted_keys.json"
+	// DefaultKeyRotationGracePeriod is the default duration during which a rotated key is still trusted.
+	DefaultKeyRotationGracePeriod = 24 * time.Hour
+	// RevocationCacheDirectory is the name of the folder used to persist the certificate revocation data (CRLs and OCSP responses).
+	RevocationCacheDirectory = "revocation_cache"
+	// PolicyFile is the name of the file containing the local operation policy enforced by the agent.
+	PolicyFile = "agent_policy.json"
 	// DefaultAssetsPath is the default path of the binaries
 	DefaultAssetsPath = "/app"
 	// EdgeStackFilesPath is the path where edge stack files are saved
@@ -388,3 +578,60 @@ const (
 	// TunnelStatusActive represents an active state for a tunnel connected to an Edge environment(endpoint)
 	TunnelStatusActive string = "ACTIVE"
 )
+
+const (
+	// ClusterMemberStatusAlive represents a member that is part of the cluster and reachable
+	ClusterMemberStatusAlive string = "alive"
+	// ClusterMemberStatusSuspect represents an alive member that was not reached recently
+	ClusterMemberStatusSuspect string = "suspect"
+	// ClusterMemberStatusLeaving represents a member that is leaving the cluster
+	ClusterMemberStatusLeaving string = "leaving"
+	// ClusterMemberStatusLeft represents a member that left the cluster gracefully
+	ClusterMemberStatusLeft string = "left"
+	// ClusterMemberStatusFailed represents a member that stopped responding
+	ClusterMemberStatusFailed string = "failed"
+)
+
+const (
+	// ClusterMemberEventJoin is recorded when a member joins the cluster
+	ClusterMemberEventJoin string = "join"
+	// ClusterMemberEventLeave is recorded when a member leaves the cluster gracefully
+	ClusterMemberEventLeave string = "leave"
+	// ClusterMemberEventFail is recorded when a member is considered failed
+	ClusterMemberEventFail string = "fail"
+	// ClusterMemberEventUpdate is recorded when the tags of a member are updated
+	ClusterMemberEventUpdate string = "update"
+	// ClusterMemberEventReap is recorded when a member that left or failed is removed from the member list
+	ClusterMemberEventReap string = "reap"
+)
+
+const (
+	// ClusterDiscoveryDNS joins the agents whose IP addresses are returned by a DNS lookup of the cluster address
+	ClusterDiscoveryDNS string = "dns"
+	// ClusterDiscoverySRV joins the agents returned by a DNS SRV lookup of the cluster address
+	ClusterDiscoverySRV string = "srv"
+	// ClusterDiscoveryStatic joins the agents of the comma separated list of addresses of the cluster address
+	ClusterDiscoveryStatic string = "static"
+	// ClusterDiscoveryKubernetes joins the agents listed in the endpoints of the Kubernetes service named after the cluster address
+	ClusterDiscoveryKubernetes string = "kubernetes"
+)
+
+const (
+	// ClusterKeyRolloutEnforce rejects the unencrypted gossip
+	ClusterKeyRolloutEnforce string = "enforce"
+	// ClusterKeyRolloutPermissive sends the gossip unencrypted and accepts both encrypted and unencrypted gossip,
+	// it is the default so that the agents of a running unencrypted cluster can be upgraded one by one
+	ClusterKeyRolloutPermissive string = "permissive"
+	// ClusterKeyRolloutEncrypt sends the gossip encrypted and still accepts unencrypted gossip, it is the second stage
+	// when enabling the encryption on a running cluster
+	ClusterKeyRolloutEncrypt string = "encrypt"
+)
+
+const (
+	// JobConcurrencyPolicySkip skips a run of an Edge job while the previous run is still running
+	JobConcurrencyPolicySkip string = "skip"
+	// JobConcurrencyPolicyQueue starts a run of an Edge job once the previous run ends, at most one run is queued
+	JobConcurrencyPolicyQueue string = "queue"
+	// JobConcurrencyPolicyReplace stops the previous run of an Edge job before starting a new run
+	JobConcurrencyPolicyReplace string = "replace"
+)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	gohttp "net/http"
@@ -13,13 +14,17 @@ import (
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/docker/backup"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/edge/aws"
 	httpEdge "github.com/portainer/agent/edge/http"
 	"github.com/portainer/agent/edge/registry"
 	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/filesystem"
 	"github.com/portainer/agent/ghw"
 	"github.com/portainer/agent/http"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
 	"github.com/portainer/agent/internals/updates"
 	"github.com/portainer/agent/kubernetes"
 	"github.com/portainer/agent/net"
@@ -54,6 +59,10 @@ func main() {
 		log.Fatal().Msg("edge Async mode cannot be enabled if Edge Mode is disabled")
 	}
 
+	if err := proxy.ValidateQuorum(options.ClusterQuorum); err != nil {
+		log.Fatal().Err(err).Msg("invalid agent cluster quorum")
+	}
+
 	if options.SSLCert != "" && options.SSLKey != "" && options.CertRetryInterval > 0 {
 		edge.BlockUntilCertificateIsReady(options.SSLCert, options.SSLKey, options.CertRetryInterval)
 	}
@@ -68,6 +77,7 @@ func main() {
 	var dockerInfoService agent.DockerInfoService
 	var advertiseAddr string
 	var kubeClient *kubernetes.KubeClient
+	var backupService *backup.Service
 
 	var updaterCleaner updates.GhostUpdaterCleaner
 	ctx := context.Background()
@@ -112,7 +122,21 @@ func main() {
 		}
 
 		if containerPlatform == agent.PlatformDocker && clusterMode {
-			clusterService = cluster.NewClusterService(runtimeConfiguration)
+			securityConfig := cluster.SecurityConfig{
+				Keys:       gossipKeys(options),
+				KeyFile:    options.ClusterKeyFile,
+				KeyRollout: options.ClusterKeyRollout,
+			}
+
+			// The members are matched with the tasks of the agent service, which is not possible when the agents
+			// advertise another address
+			if options.ClusterAdvertiseAddr == "" {
+				securityConfig.Topology = func() (*agent.SwarmTopology, error) {
+					return dockerInfoService.GetSwarmTopologyFromDockerEngine(containerName)
+				}
+			}
+
+			clusterService = cluster.NewClusterService(runtimeConfiguration, securityConfig)
 
 			clusterAddr := options.ClusterAddress
 			if clusterAddr == "" {
@@ -128,27 +152,35 @@ func main() {
 			// sometimes... Waiting a bit before starting the discovery (at least 3 seconds) seems to solve the problem.
 			time.Sleep(3 * time.Second)
 
-			joinAddr, err := net.LookupIPAddresses(clusterAddr)
-			if err != nil {
-				log.Fatal().Str("host", clusterAddr).Err(err).
-					Msg("unable to retrieve a list of IP associated to the host")
-			}
+			createCluster(clusterService, options, advertiseAddr, clusterAddr, nil)
 
-			err = clusterService.Create(advertiseAddr, joinAddr, options.ClusterProbeTimeout, options.ClusterProbeInterval)
-			if err != nil {
-				log.Fatal().Err(err).Msg("unable to create cluster")
+			defer clusterService.Leave()
+
+			go broadcastResourceChanges(ctx, clusterService, runtimeConfiguration.NodeName)
+		} else if options.ClusterDiscovery != "" {
+			// The agents of standalone hosts only form a cluster when a discovery mechanism is specified,
+			// the requests can then be routed to any node with the target header
+			if options.ClusterAddress == "" {
+				log.Fatal().Msg(os.EnvKeyClusterAddr + " must be specified to form a cluster of agents on standalone hosts")
 			}
 
-			log.Debug().
-				Str("agent_port", options.AgentServerPort).
-				Str("cluster_address", clusterAddr).
-				Str("advertise_address", advertiseAddr).
-				Str("probe_timeout", options.ClusterProbeTimeout.String()).
-				Str("probe_interval", options.ClusterProbeInterval.String()).
-				Msg("")
+			log.Info().Str("discovery", options.ClusterDiscovery).Msg("agent running on a standalone host. Running in cluster mode")
+
+			clusterService = cluster.NewClusterService(runtimeConfiguration, cluster.SecurityConfig{
+				Keys:       gossipKeys(options),
+				KeyFile:    options.ClusterKeyFile,
+				KeyRollout: options.ClusterKeyRollout,
+			})
+
+			createCluster(clusterService, options, advertiseAddr, options.ClusterAddress, nil)
 
 			defer clusterService.Leave()
 		}
+
+		backupService, err = backup.NewService(backupConfig(options))
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create the volume backup service")
+		}
 	}
 
 	// !Docker
@@ -165,7 +197,11 @@ func main() {
 
 		kubernetesDeployer = exec.NewKubernetesDeployer(options.AssetsPath)
 
-		clusterService = cluster.NewClusterService(runtimeConfiguration)
+		clusterService = cluster.NewClusterService(runtimeConfiguration, cluster.SecurityConfig{
+			Keys:       gossipKeys(options),
+			KeyFile:    options.ClusterKeyFile,
+			KeyRollout: options.ClusterKeyRollout,
+		})
 
 		advertiseAddr = os.GetKubernetesPodIP()
 		if advertiseAddr == "" {
@@ -181,24 +217,7 @@ func main() {
 		// for the container to be considered running by Kubernetes and an entry to be added to the DNS.
 		time.Sleep(3 * time.Second)
 
-		joinAddr, err := net.LookupIPAddresses(clusterAddr)
-		if err != nil {
-			log.Fatal().Str("host", clusterAddr).Err(err).
-				Msg("unable to retrieve a list of IP associated to the host")
-		}
-
-		err = clusterService.Create(advertiseAddr, joinAddr, options.ClusterProbeTimeout, options.ClusterProbeInterval)
-		if err != nil {
-			log.Fatal().Err(err).Msg("unable to create cluster")
-		}
-
-		log.Debug().
-			Str("agent_port", options.AgentServerPort).
-			Str("cluster_address", clusterAddr).
-			Str("advertise_address", advertiseAddr).
-			Str("probe_timeout", options.ClusterProbeTimeout.String()).
-			Str("probe_interval", options.ClusterProbeInterval.String()).
-			Msg("")
+		createCluster(clusterService, options, advertiseAddr, clusterAddr, kubeClient)
 
 		defer clusterService.Leave()
 	}
@@ -211,15 +230,33 @@ func main() {
 	// !Clean the updater
 
 	// Security
-	signatureService := crypto.NewECDSAService(options.SharedSecret)
+	signatureService, err := crypto.NewECDSAService(options.SharedSecret, options.DataPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load the trusted public keys")
+	}
 
-	if !options.EdgeMode {
-		tlsService := crypto.TLSService{}
+	policyService, err := security.NewPolicyService(options.DataPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to load the agent operation policy")
+	}
 
-		err := tlsService.GenerateCertsForHost(advertiseAddr)
+	uploadService := filesystem.NewUploadService(options.DataPath)
+	go uploadService.Start(ctx)
+
+	var certificateManager *crypto.CertificateManager
+	if !options.EdgeMode {
+		certificateManager, err = crypto.NewCertificateManager(crypto.CertificateManagerConfig{
+			CertPath:     options.TLSCert,
+			KeyPath:      options.TLSKey,
+			ClientCAPath: options.TLSClientCA,
+			Host:         advertiseAddr,
+			RenewBefore:  options.TLSRenewBefore,
+		})
 		if err != nil {
-			log.Fatal().Err(err).Msg("unable to generate self-signed certificates")
+			log.Fatal().Err(err).Msg("unable to load the TLS certificates")
 		}
+
+		go certificateManager.Start(ctx)
 	}
 
 	// !Security
@@ -233,6 +270,9 @@ func main() {
 			ClusterService:    clusterService,
 			DockerInfoService: dockerInfoService,
 			ContainerPlatform: containerPlatform,
+			KubeClient:        kubeClient,
+			BackupService:     backupService,
+			SignatureService:  signatureService,
 		}
 
 		edgeManager = edge.NewManager(edgeManagerParameters)
@@ -270,7 +310,11 @@ func main() {
 		SystemService:        systemService,
 		ClusterService:       clusterService,
 		EdgeManager:          edgeManager,
+		BackupService:        backupService,
 		SignatureService:     signatureService,
+		PolicyService:        policyService,
+		UploadService:        uploadService,
+		CertificateManager:   certificateManager,
 		RuntimeConfiguration: runtimeConfiguration,
 		AgentOptions:         options,
 		KubeClient:           kubeClient,
@@ -308,6 +352,100 @@ func startAPIServer(config *http.APIServerConfig, edgeMode bool) error {
 	return server.Start(edgeMode)
 }
 
+func backupConfig(options *agent.Options) backup.Config {
+	config := backup.Config{
+		DataPath: options.DataPath,
+		Retention: backup.RetentionPolicy{
+			Count:  options.BackupRetentionCount,
+			MaxAge: options.BackupRetentionMaxAge,
+		},
+	}
+
+	if options.BackupS3Endpoint != "" {
+		config.S3 = &backup.S3Config{
+			Endpoint:        options.BackupS3Endpoint,
+			Region:          options.BackupS3Region,
+			Bucket:          options.BackupS3Bucket,
+			AccessKeyID:     options.BackupS3AccessKeyID,
+			SecretAccessKey: options.BackupS3SecretKey,
+			Prefix:          options.BackupS3Prefix,
+			ForcePathStyle:  options.BackupS3PathStyle,
+		}
+	}
+
+	return config
+}
+
+// broadcastResourceChanges notifies the agent cluster when the Docker resources of the node are modified,
+// so that the cached responses of the node are invalidated
+func broadcastResourceChanges(ctx context.Context, clusterService agent.ClusterService, nodeName string) {
+	docker.WatchResourceChanges(ctx, time.Second, func(resources []string) {
+		payload, err := json.Marshal(agent.ResourcesChangedEvent{NodeName: nodeName, Resources: resources})
+		if err != nil {
+			return
+		}
+
+		if err := clusterService.BroadcastEvent(agent.ClusterEventResourcesChanged, payload); err != nil {
+			log.Debug().Err(err).Msg("unable to broadcast the resource changes to the agent cluster")
+		}
+	})
+}
+
+// createCluster creates the agent cluster and joins the agents found at clusterAddr by the discovery mechanism
+// of the options
+func createCluster(clusterService agent.ClusterService, options *agent.Options, advertiseAddr, clusterAddr string, kubeClient *kubernetes.KubeClient) {
+	if options.ClusterAdvertiseAddr != "" {
+		advertiseAddr = options.ClusterAdvertiseAddr
+	}
+
+	joinAddr, err := clusterJoinAddresses(options.ClusterDiscovery, clusterAddr, kubeClient)
+	if err != nil {
+		log.Fatal().Str("host", clusterAddr).Str("discovery", options.ClusterDiscovery).Err(err).
+			Msg("unable to retrieve the addresses of the agents to join")
+	}
+
+	err = clusterService.Create(advertiseAddr, joinAddr, options.ClusterProbeTimeout, options.ClusterProbeInterval)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to create cluster")
+	}
+
+	log.Debug().
+		Str("agent_port", options.AgentServerPort).
+		Str("cluster_address", clusterAddr).
+		Str("advertise_address", advertiseAddr).
+		Str("probe_timeout", options.ClusterProbeTimeout.String()).
+		Str("probe_interval", options.ClusterProbeInterval.String()).
+		Msg("")
+}
+
+// clusterJoinAddresses returns the addresses of the agents to join, a DNS lookup of clusterAddr is used
+// when no discovery mechanism is specified
+func clusterJoinAddresses(discovery, clusterAddr string, kubeClient *kubernetes.KubeClient) ([]string, error) {
+	switch discovery {
+	case agent.ClusterDiscoverySRV:
+		return net.LookupSRVAddresses(clusterAddr)
+	case agent.ClusterDiscoveryStatic:
+		return net.ParseStaticAddresses(clusterAddr)
+	case agent.ClusterDiscoveryKubernetes:
+		if kubeClient == nil {
+			return nil, errors.New("the kubernetes discovery is only available when the agent runs on Kubernetes")
+		}
+
+		return kubeClient.GetServiceEndpointAddresses(kubernetes.GetAgentNamespace(), clusterAddr)
+	default:
+		return net.LookupIPAddresses(clusterAddr)
+	}
+}
+
+func gossipKeys(options *agent.Options) [][]byte {
+	keys, err := cluster.GossipKeys(options.ClusterKeyFile, options.SharedSecret)
+	if err != nil {
+		log.Fatal().Err(err).Str("key_file", options.ClusterKeyFile).Msg("unable to read the agent cluster gossip keys")
+	}
+
+	return keys
+}
+
 func parseOptions() (*agent.Options, error) {
 	optionParser := os.NewEnvOptionParser()
 	return optionParser.Options()
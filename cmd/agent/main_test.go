@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClusterJoinAddresses(t *testing.T) {
+	addresses, err := clusterJoinAddresses(agent.ClusterDiscoveryStatic, "10.0.0.1:9001,10.0.0.2:9001", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:9001", "10.0.0.2:9001"}, addresses)
+
+	_, err = clusterJoinAddresses(agent.ClusterDiscoveryStatic, "", nil)
+	require.Error(t, err)
+
+	// The kubernetes discovery requires the agent to run on Kubernetes
+	_, err = clusterJoinAddresses(agent.ClusterDiscoveryKubernetes, "portainer-agent", nil)
+	require.Error(t, err)
+
+	// The IP addresses are looked up when no discovery is specified
+	addresses, err = clusterJoinAddresses("", "127.0.0.1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addresses)
+
+	addresses, err = clusterJoinAddresses(agent.ClusterDiscoveryDNS, "127.0.0.1", nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addresses)
+}
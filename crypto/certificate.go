@@ -0,0 +1,314 @@
+package crypto
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// expiryWarningThresholds are the durations before the expiry of a user supplied certificate at which a warning is
+// logged, in addition to the renewal threshold. Each warning is logged once.
+var expiryWarningThresholds = []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, 0}
+
+// CertificateManagerConfig is the configuration used to create a CertificateManager
+type CertificateManagerConfig struct {
+	// CertPath and KeyPath are the paths to a user supplied certificate chain and key,
+	// a self-signed certificate is generated when they are not specified
+	CertPath string
+	KeyPath  string
+	// ClientCAPath is the path to the CA certificates used to verify the client certificates,
+	// client certificates are not required when it is not specified
+	ClientCAPath string
+	// Host is the address used to generate the self-signed certificate
+	Host string
+	// RenewBefore is the duration before the expiry of the self-signed certificate after which it is renewed
+	RenewBefore time.Duration
+	// CheckInterval is the interval used to check if the certificates must be reloaded or renewed
+	CheckInterval time.Duration
+}
+
+// CertificateManager is a service used to manage the TLS certificate of the agent API.
+// It reloads the user supplied certificates when the files are modified and renews
+// the self-signed certificate before it expires.
+type CertificateManager struct {
+	config      CertificateManagerConfig
+	selfSigned  bool
+	tlsService  *TLSService
+	certificate *tls.Certificate
+	leaf        *x509.Certificate
+	clientCAs   *x509.CertPool
+	certMTime   time.Time
+	keyMTime    time.Time
+	caMTime     time.Time
+	mu          sync.RWMutex
+	// warnedExpiryThreshold is the last expiry threshold of the certificate for which a warning was logged
+	warnedExpiryThreshold time.Duration
+	expiryWarned          bool
+}
+
+// NewCertificateManager returns a pointer to a CertificateManager. The certificates are loaded
+// (or generated) immediately so that the configuration errors are detected at startup.
+func NewCertificateManager(config CertificateManagerConfig) (*CertificateManager, error) {
+	if (config.CertPath == "") != (config.KeyPath == "") {
+		return nil, errors.New("both the TLS certificate and key must be specified")
+	}
+
+	if config.RenewBefore <= 0 {
+		config.RenewBefore, _ = time.ParseDuration(agent.DefaultTLSRenewBefore)
+	}
+
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = agent.DefaultTLSCheckInterval
+	}
+
+	manager := &CertificateManager{
+		config:     config,
+		selfSigned: config.CertPath == "",
+		tlsService: &TLSService{},
+	}
+
+	if manager.selfSigned {
+		manager.config.CertPath = agent.TLSCertPath
+		manager.config.KeyPath = agent.TLSKeyPath
+
+		err := manager.tlsService.GenerateCertsForHost(config.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := manager.loadCertificate()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ClientCAPath != "" {
+		err := manager.loadClientCAs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return manager, nil
+}
+
+// TLSConfig returns the TLS configuration of the agent API server. The certificates
+// are resolved for each connection so that the reloaded certificates are used right away.
+func (manager *CertificateManager) TLSConfig() *tls.Config {
+	config := CreateTLSConfiguration()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		manager.mu.RLock()
+		defer manager.mu.RUnlock()
+
+		clientConfig := CreateTLSConfiguration()
+		clientConfig.Certificates = []tls.Certificate{*manager.certificate}
+
+		if manager.clientCAs != nil {
+			clientConfig.ClientCAs = manager.clientCAs
+			clientConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		return clientConfig, nil
+	}
+
+	return config
+}
+
+// Start checks periodically if the certificates must be reloaded or renewed until the context is done
+func (manager *CertificateManager) Start(ctx context.Context) {
+	ticker := time.NewTicker(manager.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			manager.checkCertificates()
+		}
+	}
+}
+
+// Certificate returns the certificate currently used by the agent API
+func (manager *CertificateManager) Certificate() *tls.Certificate {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+
+	return manager.certificate
+}
+
+func (manager *CertificateManager) checkCertificates() {
+	manager.mu.RLock()
+	expiresAt := manager.leaf.NotAfter
+	certificateModified := fileModified(manager.config.CertPath, manager.certMTime) || fileModified(manager.config.KeyPath, manager.keyMTime)
+	clientCAsModified := manager.config.ClientCAPath != "" && fileModified(manager.config.ClientCAPath, manager.caMTime)
+	manager.mu.RUnlock()
+
+	renew := time.Until(expiresAt) < manager.config.RenewBefore
+
+	switch {
+	case manager.selfSigned && renew:
+		log.Info().Time("expires_at", expiresAt).Msg("renewing the self-signed TLS certificate")
+
+		err := manager.tlsService.GenerateCertsForHost(manager.config.Host)
+		if err != nil {
+			log.Error().Err(err).Msg("unable to renew the self-signed TLS certificate")
+			break
+		}
+
+		certificateModified = true
+	case renew && manager.shouldWarnExpiry(time.Until(expiresAt)):
+		log.Warn().
+			Str("cert_path", manager.config.CertPath).
+			Time("expires_at", expiresAt).
+			Msg("the TLS certificate of the agent API is about to expire")
+	}
+
+	if certificateModified {
+		err := manager.loadCertificate()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to reload the TLS certificate, keeping the current one")
+		} else {
+			log.Info().Str("cert_path", manager.config.CertPath).Msg("TLS certificate reloaded")
+		}
+	}
+
+	if clientCAsModified {
+		err := manager.loadClientCAs()
+		if err != nil {
+			log.Error().Err(err).Msg("unable to reload the TLS client CA certificates, keeping the current ones")
+		} else {
+			log.Info().Str("client_ca_path", manager.config.ClientCAPath).Msg("TLS client CA certificates reloaded")
+		}
+	}
+}
+
+// shouldWarnExpiry returns true the first time the remaining validity of the certificate crosses an expiry threshold
+func (manager *CertificateManager) shouldWarnExpiry(remaining time.Duration) bool {
+	crossed := false
+	threshold := manager.config.RenewBefore
+
+	for _, t := range append([]time.Duration{manager.config.RenewBefore}, expiryWarningThresholds...) {
+		if t <= manager.config.RenewBefore && remaining < t {
+			crossed = true
+			threshold = min(threshold, t)
+		}
+	}
+
+	if !crossed || (manager.expiryWarned && threshold >= manager.warnedExpiryThreshold) {
+		return false
+	}
+
+	manager.expiryWarned = true
+	manager.warnedExpiryThreshold = threshold
+
+	return true
+}
+
+func (manager *CertificateManager) loadCertificate() error {
+	certStat, err := os.Stat(manager.config.CertPath)
+	if err != nil {
+		return err
+	}
+
+	keyStat, err := os.Stat(manager.config.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(manager.config.CertPath, manager.config.KeyPath)
+	if err != nil {
+		return err
+	}
+
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	// The certificate is presented as a client certificate to the other agents of the cluster
+	if manager.config.ClientCAPath != "" && !allowsClientAuth(leaf) {
+		return errors.New("the TLS certificate must allow client authentication (ClientAuth extended key usage) when client certificates are required")
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.certificate = &certificate
+	manager.leaf = leaf
+	manager.certMTime = certStat.ModTime()
+	manager.keyMTime = keyStat.ModTime()
+	manager.expiryWarned = false
+
+	return nil
+}
+
+func (manager *CertificateManager) loadClientCAs() error {
+	caStat, err := os.Stat(manager.config.ClientCAPath)
+	if err != nil {
+		return err
+	}
+
+	caCert, err := os.ReadFile(manager.config.ClientCAPath)
+	if err != nil {
+		return err
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caCert) {
+		return errors.New("no valid certificate found in the TLS client CA file")
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.clientCAs = clientCAs
+	manager.caMTime = caStat.ModTime()
+
+	return nil
+}
+
+// CreateAgentClientTLSConfiguration creates the TLS configuration used by the agent to send requests
+// to the other agents of the cluster. The certificate of certificateManager is presented when the other agents
+// require a client certificate, it must be issued by their client CA in that case. No certificate is presented
+// when certificateManager is nil.
+func CreateAgentClientTLSConfiguration(certificateManager *CertificateManager) *tls.Config {
+	config := CreateTLSConfiguration()
+	config.InsecureSkipVerify = true
+
+	if certificateManager != nil {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certificateManager.Certificate(), nil
+		}
+	}
+
+	return config
+}
+
+func allowsClientAuth(certificate *x509.Certificate) bool {
+	if len(certificate.ExtKeyUsage) == 0 {
+		return true
+	}
+
+	for _, usage := range certificate.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageClientAuth || usage == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fileModified(filename string, mtime time.Time) bool {
+	stat, err := os.Stat(filename)
+
+	return err == nil && stat.ModTime() != mtime
+}
@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestCertificate(t *testing.T, certPath, keyPath string, serialNumber int64) {
+	writeTestCertificateWithUsage(t, certPath, keyPath, serialNumber, x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth)
+}
+
+func writeTestCertificateWithUsage(t *testing.T, certPath, keyPath string, serialNumber int64, extKeyUsage ...x509.ExtKeyUsage) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		ExtKeyUsage:  extKeyUsage,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+func TestCertificateManagerReloadsModifiedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	writeTestCertificate(t, certPath, keyPath, 1)
+
+	manager, err := NewCertificateManager(CertificateManagerConfig{CertPath: certPath, KeyPath: keyPath})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), manager.leaf.SerialNumber.Int64())
+
+	writeTestCertificate(t, certPath, keyPath, 2)
+
+	// Make sure the modification is detected regardless of the file system timestamp resolution
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyPath, modTime, modTime))
+
+	manager.checkCertificates()
+	require.Equal(t, int64(2), manager.leaf.SerialNumber.Int64())
+
+	// An invalid certificate is ignored and the current one is kept
+	require.NoError(t, os.WriteFile(certPath, []byte("invalid"), 0600))
+	modTime = modTime.Add(time.Minute)
+	require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+
+	manager.checkCertificates()
+	require.Equal(t, int64(2), manager.leaf.SerialNumber.Int64())
+}
+
+func TestAgentClientTLSConfigurationPresentsManagerCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	writeTestCertificate(t, certPath, keyPath, 1)
+
+	manager, err := NewCertificateManager(CertificateManagerConfig{CertPath: certPath, KeyPath: keyPath})
+	require.NoError(t, err)
+
+	config := CreateAgentClientTLSConfiguration(manager)
+	require.NotNil(t, config.GetClientCertificate)
+
+	certificate, err := config.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, manager.Certificate(), certificate)
+
+	// Creating another manager does not change the certificate presented by the existing configurations
+	otherDir := t.TempDir()
+	writeTestCertificate(t, filepath.Join(otherDir, "cert.pem"), filepath.Join(otherDir, "key.pem"), 2)
+
+	_, err = NewCertificateManager(CertificateManagerConfig{CertPath: filepath.Join(otherDir, "cert.pem"), KeyPath: filepath.Join(otherDir, "key.pem")})
+	require.NoError(t, err)
+
+	certificate, err = config.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, manager.Certificate(), certificate)
+
+	// No certificate is presented without a manager
+	require.Nil(t, CreateAgentClientTLSConfiguration(nil).GetClientCertificate)
+}
+
+func TestCertificateManagerRequiresCertificateAndKey(t *testing.T) {
+	_, err := NewCertificateManager(CertificateManagerConfig{CertPath: "cert.pem"})
+	require.Error(t, err)
+}
+
+func TestCertificateManagerRequiresClientAuthUsage(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	writeTestCertificateWithUsage(t, certPath, keyPath, 1, x509.ExtKeyUsageServerAuth)
+
+	writeTestCertificate(t, filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"), 2)
+
+	// The certificate is only presented to the other agents when they require a client certificate
+	_, err := NewCertificateManager(CertificateManagerConfig{CertPath: certPath, KeyPath: keyPath})
+	require.NoError(t, err)
+
+	_, err = NewCertificateManager(CertificateManagerConfig{CertPath: certPath, KeyPath: keyPath, ClientCAPath: filepath.Join(dir, "ca.pem")})
+	require.Error(t, err)
+}
+
+func TestCertificateManagerWarnsOncePerExpiryThreshold(t *testing.T) {
+	manager := &CertificateManager{config: CertificateManagerConfig{RenewBefore: 30 * 24 * time.Hour}}
+
+	day := 24 * time.Hour
+
+	require.False(t, manager.shouldWarnExpiry(40*day))
+	require.True(t, manager.shouldWarnExpiry(20*day))
+	require.False(t, manager.shouldWarnExpiry(20*day-time.Minute))
+	require.True(t, manager.shouldWarnExpiry(6*day))
+	require.False(t, manager.shouldWarnExpiry(5*day))
+	require.True(t, manager.shouldWarnExpiry(time.Hour))
+	require.False(t, manager.shouldWarnExpiry(time.Minute))
+	require.True(t, manager.shouldWarnExpiry(-time.Minute))
+	require.False(t, manager.shouldWarnExpiry(-time.Hour))
+}
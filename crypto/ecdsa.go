@@ -3,29 +3,56 @@ package crypto
 import (
 	"crypto/ecdsa"
 	"crypto/md5"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"math/big"
+	"path"
 	"sync"
+	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
+
+	"github.com/rs/zerolog/log"
 )
 
 // ECDSAService is a service used to validate a digital signature.
 // An optional secret can be associated to this service
 type ECDSAService struct {
+	trustedKeys []*trustedKey
+	secret      string
+	dataPath    string
+	mu          sync.Mutex
+}
+
+type trustedKey struct {
+	agent.TrustedKey
 	publicKey *ecdsa.PublicKey
-	secret    string
-	mu        sync.Mutex
 }
 
 // NewECDSAService returns a pointer to a ECDSAService.
-// An optional secret can be specified
-func NewECDSAService(secret string) *ECDSAService {
-	return &ECDSAService{
-		secret: secret,
+// An optional secret can be specified. The public keys previously trusted by the agent
+// are loaded from the specified data folder.
+func NewECDSAService(secret, dataPath string) (*ECDSAService, error) {
+	service := &ECDSAService{
+		secret:   secret,
+		dataPath: dataPath,
+	}
+
+	if secret != "" || dataPath == "" {
+		return service, nil
+	}
+
+	err := service.loadTrustedKeys()
+	if err != nil {
+		return nil, err
 	}
+
+	return service, nil
 }
 
 // IsAssociated tells if the service is associated with a public key
@@ -34,14 +61,14 @@ func (service *ECDSAService) IsAssociated() bool {
 	service.mu.Lock()
 	defer service.mu.Unlock()
 
-	return service.publicKey != nil || service.secret != ""
+	return len(service.activeKeys()) > 0 || service.secret != ""
 }
 
 // VerifySignature is used to verify a digital signature using a specified public
 // key. The public key specified as a parameter must be hexadecimal encoded.
 // The public key will be decoded and parsed as DER data. If the service is not
-// using a secret, the public key will be associated to the service so that
-// only signatures associated to this key will be considered valid.
+// using a secret and not associated yet, the public key will be associated to the
+// service so that only signatures associated to the trusted keys will be considered valid.
 // When a secret is associated to the service, the specified key will be
 // decoded and parsed each time.
 // NOTE: this could have an impact on performance.
@@ -54,17 +81,260 @@ func (service *ECDSAService) VerifySignature(signature, key string) (bool, error
 		return false, err
 	}
 
-	return service.decodeAndVerifySignature(signature, publicKey)
+	if publicKey == nil {
+		return false, nil
+	}
+
+	digest := md5.New()
+	digest.Write([]byte(service.signedMessage()))
+
+	return decodeAndVerifySignature(signature, digest.Sum(nil), publicKey)
+}
+
+// VerifyRequestSignature is used to verify a digital signature created with the replay protected
+// signature scheme. The signed content is the SHA-256 hash of the message used by VerifySignature
+// followed by a pipe and the request digest. The public key is handled the same way as in VerifySignature.
+func (service *ECDSAService) VerifyRequestSignature(signature, key, requestDigest string) (bool, error) {
+	publicKey, err := service.decodeAndParsePublicKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if publicKey == nil {
+		return false, nil
+	}
+
+	hash := sha256.Sum256([]byte(service.signedMessage() + "|" + requestDigest))
+
+	return decodeAndVerifySignature(signature, hash[:], publicKey)
+}
+
+// VerifyContentSignature is used to verify that content was signed by the specified public key, the
+// signature is the base64 encoded ECDSA signature of the SHA-256 hash of content. The public key is
+// handled the same way as in VerifySignature.
+func (service *ECDSAService) VerifyContentSignature(signature, key, content string) (bool, error) {
+	publicKey, err := service.decodeAndParsePublicKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if publicKey == nil {
+		return false, nil
+	}
+
+	hash := sha256.Sum256([]byte(content))
+
+	return decodeAndVerifySignature(signature, hash[:], publicKey)
+}
+
+// RotateKey adds newKey to the set of trusted keys. The new key must be signed by currentKey,
+// which must be trusted by the agent: the signature is the base64 encoded ECDSA signature of the
+// SHA-256 hash of the hexadecimal encoded new key. currentKey will stop being trusted once the
+// grace period is over, a zero grace period revokes it immediately.
+func (service *ECDSAService) RotateKey(currentKey, newKey, newKeySignature string, gracePeriod time.Duration) error {
+	if service.secret != "" {
+		return errors.New("key rotation is not available when the agent is secured by a shared secret")
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	current := service.findActiveKey(currentKey)
+	if current == nil {
+		return errors.New("the current key is not trusted by the agent")
+	}
+
+	newPublicKey, err := parsePublicKey(newKey)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256([]byte(newKey))
+
+	valid, err := decodeAndVerifySignature(newKeySignature, hash[:], current.publicKey)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid new key signature")
+	}
+
+	// A key rotated out during its grace period is trusted again without expiration
+	if trusted := service.findActiveKey(newKey); trusted == nil {
+		service.trustedKeys = append(service.trustedKeys, newTrustedKey(newKey, newPublicKey))
+	} else {
+		trusted.ExpiresAt = 0
+	}
+
+	if currentKey != newKey {
+		current.ExpiresAt = time.Now().Add(gracePeriod).Unix()
+	}
+
+	log.Info().
+		Str("new_key_fingerprint", fingerprint(newKey)).
+		Str("rotated_key_fingerprint", current.Fingerprint).
+		Dur("grace_period", gracePeriod).
+		Msg("public key rotated")
+
+	return service.persistTrustedKeys()
+}
+
+// TrustedKeys returns the public keys currently trusted by the agent
+func (service *ECDSAService) TrustedKeys() []agent.TrustedKey {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	keys := make([]agent.TrustedKey, 0, len(service.trustedKeys))
+	for _, key := range service.activeKeys() {
+		keys = append(keys, key.TrustedKey)
+	}
+
+	return keys
 }
 
 func (service *ECDSAService) decodeAndParsePublicKey(key string) (*ecdsa.PublicKey, error) {
+	if service.secret != "" {
+		return parsePublicKey(key)
+	}
+
 	service.mu.Lock()
 	defer service.mu.Unlock()
 
-	if service.publicKey != nil {
-		return service.publicKey, nil
+	if len(service.activeKeys()) > 0 {
+		trusted := service.findActiveKey(key)
+		if trusted == nil {
+			return nil, nil
+		}
+
+		return trusted.publicKey, nil
+	}
+
+	publicKey, err := parsePublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	service.trustedKeys = []*trustedKey{newTrustedKey(key, publicKey)}
+
+	log.Info().Str("fingerprint", fingerprint(key)).Msg("agent associated with a public key")
+
+	err = service.persistTrustedKeys()
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to persist the trusted public keys")
 	}
 
+	return publicKey, nil
+}
+
+// activeKeys removes the expired keys from the trusted keys and returns the remaining ones.
+// It must be called while holding the lock.
+func (service *ECDSAService) activeKeys() []*trustedKey {
+	now := time.Now().Unix()
+
+	active := service.trustedKeys[:0]
+	for _, key := range service.trustedKeys {
+		if key.ExpiresAt != 0 && key.ExpiresAt <= now {
+			log.Info().Str("fingerprint", key.Fingerprint).Msg("trusted public key expired")
+			continue
+		}
+
+		active = append(active, key)
+	}
+
+	if len(active) != len(service.trustedKeys) {
+		service.trustedKeys = active
+
+		err := service.persistTrustedKeys()
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to persist the trusted public keys")
+		}
+	}
+
+	return service.trustedKeys
+}
+
+// findActiveKey must be called while holding the lock.
+func (service *ECDSAService) findActiveKey(key string) *trustedKey {
+	for _, trusted := range service.activeKeys() {
+		if trusted.PublicKey == key {
+			return trusted
+		}
+	}
+
+	return nil
+}
+
+func (service *ECDSAService) loadTrustedKeys() error {
+	keysFilePath := path.Join(service.dataPath, agent.TrustedKeysFile)
+
+	exists, err := filesystem.FileExists(keysFilePath)
+	if err != nil || !exists {
+		return err
+	}
+
+	data, err := filesystem.ReadFromFile(keysFilePath)
+	if err != nil {
+		return err
+	}
+
+	var keys []agent.TrustedKey
+	err = json.Unmarshal(data, &keys)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		publicKey, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+
+		service.trustedKeys = append(service.trustedKeys, &trustedKey{TrustedKey: key, publicKey: publicKey})
+	}
+
+	log.Info().Int("keys", len(service.trustedKeys)).Msg("trusted public keys loaded from the filesystem")
+
+	return nil
+}
+
+// persistTrustedKeys must be called while holding the lock.
+func (service *ECDSAService) persistTrustedKeys() error {
+	if service.dataPath == "" {
+		return nil
+	}
+
+	keys := make([]agent.TrustedKey, 0, len(service.trustedKeys))
+	for _, key := range service.trustedKeys {
+		keys = append(keys, key.TrustedKey)
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	return filesystem.WriteFile(service.dataPath, agent.TrustedKeysFile, data, 0600)
+}
+
+func (service *ECDSAService) signedMessage() string {
+	if service.secret != "" {
+		return service.secret
+	}
+
+	return agent.PortainerAgentSignatureMessage
+}
+
+func newTrustedKey(key string, publicKey *ecdsa.PublicKey) *trustedKey {
+	return &trustedKey{
+		TrustedKey: agent.TrustedKey{
+			PublicKey:    key,
+			Fingerprint:  fingerprint(key),
+			AssociatedAt: time.Now().Unix(),
+		},
+		publicKey: publicKey,
+	}
+}
+
+func parsePublicKey(key string) (*ecdsa.PublicKey, error) {
 	decodedKey, err := hex.DecodeString(key)
 	if err != nil {
 		return nil, err
@@ -75,14 +345,26 @@ func (service *ECDSAService) decodeAndParsePublicKey(key string) (*ecdsa.PublicK
 		return nil, err
 	}
 
-	if service.secret == "" {
-		service.publicKey = publicKey.(*ecdsa.PublicKey)
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an ECDSA key")
 	}
 
-	return publicKey.(*ecdsa.PublicKey), nil
+	return ecdsaPublicKey, nil
 }
 
-func (service *ECDSAService) decodeAndVerifySignature(signature string, publicKey *ecdsa.PublicKey) (bool, error) {
+func fingerprint(key string) string {
+	decodedKey, err := hex.DecodeString(key)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(decodedKey)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func decodeAndVerifySignature(signature string, hash []byte, publicKey *ecdsa.PublicKey) (bool, error) {
 	decodedSignature, err := base64.RawStdEncoding.DecodeString(signature)
 	if err != nil {
 		return false, err
@@ -97,15 +379,6 @@ func (service *ECDSAService) decodeAndVerifySignature(signature string, publicKe
 	r := big.NewInt(0).SetBytes(decodedSignature[:keySize])
 	s := big.NewInt(0).SetBytes(decodedSignature[keySize:])
 
-	validSignature := agent.PortainerAgentSignatureMessage
-	if service.secret != "" {
-		validSignature = service.secret
-	}
-
-	digest := md5.New()
-	digest.Write([]byte(validSignature))
-	hash := digest.Sum(nil)
-
 	valid := ecdsa.Verify(publicKey, hash, r, s)
 
 	return valid, nil
@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/stretchr/testify/require"
+)
+
+type testKey struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  string
+}
+
+func newTestKey(t *testing.T) *testKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	return &testKey{privateKey: privateKey, publicKey: hex.EncodeToString(der)}
+}
+
+func (key *testKey) sign(t *testing.T, hash []byte) string {
+	r, s, err := ecdsa.Sign(rand.Reader, key.privateKey, hash)
+	require.NoError(t, err)
+
+	keySize := key.privateKey.Params().BitSize / 8
+	signature := make([]byte, 2*keySize)
+	r.FillBytes(signature[:keySize])
+	s.FillBytes(signature[keySize:])
+
+	return base64.RawStdEncoding.EncodeToString(signature)
+}
+
+func (key *testKey) signMessage(t *testing.T) string {
+	hash := md5.Sum([]byte(agent.PortainerAgentSignatureMessage))
+
+	return key.sign(t, hash[:])
+}
+
+func (key *testKey) signKey(t *testing.T, newKey string) string {
+	hash := sha256.Sum256([]byte(newKey))
+
+	return key.sign(t, hash[:])
+}
+
+func TestVerifySignatureAssociatesFirstKey(t *testing.T) {
+	service, err := NewECDSAService("", t.TempDir())
+	require.NoError(t, err)
+	require.False(t, service.IsAssociated())
+
+	first, second := newTestKey(t), newTestKey(t)
+
+	valid, err := service.VerifySignature(first.signMessage(t), first.publicKey)
+	require.NoError(t, err)
+	require.True(t, valid)
+	require.True(t, service.IsAssociated())
+
+	valid, err = service.VerifySignature(second.signMessage(t), second.publicKey)
+	require.NoError(t, err)
+	require.False(t, valid)
+}
+
+func TestRotateKey(t *testing.T) {
+	dataPath := t.TempDir()
+
+	service, err := NewECDSAService("", dataPath)
+	require.NoError(t, err)
+
+	current, next, other := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	_, err = service.VerifySignature(current.signMessage(t), current.publicKey)
+	require.NoError(t, err)
+
+	// The new key must be signed by the current key
+	err = service.RotateKey(current.publicKey, next.publicKey, other.signKey(t, next.publicKey), time.Hour)
+	require.Error(t, err)
+
+	// The current key must be trusted
+	err = service.RotateKey(other.publicKey, next.publicKey, other.signKey(t, next.publicKey), time.Hour)
+	require.Error(t, err)
+
+	err = service.RotateKey(current.publicKey, next.publicKey, current.signKey(t, next.publicKey), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, service.TrustedKeys(), 2)
+
+	for _, key := range []*testKey{current, next} {
+		valid, err := service.VerifySignature(key.signMessage(t), key.publicKey)
+		require.NoError(t, err)
+		require.True(t, valid)
+	}
+
+	// The trusted keys are persisted across restarts
+	reloaded, err := NewECDSAService("", dataPath)
+	require.NoError(t, err)
+	require.ElementsMatch(t, service.TrustedKeys(), reloaded.TrustedKeys())
+}
+
+func TestRotateKeyWithoutGracePeriod(t *testing.T) {
+	service, err := NewECDSAService("", t.TempDir())
+	require.NoError(t, err)
+
+	current, next := newTestKey(t), newTestKey(t)
+
+	_, err = service.VerifySignature(current.signMessage(t), current.publicKey)
+	require.NoError(t, err)
+
+	err = service.RotateKey(current.publicKey, next.publicKey, current.signKey(t, next.publicKey), 0)
+	require.NoError(t, err)
+
+	trustedKeys := service.TrustedKeys()
+	require.Len(t, trustedKeys, 1)
+	require.Equal(t, next.publicKey, trustedKeys[0].PublicKey)
+
+	valid, err := service.VerifySignature(current.signMessage(t), current.publicKey)
+	require.NoError(t, err)
+	require.False(t, valid)
+}
+
+func TestRotateKeyBackDuringGracePeriod(t *testing.T) {
+	service, err := NewECDSAService("", t.TempDir())
+	require.NoError(t, err)
+
+	first, second := newTestKey(t), newTestKey(t)
+
+	_, err = service.VerifySignature(first.signMessage(t), first.publicKey)
+	require.NoError(t, err)
+
+	err = service.RotateKey(first.publicKey, second.publicKey, first.signKey(t, second.publicKey), time.Hour)
+	require.NoError(t, err)
+
+	err = service.RotateKey(second.publicKey, first.publicKey, second.signKey(t, first.publicKey), time.Hour)
+	require.NoError(t, err)
+
+	// Only the key rotated out last expires, the agent stays associated with the first key
+	expiresAt := map[string]int64{}
+	for _, key := range service.TrustedKeys() {
+		expiresAt[key.PublicKey] = key.ExpiresAt
+	}
+
+	require.Len(t, expiresAt, 2)
+	require.Zero(t, expiresAt[first.publicKey])
+	require.NotZero(t, expiresAt[second.publicKey])
+}
+
+func TestRotateKeyWithSecret(t *testing.T) {
+	service, err := NewECDSAService("secret", t.TempDir())
+	require.NoError(t, err)
+
+	current, next := newTestKey(t), newTestKey(t)
+
+	err = service.RotateKey(current.publicKey, next.publicKey, current.signKey(t, next.publicKey), 0)
+	require.Error(t, err)
+}
+
+func TestVerifyContentSignature(t *testing.T) {
+	service, err := NewECDSAService("", t.TempDir())
+	require.NoError(t, err)
+
+	trusted, other := newTestKey(t), newTestKey(t)
+
+	_, err = service.VerifySignature(trusted.signMessage(t), trusted.publicKey)
+	require.NoError(t, err)
+
+	valid, err := service.VerifyContentSignature(trusted.signKey(t, "content"), trusted.publicKey, "content")
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	valid, err = service.VerifyContentSignature(trusted.signKey(t, "content"), trusted.publicKey, "other content")
+	require.NoError(t, err)
+	require.False(t, valid)
+
+	// Only the trusted keys can sign a content
+	valid, err = service.VerifyContentSignature(other.signKey(t, "content"), other.publicKey, "content")
+	require.NoError(t, err)
+	require.False(t, valid)
+}
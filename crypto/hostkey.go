@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
+
+	"github.com/rs/zerolog/log"
+)
+
+const hostKeySaltSize = 32
+
+// sealedDataPrefix identifies the data encrypted with a host key
+var sealedDataPrefix = []byte("PTSEALED1:")
+
+// machineIDPaths are the files read to identify the host, the files of the host filesystem are preferred
+// to the files of the agent container
+var machineIDPaths = []string{
+	agent.HostRoot + "/etc/machine-id",
+	agent.HostRoot + "/var/lib/dbus/machine-id",
+	"/etc/machine-id",
+	"/var/lib/dbus/machine-id",
+}
+
+// HostKey returns the key used to encrypt the secrets persisted by the agent in dataPath. The key is derived
+// from the machine identifier of the host and from a random salt persisted in dataPath, the secrets cannot be
+// decrypted once the data folder is copied to another host.
+func HostKey(dataPath string) ([]byte, error) {
+	salt, err := hostKeySalt(dataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	machineID := readMachineID()
+	if machineID == "" {
+		log.Warn().Msg("unable to find the machine identifier of the host, the secrets of the agent are only bound to its data folder")
+	}
+
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(machineID))
+
+	return mac.Sum(nil), nil
+}
+
+// Seal encrypts data with the specified key using AES-GCM
+func Seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append([]byte{}, sealedDataPrefix...)
+	sealed = append(sealed, nonce...)
+
+	return gcm.Seal(sealed, nonce, data, nil), nil
+}
+
+// Open decrypts data encrypted by Seal with the same key
+func Open(key, sealed []byte) ([]byte, error) {
+	if !IsSealed(sealed) {
+		return nil, errors.New("the data is not encrypted")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[len(sealedDataPrefix):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted data")
+	}
+
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("unable to decrypt the data, it was encrypted on another host or is corrupted")
+	}
+
+	return data, nil
+}
+
+// IsSealed returns true when data was encrypted by Seal
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, sealedDataPrefix)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// hostKeySalt returns the salt persisted in dataPath, the salt is created the first time it is required
+func hostKeySalt(dataPath string) ([]byte, error) {
+	salt, err := os.ReadFile(path.Join(dataPath, agent.HostKeySaltFile))
+	if err == nil && len(salt) == hostKeySaltSize {
+		return salt, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		return nil, errors.New("invalid host key salt")
+	}
+
+	salt = make([]byte, hostKeySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	if err := filesystem.WriteFile(dataPath, agent.HostKeySaltFile, salt, 0600); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+func readMachineID() string {
+	for _, machineIDPath := range machineIDPaths {
+		machineID, err := os.ReadFile(machineIDPath)
+		if err != nil {
+			continue
+		}
+
+		if id := strings.TrimSpace(string(machineID)); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setTestMachineID(t *testing.T, machineID string) {
+	machineIDPath := path.Join(t.TempDir(), "machine-id")
+	require.NoError(t, os.WriteFile(machineIDPath, []byte(machineID+"\n"), 0644))
+
+	previousPaths := machineIDPaths
+	machineIDPaths = []string{machineIDPath}
+	t.Cleanup(func() { machineIDPaths = previousPaths })
+}
+
+func TestSealAndOpen(t *testing.T) {
+	setTestMachineID(t, "host1")
+	dataPath := t.TempDir()
+
+	key, err := HostKey(dataPath)
+	require.NoError(t, err)
+
+	sealed, err := Seal(key, []byte("secret"))
+	require.NoError(t, err)
+	require.True(t, IsSealed(sealed))
+	require.NotContains(t, string(sealed), "secret")
+
+	info, err := os.Stat(path.Join(dataPath, agent.HostKeySaltFile))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The key is stable for the same host and data folder
+	sameKey, err := HostKey(dataPath)
+	require.NoError(t, err)
+
+	data, err := Open(sameKey, sealed)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(data))
+
+	_, err = Open(key, []byte("secret"))
+	require.Error(t, err)
+}
+
+func TestOpenOnAnotherHost(t *testing.T) {
+	dataPath := t.TempDir()
+
+	setTestMachineID(t, "host1")
+	key, err := HostKey(dataPath)
+	require.NoError(t, err)
+
+	sealed, err := Seal(key, []byte("secret"))
+	require.NoError(t, err)
+
+	setTestMachineID(t, "host2")
+	otherKey, err := HostKey(dataPath)
+	require.NoError(t, err)
+
+	_, err = Open(otherKey, sealed)
+	require.Error(t, err)
+}
@@ -0,0 +1,668 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/filesystem"
+	"github.com/portainer/agent/identifier"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// BackupsDirectory is the folder inside the agent data folder where the backups are stored
+	BackupsDirectory = "backups"
+	// StorageLocal is used for the backups stored inside the agent data folder
+	StorageLocal = "local"
+	// StorageS3 is used for the backups sent to an S3-compatible storage
+	StorageS3 = "s3"
+)
+
+var (
+	// ErrBackupNotFound is returned when a backup does not exist
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrVolumeNotFound is returned when the volume to back up does not exist
+	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrVolumeNotEmpty is returned when a backup is restored into a volume that is not empty without overwriting it
+	ErrVolumeNotEmpty = errors.New("volume is not empty")
+	// ErrInvalidVolumeName is returned when a volume name is not a valid Docker volume name
+	ErrInvalidVolumeName = errors.New("invalid volume name")
+	// ErrS3NotConfigured is returned when a backup is sent to S3 while no S3 storage is configured
+	ErrS3NotConfigured = errors.New("S3 storage is not configured")
+	// ErrChecksumMismatch is returned when the content of a backup does not match its checksum
+	ErrChecksumMismatch = errors.New("backup checksum mismatch")
+
+	volumeNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// Backup represents a gzip compressed tar archive of the content of a volume
+type Backup struct {
+	ID         string `json:"ID"`
+	VolumeName string `json:"VolumeName"`
+	// Storage is either StorageLocal or StorageS3
+	Storage string `json:"Storage"`
+	// ObjectKey is the key of the archive inside the S3 bucket
+	ObjectKey string `json:"ObjectKey,omitempty"`
+	Size      int64  `json:"Size"`
+	// Checksum is the hex encoded SHA-256 checksum of the archive
+	Checksum string `json:"Checksum"`
+	// PausedContainers is the number of containers paused while the archive was created
+	PausedContainers int   `json:"PausedContainers"`
+	CreatedAt        int64 `json:"CreatedAt"`
+}
+
+// CreateOptions are the options used to create a backup
+type CreateOptions struct {
+	// PauseContainers pauses the running containers using the volume while the archive is created
+	// so that its content is consistent
+	PauseContainers bool
+	// Storage is either StorageLocal (default) or StorageS3
+	Storage string
+}
+
+// RestoreOptions are the options used to restore a backup
+type RestoreOptions struct {
+	// VolumeName is the volume where the backup is restored, the volume of the backup is used when empty.
+	// The volume is created when it does not exist.
+	VolumeName string
+	// Overwrite removes the existing content of the volume before the backup is restored
+	Overwrite bool
+	// PauseContainers pauses the running containers using the volume while the backup is restored
+	PauseContainers bool
+}
+
+// RetentionPolicy defines which backups of a volume are kept, older backups are removed after each new backup
+type RetentionPolicy struct {
+	// Count is the maximum number of backups kept for each volume, no limit when 0
+	Count int
+	// MaxAge is the duration after which a backup is removed, no limit when 0
+	MaxAge time.Duration
+}
+
+// Config is the configuration of the backup service
+type Config struct {
+	DataPath  string
+	Retention RetentionPolicy
+	// S3 is the S3-compatible storage where the backups can be sent, backups can only be stored locally when nil
+	S3 *S3Config
+}
+
+// volumeManager abstracts the operations of the container engine used by the backups
+type volumeManager interface {
+	// path returns the path to the content of a volume
+	path(volumeName string) (string, error)
+	exists(volumeName string) (bool, error)
+	create(volumeName string) error
+	runningContainers(volumeName string) ([]string, error)
+	pause(containerID string) error
+	unpause(containerID string) error
+}
+
+// Service is used to back up the Docker volumes and to restore their backups. The metadata of the backups
+// is stored inside the agent data folder, along with the archives when they are stored locally.
+type Service struct {
+	directory string
+	retention RetentionPolicy
+	s3        *s3Client
+	volumes   volumeManager
+	locks     map[string]*volumeLock
+	mu        sync.Mutex
+}
+
+// volumeLock serializes the backup operations on a volume, it is removed once no operation uses it
+type volumeLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewService returns a pointer to a Service
+func NewService(config Config) (*Service, error) {
+	service := &Service{
+		directory: filepath.Join(config.DataPath, BackupsDirectory),
+		retention: config.Retention,
+		volumes:   dockerVolumeManager{},
+		locks:     make(map[string]*volumeLock),
+	}
+
+	if config.S3 != nil {
+		client, err := newS3Client(*config.S3)
+		if err != nil {
+			return nil, err
+		}
+
+		service.s3 = client
+	}
+
+	return service, nil
+}
+
+// IsValidVolumeName returns true when name is a valid Docker volume name
+func IsValidVolumeName(name string) bool {
+	return volumeNameRegexp.MatchString(name)
+}
+
+// Create creates a backup of a volume, the retention policy is applied to the backups of the volume afterwards
+func (service *Service) Create(ctx context.Context, volumeName string, options CreateOptions) (*Backup, error) {
+	if !volumeNameRegexp.MatchString(volumeName) {
+		return nil, ErrInvalidVolumeName
+	}
+
+	if options.Storage == "" {
+		options.Storage = StorageLocal
+	}
+
+	switch options.Storage {
+	case StorageLocal:
+	case StorageS3:
+		if service.s3 == nil {
+			return nil, ErrS3NotConfigured
+		}
+	default:
+		return nil, fmt.Errorf("invalid backup storage %q", options.Storage)
+	}
+
+	unlock := service.lock(volumeName)
+	defer unlock()
+
+	exists, err := service.volumes.exists(volumeName)
+	if err != nil {
+		return nil, err
+	} else if !exists {
+		return nil, ErrVolumeNotFound
+	}
+
+	volumePath, err := service.volumes.path(volumeName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(service.directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := identifier.New()
+	if err != nil {
+		return nil, err
+	}
+
+	backup := &Backup{
+		ID:         id,
+		VolumeName: volumeName,
+		Storage:    options.Storage,
+		CreatedAt:  time.Now().Unix(),
+	}
+
+	partPath := service.archivePath(id) + ".part"
+	defer os.Remove(partPath)
+
+	backup.PausedContainers, backup.Size, backup.Checksum, err = service.writeArchive(volumeName, volumePath, partPath, options.PauseContainers)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Storage == StorageS3 {
+		backup.ObjectKey = service.s3.objectKey(volumeName + "/" + id + ".tar.gz")
+
+		err = service.s3.putObject(ctx, backup.ObjectKey, partPath, backup.Checksum)
+	} else {
+		err = os.Rename(partPath, service.archivePath(id))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.save(backup)
+	if err != nil {
+		service.removeArchive(ctx, backup)
+		return nil, err
+	}
+
+	service.applyRetention(ctx, volumeName)
+
+	return backup, nil
+}
+
+// writeArchive writes the archive of a volume to filePath and returns the number of paused containers,
+// the size of the archive and its checksum
+func (service *Service) writeArchive(volumeName, volumePath, filePath string, pauseContainers bool) (int, int64, string, error) {
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer file.Close()
+
+	paused, resume, err := service.pauseContainers(volumeName, pauseContainers)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	hash := sha256.New()
+	err = filesystem.WriteArchive(io.MultiWriter(file, hash), volumePath, filesystem.ArchiveFormatTarGz)
+
+	resume()
+
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	return paused, info.Size(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// List returns the backups of a volume, or all the backups when volumeName is empty, the most recent first
+func (service *Service) List(volumeName string) ([]Backup, error) {
+	metadataFiles, err := filepath.Glob(filepath.Join(service.directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Backup, 0)
+
+	for _, metadataFile := range metadataFiles {
+		backup, err := service.load(strings.TrimSuffix(filepath.Base(metadataFile), ".json"))
+		if err != nil {
+			log.Warn().Err(err).Str("file", metadataFile).Msg("unable to read backup metadata")
+			continue
+		}
+
+		if volumeName == "" || backup.VolumeName == volumeName {
+			backups = append(backups, *backup)
+		}
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt > backups[j].CreatedAt
+	})
+
+	return backups, nil
+}
+
+// Get returns a backup
+func (service *Service) Get(id string) (*Backup, error) {
+	return service.load(id)
+}
+
+// Open returns the archive of a backup, the caller must close it
+func (service *Service) Open(ctx context.Context, id string) (io.ReadCloser, *Backup, error) {
+	backup, err := service.load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	archive, err := service.openArchive(ctx, backup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return archive, backup, nil
+}
+
+// Delete removes a backup and its archive
+func (service *Service) Delete(ctx context.Context, id string) error {
+	backup, err := service.load(id)
+	if err != nil {
+		return err
+	}
+
+	unlock := service.lock(backup.VolumeName)
+	defer unlock()
+
+	// The lock is associated to the volume of the backup, the backup is loaded again once the lock is held as it
+	// may have been removed in the meantime, by the retention policy for instance
+	backup, err = service.load(id)
+	if err != nil {
+		return err
+	}
+
+	return service.remove(ctx, backup)
+}
+
+// Restore extracts a backup into a volume. The integrity of the archive is verified before the volume is modified.
+func (service *Service) Restore(ctx context.Context, id string, options RestoreOptions) error {
+	backup, err := service.load(id)
+	if err != nil {
+		return err
+	}
+
+	volumeName := options.VolumeName
+	if volumeName == "" {
+		volumeName = backup.VolumeName
+	}
+
+	if !volumeNameRegexp.MatchString(volumeName) {
+		return ErrInvalidVolumeName
+	}
+
+	unlock := service.lock(volumeName)
+	defer unlock()
+
+	archivePath, cleanup, err := service.verifiedArchive(ctx, backup)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	exists, err := service.volumes.exists(volumeName)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		err = service.volumes.create(volumeName)
+		if err != nil {
+			return fmt.Errorf("unable to create volume: %w", err)
+		}
+	}
+
+	volumePath, err := service.volumes.path(volumeName)
+	if err != nil {
+		return err
+	}
+
+	if exists && !options.Overwrite {
+		empty, err := isEmptyDirectory(volumePath)
+		if err != nil {
+			return err
+		} else if !empty {
+			return ErrVolumeNotEmpty
+		}
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	_, resume, err := service.pauseContainers(volumeName, options.PauseContainers)
+	if err != nil {
+		return err
+	}
+	defer resume()
+
+	if options.Overwrite {
+		err = clearDirectory(volumePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return filesystem.ExtractTarGzArchiveWithMetadata(archive, volumePath, 0)
+}
+
+// verifiedArchive returns the path of a local copy of the archive of a backup after verifying its checksum.
+// The archives stored on S3 are downloaded to a temporary file removed by the returned cleanup function.
+func (service *Service) verifiedArchive(ctx context.Context, backup *Backup) (string, func(), error) {
+	archivePath := service.archivePath(backup.ID)
+	cleanup := func() {}
+
+	if backup.Storage == StorageS3 {
+		archivePath += ".download"
+		cleanup = func() { os.Remove(archivePath) }
+
+		err := service.download(ctx, backup, archivePath)
+		if err != nil {
+			cleanup()
+			return "", nil, err
+		}
+	}
+
+	checksum, err := filesystem.FileChecksum(archivePath)
+	if os.IsNotExist(err) {
+		err = ErrBackupNotFound
+	}
+
+	if err == nil && !strings.EqualFold(checksum, backup.Checksum) {
+		err = ErrChecksumMismatch
+	}
+
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	return archivePath, cleanup, nil
+}
+
+func (service *Service) download(ctx context.Context, backup *Backup, filePath string) error {
+	archive, err := service.openArchive(ctx, backup)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, archive)
+
+	return err
+}
+
+func (service *Service) openArchive(ctx context.Context, backup *Backup) (io.ReadCloser, error) {
+	if backup.Storage != StorageS3 {
+		archive, err := os.Open(service.archivePath(backup.ID))
+		if os.IsNotExist(err) {
+			return nil, ErrBackupNotFound
+		}
+
+		return archive, err
+	}
+
+	if service.s3 == nil {
+		return nil, ErrS3NotConfigured
+	}
+
+	return service.s3.getObject(ctx, backup.ObjectKey)
+}
+
+// pauseContainers pauses the running containers using a volume when enabled. It returns the number of paused
+// containers and the function used to resume them.
+func (service *Service) pauseContainers(volumeName string, enabled bool) (int, func(), error) {
+	if !enabled {
+		return 0, func() {}, nil
+	}
+
+	containerIDs, err := service.volumes.runningContainers(volumeName)
+	if err != nil {
+		return 0, nil, fmt.Errorf("unable to list the containers using the volume: %w", err)
+	}
+
+	paused := make([]string, 0, len(containerIDs))
+
+	resume := func() {
+		for _, containerID := range paused {
+			err := service.volumes.unpause(containerID)
+			if err != nil {
+				log.Error().Err(err).Str("container_id", containerID).Str("volume", volumeName).Msg("unable to unpause container")
+			}
+		}
+	}
+
+	for _, containerID := range containerIDs {
+		err := service.volumes.pause(containerID)
+		if err != nil {
+			resume()
+			return 0, nil, fmt.Errorf("unable to pause container %s: %w", containerID, err)
+		}
+
+		paused = append(paused, containerID)
+	}
+
+	return len(paused), resume, nil
+}
+
+// applyRetention removes the backups of a volume that are not kept by the retention policy
+func (service *Service) applyRetention(ctx context.Context, volumeName string) {
+	if service.retention.Count <= 0 && service.retention.MaxAge <= 0 {
+		return
+	}
+
+	backups, err := service.List(volumeName)
+	if err != nil {
+		log.Warn().Err(err).Str("volume", volumeName).Msg("unable to apply the backup retention policy")
+		return
+	}
+
+	for i, backup := range backups {
+		expired := service.retention.MaxAge > 0 && time.Since(time.Unix(backup.CreatedAt, 0)) > service.retention.MaxAge
+		if !expired && (service.retention.Count <= 0 || i < service.retention.Count) {
+			continue
+		}
+
+		log.Info().Str("backup_id", backup.ID).Str("volume", volumeName).Msg("removing backup according to the retention policy")
+
+		err := service.remove(ctx, &backup)
+		if err != nil {
+			log.Warn().Err(err).Str("backup_id", backup.ID).Msg("unable to remove backup")
+		}
+	}
+}
+
+func (service *Service) remove(ctx context.Context, backup *Backup) error {
+	err := service.removeArchive(ctx, backup)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(service.metadataPath(backup.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (service *Service) removeArchive(ctx context.Context, backup *Backup) error {
+	if backup.Storage == StorageS3 {
+		if service.s3 == nil {
+			return ErrS3NotConfigured
+		}
+
+		return service.s3.deleteObject(ctx, backup.ObjectKey)
+	}
+
+	err := os.Remove(service.archivePath(backup.ID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (service *Service) save(backup *Backup) error {
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(service.metadataPath(backup.ID), data, 0600)
+}
+
+func (service *Service) load(id string) (*Backup, error) {
+	if !identifier.IsValid(id) {
+		return nil, ErrBackupNotFound
+	}
+
+	data, err := os.ReadFile(service.metadataPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrBackupNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var backup Backup
+	err = json.Unmarshal(data, &backup)
+	if err != nil {
+		return nil, err
+	}
+
+	return &backup, nil
+}
+
+// lock serializes the backup operations on a volume, it returns the function used to release the lock
+func (service *Service) lock(volumeName string) func() {
+	service.mu.Lock()
+	lock, ok := service.locks[volumeName]
+	if !ok {
+		lock = &volumeLock{}
+		service.locks[volumeName] = lock
+	}
+	lock.refs++
+	service.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		service.mu.Lock()
+		defer service.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(service.locks, volumeName)
+		}
+	}
+}
+
+func (service *Service) metadataPath(id string) string {
+	return filepath.Join(service.directory, id+".json")
+}
+
+func (service *Service) archivePath(id string) string {
+	return filepath.Join(service.directory, id+".tar.gz")
+}
+
+func isEmptyDirectory(directoryPath string) (bool, error) {
+	entries, err := os.ReadDir(directoryPath)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+
+	return len(entries) == 0, err
+}
+
+// clearDirectory removes the content of a directory but not the directory itself
+func clearDirectory(directoryPath string) error {
+	entries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(directoryPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
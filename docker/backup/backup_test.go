@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeVolumeManager struct {
+	root       string
+	containers []string
+	paused     map[string]bool
+}
+
+func newFakeVolumeManager(t *testing.T) *fakeVolumeManager {
+	return &fakeVolumeManager{root: t.TempDir(), paused: make(map[string]bool)}
+}
+
+func (manager *fakeVolumeManager) path(volumeName string) (string, error) {
+	return filepath.Join(manager.root, volumeName), nil
+}
+
+func (manager *fakeVolumeManager) exists(volumeName string) (bool, error) {
+	_, err := os.Stat(filepath.Join(manager.root, volumeName))
+
+	return err == nil, nil
+}
+
+func (manager *fakeVolumeManager) create(volumeName string) error {
+	return os.Mkdir(filepath.Join(manager.root, volumeName), 0755)
+}
+
+func (manager *fakeVolumeManager) runningContainers(volumeName string) ([]string, error) {
+	return manager.containers, nil
+}
+
+func (manager *fakeVolumeManager) pause(containerID string) error {
+	manager.paused[containerID] = true
+
+	return nil
+}
+
+func (manager *fakeVolumeManager) unpause(containerID string) error {
+	delete(manager.paused, containerID)
+
+	return nil
+}
+
+func newTestService(t *testing.T, config Config) (*Service, *fakeVolumeManager) {
+	config.DataPath = t.TempDir()
+
+	service, err := NewService(config)
+	require.NoError(t, err)
+
+	volumes := newFakeVolumeManager(t)
+	service.volumes = volumes
+
+	return service, volumes
+}
+
+func createVolume(t *testing.T, volumes *fakeVolumeManager, volumeName, content string) {
+	require.NoError(t, volumes.create(volumeName))
+	require.NoError(t, os.MkdirAll(filepath.Join(volumes.root, volumeName, "dir"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(volumes.root, volumeName, "dir", "file.txt"), []byte(content), 0640))
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	service, volumes := newTestService(t, Config{})
+	createVolume(t, volumes, "data", "content")
+	require.NoError(t, os.Chmod(filepath.Join(volumes.root, "data"), 0710))
+	volumes.containers = []string{"container"}
+
+	backup, err := service.Create(context.Background(), "data", CreateOptions{PauseContainers: true})
+	require.NoError(t, err)
+	require.Equal(t, StorageLocal, backup.Storage)
+	require.Equal(t, 1, backup.PausedContainers)
+	require.Empty(t, volumes.paused, "the containers must be resumed")
+
+	err = service.Restore(context.Background(), backup.ID, RestoreOptions{})
+	require.ErrorIs(t, err, ErrVolumeNotEmpty)
+
+	err = service.Restore(context.Background(), backup.ID, RestoreOptions{VolumeName: "copy"})
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(volumes.root, "copy", "dir", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "content", string(content))
+
+	info, err := os.Stat(filepath.Join(volumes.root, "copy", "dir"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0750), info.Mode().Perm())
+
+	// The metadata of the volume root is restored as well
+	info, err = os.Stat(filepath.Join(volumes.root, "copy"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0710), info.Mode().Perm())
+
+	require.NoError(t, os.WriteFile(filepath.Join(volumes.root, "data", "new.txt"), nil, 0644))
+	require.NoError(t, service.Restore(context.Background(), backup.ID, RestoreOptions{Overwrite: true}))
+
+	_, err = os.Stat(filepath.Join(volumes.root, "data", "new.txt"))
+	require.True(t, os.IsNotExist(err), "the existing content must be removed when overwriting the volume")
+
+	require.NoError(t, service.Delete(context.Background(), backup.ID))
+	require.ErrorIs(t, service.Delete(context.Background(), backup.ID), ErrBackupNotFound)
+
+	// The locks of the volumes are released once they are not used anymore
+	require.Empty(t, service.locks)
+}
+
+func TestBackupUnknownVolume(t *testing.T) {
+	service, _ := newTestService(t, Config{})
+
+	_, err := service.Create(context.Background(), "missing", CreateOptions{})
+	require.ErrorIs(t, err, ErrVolumeNotFound)
+
+	_, err = service.Create(context.Background(), "../escape", CreateOptions{})
+	require.ErrorIs(t, err, ErrInvalidVolumeName)
+
+	_, err = service.Create(context.Background(), "missing", CreateOptions{Storage: StorageS3})
+	require.ErrorIs(t, err, ErrS3NotConfigured)
+}
+
+func TestBackupRestoreDetectsCorruption(t *testing.T) {
+	service, volumes := newTestService(t, Config{})
+	createVolume(t, volumes, "data", "content")
+
+	backup, err := service.Create(context.Background(), "data", CreateOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(service.archivePath(backup.ID), []byte("corrupted"), 0600))
+
+	err = service.Restore(context.Background(), backup.ID, RestoreOptions{VolumeName: "copy"})
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	exists, _ := volumes.exists("copy")
+	require.False(t, exists, "the volume must not be created when the archive is corrupted")
+}
+
+func TestBackupRetention(t *testing.T) {
+	service, volumes := newTestService(t, Config{Retention: RetentionPolicy{Count: 2}})
+	createVolume(t, volumes, "data", "content")
+	createVolume(t, volumes, "other", "content")
+
+	other, err := service.Create(context.Background(), "other", CreateOptions{})
+	require.NoError(t, err)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		backup, err := service.Create(context.Background(), "data", CreateOptions{})
+		require.NoError(t, err)
+
+		// Ensure that the backups are ordered by creation date
+		backup.CreatedAt = time.Now().Add(time.Duration(i-10) * time.Minute).Unix()
+		require.NoError(t, service.save(backup))
+
+		ids = append(ids, backup.ID)
+	}
+
+	backups, err := service.List("data")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.Equal(t, ids[2], backups[0].ID)
+	require.Equal(t, ids[1], backups[1].ID)
+
+	_, err = service.Get(ids[0])
+	require.ErrorIs(t, err, ErrBackupNotFound)
+
+	_, err = os.Stat(service.archivePath(ids[0]))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = service.Get(other.ID)
+	require.NoError(t, err, "the retention policy only applies to the backups of the same volume")
+}
+
+func TestBackupS3Storage(t *testing.T) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") || r.Header.Get("X-Amz-Content-Sha256") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			object, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(object)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	service, volumes := newTestService(t, Config{S3: &S3Config{
+		Endpoint:        server.URL,
+		Bucket:          "bucket",
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		Prefix:          "agent",
+		ForcePathStyle:  true,
+	}})
+	createVolume(t, volumes, "data", "content")
+
+	backup, err := service.Create(context.Background(), "data", CreateOptions{Storage: StorageS3})
+	require.NoError(t, err)
+	require.Equal(t, "agent/data/"+backup.ID+".tar.gz", backup.ObjectKey)
+	require.Contains(t, objects, "/bucket/"+backup.ObjectKey)
+
+	_, err = os.Stat(service.archivePath(backup.ID))
+	require.True(t, os.IsNotExist(err), "the archive must not be kept locally")
+
+	require.NoError(t, service.Restore(context.Background(), backup.ID, RestoreOptions{VolumeName: "copy"}))
+
+	content, err := os.ReadFile(filepath.Join(volumes.root, "copy", "dir", "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "content", string(content))
+
+	require.NoError(t, service.Delete(context.Background(), backup.ID))
+	require.Empty(t, objects)
+}
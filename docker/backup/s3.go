@@ -0,0 +1,188 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// maxS3ObjectSize is the maximum size of an object uploaded with a single PUT request
+const maxS3ObjectSize = 5 << 30 // 5 GiB
+
+// S3Config is the configuration of an S3-compatible storage where the backups are sent
+type S3Config struct {
+	// Endpoint is the URL of the S3 API (e.g. https://s3.eu-west-1.amazonaws.com)
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// Prefix is prepended to the key of the backup objects
+	Prefix string
+	// ForcePathStyle uses path-style URLs (endpoint/bucket/key) instead of virtual-hosted-style URLs,
+	// it is usually required by self-hosted S3-compatible storages
+	ForcePathStyle bool
+}
+
+// s3Client is a minimal S3 client signing its requests with AWS Signature Version 4
+type s3Client struct {
+	config     S3Config
+	endpoint   *url.URL
+	signer     *v4.Signer
+	httpClient *http.Client
+}
+
+func newS3Client(config S3Config) (*s3Client, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+
+	if config.Bucket == "" {
+		return nil, errors.New("an S3 bucket is required")
+	}
+
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	return &s3Client{
+		config:   config,
+		endpoint: endpoint,
+		// The object keys are escaped once in the canonical request of S3, unlike the other AWS services
+		signer: v4.NewSigner(func(options *v4.SignerOptions) {
+			options.DisableURIPathEscaping = true
+		}),
+		httpClient: &http.Client{},
+	}, nil
+}
+
+func (client *s3Client) objectKey(name string) string {
+	return path.Join(client.config.Prefix, name)
+}
+
+func (client *s3Client) objectURL(key string) string {
+	u := *client.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	if client.config.ForcePathStyle {
+		u.Path += "/" + client.config.Bucket
+	} else {
+		u.Host = client.config.Bucket + "." + u.Host
+	}
+	u.Path += "/" + key
+	u.RawPath = ""
+
+	return u.String()
+}
+
+// putObject uploads a file, checksum is the hex encoded SHA-256 checksum of its content
+func (client *s3Client) putObject(ctx context.Context, key, filePath, checksum string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() > maxS3ObjectSize {
+		return fmt.Errorf("the archive size (%d bytes) exceeds the maximum size of an S3 object uploaded in a single request", info.Size())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, client.objectURL(key), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := client.do(req, checksum)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// getObject returns the content of an object, the caller must close it
+func (client *s3Client) getObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (client *s3Client) deleteObject(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, client.objectURL(key), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// do signs and sends a request, the response body must be closed by the caller when no error is returned
+func (client *s3Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	credentials := aws.Credentials{
+		AccessKeyID:     client.config.AccessKeyID,
+		SecretAccessKey: client.config.SecretAccessKey,
+	}
+
+	err := client.signer.SignHTTP(req.Context(), credentials, req, payloadHash, "s3", client.config.Region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+		return nil, fmt.Errorf("unexpected S3 response status %d for %s %s: %s", resp.StatusCode, req.Method, req.URL.Path, strings.TrimSpace(string(body)))
+	}
+
+	return resp, nil
+}
+
+var emptyPayloadHash = func() string {
+	hash := sha256.Sum256(nil)
+
+	return hex.EncodeToString(hash[:])
+}()
@@ -0,0 +1,42 @@
+package backup
+
+import (
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/filesystem"
+
+	"github.com/docker/docker/client"
+)
+
+// dockerVolumeManager manages the volumes and containers through the Docker API
+type dockerVolumeManager struct{}
+
+func (dockerVolumeManager) path(volumeName string) (string, error) {
+	return filesystem.BuildPathToFileInsideVolume(volumeName, "")
+}
+
+func (dockerVolumeManager) exists(volumeName string) (bool, error) {
+	_, err := docker.VolumeInspect(volumeName)
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (dockerVolumeManager) create(volumeName string) error {
+	_, err := docker.VolumeCreate(volumeName)
+
+	return err
+}
+
+func (dockerVolumeManager) runningContainers(volumeName string) ([]string, error) {
+	return docker.VolumeRunningContainers(volumeName)
+}
+
+func (dockerVolumeManager) pause(containerID string) error {
+	return docker.ContainerPause(containerID)
+}
+
+func (dockerVolumeManager) unpause(containerID string) error {
+	return docker.ContainerUnpause(containerID)
+}
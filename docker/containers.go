@@ -2,6 +2,7 @@ package docker
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	specs "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -99,3 +101,121 @@ func ContainerWait(name string, condition container.WaitCondition) (<-chan conta
 
 	return statusCh, errCh
 }
+
+// ContainerInspect returns the details of a container
+func ContainerInspect(name string) (types.ContainerJSON, error) {
+	var err error
+	var inspect types.ContainerJSON
+
+	err = withCli(func(cli *client.Client) error {
+		inspect, err = cli.ContainerInspect(context.Background(), name)
+
+		return err
+	})
+
+	return inspect, err
+}
+
+func ContainerPause(name string) error {
+	return withCli(func(cli *client.Client) error {
+		return cli.ContainerPause(context.Background(), name)
+	})
+}
+
+func ContainerUnpause(name string) error {
+	return withCli(func(cli *client.Client) error {
+		return cli.ContainerUnpause(context.Background(), name)
+	})
+}
+
+// ContainerStatPath returns the details of a file or directory inside a container
+func ContainerStatPath(name, path string) (types.ContainerPathStat, error) {
+	var err error
+	var stat types.ContainerPathStat
+
+	err = withCli(func(cli *client.Client) error {
+		stat, err = cli.ContainerStatPath(context.Background(), name, path)
+
+		return err
+	})
+
+	return stat, err
+}
+
+// CopyFromContainer returns a tar archive of a file or directory inside a container along with its details,
+// the caller must close the archive
+func CopyFromContainer(name, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	var err error
+	var reader io.ReadCloser
+	var stat types.ContainerPathStat
+
+	err = withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		reader, stat, err = cli.CopyFromContainer(context.Background(), name, srcPath)
+
+		return err
+	})
+
+	return reader, stat, err
+}
+
+// CopyToContainer extracts a tar archive inside a directory of a container
+func CopyToContainer(name, dstPath string, content io.Reader) error {
+	return withCli(func(cli *client.Client) error {
+		cli.HTTPClient().Timeout = largeClientTimeout
+
+		return cli.CopyToContainer(context.Background(), name, dstPath, content, types.CopyToContainerOptions{})
+	})
+}
+
+// ContainerExecOutput runs a command inside a running container and returns its standard output as it is produced,
+// the standard error is discarded. Reading the output returns an error when the command does not exit successfully.
+// The caller must close the output, which ends the command if it is still running.
+func ContainerExecOutput(name string, cmd []string) (io.ReadCloser, error) {
+	cli, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	exec, err := cli.ContainerExecCreate(context.Background(), name, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		cli.Close()
+
+		return nil, err
+	}
+
+	attach, err := cli.ContainerExecAttach(context.Background(), exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		cli.Close()
+
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		defer cli.Close()
+		defer attach.Close()
+
+		_, err := stdcopy.StdCopy(writer, io.Discard, attach.Reader)
+		if err != nil {
+			writer.CloseWithError(err)
+
+			return
+		}
+
+		inspect, err := cli.ContainerExecInspect(context.Background(), exec.ID)
+		if err == nil && inspect.ExitCode != 0 {
+			err = fmt.Errorf("the command exited with code %d", inspect.ExitCode)
+		}
+
+		writer.CloseWithError(err)
+	}()
+
+	return reader, nil
+}
@@ -3,12 +3,14 @@ package docker
 import (
 	"context"
 	"errors"
+	"net"
 	"time"
 
 	"github.com/portainer/agent"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/client"
 	"github.com/rs/zerolog/log"
@@ -131,6 +133,92 @@ func (service *InfoService) GetServiceNameFromDockerEngine(containerName string)
 	return containerInspect.Config.Labels[serviceNameLabel], nil
 }
 
+// GetSwarmTopologyFromDockerEngine returns the node running each task of the service of the agent container, along with
+// the nodes of the Swarm cluster. The nodes can only be listed on a manager, the addresses of the managers are returned
+// on the workers. The node running a task is identified by the host address of the task in the overlay networks, which
+// is the address of the node unless a different data path address is used.
+func (service *InfoService) GetSwarmTopologyFromDockerEngine(containerName string) (*agent.SwarmTopology, error) {
+	cli, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	ctx := context.Background()
+
+	dockerInfo, err := cli.Info(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := &agent.SwarmTopology{
+		TaskHosts: make(map[string]string),
+		LocalNode: agent.SwarmNode{
+			Hostname: dockerInfo.Name,
+			Role:     agent.NodeRoleWorker,
+			Address:  dockerInfo.Swarm.NodeAddr,
+		},
+	}
+
+	for _, manager := range dockerInfo.Swarm.RemoteManagers {
+		host, _, err := net.SplitHostPort(manager.Addr)
+		if err != nil {
+			host = manager.Addr
+		}
+
+		topology.ManagerAddresses = append(topology.ManagerAddresses, host)
+	}
+
+	if dockerInfo.Swarm.ControlAvailable {
+		topology.LocalNode.Role = agent.NodeRoleManager
+
+		nodes, err := cli.NodeList(ctx, types.NodeListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		topology.Nodes = make(map[string]agent.SwarmNode, len(nodes))
+		for _, node := range nodes {
+			swarmNode := agent.SwarmNode{
+				Hostname: node.Description.Hostname,
+				Role:     agent.NodeRoleWorker,
+				Address:  node.Status.Addr,
+			}
+
+			if node.Spec.Role == swarm.NodeRoleManager {
+				swarmNode.Role = agent.NodeRoleManager
+			}
+
+			topology.Nodes[swarmNode.Hostname] = swarmNode
+		}
+	}
+
+	containerInspect, err := cli.ContainerInspect(ctx, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := containerInspect.Config.Labels[serviceNameLabel]
+
+	// The verbose inspection of an overlay network lists the tasks attached to it on every node
+	for _, settings := range containerInspect.NetworkSettings.Networks {
+		networkResource, err := cli.NetworkInspect(ctx, settings.NetworkID, types.NetworkInspectOptions{Verbose: true})
+		if err != nil {
+			return nil, err
+		}
+
+		if networkResource.Scope != "swarm" || networkResource.Ingress {
+			continue
+		}
+
+		for _, task := range networkResource.Services[serviceName].Tasks {
+			topology.TaskHosts[task.EndpointIP] = task.Info["Host IP"]
+		}
+	}
+
+	return topology, nil
+}
+
 func getStandaloneConfig(config *agent.RuntimeConfig) {
 	config.DockerConfig.EngineType = agent.EngineTypeStandalone
 }
@@ -138,6 +226,7 @@ func getStandaloneConfig(config *agent.RuntimeConfig) {
 func getSwarmConfig(config *agent.RuntimeConfig, dockerInfo system.Info, cli *client.Client) error {
 	config.DockerConfig.EngineType = agent.EngineTypeSwarm
 	config.DockerConfig.NodeRole = agent.NodeRoleWorker
+	config.DockerConfig.NodeID = dockerInfo.Swarm.NodeID
 
 	if dockerInfo.Swarm.ControlAvailable {
 		config.DockerConfig.NodeRole = agent.NodeRoleManager
@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/rs/zerolog/log"
+)
+
+const eventsRetryInterval = 5 * time.Second
+
+// watchedResources are the types of the resources listed by the cluster operations
+var watchedResources = []events.Type{
+	events.ContainerEventType,
+	events.ImageEventType,
+	events.VolumeEventType,
+	events.NetworkEventType,
+	events.BuilderEventType,
+}
+
+// ignoredContainerActions are the container events that do not modify the container list
+var ignoredContainerActions = []string{"exec_", "attach", "detach", "resize", "top", "archive-path", "extract-to-dir", "export", "commit"}
+
+// WatchResourceChanges calls notify with the types of the resources (container, image, volume, network or builder)
+// modified on the local Docker engine, the changes are batched during interval.
+// Every type is notified when the connection to Docker is restored, as changes might have been missed.
+// It returns when the context is done.
+func WatchResourceChanges(ctx context.Context, interval time.Duration, notify func(resources []string)) {
+	// The events are streamed, the client must not time out
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		log.Error().Err(err).Msg("unable to create the Docker client used to watch the resource changes")
+
+		return
+	}
+	defer cli.Close()
+
+	options := types.EventsOptions{Filters: filters.NewArgs()}
+	for _, resource := range watchedResources {
+		options.Filters.Add("type", string(resource))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for reconnected := false; ; reconnected = true {
+		if reconnected {
+			notify(resourceNames(watchedResources))
+		}
+
+		messages, errs := cli.Events(ctx, options)
+		changes := map[events.Type]bool{}
+
+	watch:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err := <-errs:
+				log.Debug().Err(err).Msg("the Docker events stream was interrupted")
+
+				break watch
+			case message := <-messages:
+				if !ignoredEvent(message) {
+					changes[message.Type] = true
+				}
+			case <-ticker.C:
+				if len(changes) == 0 {
+					continue
+				}
+
+				resources := make([]events.Type, 0, len(changes))
+				for resource := range changes {
+					resources = append(resources, resource)
+				}
+
+				changes = map[events.Type]bool{}
+
+				notify(resourceNames(resources))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryInterval):
+		}
+	}
+}
+
+func ignoredEvent(message events.Message) bool {
+	if message.Type != events.ContainerEventType {
+		return false
+	}
+
+	for _, action := range ignoredContainerActions {
+		if strings.HasPrefix(string(message.Action), action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resourceNames(resources []events.Type) []string {
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, string(resource))
+	}
+
+	sort.Strings(names)
+
+	return names
+}
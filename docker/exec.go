@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// ContainerExecResize changes the size of the terminal of an exec instance
+func ContainerExecResize(execID string, width, height uint) error {
+	return withCli(func(cli *client.Client) error {
+		return cli.ContainerExecResize(context.Background(), execID, container.ResizeOptions{
+			Width:  width,
+			Height: height,
+		})
+	})
+}
+
+// ContainerExecInspect returns the details of an exec instance, including the exit code of its process once ended
+func ContainerExecInspect(execID string) (types.ContainerExecInspect, error) {
+	var err error
+	var inspect types.ContainerExecInspect
+
+	err = withCli(func(cli *client.Client) error {
+		inspect, err = cli.ContainerExecInspect(context.Background(), execID)
+
+		return err
+	})
+
+	return inspect, err
+}
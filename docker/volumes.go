@@ -3,6 +3,9 @@ package docker
 import (
 	"context"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 )
 
@@ -11,3 +14,54 @@ func VolumeDelete(name string, force bool) error {
 		return cli.VolumeRemove(context.Background(), name, force)
 	})
 }
+
+func VolumeInspect(name string) (volume.Volume, error) {
+	var err error
+	var vol volume.Volume
+
+	err = withCli(func(cli *client.Client) error {
+		vol, err = cli.VolumeInspect(context.Background(), name)
+
+		return err
+	})
+
+	return vol, err
+}
+
+func VolumeCreate(name string) (volume.Volume, error) {
+	var err error
+	var vol volume.Volume
+
+	err = withCli(func(cli *client.Client) error {
+		vol, err = cli.VolumeCreate(context.Background(), volume.CreateOptions{Name: name})
+
+		return err
+	})
+
+	return vol, err
+}
+
+// VolumeRunningContainers returns the identifiers of the running containers using a volume
+func VolumeRunningContainers(name string) ([]string, error) {
+	var containerIDs []string
+
+	err := withCli(func(cli *client.Client) error {
+		containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+			Filters: filters.NewArgs(
+				filters.Arg("volume", name),
+				filters.Arg("status", "running"),
+			),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, c := range containers {
+			containerIDs = append(containerIDs, c.ID)
+		}
+
+		return nil
+	})
+
+	return containerIDs, err
+}
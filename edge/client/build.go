@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -27,7 +28,7 @@ type edgeHTTPClient struct {
 }
 
 func BuildHTTPClient(timeout float64, options *agent.Options) *edgeHTTPClient {
-	revokeService := revoke.NewService()
+	revokeService := revoke.NewService(filepath.Join(options.DataPath, agent.RevocationCacheDirectory), options.RevocationHardFail)
 
 	c := &edgeHTTPClient{
 		httpClient: &http.Client{
@@ -122,17 +123,33 @@ func (c *edgeHTTPClient) buildTransport() *http.Transport {
 		return &cert, err
 	}
 
-	transport.TLSClientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
-		for _, chain := range verifiedChains {
-			for _, cert := range chain {
-				revoked, err := c.revokeService.VerifyCertificate(cert)
-				if err != nil {
-					return err
+	// VerifyConnection is used instead of VerifyPeerCertificate to access the stapled OCSP response
+	transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for i, cert := range chain {
+				var issuer *x509.Certificate
+				if i+1 < len(chain) {
+					issuer = chain[i+1]
+				}
+
+				// The stapled OCSP response only applies to the leaf certificate
+				var stapledOCSPResponse []byte
+				if i == 0 {
+					stapledOCSPResponse = cs.OCSPResponse
 				}
 
+				revoked, err := c.revokeService.VerifyCertificateWithIssuer(cert, issuer, stapledOCSPResponse)
 				if revoked {
+					if err != nil {
+						return errors.WithMessage(err, "certificate has been revoked")
+					}
+
 					return errors.New("certificate has been revoked")
 				}
+
+				if err != nil {
+					log.Warn().Err(err).Str("subject", cert.Subject.String()).Msg("unable to check the certificate revocation status, ignoring")
+				}
 			}
 		}
 
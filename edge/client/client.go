@@ -26,37 +26,47 @@ func NewAPIClient() *APIClient {
 }
 
 type getEdgeKeyResponse struct {
-	Key string `json:"key"`
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+	PublicKey string `json:"publicKey"`
 }
 
 // GetEdgeKey executes a KeyInspect operation against the specified server
 func (client *APIClient) GetEdgeKey(serverAddr string) (string, error) {
+	key, _, _, err := client.GetSignedEdgeKey(serverAddr)
+
+	return key, err
+}
+
+// GetSignedEdgeKey executes a KeyInspect operation against the specified server and also returns the signature
+// of the key and the public key used to create it, which are only known once the key was rotated
+func (client *APIClient) GetSignedEdgeKey(serverAddr string) (string, string, string, error) {
 	requestURL := fmt.Sprintf("http://%s/key", serverAddr)
 
 	req, err := http.NewRequest(http.MethodGet, requestURL, nil)
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
 	resp, err := client.httpClient.Do(req)
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Error().Int("response_code", resp.StatusCode).Msg("GetEdgeKey operation failed")
 
-		return "", errors.New("GetEdgeKey operation failed")
+		return "", "", "", errors.New("GetEdgeKey operation failed")
 	}
 
 	var data getEdgeKeyResponse
 	err = json.NewDecoder(resp.Body).Decode(&data)
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
-	return data.Key, nil
+	return data.Key, data.Signature, data.PublicKey, nil
 }
 
 type setEdgeKeyPayload struct {
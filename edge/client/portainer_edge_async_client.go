@@ -129,6 +129,8 @@ type EdgeJobData struct {
 	CronExpression    string
 	ScriptFileContent string
 	Version           int
+	Timeout           int
+	ConcurrencyPolicy string
 }
 
 type LogCommandData struct {
@@ -156,6 +158,17 @@ type VolumeCommandData struct {
 	VolumeOperation string
 }
 
+type VolumeBackupCommandData struct {
+	VolumeName      string
+	BackupID        string
+	PauseContainers bool
+	Storage         string
+	// TargetVolumeName is the volume where the backup is restored, the volume of the backup is used when empty
+	TargetVolumeName string
+	Overwrite        bool
+	BackupOperation  string
+}
+
 type NormalStackCommandData struct {
 	Name             string
 	StackFileContent string
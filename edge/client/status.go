@@ -0,0 +1,47 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/pkg/errors"
+)
+
+// ServerStatusChecker is used to check if a Portainer instance is healthy
+type ServerStatusChecker struct {
+	httpClient *edgeHTTPClient
+}
+
+// NewServerStatusChecker returns a pointer to a new ServerStatusChecker, the requests use the same TLS configuration
+// as the Portainer clients
+func NewServerStatusChecker(timeout float64, options *agent.Options) *ServerStatusChecker {
+	return &ServerStatusChecker{
+		httpClient: BuildHTTPClient(timeout, options),
+	}
+}
+
+// Check returns an error when the Portainer instance running at serverAddress is not healthy. Otherwise it returns
+// the time of the Portainer instance, or a zero time when the response is not dated.
+func (checker *ServerStatusChecker) Check(serverAddress string) (time.Time, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/system/status", serverAddress), nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	resp, err := checker.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, errors.Errorf("the Portainer instance responded with status %d", resp.StatusCode)
+	}
+
+	serverTime, _ := http.ParseTime(resp.Header.Get("Date"))
+
+	return serverTime, nil
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+	portainer "github.com/portainer/portainer/api"
+	"github.com/portainer/portainer/api/edge"
+)
+
+// SwitchableClient is a PortainerClient forwarding its calls to a client that can be replaced at runtime.
+// It is shared by the Edge components so that they all switch to a new Portainer instance when the Edge key
+// is rotated.
+type SwitchableClient struct {
+	portainerClient PortainerClient
+	mu              sync.RWMutex
+}
+
+// NewSwitchableClient returns a pointer to a new SwitchableClient forwarding its calls to cli
+func NewSwitchableClient(cli PortainerClient) *SwitchableClient {
+	return &SwitchableClient{portainerClient: cli}
+}
+
+// Switch replaces the client used by the subsequent calls
+func (client *SwitchableClient) Switch(cli PortainerClient) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	client.portainerClient = cli
+}
+
+func (client *SwitchableClient) current() PortainerClient {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	return client.portainerClient
+}
+
+func (client *SwitchableClient) GetEnvironmentID() (portainer.EndpointID, error) {
+	return client.current().GetEnvironmentID()
+}
+
+func (client *SwitchableClient) GetEnvironmentStatus(flags ...string) (*PollStatusResponse, error) {
+	return client.current().GetEnvironmentStatus(flags...)
+}
+
+func (client *SwitchableClient) GetEdgeStackConfig(edgeStackID int, version *int) (*edge.StackPayload, error) {
+	return client.current().GetEdgeStackConfig(edgeStackID, version)
+}
+
+func (client *SwitchableClient) SetEdgeStackStatus(edgeStackID int, edgeStackStatus portainer.EdgeStackStatusType, rollbackTo *int, errMessage string) error {
+	return client.current().SetEdgeStackStatus(edgeStackID, edgeStackStatus, rollbackTo, errMessage)
+}
+
+func (client *SwitchableClient) SetEdgeJobStatus(edgeJobStatus agent.EdgeJobStatus) error {
+	return client.current().SetEdgeJobStatus(edgeJobStatus)
+}
+
+func (client *SwitchableClient) GetEdgeConfig(id EdgeConfigID) (*EdgeConfig, error) {
+	return client.current().GetEdgeConfig(id)
+}
+
+func (client *SwitchableClient) SetEdgeConfigState(id EdgeConfigID, state EdgeConfigStateType) error {
+	return client.current().SetEdgeConfigState(id, state)
+}
+
+func (client *SwitchableClient) SetTimeout(t time.Duration) {
+	client.current().SetTimeout(t)
+}
+
+func (client *SwitchableClient) SetLastCommandTimestamp(timestamp time.Time) {
+	client.current().SetLastCommandTimestamp(timestamp)
+}
+
+func (client *SwitchableClient) EnqueueLogCollectionForStack(logCmd LogCommandData) {
+	client.current().EnqueueLogCollectionForStack(logCmd)
+}
@@ -0,0 +1,271 @@
+package edge
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/edge/client"
+)
+
+const (
+	// DiagnosticStatusSuccess is the status of a successful pre-flight check
+	DiagnosticStatusSuccess = "success"
+	// DiagnosticStatusWarning is the status of a pre-flight check that failed without preventing the agent from working
+	DiagnosticStatusWarning = "warning"
+	// DiagnosticStatusFailure is the status of a failed pre-flight check
+	DiagnosticStatusFailure = "failure"
+	// DiagnosticStatusSkipped is the status of a pre-flight check that does not apply to the agent configuration
+	DiagnosticStatusSkipped = "skipped"
+)
+
+// diagnosticTimeout is the maximum duration of each network check
+const diagnosticTimeout = 10 * time.Second
+
+type (
+	// KeyDiagnosis is the report of the pre-flight checks run before associating an Edge key to the agent
+	KeyDiagnosis struct {
+		// Success is false when at least one check failed
+		Success bool             `json:"Success"`
+		Steps   []DiagnosticStep `json:"Steps"`
+	}
+
+	// DiagnosticStep is the result of a pre-flight check
+	DiagnosticStep struct {
+		Name    string `json:"Name"`
+		Status  string `json:"Status"`
+		Message string `json:"Message"`
+	}
+)
+
+func (diagnosis *KeyDiagnosis) add(name, status, message string) {
+	if status == DiagnosticStatusFailure {
+		diagnosis.Success = false
+	}
+
+	diagnosis.Steps = append(diagnosis.Steps, DiagnosticStep{Name: name, Status: status, Message: message})
+}
+
+// DiagnoseKey runs the pre-flight checks of an Edge key without associating it to the agent. It validates the key,
+// checks that the Portainer servers and the tunnel servers of the key can be reached from the device with the proxy
+// settings of the agent, that the clock of the device is synchronized with Portainer and that the agent can access
+// the container platform. The checks of the failover servers only report warnings.
+func (manager *Manager) DiagnoseKey(key string) *KeyDiagnosis {
+	diagnosis := &KeyDiagnosis{Success: true}
+
+	edgeKey, err := ParseEdgeKey(strings.TrimSpace(key))
+	if err != nil {
+		diagnosis.add("Edge key", DiagnosticStatusFailure, "The key is not a valid Edge key, make sure that it was copied entirely from Portainer")
+
+		return diagnosis
+	}
+
+	servers := edgeKey.servers()
+	diagnosis.add("Edge key", DiagnosticStatusSuccess, fmt.Sprintf("The key is valid and lists %d Portainer server(s)", len(servers)))
+
+	checker := client.NewServerStatusChecker(diagnosticTimeout.Seconds(), manager.agentOptions)
+
+	for i, server := range servers {
+		failureStatus := DiagnosticStatusFailure
+		if i > 0 {
+			failureStatus = DiagnosticStatusWarning
+		}
+
+		manager.diagnoseServer(diagnosis, checker, server, failureStatus)
+	}
+
+	manager.diagnosePlatform(diagnosis)
+
+	return diagnosis
+}
+
+// diagnoseServer checks the DNS resolution and the reachability of a Portainer server, the synchronization of the
+// clock of the device with the server and the reachability of its tunnel server
+func (manager *Manager) diagnoseServer(diagnosis *KeyDiagnosis, checker *client.ServerStatusChecker, server edgeServer, failureStatus string) {
+	serverURL, err := url.Parse(server.PortainerInstanceURL)
+	if err != nil || serverURL.Hostname() == "" {
+		diagnosis.add("Portainer URL "+server.PortainerInstanceURL, failureStatus, "The Portainer URL of the key is invalid")
+
+		return
+	}
+
+	// The requests sent to Portainer use the proxy of the environment
+	proxyURL, err := http.ProxyFromEnvironment(&http.Request{URL: serverURL})
+	if err != nil {
+		diagnosis.add("Proxy", failureStatus, fmt.Sprintf("The proxy configuration is invalid: %s", err))
+
+		return
+	}
+
+	dnsStep := "DNS resolution of " + serverURL.Hostname()
+	if proxyURL != nil {
+		diagnosis.add(dnsStep, DiagnosticStatusSkipped, fmt.Sprintf("The name is resolved by the proxy %s", proxyURL.Host))
+	} else if addrs, err := lookupHost(serverURL.Hostname()); err != nil {
+		diagnosis.add(dnsStep, failureStatus, fmt.Sprintf("Unable to resolve the name of the Portainer server, check the DNS configuration of the device: %s", err))
+
+		return
+	} else {
+		diagnosis.add(dnsStep, DiagnosticStatusSuccess, fmt.Sprintf("Resolved to %s", strings.Join(addrs, ", ")))
+	}
+
+	apiStep := "Portainer API at " + server.PortainerInstanceURL
+
+	serverTime, err := checker.Check(server.PortainerInstanceURL)
+	if err != nil {
+		diagnosis.add(apiStep, failureStatus, describeRequestError(err, proxyURL))
+
+		return
+	}
+
+	message := "Portainer is reachable"
+	if proxyURL != nil {
+		message += " through the proxy " + proxyURL.Host
+	}
+
+	diagnosis.add(apiStep, DiagnosticStatusSuccess, message)
+
+	manager.diagnoseClock(diagnosis, serverTime, failureStatus)
+	manager.diagnoseTunnelServer(diagnosis, server, failureStatus)
+}
+
+// diagnoseClock checks that the clock of the device is synchronized with the clock of Portainer, the signatures of
+// the requests sent by Portainer are rejected when the clocks differ by more than the accepted skew
+func (manager *Manager) diagnoseClock(diagnosis *KeyDiagnosis, serverTime time.Time, failureStatus string) {
+	if serverTime.IsZero() {
+		diagnosis.add("Clock synchronization", DiagnosticStatusSkipped, "Portainer did not report its time")
+
+		return
+	}
+
+	maxSkew := manager.agentOptions.SignatureMaxSkew
+	if maxSkew <= 0 {
+		maxSkew, _ = time.ParseDuration(agent.DefaultSignatureMaxSkew)
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if skew > maxSkew {
+		diagnosis.add("Clock synchronization", failureStatus, fmt.Sprintf("The clock of the device differs from the clock of Portainer by %s, more than the accepted %s. Synchronize the clock of the device (NTP)", skew, maxSkew))
+
+		return
+	}
+
+	diagnosis.add("Clock synchronization", DiagnosticStatusSuccess, fmt.Sprintf("The clock of the device differs from the clock of Portainer by %s", skew))
+}
+
+// diagnoseTunnelServer checks that a connection can be opened to the tunnel server, or to the tunnel proxy when
+// the tunnel is opened through a proxy
+func (manager *Manager) diagnoseTunnelServer(diagnosis *KeyDiagnosis, server edgeServer, failureStatus string) {
+	name := "Tunnel server " + server.TunnelServerAddr
+
+	if !manager.agentOptions.EdgeTunnel {
+		diagnosis.add(name, DiagnosticStatusSkipped, "The reverse tunnel is disabled")
+
+		return
+	}
+
+	if manager.agentOptions.EdgeAsyncMode {
+		diagnosis.add(name, DiagnosticStatusSkipped, "The reverse tunnel is not used in async mode")
+
+		return
+	}
+
+	addr := server.TunnelServerAddr
+	target := "the tunnel server"
+
+	if manager.agentOptions.EdgeTunnelProxy != "" {
+		proxyURL, err := url.Parse(manager.agentOptions.EdgeTunnelProxy)
+		if err != nil || proxyURL.Host == "" {
+			diagnosis.add(name, failureStatus, "The tunnel proxy URL is invalid")
+
+			return
+		}
+
+		addr = proxyURL.Host
+		if proxyURL.Port() == "" {
+			addr = net.JoinHostPort(proxyURL.Hostname(), "80")
+		}
+
+		target = "the tunnel proxy " + proxyURL.Host
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, diagnosticTimeout)
+	if err != nil {
+		diagnosis.add(name, failureStatus, fmt.Sprintf("Unable to connect to %s, check that the port is open in the firewall: %s", target, err))
+
+		return
+	}
+	conn.Close()
+
+	diagnosis.add(name, DiagnosticStatusSuccess, fmt.Sprintf("A connection to %s was opened", target))
+}
+
+// diagnosePlatform checks that the agent can access the Docker engine or the Kubernetes API
+func (manager *Manager) diagnosePlatform(diagnosis *KeyDiagnosis) {
+	switch {
+	case manager.dockerInfoService != nil:
+		runtimeConfig, err := manager.dockerInfoService.GetRuntimeConfigurationFromDockerEngine()
+		if err != nil {
+			diagnosis.add("Docker engine", DiagnosticStatusFailure, fmt.Sprintf("Unable to access the Docker engine, make sure that the Docker socket is mounted in the agent container: %s", err))
+
+			return
+		}
+
+		engineType := "standalone"
+		if runtimeConfig.DockerConfig.EngineType == agent.EngineTypeSwarm {
+			engineType = "Swarm"
+		}
+
+		diagnosis.add("Docker engine", DiagnosticStatusSuccess, fmt.Sprintf("The Docker engine is accessible (%s)", engineType))
+	case manager.kubeClient != nil:
+		version, err := manager.kubeClient.ServerVersion()
+		if err != nil {
+			diagnosis.add("Kubernetes API", DiagnosticStatusFailure, fmt.Sprintf("Unable to access the Kubernetes API, check the service account of the agent: %s", err))
+
+			return
+		}
+
+		diagnosis.add("Kubernetes API", DiagnosticStatusSuccess, fmt.Sprintf("The Kubernetes API is accessible (%s)", version))
+	default:
+		diagnosis.add("Container platform", DiagnosticStatusSkipped, "The container platform cannot be checked")
+	}
+}
+
+func lookupHost(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticTimeout)
+	defer cancel()
+
+	return net.DefaultResolver.LookupHost(ctx, host)
+}
+
+// describeRequestError explains why a request to Portainer failed
+func describeRequestError(err error, proxyURL *url.URL) string {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &verificationErr), errors.As(err, &unknownAuthorityErr), errors.As(err, &hostnameErr):
+		return fmt.Sprintf("The TLS certificate of Portainer is not trusted by the agent, set EDGE_INSECURE_POLL=1 when Portainer uses a self-signed certificate: %s", err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		if proxyURL != nil {
+			return fmt.Sprintf("Portainer did not respond in time, check the proxy %s: %s", proxyURL.Host, err)
+		}
+
+		return fmt.Sprintf("Portainer did not respond in time, check the firewall rules of the device and of Portainer: %s", err)
+	}
+
+	return fmt.Sprintf("Unable to reach Portainer: %s", err)
+}
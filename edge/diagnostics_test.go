@@ -0,0 +1,90 @@
+package edge
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnoseInvalidKey(t *testing.T) {
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: t.TempDir()}})
+
+	diagnosis := mgr.DiagnoseKey("invalid")
+	require.False(t, diagnosis.Success)
+	require.Len(t, diagnosis.Steps, 1)
+	require.Equal(t, DiagnosticStatusFailure, diagnosis.Steps[0].Status)
+}
+
+func TestDiagnoseKey(t *testing.T) {
+	serverTime := time.Now()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	tunnelServer, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer tunnelServer.Close()
+
+	options := &agent.Options{DataPath: t.TempDir(), EdgeTunnel: true, SignatureMaxSkew: time.Minute}
+	mgr := NewManager(&ManagerParameters{Options: options})
+
+	key := encodeKey(&edgeKey{PortainerInstanceURL: server.URL, TunnelServerAddr: tunnelServer.Addr().String(), EndpointID: 1})
+
+	diagnosis := mgr.DiagnoseKey(key)
+	require.True(t, diagnosis.Success, diagnosis.Steps)
+
+	statuses := make([]string, 0, len(diagnosis.Steps))
+	for _, step := range diagnosis.Steps {
+		statuses = append(statuses, step.Status)
+	}
+
+	// Key, DNS, Portainer API, clock, tunnel server and container platform
+	require.Equal(t, []string{
+		DiagnosticStatusSuccess,
+		DiagnosticStatusSuccess,
+		DiagnosticStatusSuccess,
+		DiagnosticStatusSuccess,
+		DiagnosticStatusSuccess,
+		DiagnosticStatusSkipped,
+	}, statuses)
+
+	// The clock of the device is rejected when it is not synchronized with Portainer
+	serverTime = time.Now().Add(-time.Hour)
+
+	diagnosis = mgr.DiagnoseKey(key)
+	require.False(t, diagnosis.Success)
+	require.Equal(t, "Clock synchronization", diagnosis.Steps[3].Name)
+	require.Equal(t, DiagnosticStatusFailure, diagnosis.Steps[3].Status)
+}
+
+func TestDiagnoseUnreachableFailoverServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	unreachableServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachableServer.Close()
+
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: t.TempDir()}})
+
+	key := encodeKey(&edgeKey{
+		PortainerInstanceURL: server.URL,
+		FailoverServers:      []edgeServer{{PortainerInstanceURL: unreachableServer.URL}},
+		EndpointID:           1,
+	})
+
+	diagnosis := mgr.DiagnoseKey(key)
+	require.True(t, diagnosis.Success, diagnosis.Steps)
+
+	// The failure of a failover server does not prevent the association of the key
+	apiStep := diagnosis.Steps[len(diagnosis.Steps)-2]
+	require.Equal(t, "Portainer API at "+unreachableServer.URL, apiStep.Name)
+	require.Equal(t, DiagnosticStatusWarning, apiStep.Status)
+}
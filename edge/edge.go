@@ -4,14 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker/backup"
 	"github.com/portainer/agent/edge/aws"
 	"github.com/portainer/agent/edge/client"
 	"github.com/portainer/agent/edge/scheduler"
 	"github.com/portainer/agent/edge/stack"
+	"github.com/portainer/agent/kubernetes"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/filesystem"
 
@@ -24,13 +27,23 @@ type (
 		containerPlatform agent.ContainerPlatform
 		advertiseAddr     string
 		agentOptions      *agent.Options
+		backupService     *backup.Service
 		clusterService    agent.ClusterService
 		dockerInfoService agent.DockerInfoService
+		kubeClient        *kubernetes.KubeClient
 		key               *edgeKey
 		logsManager       *scheduler.LogsManager
+		portainerClient   *client.SwitchableClient
+		statusChecker     *client.ServerStatusChecker
 		pollService       *PollService
+		scheduleManager   agent.Scheduler
+		signatureService  agent.DigitalSignatureService
 		stackManager      *stack.StackManager
-		mu                sync.Mutex
+		// keySignature and keyPublicKey prove that the rotated key was sent by Portainer, the other agents
+		// of the cluster verify them before using the key
+		keySignature string
+		keyPublicKey string
+		mu           sync.Mutex
 	}
 
 	// ManagerParameters represents an object used to create a Manager
@@ -40,6 +53,12 @@ type (
 		ClusterService    agent.ClusterService
 		DockerInfoService agent.DockerInfoService
 		ContainerPlatform agent.ContainerPlatform
+		// KubeClient is used to check the access to the Kubernetes API, it is nil when the agent does not run on Kubernetes
+		KubeClient *kubernetes.KubeClient
+		// BackupService is used by the volume backup commands, it is nil when volume backups are not supported
+		BackupService *backup.Service
+		// SignatureService verifies the signature of the Edge keys rotated by the other agents of the cluster
+		SignatureService agent.DigitalSignatureService
 	}
 )
 
@@ -49,13 +68,22 @@ func (manager *Manager) GetStackManager() *stack.StackManager {
 
 // NewManager returns a pointer to a new instance of Manager
 func NewManager(parameters *ManagerParameters) *Manager {
-	return &Manager{
+	manager := &Manager{
 		clusterService:    parameters.ClusterService,
 		dockerInfoService: parameters.DockerInfoService,
 		agentOptions:      parameters.Options,
 		advertiseAddr:     parameters.AdvertiseAddr,
 		containerPlatform: parameters.ContainerPlatform,
+		backupService:     parameters.BackupService,
+		kubeClient:        parameters.KubeClient,
+		signatureService:  parameters.SignatureService,
 	}
+
+	if keySharedInCluster(manager.clusterService) {
+		manager.clusterService.SubscribeEvents(agent.ClusterEventEdgeKeyRotated, manager.handleKeyRotatedEvent)
+	}
+
+	return manager
 }
 
 // Start starts the manager
@@ -64,30 +92,58 @@ func (manager *Manager) Start() error {
 		return errors.New("unable to Start Edge manager without key")
 	}
 
-	apiServerAddr := fmt.Sprintf("%s:%s", manager.advertiseAddr, manager.agentOptions.AgentServerPort)
-
-	pollServiceConfig := &pollServiceConfig{
-		APIServerAddr:           apiServerAddr,
-		EdgeID:                  manager.agentOptions.EdgeID,
-		PollFrequency:           agent.DefaultEdgePollInterval,
-		InactivityTimeout:       manager.agentOptions.EdgeInactivityTimeout,
-		TunnelCapability:        manager.agentOptions.EdgeTunnel,
-		PortainerURL:            manager.key.PortainerInstanceURL,
-		TunnelServerAddr:        manager.key.TunnelServerAddr,
-		TunnelServerFingerprint: manager.key.TunnelServerFingerprint,
-		TunnelProxy:             manager.agentOptions.EdgeTunnelProxy,
-		ContainerPlatform:       manager.containerPlatform,
-	}
+	manager.mu.Lock()
+	key := *manager.key
+	manager.mu.Unlock()
 
 	log.Debug().
-		Str("api_addr", pollServiceConfig.APIServerAddr).
-		Str("edge_id", pollServiceConfig.EdgeID).
-		Str("poll_frequency", pollServiceConfig.PollFrequency).
-		Str("inactivity_timeout", pollServiceConfig.InactivityTimeout).
+		Str("api_addr", manager.apiServerAddr()).
+		Str("edge_id", manager.agentOptions.EdgeID).
+		Str("poll_frequency", agent.DefaultEdgePollInterval).
+		Str("inactivity_timeout", manager.agentOptions.EdgeInactivityTimeout).
 		Bool("insecure_poll", manager.agentOptions.EdgeInsecurePoll).
 		Bool("tunnel_capability", manager.agentOptions.EdgeTunnel).
 		Msg("")
 
+	// The components share a client that is switched to another Portainer instance on failover and when the key
+	// is rotated
+	manager.portainerClient = client.NewSwitchableClient(manager.newPortainerClient(key.PortainerInstanceURL))
+	manager.statusChecker = client.NewServerStatusChecker(10, manager.agentOptions)
+
+	manager.stackManager = stack.NewStackManager(
+		manager.portainerClient,
+		manager.agentOptions.AssetsPath,
+		aws.ExtractAwsConfig(manager.agentOptions),
+		manager.agentOptions.EdgeID,
+	)
+
+	manager.logsManager = scheduler.NewLogsManager(manager.portainerClient)
+	manager.logsManager.Start()
+
+	scheduleManager, err := scheduler.NewScheduler(manager.agentOptions.EdgeJobScheduler, manager.logsManager, manager.agentOptions.DataPath)
+	if err != nil {
+		return err
+	}
+	manager.scheduleManager = scheduleManager
+
+	pollService, err := manager.newPollService(key)
+	if err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	manager.pollService = pollService
+	manager.mu.Unlock()
+
+	return manager.startEdgeBackgroundProcess()
+}
+
+func (manager *Manager) apiServerAddr() string {
+	return fmt.Sprintf("%s:%s", manager.advertiseAddr, manager.agentOptions.AgentServerPort)
+}
+
+// newPortainerClient returns a client of the Portainer instance running at portainerURL
+func (manager *Manager) newPortainerClient(portainerURL string) client.PortainerClient {
 	// When the header is not set to PlatformDocker Portainer assumes the platform to be kubernetes.
 	// However, Portainer should handle podman agents the same way as docker agents.
 	agentPlatform := manager.containerPlatform
@@ -95,8 +151,8 @@ func (manager *Manager) Start() error {
 		agentPlatform = agent.PlatformDocker
 	}
 
-	portainerClient := client.NewPortainerClient(
-		manager.key.PortainerInstanceURL,
+	return client.NewPortainerClient(
+		portainerURL,
 		manager.SetEndpointID,
 		manager.GetEndpointID,
 		manager.agentOptions.EdgeID,
@@ -105,36 +161,66 @@ func (manager *Manager) Start() error {
 		manager.agentOptions.EdgeMetaFields,
 		client.BuildHTTPClient(30, manager.agentOptions),
 	)
+}
 
-	manager.stackManager = stack.NewStackManager(
-		portainerClient,
-		manager.agentOptions.AssetsPath,
-		aws.ExtractAwsConfig(manager.agentOptions),
-		manager.agentOptions.EdgeID,
-	)
-
-	manager.logsManager = scheduler.NewLogsManager(portainerClient)
-	manager.logsManager.Start()
+// newPollService returns a poll service connecting to the servers of key, the primary server first
+func (manager *Manager) newPollService(key edgeKey) (*PollService, error) {
+	pollServiceConfig := &pollServiceConfig{
+		APIServerAddr:     manager.apiServerAddr(),
+		EdgeID:            manager.agentOptions.EdgeID,
+		PollFrequency:     agent.DefaultEdgePollInterval,
+		InactivityTimeout: manager.agentOptions.EdgeInactivityTimeout,
+		TunnelCapability:  manager.agentOptions.EdgeTunnel,
+		Servers:           key.servers(),
+		FailoverThreshold: manager.agentOptions.EdgeFailoverThreshold,
+		FailbackInterval:  manager.agentOptions.EdgeFailbackInterval,
+		TunnelProxy:       manager.agentOptions.EdgeTunnelProxy,
+		ContainerPlatform: manager.containerPlatform,
+	}
 
-	pollService, err := newPollService(
+	return newPollService(
 		manager,
 		manager.stackManager,
-		manager.logsManager,
+		manager.scheduleManager,
 		pollServiceConfig,
-		portainerClient,
+		manager.portainerClient,
 		manager.agentOptions.EdgeAsyncMode,
 	)
-	if err != nil {
-		return err
+}
+
+// useServer switches the Edge components to the Portainer instance of server. The requests of a poll service
+// that was replaced, or that uses the servers of a rotated key, are ignored.
+func (manager *Manager) useServer(pollService *PollService, server edgeServer) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if pollService != manager.pollService || !slices.Contains(manager.key.servers(), server) {
+		return
 	}
-	manager.pollService = pollService
 
-	return manager.startEdgeBackgroundProcess()
+	manager.portainerClient.Switch(manager.newPortainerClient(server.PortainerInstanceURL))
+}
+
+// checkServer returns an error when the Portainer instance of server is not healthy
+func (manager *Manager) checkServer(server edgeServer) error {
+	_, err := manager.statusChecker.Check(server.PortainerInstanceURL)
+
+	return err
+}
+
+// getPollService returns the poll service in use, the poll service is replaced when the key is rotated
+func (manager *Manager) getPollService() *PollService {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.pollService
 }
 
 // ResetActivityTimer resets the activity timer
 func (manager *Manager) ResetActivityTimer() {
-	manager.pollService.resetActivityTimer()
+	if pollService := manager.getPollService(); pollService != nil {
+		pollService.resetActivityTimer()
+	}
 }
 
 // SetEndpointID set the endpointID of the agent
@@ -176,12 +262,12 @@ func (manager *Manager) startEdgeBackgroundProcessOnDocker(runtimeCheckFrequency
 }
 
 func (manager *Manager) startEdgeBackgroundProcessOnKubernetes(runtimeCheckFrequency time.Duration) error {
-	manager.pollService.Start()
+	manager.getPollService().Start()
 
 	go func() {
 		ticker := time.NewTicker(runtimeCheckFrequency)
 		for range ticker.C {
-			manager.pollService.Start()
+			manager.getPollService().Start()
 
 			err := manager.stackManager.SetEngineType(stack.EngineTypeKubernetes)
 			if err != nil {
@@ -238,7 +324,7 @@ func (manager *Manager) checkDockerRuntimeConfig() error {
 			engineType = stack.EngineTypeDockerSwarm
 		}
 
-		manager.pollService.Start()
+		manager.getPollService().Start()
 
 		err = manager.stackManager.SetEngineType(engineType)
 		if err != nil {
@@ -248,7 +334,7 @@ func (manager *Manager) checkDockerRuntimeConfig() error {
 		return manager.stackManager.Start()
 	}
 
-	manager.pollService.Stop()
+	manager.getPollService().Stop()
 	manager.stackManager.Stop()
 
 	return nil
@@ -0,0 +1,71 @@
+package edge
+
+import "time"
+
+// serverFailover selects the server used by the poll service among the servers of the Edge key. It fails over to
+// the next server after consecutive poll failures and fails back to the primary server once it is healthy again.
+type serverFailover struct {
+	servers           []edgeServer
+	current           int
+	failures          int
+	threshold         int
+	failbackInterval  time.Duration
+	lastFailbackCheck time.Time
+	// checkServer returns an error when the server is not healthy
+	checkServer func(server edgeServer) error
+}
+
+func newServerFailover(servers []edgeServer, threshold int, failbackInterval time.Duration, checkServer func(server edgeServer) error) *serverFailover {
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	return &serverFailover{
+		servers:          servers,
+		threshold:        threshold,
+		failbackInterval: failbackInterval,
+		checkServer:      checkServer,
+	}
+}
+
+// server returns the server in use
+func (failover *serverFailover) server() edgeServer {
+	return failover.servers[failover.current]
+}
+
+// pollFailed records a poll failure, it returns true when the agent failed over to the next server
+func (failover *serverFailover) pollFailed(now time.Time) bool {
+	if len(failover.servers) < 2 {
+		return false
+	}
+
+	failover.failures++
+	if failover.failures < failover.threshold {
+		return false
+	}
+
+	failover.failures = 0
+	failover.current = (failover.current + 1) % len(failover.servers)
+	failover.lastFailbackCheck = now
+
+	return true
+}
+
+// pollSucceeded records a successful poll, it returns true when the agent failed back to the primary server
+func (failover *serverFailover) pollSucceeded(now time.Time) bool {
+	failover.failures = 0
+
+	if failover.current == 0 || now.Sub(failover.lastFailbackCheck) < failover.failbackInterval {
+		return false
+	}
+
+	failover.lastFailbackCheck = now
+
+	if failover.checkServer(failover.servers[0]) != nil {
+		return false
+	}
+
+	failover.current = 0
+
+	return true
+}
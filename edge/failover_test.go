@@ -0,0 +1,71 @@
+package edge
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerFailover(t *testing.T) {
+	servers := []edgeServer{
+		{PortainerInstanceURL: "https://primary:9443"},
+		{PortainerInstanceURL: "https://secondary:9443"},
+	}
+
+	primaryHealthy := false
+	failover := newServerFailover(servers, 3, time.Minute, func(server edgeServer) error {
+		require.Equal(t, servers[0], server)
+
+		if !primaryHealthy {
+			return errors.New("unavailable")
+		}
+
+		return nil
+	})
+
+	now := time.Unix(1700000000, 0)
+
+	// The failures must be consecutive
+	require.False(t, failover.pollFailed(now))
+	require.False(t, failover.pollFailed(now))
+	require.False(t, failover.pollSucceeded(now))
+	require.False(t, failover.pollFailed(now))
+	require.False(t, failover.pollFailed(now))
+	require.Equal(t, servers[0], failover.server())
+
+	require.True(t, failover.pollFailed(now))
+	require.Equal(t, servers[1], failover.server())
+
+	// The primary server is checked once per failback interval
+	require.False(t, failover.pollSucceeded(now.Add(time.Second)))
+	require.False(t, failover.pollSucceeded(now.Add(time.Minute)))
+
+	primaryHealthy = true
+	require.False(t, failover.pollSucceeded(now.Add(90*time.Second)))
+	require.True(t, failover.pollSucceeded(now.Add(2*time.Minute)))
+	require.Equal(t, servers[0], failover.server())
+}
+
+func TestServerFailoverWrapsAround(t *testing.T) {
+	servers := []edgeServer{
+		{PortainerInstanceURL: "https://primary:9443"},
+		{PortainerInstanceURL: "https://secondary:9443"},
+	}
+
+	failover := newServerFailover(servers, 1, time.Minute, func(edgeServer) error { return nil })
+
+	require.True(t, failover.pollFailed(time.Now()))
+	require.Equal(t, servers[1], failover.server())
+
+	require.True(t, failover.pollFailed(time.Now()))
+	require.Equal(t, servers[0], failover.server())
+}
+
+func TestServerFailoverSingleServer(t *testing.T) {
+	failover := newServerFailover([]edgeServer{{PortainerInstanceURL: "https://primary:9443"}}, 1, time.Minute, nil)
+
+	require.False(t, failover.pollFailed(time.Now()))
+	require.False(t, failover.pollSucceeded(time.Now()))
+}
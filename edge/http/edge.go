@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 
@@ -11,7 +12,8 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// EdgeServer expose an UI to associate an Edge key with the agent.
+// EdgeServer expose an UI to associate an Edge key with the agent, the key can be checked by pre-flight
+// diagnostics before it is associated.
 type EdgeServer struct {
 	httpServer  *http.Server
 	edgeManager *edge.Manager
@@ -28,6 +30,7 @@ func NewEdgeServer(edgeManager *edge.Manager) *EdgeServer {
 func (server *EdgeServer) Start(addr, port string) error {
 	router := mux.NewRouter()
 	router.HandleFunc("/init", server.handleKeySetup()).Methods(http.MethodPost)
+	router.HandleFunc("/diagnose", server.handleKeyDiagnosis()).Methods(http.MethodPost)
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static")))
 
 	listenAddr := addr + ":" + port
@@ -73,6 +76,33 @@ func (server *EdgeServer) handleKeySetup() http.HandlerFunc {
 	}
 }
 
+func (server *EdgeServer) handleKeyDiagnosis() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			http.Error(w, "Unable to parse form", http.StatusInternalServerError)
+			return
+		}
+
+		key := r.Form.Get("key")
+		if key == "" {
+			http.Error(w, "Missing key parameter", http.StatusBadRequest)
+			return
+		}
+
+		writeDiagnosis(w, server.edgeManager.DiagnoseKey(key))
+	}
+}
+
+func writeDiagnosis(w http.ResponseWriter, diagnosis *edge.KeyDiagnosis) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(diagnosis)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to write the Edge key diagnosis")
+	}
+}
+
 func (server *EdgeServer) propagateKeyInCluster() {
 	err := server.edgeManager.PropagateKeyInCluster()
 	if err != nil {
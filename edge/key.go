@@ -1,14 +1,20 @@
 package edge
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/edge/client"
 	"github.com/portainer/agent/filesystem"
 	portainer "github.com/portainer/portainer/api"
@@ -16,43 +22,229 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// keyRotationRestartDelay is the delay before the poll service is restarted with a rotated key, the rotation
+// request is usually received through the reverse tunnel that is closed by the restart
+const keyRotationRestartDelay = 2 * time.Second
+
+// replacedEdgeKeyFile is the name of the file recording the hash of the Edge key of the options replaced by a rotation
+const replacedEdgeKeyFile = agent.EdgeKeyFile + "_replaced"
+
+// errEdgeKeyDecryption is returned when the Edge key file cannot be decrypted with the host key
+var errEdgeKeyDecryption = errors.New("unable to decrypt the edge key")
+
 type edgeKey struct {
 	PortainerInstanceURL    string
 	TunnelServerAddr        string
 	TunnelServerFingerprint string
 	EndpointID              portainer.EndpointID
 	Global                  bool
+	// FailoverServers are the servers used when the primary server is unavailable, ordered by priority
+	FailoverServers []edgeServer
+}
+
+// edgeServer is a Portainer instance and the tunnel server associated to it
+type edgeServer struct {
+	PortainerInstanceURL    string
+	TunnelServerAddr        string
+	TunnelServerFingerprint string
+}
+
+// servers returns the servers of the key ordered by priority, the primary server first
+func (key *edgeKey) servers() []edgeServer {
+	primary := edgeServer{
+		PortainerInstanceURL:    key.PortainerInstanceURL,
+		TunnelServerAddr:        key.TunnelServerAddr,
+		TunnelServerFingerprint: key.TunnelServerFingerprint,
+	}
+
+	return append([]edgeServer{primary}, key.FailoverServers...)
 }
 
 // SetKey parses and associates an Edge key to the agent.
-// If the agent is running inside a cluster, it will also set the "set" flag to specify that a key is set on this agent in the cluster.
+// If the agent is running inside a Swarm cluster, it will also set the "set" flag to specify that a key is set on this agent in the cluster.
+// The key is persisted encrypted with a key bound to the host.
 func (manager *Manager) SetKey(key string) error {
-	edgeKey, err := ParseEdgeKey(key)
+	edgeKey, err := parseAndCheckEdgeKey(key)
+	if err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if err := persistEdgeKey(manager.agentOptions.DataPath, key); err != nil {
+		return err
+	}
+
+	manager.key = edgeKey
+	manager.keySignature = ""
+	manager.keyPublicKey = ""
+
+	if keySharedInCluster(manager.clusterService) {
+		tags := manager.clusterService.GetRuntimeConfiguration()
+		tags.EdgeKeySet = true
+
+		return manager.clusterService.UpdateRuntimeConfiguration(tags)
+	}
+
+	return nil
+}
+
+// RotateKey replaces the Edge key associated to the agent at runtime. The new key is persisted and the Edge
+// components switch to the Portainer instance of the new key right away, the poll service and the reverse
+// tunnel are restarted shortly after so that the rotation request can be answered first.
+// The other agents of a Swarm cluster retrieve the new key from this agent along with its signature, created with
+// the private key associated to publicKey, which they verify before using the key.
+func (manager *Manager) RotateKey(key, signature, publicKey string) error {
+	err := manager.rotateKey(key, signature, publicKey)
 	if err != nil {
 		return err
 	}
 
-	u, err := url.Parse(edgeKey.PortainerInstanceURL)
+	if keySharedInCluster(manager.clusterService) {
+		nodeName := manager.clusterService.GetRuntimeConfiguration().NodeName
+
+		err := manager.clusterService.BroadcastEvent(agent.ClusterEventEdgeKeyRotated, []byte(nodeName))
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to notify the cluster of the Edge key rotation")
+		}
+	}
+
+	return nil
+}
+
+func (manager *Manager) rotateKey(key, signature, publicKey string) error {
+	edgeKey, err := parseAndCheckEdgeKey(key)
 	if err != nil {
 		return err
-	} else if u.Scheme != "https" {
-		log.Warn().Msg("This agent has been configured using an insecure connection, which can limit functionality. We recommend updating the agent to use a secure connection.")
 	}
 
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
-	if err := filesystem.WriteFile(manager.agentOptions.DataPath, agent.EdgeKeyFile, []byte(key), 0644); err != nil {
+	if manager.key == nil {
+		return errors.New("no Edge key is associated to the agent")
+	}
+
+	if encodeKey(edgeKey) == encodeKey(manager.key) {
+		return nil
+	}
+
+	// The key of the options must not replace the rotated key when the agent restarts
+	if manager.agentOptions.EdgeKey != "" {
+		if err := persistReplacedEdgeKey(manager.agentOptions.DataPath, manager.agentOptions.EdgeKey); err != nil {
+			return err
+		}
+	}
+
+	if err := persistEdgeKey(manager.agentOptions.DataPath, key); err != nil {
 		return err
 	}
 
 	manager.key = edgeKey
+	manager.keySignature = signature
+	manager.keyPublicKey = publicKey
 
-	if manager.clusterService != nil {
-		tags := manager.clusterService.GetRuntimeConfiguration()
-		tags.EdgeKeySet = true
+	log.Info().Str("portainer_url", edgeKey.PortainerInstanceURL).Msg("edge key rotated")
 
-		return manager.clusterService.UpdateRuntimeConfiguration(tags)
+	// The new key is used when the manager starts
+	if manager.pollService == nil {
+		return nil
+	}
+
+	manager.portainerClient.Switch(manager.newPortainerClient(edgeKey.PortainerInstanceURL))
+
+	time.AfterFunc(keyRotationRestartDelay, manager.restartPollService)
+
+	return nil
+}
+
+// restartPollService replaces the poll service by a new one using the Edge key associated to the agent, the
+// reverse tunnel of the previous poll service is closed. The new poll service is started right away when the
+// previous one was running, otherwise it is started by the next runtime configuration check.
+func (manager *Manager) restartPollService() {
+	manager.mu.Lock()
+
+	pollService, err := manager.newPollService(*manager.key)
+	if err != nil {
+		manager.mu.Unlock()
+
+		log.Error().Err(err).Msg("unable to restart the poll service with the rotated Edge key")
+
+		return
+	}
+
+	previousPollService := manager.pollService
+	manager.pollService = pollService
+
+	manager.mu.Unlock()
+
+	previousPollService.Close()
+
+	// The poll service is started once the manager is unlocked, the poll in progress uses the manager
+	if previousPollService.isStarted() {
+		pollService.Start()
+	}
+
+	log.Info().Msg("poll service restarted with the rotated Edge key")
+}
+
+// handleKeyRotatedEvent retrieves the Edge key of the cluster member that rotated its key. The key is only used
+// when its signature was created by a public key trusted by this agent, the key API of the members is not signed.
+func (manager *Manager) handleKeyRotatedEvent(payload []byte) {
+	nodeName := string(payload)
+
+	if !manager.IsKeySet() || nodeName == manager.clusterService.GetRuntimeConfiguration().NodeName {
+		return
+	}
+
+	go func() {
+		member := manager.clusterService.GetMemberByNodeName(nodeName)
+		if member == nil {
+			log.Warn().Str("node_name", nodeName).Msg("unable to find the cluster member that rotated its Edge key")
+
+			return
+		}
+
+		memberAddr := fmt.Sprintf("%s:%s", member.IPAddress, member.Port)
+
+		key, signature, publicKey, err := client.NewAPIClient().GetSignedEdgeKey(memberAddr)
+		if err != nil {
+			log.Error().Err(err).Str("node_name", nodeName).Msg("unable to retrieve the rotated Edge key")
+
+			return
+		}
+
+		err = manager.verifyKeySignature(key, signature, publicKey)
+		if err != nil {
+			log.Error().Err(err).Str("node_name", nodeName).Msg("refusing the rotated Edge key")
+
+			return
+		}
+
+		err = manager.rotateKey(key, signature, publicKey)
+		if err != nil {
+			log.Error().Err(err).Str("node_name", nodeName).Msg("unable to rotate the Edge key")
+		}
+	}()
+}
+
+// verifyKeySignature checks that key was signed by a public key trusted by the agent. An agent that is not associated
+// yet would trust the first public key it verifies, the keys are refused until Portainer contacts the agent.
+func (manager *Manager) verifyKeySignature(key, signature, publicKey string) error {
+	if manager.signatureService == nil || !manager.signatureService.IsAssociated() {
+		return errors.New("the agent is not associated with a public key")
+	}
+
+	if signature == "" || publicKey == "" {
+		return errors.New("the key is not signed")
+	}
+
+	valid, err := manager.signatureService.VerifyContentSignature(signature, publicKey, key)
+	if err != nil {
+		return err
+	} else if !valid {
+		return errors.New("invalid key signature")
 	}
 
 	return nil
@@ -70,6 +262,15 @@ func (manager *Manager) GetKey() string {
 	return encodeKey(manager.key)
 }
 
+// GetKeySignature returns the signature of the Edge key associated to the agent and the public key used to create it,
+// they are only known once the key was rotated
+func (manager *Manager) GetKeySignature() (string, string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	return manager.keySignature, manager.keyPublicKey
+}
+
 // IsKeySet returns true if an Edge key is associated to the agent
 func (manager *Manager) IsKeySet() bool {
 	manager.mu.Lock()
@@ -78,9 +279,9 @@ func (manager *Manager) IsKeySet() bool {
 	return manager.key != nil
 }
 
-// PropagateKeyInCluster propagates the Edge key associated to the agent to all the other agents inside the cluster
+// PropagateKeyInCluster propagates the Edge key associated to the agent to all the other agents inside the Swarm cluster
 func (manager *Manager) PropagateKeyInCluster() error {
-	if manager.clusterService == nil {
+	if !keySharedInCluster(manager.clusterService) {
 		return nil
 	}
 
@@ -107,6 +308,9 @@ func (manager *Manager) PropagateKeyInCluster() error {
 
 // parseEdgeKey decodes a base64 encoded key and extract the decoded information from the following
 // format: <portainer_instance_url>|<tunnel_server_addr>|<tunnel_server_fingerprint>|<endpoint_id>
+// A key can specify several servers ordered by priority, the Portainer instance URLs, tunnel server addresses and
+// tunnel server fingerprints are then comma-separated lists. A single tunnel server address or fingerprint is
+// shared by all the servers.
 func ParseEdgeKey(key string) (*edgeKey, error) {
 	decodedKey, err := base64.RawStdEncoding.DecodeString(key)
 	if err != nil {
@@ -124,39 +328,111 @@ func ParseEdgeKey(key string) (*edgeKey, error) {
 		return nil, errors.New("invalid key format")
 	}
 
+	portainerURLs := strings.Split(keyInfo[0], ",")
+	tunnelServerAddrs := strings.Split(keyInfo[1], ",")
+	tunnelServerFingerprints := strings.Split(keyInfo[2], ",")
+
+	for _, values := range [][]string{tunnelServerAddrs, tunnelServerFingerprints} {
+		if len(values) != 1 && len(values) != len(portainerURLs) {
+			return nil, errors.New("invalid key format")
+		}
+	}
+
+	servers := make([]edgeServer, len(portainerURLs))
+	for i, portainerURL := range portainerURLs {
+		servers[i] = edgeServer{
+			PortainerInstanceURL:    portainerURL,
+			TunnelServerAddr:        tunnelServerAddrs[min(i, len(tunnelServerAddrs)-1)],
+			TunnelServerFingerprint: tunnelServerFingerprints[min(i, len(tunnelServerFingerprints)-1)],
+		}
+	}
+
 	edgeKey := &edgeKey{
-		PortainerInstanceURL:    keyInfo[0],
-		TunnelServerAddr:        keyInfo[1],
-		TunnelServerFingerprint: keyInfo[2],
+		PortainerInstanceURL:    servers[0].PortainerInstanceURL,
+		TunnelServerAddr:        servers[0].TunnelServerAddr,
+		TunnelServerFingerprint: servers[0].TunnelServerFingerprint,
 		EndpointID:              portainer.EndpointID(endpointID),
 		Global:                  endpointID == 0,
+		FailoverServers:         servers[1:],
+	}
+
+	return edgeKey, nil
+}
+
+// parseAndCheckEdgeKey parses key and warns when the Portainer instance is not reached over a secure connection
+func parseAndCheckEdgeKey(key string) (*edgeKey, error) {
+	edgeKey, err := ParseEdgeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range edgeKey.servers() {
+		u, err := url.Parse(server.PortainerInstanceURL)
+		if err != nil {
+			return nil, err
+		} else if u.Scheme != "https" {
+			log.Warn().Msg("This agent has been configured using an insecure connection, which can limit functionality. We recommend updating the agent to use a secure connection.")
+
+			break
+		}
 	}
 
 	return edgeKey, nil
 }
 
 func encodeKey(edgeKey *edgeKey) string {
-	keyInfo := fmt.Sprintf("%s|%s|%s|%d", edgeKey.PortainerInstanceURL, edgeKey.TunnelServerAddr, edgeKey.TunnelServerFingerprint, edgeKey.EndpointID)
+	var portainerURLs, tunnelServerAddrs, tunnelServerFingerprints []string
+	for _, server := range edgeKey.servers() {
+		portainerURLs = append(portainerURLs, server.PortainerInstanceURL)
+		tunnelServerAddrs = append(tunnelServerAddrs, server.TunnelServerAddr)
+		tunnelServerFingerprints = append(tunnelServerFingerprints, server.TunnelServerFingerprint)
+	}
+
+	keyInfo := fmt.Sprintf("%s|%s|%s|%d", strings.Join(portainerURLs, ","), strings.Join(tunnelServerAddrs, ","), strings.Join(tunnelServerFingerprints, ","), edgeKey.EndpointID)
 	encodedKey := base64.RawStdEncoding.EncodeToString([]byte(keyInfo))
 
 	return encodedKey
 }
 
+// RetrieveEdgeKey returns the Edge key of the options, the key persisted on the filesystem or the key of the other
+// agents of a Swarm cluster. The key of the options is only replaced by the persisted key once it was rotated.
 func RetrieveEdgeKey(edgeKey string, clusterService agent.ClusterService, dataPath string) (string, error) {
-	if edgeKey != "" {
+	if edgeKey != "" && !isReplacedEdgeKey(dataPath, edgeKey) {
+		// The record left by a rotation of a previous key of the options is obsolete
+		if err := os.Remove(path.Join(dataPath, replacedEdgeKeyFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Err(err).Msg("unable to remove the record of the replaced edge key")
+		}
+
 		log.Info().Msg("edge key loaded from options")
 
 		return edgeKey, nil
 	}
 
+	if edgeKey != "" {
+		rotatedKey, err := retrieveEdgeKeyFromFilesystem(dataPath)
+		if err != nil || rotatedKey == "" {
+			log.Warn().Err(err).Msg("unable to read the rotated edge key persisted on the filesystem, using the edge key of the options")
+
+			return edgeKey, nil
+		}
+
+		log.Info().Msg("the edge key of the options was rotated, using the rotated edge key")
+
+		return rotatedKey, nil
+	}
+
 	var keyRetrievalError error
 
 	edgeKey, keyRetrievalError = retrieveEdgeKeyFromFilesystem(dataPath)
-	if keyRetrievalError != nil {
+	if errors.Is(keyRetrievalError, errEdgeKeyDecryption) && keySharedInCluster(clusterService) {
+		// The key file was copied from another host or is corrupted, the key is retrieved from the cluster and
+		// persisted again once it is associated to the agent
+		log.Warn().Err(keyRetrievalError).Msg("unable to read the edge key persisted on the filesystem, retrieving it from the cluster")
+	} else if keyRetrievalError != nil {
 		return "", keyRetrievalError
 	}
 
-	if edgeKey == "" && clusterService != nil {
+	if edgeKey == "" && keySharedInCluster(clusterService) {
 		edgeKey, keyRetrievalError = retrieveEdgeKeyFromCluster(clusterService)
 		if keyRetrievalError != nil {
 			return "", keyRetrievalError
@@ -183,9 +459,84 @@ func retrieveEdgeKeyFromFilesystem(dataPath string) (string, error) {
 		return "", err
 	}
 
+	// The keys persisted by the previous versions of the agent are not encrypted
+	if !crypto.IsSealed(filesystemKey) {
+		log.Info().Msg("encrypting the edge key persisted on the filesystem")
+
+		if err := persistEdgeKey(dataPath, string(filesystemKey)); err != nil {
+			return "", err
+		}
+
+		log.Info().Msg("edge key loaded from the filesystem")
+
+		return string(filesystemKey), nil
+	}
+
+	hostKey, err := crypto.HostKey(dataPath)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := crypto.Open(hostKey, filesystemKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errEdgeKeyDecryption, err)
+	}
+
 	log.Info().Msg("edge key loaded from the filesystem")
 
-	return string(filesystemKey), nil
+	return string(key), nil
+}
+
+// persistEdgeKey encrypts key with the host key and replaces the key file, the file is only readable by the agent
+func persistEdgeKey(dataPath, key string) error {
+	hostKey, err := crypto.HostKey(dataPath)
+	if err != nil {
+		return err
+	}
+
+	sealedKey, err := crypto.Seal(hostKey, []byte(key))
+	if err != nil {
+		return err
+	}
+
+	// The key file is replaced atomically so that it is never partially written
+	tmpFile := agent.EdgeKeyFile + ".tmp"
+
+	if err := os.Remove(path.Join(dataPath, tmpFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := filesystem.WriteFile(dataPath, tmpFile, sealedKey, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path.Join(dataPath, tmpFile), path.Join(dataPath, agent.EdgeKeyFile))
+}
+
+// persistReplacedEdgeKey records the hash of the Edge key of the options once it is replaced by a rotation
+func persistReplacedEdgeKey(dataPath, key string) error {
+	hash := sha256.Sum256([]byte(key))
+
+	return filesystem.WriteFile(dataPath, replacedEdgeKeyFile, []byte(hex.EncodeToString(hash[:])), 0600)
+}
+
+// isReplacedEdgeKey returns true when the Edge key of the options was replaced by a rotation
+func isReplacedEdgeKey(dataPath, key string) bool {
+	data, err := os.ReadFile(path.Join(dataPath, replacedEdgeKeyFile))
+	if err != nil {
+		return false
+	}
+
+	hash := sha256.Sum256([]byte(key))
+
+	return string(data) == hex.EncodeToString(hash[:])
+}
+
+// keySharedInCluster returns true when the Edge key is shared with the other agents of the cluster, which is only
+// the case on Swarm where the agents form a single Edge environment. The agents of the other clusters are distinct
+// Edge environments, each with its own key.
+func keySharedInCluster(clusterService agent.ClusterService) bool {
+	return clusterService != nil && clusterService.GetRuntimeConfiguration().DockerConfig.EngineType == agent.EngineTypeSwarm
 }
 
 func retrieveEdgeKeyFromCluster(clusterService agent.ClusterService) (string, error) {
@@ -1,10 +1,23 @@
 package edge
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
 	"testing"
 	"time"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/edge/client"
+	"github.com/portainer/agent/internals/mocks"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
 )
 
 func TestKeyDataRace(t *testing.T) {
@@ -22,3 +35,283 @@ func TestKeyDataRace(t *testing.T) {
 	mgr.IsKeySet()
 	time.Sleep(1 * time.Second)
 }
+
+func TestSetKeyEncryptsKeyFile(t *testing.T) {
+	dataPath := t.TempDir()
+	key := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", TunnelServerAddr: "portainer:8000", EndpointID: 1})
+
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: dataPath}})
+	require.NoError(t, mgr.SetKey(key))
+
+	keyFilePath := path.Join(dataPath, agent.EdgeKeyFile)
+
+	info, err := os.Stat(keyFilePath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(keyFilePath)
+	require.NoError(t, err)
+	require.True(t, crypto.IsSealed(data))
+	require.NotContains(t, string(data), key)
+
+	retrievedKey, err := RetrieveEdgeKey("", nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, key, retrievedKey)
+}
+
+func TestRetrieveUnencryptedEdgeKey(t *testing.T) {
+	dataPath := t.TempDir()
+	key := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+
+	keyFilePath := path.Join(dataPath, agent.EdgeKeyFile)
+	require.NoError(t, os.WriteFile(keyFilePath, []byte(key), 0644))
+
+	retrievedKey, err := RetrieveEdgeKey("", nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, key, retrievedKey)
+
+	// The key file is encrypted once it was read
+	info, err := os.Stat(keyFilePath)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	data, err := os.ReadFile(keyFilePath)
+	require.NoError(t, err)
+	require.True(t, crypto.IsSealed(data))
+
+	retrievedKey, err = RetrieveEdgeKey("", nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, key, retrievedKey)
+}
+
+func TestRotateKey(t *testing.T) {
+	dataPath := t.TempDir()
+	currentKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+	newKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", EndpointID: 1})
+
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: dataPath}})
+
+	// A key must be associated to the agent before it can be rotated
+	require.Error(t, mgr.RotateKey(newKey, "signature", "public-key"))
+
+	require.NoError(t, mgr.SetKey(currentKey))
+	require.Error(t, mgr.RotateKey("invalid", "signature", "public-key"))
+	require.Equal(t, currentKey, mgr.GetKey())
+
+	require.NoError(t, mgr.RotateKey(newKey, "signature", "public-key"))
+	require.Equal(t, newKey, mgr.GetKey())
+
+	retrievedKey, err := RetrieveEdgeKey("", nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, newKey, retrievedKey)
+}
+
+func TestRotatedKeyKeptAfterRestart(t *testing.T) {
+	dataPath := t.TempDir()
+	optionsKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+	newKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", EndpointID: 1})
+
+	retrievedKey, err := RetrieveEdgeKey(optionsKey, nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, optionsKey, retrievedKey)
+
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: dataPath, EdgeKey: optionsKey}})
+	require.NoError(t, mgr.SetKey(retrievedKey))
+	require.NoError(t, mgr.RotateKey(newKey, "signature", "public-key"))
+
+	// The agent restarts with the same key in its options
+	retrievedKey, err = RetrieveEdgeKey(optionsKey, nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, newKey, retrievedKey)
+
+	mgr = NewManager(&ManagerParameters{Options: &agent.Options{DataPath: dataPath, EdgeKey: optionsKey}})
+	require.NoError(t, mgr.SetKey(retrievedKey))
+
+	retrievedKey, err = RetrieveEdgeKey(optionsKey, nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, newKey, retrievedKey)
+
+	// A different key in the options replaces the rotated key
+	otherKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://other:9443", EndpointID: 2})
+
+	retrievedKey, err = RetrieveEdgeKey(otherKey, nil, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, otherKey, retrievedKey)
+}
+
+func TestRotateKeyRestartsPollService(t *testing.T) {
+	for _, started := range []bool{true, false} {
+		ctrl := gomock.NewController(t)
+
+		currentKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+		newKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", EndpointID: 1})
+
+		mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: t.TempDir(), EdgeInactivityTimeout: "1h"}})
+		require.NoError(t, mgr.SetKey(currentKey))
+
+		// The calls of the Edge components must reach the Portainer instance of the new key once it is rotated
+		mgr.portainerClient = client.NewSwitchableClient(mocks.NewMockPortainerClient(ctrl))
+
+		pollService, err := mgr.newPollService(*mgr.key)
+		require.NoError(t, err)
+
+		mgr.pollService = pollService
+		if started {
+			pollService.Start()
+		}
+
+		require.NoError(t, mgr.RotateKey(newKey, "signature", "public-key"))
+		mgr.portainerClient.SetTimeout(time.Second)
+
+		require.Eventually(t, func() bool {
+			return mgr.getPollService() != pollService
+		}, 2*keyRotationRestartDelay, 50*time.Millisecond)
+
+		restartedPollService := mgr.getPollService()
+		restartedPollService.Close()
+
+		select {
+		case <-pollService.closeSignal:
+		default:
+			t.Fatal("the previous poll service was not closed")
+		}
+
+		require.Equal(t, started, restartedPollService.isStarted())
+		require.Equal(t, []edgeServer{{PortainerInstanceURL: "https://portainer.example.com"}}, restartedPollService.failover.servers)
+	}
+}
+
+// newKeyServer returns the address of an agent API serving key along with its signature
+func newKeyServer(t *testing.T, key, signature string) (string, string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"key": key, "signature": signature, "publicKey": "public-key"})
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	return host, port
+}
+
+func TestHandleKeyRotatedEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	currentKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+	newKey := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer.example.com", EndpointID: 1})
+
+	host, port := newKeyServer(t, newKey, "valid")
+	unsignedHost, unsignedPort := newKeyServer(t, newKey, "")
+	forgedHost, forgedPort := newKeyServer(t, newKey, "forged")
+
+	clusterService := mocks.NewMockClusterService(ctrl)
+	clusterService.EXPECT().GetRuntimeConfiguration().Return(&agent.RuntimeConfig{
+		NodeName:     "node1",
+		DockerConfig: agent.DockerRuntimeConfig{EngineType: agent.EngineTypeSwarm},
+	}).AnyTimes()
+	clusterService.EXPECT().UpdateRuntimeConfiguration(gomock.Any()).Return(nil)
+	clusterService.EXPECT().SubscribeEvents(agent.ClusterEventEdgeKeyRotated, gomock.Any())
+
+	signatureService := mocks.NewMockDigitalSignatureService(ctrl)
+	signatureService.EXPECT().IsAssociated().Return(true).AnyTimes()
+
+	mgr := NewManager(&ManagerParameters{Options: &agent.Options{DataPath: t.TempDir()}, ClusterService: clusterService, SignatureService: signatureService})
+	require.NoError(t, mgr.SetKey(currentKey))
+
+	// The events of the agent are ignored
+	mgr.handleKeyRotatedEvent([]byte("node1"))
+
+	// The keys that are not signed by a trusted public key are refused
+	verified := make(chan struct{})
+
+	clusterService.EXPECT().GetMemberByNodeName("unsigned").Return(&agent.ClusterMember{IPAddress: unsignedHost, Port: unsignedPort, NodeName: "unsigned"})
+	clusterService.EXPECT().GetMemberByNodeName("forged").Return(&agent.ClusterMember{IPAddress: forgedHost, Port: forgedPort, NodeName: "forged"})
+	signatureService.EXPECT().VerifyContentSignature("forged", "public-key", newKey).DoAndReturn(func(signature, key, content string) (bool, error) {
+		close(verified)
+
+		return false, nil
+	})
+
+	mgr.handleKeyRotatedEvent([]byte("unsigned"))
+	mgr.handleKeyRotatedEvent([]byte("forged"))
+
+	select {
+	case <-verified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the signature of the forged key was not verified")
+	}
+
+	require.Never(t, func() bool {
+		return mgr.GetKey() != currentKey
+	}, 500*time.Millisecond, 50*time.Millisecond)
+
+	clusterService.EXPECT().GetMemberByNodeName("node2").Return(&agent.ClusterMember{IPAddress: host, Port: port, NodeName: "node2"})
+	signatureService.EXPECT().VerifyContentSignature("valid", "public-key", newKey).Return(true, nil)
+	mgr.handleKeyRotatedEvent([]byte("node2"))
+
+	require.Eventually(t, func() bool {
+		return mgr.GetKey() == newKey
+	}, 5*time.Second, 50*time.Millisecond)
+
+	signature, publicKey := mgr.GetKeySignature()
+	require.Equal(t, "valid", signature)
+	require.Equal(t, "public-key", publicKey)
+}
+
+func TestRetrieveUndecryptableEdgeKeyFromCluster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	dataPath := t.TempDir()
+	key := encodeKey(&edgeKey{PortainerInstanceURL: "https://portainer:9443", EndpointID: 1})
+
+	// The key file was encrypted on another host
+	otherHostKey := make([]byte, 32)
+	sealedKey, err := crypto.Seal(otherHostKey, []byte(key))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path.Join(dataPath, agent.EdgeKeyFile), sealedKey, 0600))
+
+	_, err = RetrieveEdgeKey("", nil, dataPath)
+	require.ErrorIs(t, err, errEdgeKeyDecryption)
+
+	host, port := newKeyServer(t, key, "")
+
+	clusterService := mocks.NewMockClusterService(ctrl)
+	clusterService.EXPECT().GetRuntimeConfiguration().Return(&agent.RuntimeConfig{
+		DockerConfig: agent.DockerRuntimeConfig{EngineType: agent.EngineTypeSwarm},
+	}).AnyTimes()
+	clusterService.EXPECT().GetMemberWithEdgeKeySet().Return(&agent.ClusterMember{IPAddress: host, Port: port})
+
+	retrievedKey, err := RetrieveEdgeKey("", clusterService, dataPath)
+	require.NoError(t, err)
+	require.Equal(t, key, retrievedKey)
+}
+
+func TestParseEdgeKeyWithFailoverServers(t *testing.T) {
+	key := base64.RawStdEncoding.EncodeToString([]byte("https://primary:9443,https://secondary:9443|primary:8000,secondary:8000|fingerprint|0"))
+
+	edgeKey, err := ParseEdgeKey(key)
+	require.NoError(t, err)
+	require.True(t, edgeKey.Global)
+	require.Equal(t, []edgeServer{
+		{PortainerInstanceURL: "https://primary:9443", TunnelServerAddr: "primary:8000", TunnelServerFingerprint: "fingerprint"},
+		{PortainerInstanceURL: "https://secondary:9443", TunnelServerAddr: "secondary:8000", TunnelServerFingerprint: "fingerprint"},
+	}, edgeKey.servers())
+
+	decodedKey, err := ParseEdgeKey(encodeKey(edgeKey))
+	require.NoError(t, err)
+	require.Equal(t, edgeKey, decodedKey)
+
+	// A single server key is encoded as before
+	singleServerKey := base64.RawStdEncoding.EncodeToString([]byte("https://primary:9443|primary:8000|fingerprint|1"))
+
+	edgeKey, err = ParseEdgeKey(singleServerKey)
+	require.NoError(t, err)
+	require.Empty(t, edgeKey.FailoverServers)
+	require.Equal(t, singleServerKey, encodeKey(edgeKey))
+
+	// The tunnel servers must be shared or specified for each server
+	invalidKey := base64.RawStdEncoding.EncodeToString([]byte("https://a,https://b,https://c|a:8000,b:8000|fingerprint|1"))
+
+	_, err = ParseEdgeKey(invalidKey)
+	require.Error(t, err)
+}
@@ -6,12 +6,13 @@ import (
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/chisel"
 	"github.com/portainer/agent/edge/client"
-	"github.com/portainer/agent/edge/scheduler"
 	"github.com/portainer/agent/edge/stack"
 	"github.com/portainer/portainer/pkg/libcrypto"
 
@@ -37,11 +38,12 @@ type PollService struct {
 	updateLastActivitySignal chan struct{}
 	startSignal              chan struct{}
 	stopSignal               chan struct{}
+	closeSignal              chan struct{}
+	closeOnce                sync.Once
+	started                  atomic.Bool
 	edgeManager              *Manager
 	edgeStackManager         *stack.StackManager
-	portainerURL             string
-	tunnelServerAddr         string
-	tunnelServerFingerprint  string
+	failover                 *serverFailover
 	tunnelProxy              string
 
 	// Async mode only
@@ -54,16 +56,16 @@ type PollService struct {
 }
 
 type pollServiceConfig struct {
-	APIServerAddr           string
-	EdgeID                  string
-	InactivityTimeout       string
-	PollFrequency           string
-	TunnelCapability        bool
-	PortainerURL            string
-	TunnelServerAddr        string
-	TunnelServerFingerprint string
-	TunnelProxy             string
-	ContainerPlatform       agent.ContainerPlatform
+	APIServerAddr     string
+	EdgeID            string
+	InactivityTimeout string
+	PollFrequency     string
+	TunnelCapability  bool
+	Servers           []edgeServer
+	FailoverThreshold int
+	FailbackInterval  time.Duration
+	TunnelProxy       string
+	ContainerPlatform agent.ContainerPlatform
 }
 
 // newPollService returns a pointer to a new instance of PollService, and will start two loops in go routines.
@@ -72,7 +74,9 @@ type pollServiceConfig struct {
 // The second loop will check for the last activity of the reverse tunnel and close the tunnel if it exceeds the tunnel
 // inactivity duration.
 // If TunnelCapability is disabled, it will only poll for Edge stacks and schedule without managing reverse tunnels.
-func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager, logsManager *scheduler.LogsManager, config *pollServiceConfig, portainerClient client.PortainerClient, edgeAsyncMode bool) (*PollService, error) {
+// The service fails over to the next server after FailoverThreshold consecutive poll failures.
+// The loops run until the service is closed.
+func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager, scheduleManager agent.Scheduler, config *pollServiceConfig, portainerClient client.PortainerClient, edgeAsyncMode bool) (*PollService, error) {
 	pollFrequency, err := time.ParseDuration(config.PollFrequency)
 	if err != nil {
 		return nil, err
@@ -88,15 +92,14 @@ func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager,
 		edgeID:                   config.EdgeID,
 		pollIntervalInSeconds:    pollFrequency.Seconds(),
 		inactivityTimeout:        inactivityTimeout,
-		scheduleManager:          scheduler.NewCronManager(logsManager),
+		scheduleManager:          scheduleManager,
 		updateLastActivitySignal: make(chan struct{}),
 		startSignal:              make(chan struct{}),
 		stopSignal:               make(chan struct{}),
+		closeSignal:              make(chan struct{}),
 		edgeManager:              edgeManager,
 		edgeStackManager:         edgeStackManager,
-		portainerURL:             config.PortainerURL,
-		tunnelServerAddr:         config.TunnelServerAddr,
-		tunnelServerFingerprint:  config.TunnelServerFingerprint,
+		failover:                 newServerFailover(config.Servers, config.FailoverThreshold, config.FailbackInterval, edgeManager.checkServer),
 		tunnelProxy:              config.TunnelProxy,
 		portainerClient:          portainerClient,
 	}
@@ -119,16 +122,76 @@ func newPollService(edgeManager *Manager, edgeStackManager *stack.StackManager,
 
 func (service *PollService) resetActivityTimer() {
 	if service.tunnelClient != nil && service.tunnelClient.IsTunnelOpen() {
-		service.updateLastActivitySignal <- struct{}{}
+		service.signal(service.updateLastActivitySignal)
 	}
 }
 
 func (service *PollService) Start() {
-	service.startSignal <- struct{}{}
+	service.started.Store(true)
+	service.signal(service.startSignal)
 }
 
 func (service *PollService) Stop() {
-	service.stopSignal <- struct{}{}
+	service.started.Store(false)
+	service.signal(service.stopSignal)
+}
+
+// isStarted returns true when the service was started and not stopped since
+func (service *PollService) isStarted() bool {
+	return service.started.Load()
+}
+
+// Close stops the loops of the service, the reverse tunnel is closed once the poll in progress is over.
+// A closed service cannot be started again.
+func (service *PollService) Close() {
+	service.closeOnce.Do(func() {
+		close(service.closeSignal)
+	})
+}
+
+// signal sends a signal to the loops, it does not block once the service is closed
+func (service *PollService) signal(signal chan struct{}) {
+	select {
+	case signal <- struct{}{}:
+	case <-service.closeSignal:
+	}
+}
+
+// updateServer fails over to the next server after consecutive poll failures and fails back to the primary
+// server once it is healthy again. The reverse tunnel is closed when the server changes, it is created again
+// with the tunnel server of the new server when Portainer requires it.
+func (service *PollService) updateServer(pollErr error) {
+	var changed bool
+	if pollErr != nil {
+		changed = service.failover.pollFailed(time.Now())
+	} else {
+		changed = service.failover.pollSucceeded(time.Now())
+	}
+
+	if !changed {
+		return
+	}
+
+	server := service.failover.server()
+
+	log.Warn().
+		Str("server_url", server.PortainerInstanceURL).
+		Str("tunnel_server_addr", server.TunnelServerAddr).
+		Msg("switching to another Portainer server")
+
+	service.closeTunnel()
+	service.edgeManager.useServer(service, server)
+}
+
+func (service *PollService) closeTunnel() {
+	if service.tunnelClient == nil || !service.tunnelClient.IsTunnelOpen() {
+		return
+	}
+
+	err := service.tunnelClient.CloseTunnel()
+	if err != nil {
+		log.Error().Err(err).Msg("unable to shutdown tunnel")
+	}
 }
 
 func (service *PollService) startStatusPollLoop() {
@@ -136,7 +199,7 @@ func (service *PollService) startStatusPollLoop() {
 
 	log.Debug().
 		Float64("poll_interval_seconds", service.pollIntervalInSeconds).
-		Str("server_url", service.portainerURL).
+		Str("server_url", service.failover.server().PortainerInstanceURL).
 		Msg("starting Portainer short-polling client")
 
 	lastPollFailed := false
@@ -158,18 +221,28 @@ func (service *PollService) startStatusPollLoop() {
 				lastPollFailed = true
 				service.pollTicker.Reset(time.Duration(service.pollIntervalInSeconds) * time.Second)
 			}
+
+			service.updateServer(err)
 		case <-service.startSignal:
 			pollCh = service.pollTicker.C
 		case <-service.stopSignal:
 			log.Debug().Msg("stopping Portainer short-polling client")
 
 			pollCh = nil
+		case <-service.closeSignal:
+			log.Debug().Msg("closing Portainer short-polling client")
+
+			service.pollTicker.Stop()
+			service.closeTunnel()
+
+			return
 		}
 	}
 }
 
 func (service *PollService) startActivityMonitoringLoop() {
 	ticker := time.NewTicker(tunnelActivityCheckInterval)
+	defer ticker.Stop()
 
 	log.Debug().
 		Float64("monitoring_interval_seconds", tunnelActivityCheckInterval.Seconds()).
@@ -201,6 +274,8 @@ func (service *PollService) startActivityMonitoringLoop() {
 			}
 		case <-service.updateLastActivitySignal:
 			service.lastActivity = time.Now()
+		case <-service.closeSignal:
+			return
 		}
 	}
 }
@@ -297,10 +372,12 @@ func (service *PollService) createTunnel(encodedCredentials string, remotePort i
 		return err
 	}
 
+	server := service.failover.server()
+
 	tunnelConfig := agent.TunnelConfig{
 		LocalAddr:         service.apiServerAddr,
-		ServerAddr:        service.tunnelServerAddr,
-		ServerFingerprint: service.tunnelServerFingerprint,
+		ServerAddr:        server.TunnelServerAddr,
+		ServerFingerprint: server.TunnelServerFingerprint,
 		Proxy:             service.tunnelProxy,
 		Credentials:       string(credentials),
 		RemotePort:        strconv.Itoa(remotePort),
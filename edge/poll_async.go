@@ -8,6 +8,7 @@ import (
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/docker/backup"
 	"github.com/portainer/agent/edge/client"
 	portainer "github.com/portainer/portainer/api"
 	"github.com/portainer/portainer/api/edge"
@@ -29,6 +30,7 @@ const (
 	EdgeAsyncCommandTypeImage       EdgeAsyncCommandType = "image"
 	EdgeAsyncCommandTypeVolume      EdgeAsyncCommandType = "volume"
 	EdgeAsyncCommandTypeNormalStack EdgeAsyncCommandType = "normalStack"
+	EdgeAsyncCommandTypeBackup      EdgeAsyncCommandType = "volumeBackup"
 
 	EdgeAsyncCommandOpAdd     EdgeAsyncCommandOperation = "add"
 	EdgeAsyncCommandOpRemove  EdgeAsyncCommandOperation = "remove"
@@ -151,6 +153,8 @@ func (service *PollService) startStatusPollLoopAsync() {
 				log.Error().Err(err).Msg("an error occurred during async poll")
 			}
 
+			service.updateServer(err)
+
 			snapshotFlag, commandFlag, coalescingFlag = false, false, false
 
 			pingCh = service.pingTicker.C
@@ -166,6 +170,16 @@ func (service *PollService) startStatusPollLoopAsync() {
 			log.Debug().Msg("stopping Portainer async-polling client")
 
 			pingCh, snapshotCh, commandCh = nil, nil, nil
+
+		case <-service.closeSignal:
+			log.Debug().Msg("closing Portainer async-polling client")
+
+			coalescingTicker.Stop()
+			service.pingTicker.Stop()
+			service.snapshotTicker.Stop()
+			service.commandTicker.Stop()
+
+			return
 		}
 	}
 }
@@ -235,6 +249,8 @@ func (service *PollService) processAsyncCommands(commands []client.AsyncCommand)
 			err = service.processVolumeCommand(command)
 		case "normalStack":
 			err = service.processNormalStackCommand(ctx, command)
+		case "volumeBackup":
+			err = service.processVolumeBackupCommand(ctx, command)
 		case "edgeConfig":
 			err = service.processEdgeConfigCommand(command)
 		default:
@@ -304,11 +320,13 @@ func (service *PollService) processScheduleCommand(command client.AsyncCommand)
 	}
 
 	schedule := agent.Schedule{
-		ID:             int(jobData.ID),
-		CronExpression: jobData.CronExpression,
-		Script:         jobData.ScriptFileContent,
-		Version:        jobData.Version,
-		CollectLogs:    jobData.CollectLogs,
+		ID:                int(jobData.ID),
+		CronExpression:    jobData.CronExpression,
+		Script:            jobData.ScriptFileContent,
+		Version:           jobData.Version,
+		CollectLogs:       jobData.CollectLogs,
+		Timeout:           jobData.Timeout,
+		ConcurrencyPolicy: jobData.ConcurrencyPolicy,
 	}
 
 	switch command.Operation {
@@ -393,6 +411,44 @@ func (service *PollService) processVolumeCommand(command client.AsyncCommand) er
 	return newOperationError("volume", command.Operation, err)
 }
 
+func (service *PollService) processVolumeBackupCommand(ctx context.Context, command client.AsyncCommand) error {
+	var backupCommand client.VolumeBackupCommandData
+
+	err := mapstructure.Decode(command.Value, &backupCommand)
+	if err != nil {
+		return newOperationError("volumeBackup", "n/a", err)
+	}
+
+	backupService := service.edgeManager.backupService
+	if backupService == nil {
+		return newOperationError("volumeBackup", command.Operation, errors.New("volume backups are not supported on this platform"))
+	}
+
+	switch backupCommand.BackupOperation {
+	case "create":
+		var createdBackup *backup.Backup
+		createdBackup, err = backupService.Create(ctx, backupCommand.VolumeName, backup.CreateOptions{
+			PauseContainers: backupCommand.PauseContainers,
+			Storage:         backupCommand.Storage,
+		})
+		if err == nil {
+			log.Info().Str("volume", createdBackup.VolumeName).Str("backup_id", createdBackup.ID).Msg("volume backup created")
+		}
+	case "restore":
+		err = backupService.Restore(ctx, backupCommand.BackupID, backup.RestoreOptions{
+			VolumeName:      backupCommand.TargetVolumeName,
+			Overwrite:       backupCommand.Overwrite,
+			PauseContainers: backupCommand.PauseContainers,
+		})
+	case "delete":
+		err = backupService.Delete(ctx, backupCommand.BackupID)
+	default:
+		err = errors.New("operation not supported")
+	}
+
+	return newOperationError("volumeBackup", command.Operation, err)
+}
+
 func (service *PollService) processNormalStackCommand(ctx context.Context, command client.AsyncCommand) error {
 	var normalStackCommand client.NormalStackCommandData
 	err := mapstructure.Decode(command.Value, &normalStackCommand)
@@ -0,0 +1,34 @@
+package edge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollServiceClose(t *testing.T) {
+	pollService, err := newPollService(&Manager{}, nil, nil, &pollServiceConfig{
+		PollFrequency:     "1h",
+		InactivityTimeout: "1h",
+		Servers:           []edgeServer{{PortainerInstanceURL: "https://portainer:9443"}},
+	}, nil, false)
+	require.NoError(t, err)
+
+	pollService.Close()
+	pollService.Close()
+
+	done := make(chan struct{})
+	go func() {
+		// The signals do not block once the service is closed
+		pollService.Start()
+		pollService.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the closed poll service blocked its callers")
+	}
+}
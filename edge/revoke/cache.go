@@ -0,0 +1,88 @@
+package revoke
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+func crlCacheFile(url string) string {
+	hash := sha256.Sum256([]byte(url))
+
+	return hex.EncodeToString(hash[:]) + ".crl"
+}
+
+func ocspCacheFile(key string) string {
+	return key + ".ocsp"
+}
+
+// readCache reads a file from the on-disk revocation cache.
+func (service *Service) readCache(name string) ([]byte, bool) {
+	if service.cacheDir == "" {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(service.cacheDir, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Str("file", name).Err(err).Msg("unable to read the revocation cache")
+		}
+
+		return nil, false
+	}
+
+	return data, true
+}
+
+// writeCache persists a file inside the on-disk revocation cache, failures are only logged
+// as the revocation data is still available in memory.
+func (service *Service) writeCache(name string, data []byte) {
+	if service.cacheDir == "" {
+		return
+	}
+
+	err := os.MkdirAll(service.cacheDir, 0700)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to create the revocation cache folder")
+
+		return
+	}
+
+	// Write to a temporary file first so that a crash cannot leave a truncated entry behind
+	path := filepath.Join(service.cacheDir, name)
+
+	err = os.WriteFile(path+".tmp", data, 0600)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+
+	if err != nil {
+		log.Warn().Str("file", name).Err(err).Msg("unable to write the revocation cache")
+	}
+}
+
+// evictExpired keeps the in-memory caches bounded by removing the outdated entries once
+// the maximum number of entries is reached, and an arbitrary entry when none is outdated.
+// The caller must hold the lock of the cache.
+func evictExpired[T any](set map[string]T, needsUpdate func(T) bool) {
+	if len(set) < maxCachedEntries {
+		return
+	}
+
+	for key, entry := range set {
+		if needsUpdate(entry) {
+			delete(set, key)
+		}
+	}
+
+	for key := range set {
+		if len(set) < maxCachedEntries {
+			return
+		}
+
+		delete(set, key)
+	}
+}
@@ -0,0 +1,167 @@
+package revoke
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+// certIsRevokedOCSP checks the revocation status of a cert using OCSP. A valid stapled
+// response is used first, then the cached response and finally the OCSP responders
+// of the certificate are queried. An outdated cached response is still used when
+// the responders cannot be reached.
+func (service *Service) certIsRevokedOCSP(cert, issuer *x509.Certificate, stapledOCSPResponse []byte) (revoked bool, err error) {
+	key := ocspCacheKey(cert, issuer)
+
+	if stapledOCSPResponse != nil {
+		resp, err := ocsp.ParseResponseForCert(stapledOCSPResponse, cert, issuer)
+		if err == nil && !ocspNeedsUpdate(resp) {
+			service.storeOCSPResponse(key, resp)
+
+			return ocspStatus(resp)
+		}
+
+		log.Debug().Err(err).Msg("ignoring invalid or outdated stapled OCSP response")
+	}
+
+	service.ocspLock.Lock()
+	resp, ok := service.ocspSet[key]
+	service.ocspLock.Unlock()
+
+	if !ok {
+		resp, ok = service.loadCachedOCSPResponse(key, cert, issuer)
+	}
+
+	if ok && !ocspNeedsUpdate(resp) {
+		return ocspStatus(resp)
+	}
+
+	fetchedResp, err := service.fetchOCSPResponse(cert, issuer)
+	if err != nil {
+		if !ok {
+			return false, err
+		}
+
+		log.Warn().Err(err).Time("next_update", resp.NextUpdate).Msg("unable to refresh the OCSP response, using the cached one")
+
+		return ocspStatus(resp)
+	}
+
+	service.storeOCSPResponse(key, fetchedResp)
+
+	return ocspStatus(fetchedResp)
+}
+
+// fetchOCSPResponse queries the OCSP responders of the certificate until one of them answers.
+func (service *Service) fetchOCSPResponse(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA1})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the OCSP request")
+	}
+
+	err = errors.New("no OCSP responder available")
+
+	for _, server := range cert.OCSPServer {
+		var resp *ocsp.Response
+
+		resp, err = service.sendOCSPRequest(server, req, cert, issuer)
+		if err != nil {
+			log.Warn().Str("url", server).Err(err).Msg("failed querying the OCSP responder")
+
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, err
+}
+
+func (service *Service) sendOCSPRequest(server string, req []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	resp, err := service.httpClient.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to retrieve the OCSP response, status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ocsp.ParseResponseForCert(body, cert, issuer)
+}
+
+func (service *Service) storeOCSPResponse(key string, resp *ocsp.Response) {
+	service.ocspLock.Lock()
+	evictExpired(service.ocspSet, ocspNeedsUpdate)
+	service.ocspSet[key] = resp
+	service.ocspLock.Unlock()
+
+	service.writeCache(ocspCacheFile(key), resp.Raw)
+}
+
+// loadCachedOCSPResponse loads an OCSP response previously persisted on disk.
+func (service *Service) loadCachedOCSPResponse(key string, cert, issuer *x509.Certificate) (*ocsp.Response, bool) {
+	data, ok := service.readCache(ocspCacheFile(key))
+	if !ok {
+		return nil, false
+	}
+
+	resp, err := ocsp.ParseResponseForCert(data, cert, issuer)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to parse the cached OCSP response")
+
+		return nil, false
+	}
+
+	service.ocspLock.Lock()
+	evictExpired(service.ocspSet, ocspNeedsUpdate)
+	service.ocspSet[key] = resp
+	service.ocspLock.Unlock()
+
+	return resp, true
+}
+
+func ocspStatus(resp *ocsp.Response) (revoked bool, err error) {
+	switch resp.Status {
+	case ocsp.Good:
+		return false, nil
+	case ocsp.Revoked:
+		return true, nil
+	}
+
+	return false, errors.New("unknown OCSP certificate status")
+}
+
+func ocspNeedsUpdate(resp *ocsp.Response) bool {
+	nextUpdate := resp.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = resp.ThisUpdate.Add(defaultOCSPRefreshInterval)
+	}
+
+	return !time.Now().Before(nextUpdate)
+}
+
+// ocspCacheKey identifies a certificate by its issuer and serial number.
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	hash := sha256.New()
+	hash.Write(issuer.RawSubjectPublicKeyInfo)
+	hash.Write(cert.SerialNumber.Bytes())
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
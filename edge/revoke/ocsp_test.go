@@ -0,0 +1,264 @@
+package revoke
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serialNumber int64, crlURL, ocspURL string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: "portainer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+
+	if crlURL != "" {
+		template.CRLDistributionPoints = []string{crlURL}
+	}
+
+	if ocspURL != "" {
+		template.OCSPServer = []string{ocspURL}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func (ca *testCA) crl(t *testing.T, revokedSerialNumbers ...int64) []byte {
+	template := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+
+	for _, serialNumber := range revokedSerialNumbers {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serialNumber),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, template, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return crl
+}
+
+func (ca *testCA) ocspResponse(t *testing.T, cert *x509.Certificate, status int) []byte {
+	resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestOCSPRevoked(t *testing.T) {
+	ca := newTestCA(t)
+
+	var cert *x509.Certificate
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(ca.ocspResponse(t, cert, ocsp.Revoked))
+	}))
+	defer responder.Close()
+
+	cert = ca.issue(t, 2, "", responder.URL)
+
+	service := NewService("", false)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err != nil || !revoked {
+		t.Fatalf("certificate should have been marked as revoked via OCSP: %v", err)
+	}
+}
+
+func TestOCSPStapledResponse(t *testing.T) {
+	ca := newTestCA(t)
+
+	// The responder is unreachable, the stapled response must be used
+	cert := ca.issue(t, 2, "", "http://127.0.0.1:1")
+
+	service := NewService("", true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, ca.ocspResponse(t, cert, ocsp.Good)); err != nil || revoked {
+		t.Fatalf("stapled OCSP response should have been used: %v", err)
+	}
+
+	// A stapled response for another certificate is ignored
+	other := ca.issue(t, 3, "", "http://127.0.0.1:1")
+	if revoked, err := service.VerifyCertificateWithIssuer(other, ca.cert, ca.ocspResponse(t, cert, ocsp.Good)); err == nil || !revoked {
+		t.Fatalf("invalid stapled OCSP response should have caused a hard fail")
+	}
+}
+
+func TestRevocationDataPersistedOnDisk(t *testing.T) {
+	ca := newTestCA(t)
+	cacheDir := t.TempDir()
+
+	var cert *x509.Certificate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/crl" {
+			w.Write(ca.crl(t, 4))
+			return
+		}
+
+		io.Copy(io.Discard, r.Body)
+		w.Write(ca.ocspResponse(t, cert, ocsp.Good))
+	}))
+
+	cert = ca.issue(t, 2, server.URL+"/crl", server.URL+"/ocsp")
+	revokedCert := ca.issue(t, 4, server.URL+"/crl", "")
+
+	service := NewService(cacheDir, true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err != nil || revoked {
+		t.Fatalf("good certificate should not have been marked as revoked: %v", err)
+	}
+
+	server.Close()
+
+	// A new service (i.e. after a restart) works offline using the persisted revocation data
+	service = NewService(cacheDir, true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err != nil || revoked {
+		t.Fatalf("cached revocation data should have been used: %v", err)
+	}
+
+	if revoked, _ := service.VerifyCertificateWithIssuer(revokedCert, ca.cert, nil); !revoked {
+		t.Fatalf("revoked certificate should have been marked as revoked using the cached CRL")
+	}
+
+	// Without any revocation data, the hard fail policy applies
+	service = NewService(t.TempDir(), true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err == nil || !revoked {
+		t.Fatalf("hard fail should have been applied without revocation data")
+	}
+}
+
+func TestCRLNeedsUpdate(t *testing.T) {
+	if !crlNeedsUpdate(&x509.RevocationList{ThisUpdate: time.Now().Add(-2 * defaultCRLRefreshInterval)}) {
+		t.Fatalf("CRL without next update should be refreshed after the default interval")
+	}
+
+	if crlNeedsUpdate(&x509.RevocationList{ThisUpdate: time.Now(), NextUpdate: time.Now().Add(time.Hour)}) {
+		t.Fatalf("CRL should not be refreshed before its next update")
+	}
+}
+
+func TestCRLSignedByAnotherIssuer(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(otherCA.crl(t))
+	}))
+	defer server.Close()
+
+	cert := ca.issue(t, 2, server.URL, "")
+
+	service := NewService("", true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err == nil || !revoked {
+		t.Fatalf("CRL signed by another issuer should have been rejected")
+	}
+}
+
+func TestOCSPUsedWhenCRLUnavailable(t *testing.T) {
+	ca := newTestCA(t)
+
+	var status int
+	var cert *x509.Certificate
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(ca.ocspResponse(t, cert, status))
+	}))
+	defer responder.Close()
+
+	unavailableCRL := httptest.NewServer(http.NotFoundHandler())
+	unavailableCRL.Close()
+
+	cert = ca.issue(t, 2, unavailableCRL.URL+"/crl", responder.URL)
+
+	// The OCSP response is trusted even when the hard fail mode is enabled
+	service := NewService("", true)
+
+	status = ocsp.Good
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err != nil || revoked {
+		t.Fatalf("certificate should have been accepted via OCSP: %v", err)
+	}
+
+	status = ocsp.Revoked
+	service = NewService("", true)
+	if revoked, err := service.VerifyCertificateWithIssuer(cert, ca.cert, nil); err != nil || !revoked {
+		t.Fatalf("certificate should have been marked as revoked via OCSP: %v", err)
+	}
+
+	// Without OCSP responder, the CRL error is reported
+	service = NewService("", true)
+	if revoked, err := service.VerifyCertificateWithIssuer(ca.issue(t, 3, unavailableCRL.URL+"/crl", ""), ca.cert, nil); err == nil || !revoked {
+		t.Fatal("the CRL error should have been reported in hard fail mode")
+	}
+}
@@ -1,13 +1,14 @@
 // Package revoke provides functionality for checking the validity of
 // a cert. Specifically, the temporal validity of the certificate is
 // checked first, then any CRL and OCSP url in the cert is checked.
+// The CRLs and OCSP responses are cached in memory and on disk until
+// their next update so that offline devices keep the revocation data.
 // ported from https://github.com/cloudflare/cfssl/blob/master/revoke/revoke.go
 package revoke
 
 import (
 	"bytes"
 	"crypto/x509"
-	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
 	"io"
@@ -18,10 +19,17 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ocsp"
 )
 
 const (
 	defaultTimeoutInSeconds = 30
+	// defaultCRLRefreshInterval is used to refresh the CRLs that do not specify a next update
+	defaultCRLRefreshInterval = 24 * time.Hour
+	// defaultOCSPRefreshInterval is used to refresh the OCSP responses that do not specify a next update
+	defaultOCSPRefreshInterval = time.Hour
+	// maxCachedEntries is the maximum number of CRLs and OCSP responses kept in memory
+	maxCachedEntries = 128
 )
 
 type Service struct {
@@ -30,25 +38,43 @@ type Service struct {
 	// status of a certificate (i.e. due to network failure) causes
 	// verification to fail (a hard failure).
 	hardFail bool
-	// crlSet associates a PKIX certificate list with the URL the CRL is
+	// cacheDir is the folder where the CRLs and OCSP responses are persisted
+	// so that they survive restarts, nothing is persisted when it is empty.
+	cacheDir string
+	// crlSet associates a certificate revocation list with the URL the CRL is
 	// fetched from.
-	crlSet  map[string]*pkix.CertificateList
+	crlSet  map[string]*x509.RevocationList
 	crlLock sync.Mutex
+	// ocspSet associates an OCSP response with the certificate it was issued for.
+	ocspSet  map[string]*ocsp.Response
+	ocspLock sync.Mutex
 }
 
-func NewService() *Service {
+// NewService returns a pointer to a Service. The revocation data is persisted inside cacheDir
+// when it is not empty, hardFail rejects the certificates whose revocation status cannot be checked.
+func NewService(cacheDir string, hardFail bool) *Service {
 	return &Service{
 		httpClient: &http.Client{
 			Timeout: defaultTimeoutInSeconds * time.Second,
 		},
-		hardFail: false,
-		crlSet:   make(map[string]*pkix.CertificateList),
+		hardFail: hardFail,
+		cacheDir: cacheDir,
+		crlSet:   make(map[string]*x509.RevocationList),
+		ocspSet:  make(map[string]*ocsp.Response),
 	}
 }
 
 // VerifyCertificate ensures that the certificate passed in hasn't
-// expired and checks the CRL for the server.
+// expired and checks the CRL and OCSP responders for the server.
 func (service *Service) VerifyCertificate(cert *x509.Certificate) (revoked bool, err error) {
+	return service.VerifyCertificateWithIssuer(cert, nil, nil)
+}
+
+// VerifyCertificateWithIssuer ensures that the certificate passed in hasn't expired and
+// checks its revocation status. The issuer is used to verify the CRLs and OCSP responses,
+// it is fetched from the certificate issuing URL when nil. A stapled OCSP response received
+// during the TLS handshake is used instead of querying the OCSP responder when it is valid.
+func (service *Service) VerifyCertificateWithIssuer(cert, issuer *x509.Certificate, stapledOCSPResponse []byte) (revoked bool, err error) {
 	// certificate expired
 	if !time.Now().Before(cert.NotAfter) {
 		log.Info().Time("not_after", cert.NotAfter).Msg("certificate expired")
@@ -63,11 +89,14 @@ func (service *Service) VerifyCertificate(cert *x509.Certificate) (revoked bool,
 		return true, fmt.Errorf("certificate isn't valid until %s", cert.NotBefore)
 	}
 
-	return service.revCheck(cert)
+	return service.revCheck(cert, issuer, stapledOCSPResponse)
 }
 
-// revCheck should check the certificate for any revocations.
-func (service *Service) revCheck(cert *x509.Certificate) (revoked bool, err error) {
+// revCheck should check the certificate for any revocations. The certificate is checked against its CRLs and
+// its OCSP responder, a valid OCSP response is enough to accept the certificate when a CRL cannot be retrieved.
+func (service *Service) revCheck(cert, issuer *x509.Certificate, stapledOCSPResponse []byte) (revoked bool, err error) {
+	var crlErr error
+
 	for _, url := range cert.CRLDistributionPoints {
 		if ldapURL(url) {
 			log.Info().Str("url", url).Msg("skipping LDAP CRL")
@@ -75,21 +104,57 @@ func (service *Service) revCheck(cert *x509.Certificate) (revoked bool, err erro
 			continue
 		}
 
-		revoked, err := service.certIsRevokedCRL(cert, url)
+		revoked, err := service.certIsRevokedCRL(cert, issuer, url)
 		if err != nil {
-			log.Warn().Msg("error checking revocation via CRL")
+			log.Warn().Err(err).Str("url", url).Msg("error checking revocation via CRL")
+
+			crlErr = err
 
-			return service.hardFail, err
+			continue
 		}
 
 		if revoked {
 			log.Info().Msg("certificate is revoked via CRL")
 
-			return true, err
+			return true, nil
 		}
 	}
 
-	return false, nil
+	if len(cert.OCSPServer) == 0 && stapledOCSPResponse == nil {
+		if crlErr != nil {
+			return service.hardFail, crlErr
+		}
+
+		return false, nil
+	}
+
+	if issuer == nil {
+		issuer = service.getIssuer(cert)
+		if issuer == nil {
+			log.Warn().Msg("unable to retrieve the certificate issuer, skipping OCSP")
+
+			if crlErr != nil {
+				return service.hardFail, crlErr
+			}
+
+			return service.hardFail, errors.New("unable to retrieve the certificate issuer to check the OCSP status")
+		}
+	}
+
+	revoked, err = service.certIsRevokedOCSP(cert, issuer, stapledOCSPResponse)
+	if err != nil {
+		log.Warn().Err(err).Msg("error checking revocation via OCSP")
+
+		return service.hardFail, err
+	}
+
+	if revoked {
+		log.Info().Msg("certificate is revoked via OCSP")
+	} else if crlErr != nil {
+		log.Info().Msg("the certificate status was confirmed via OCSP as the CRL could not be checked")
+	}
+
+	return revoked, nil
 }
 
 // We can't handle LDAP certificates, so this checks to see if the
@@ -106,8 +171,9 @@ func ldapURL(url string) bool {
 }
 
 // certIsRevokedCRL checks a cert against a specific CRL. Returns the same bool pair
-// as revCheck, plus an error if one occurred.
-func (service *Service) certIsRevokedCRL(cert *x509.Certificate, url string) (revoked bool, err error) {
+// as revCheck, plus an error if one occurred. The cached CRL is refreshed once its next
+// update is reached and is still used when the refresh fails.
+func (service *Service) certIsRevokedCRL(cert, issuer *x509.Certificate, url string) (revoked bool, err error) {
 	service.crlLock.Lock()
 	crl, ok := service.crlSet[url]
 	if ok && crl == nil {
@@ -116,40 +182,31 @@ func (service *Service) certIsRevokedCRL(cert *x509.Certificate, url string) (re
 	}
 	service.crlLock.Unlock()
 
-	var shouldFetchCRL = true
-	if ok {
-		if !crl.HasExpired(time.Now()) {
-			shouldFetchCRL = false
-		}
+	if !ok {
+		crl, ok = service.loadCachedCRL(url)
 	}
 
-	issuer := service.getIssuer(cert)
-
-	if shouldFetchCRL {
-		var err error
-		crl, err = service.fetchCRL(url)
+	if !ok || crlNeedsUpdate(crl) {
+		fetchedCRL, err := service.fetchVerifiedCRL(cert, issuer, url)
 		if err != nil {
-			log.Warn().Str("url", url).Err(err).Msg("failed fetching CRL")
+			if !ok {
+				return false, err
+			}
 
-			return false, err
-		}
+			log.Warn().Str("url", url).Time("next_update", crl.NextUpdate).Msg("unable to refresh the CRL, using the cached one")
+		} else {
+			crl = fetchedCRL
 
-		// check CRL signature
-		if issuer != nil {
-			err = issuer.CheckCRLSignature(crl)
-			if err != nil {
-				log.Warn().Str("url", url).Err(err).Msg("failed verifying CRL")
+			service.crlLock.Lock()
+			evictExpired(service.crlSet, crlNeedsUpdate)
+			service.crlSet[url] = crl
+			service.crlLock.Unlock()
 
-				return false, err
-			}
+			service.writeCache(crlCacheFile(url), crl.Raw)
 		}
-
-		service.crlLock.Lock()
-		service.crlSet[url] = crl
-		service.crlLock.Unlock()
 	}
 
-	for _, revoked := range crl.TBSCertList.RevokedCertificates {
+	for _, revoked := range crl.RevokedCertificateEntries {
 		if cert.SerialNumber.Cmp(revoked.SerialNumber) == 0 {
 			return true, nil
 		}
@@ -158,8 +215,66 @@ func (service *Service) certIsRevokedCRL(cert *x509.Certificate, url string) (re
 	return false, nil
 }
 
+// fetchVerifiedCRL fetches a CRL and checks its signature when the issuer of the certificate is known
+// or can be retrieved.
+func (service *Service) fetchVerifiedCRL(cert, issuer *x509.Certificate, url string) (*x509.RevocationList, error) {
+	crl, err := service.fetchCRL(url)
+	if err != nil {
+		log.Warn().Str("url", url).Err(err).Msg("failed fetching CRL")
+
+		return nil, err
+	}
+
+	// check CRL signature
+	if issuer == nil {
+		issuer = service.getIssuer(cert)
+	}
+
+	if issuer != nil {
+		err = crl.CheckSignatureFrom(issuer)
+		if err != nil {
+			log.Warn().Str("url", url).Err(err).Msg("failed verifying CRL")
+
+			return nil, err
+		}
+	}
+
+	return crl, nil
+}
+
+// loadCachedCRL loads a CRL previously persisted on disk.
+func (service *Service) loadCachedCRL(url string) (*x509.RevocationList, bool) {
+	data, ok := service.readCache(crlCacheFile(url))
+	if !ok {
+		return nil, false
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		log.Warn().Str("url", url).Err(err).Msg("unable to parse the cached CRL")
+
+		return nil, false
+	}
+
+	service.crlLock.Lock()
+	evictExpired(service.crlSet, crlNeedsUpdate)
+	service.crlSet[url] = crl
+	service.crlLock.Unlock()
+
+	return crl, true
+}
+
+func crlNeedsUpdate(crl *x509.RevocationList) bool {
+	nextUpdate := crl.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = crl.ThisUpdate.Add(defaultCRLRefreshInterval)
+	}
+
+	return !time.Now().Before(nextUpdate)
+}
+
 // fetchCRL fetches and parses a CRL.
-func (service *Service) fetchCRL(url string) (*pkix.CertificateList, error) {
+func (service *Service) fetchCRL(url string) (*x509.RevocationList, error) {
 	resp, err := service.httpClient.Get(url)
 	if err != nil {
 		return nil, err
@@ -176,7 +291,12 @@ func (service *Service) fetchCRL(url string) (*pkix.CertificateList, error) {
 		return nil, err
 	}
 
-	return x509.ParseCRL(body)
+	// CRLs are usually DER encoded but some distribution points serve them PEM encoded
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+
+	return x509.ParseRevocationList(body)
 }
 
 func (service *Service) getIssuer(cert *x509.Certificate) *x509.Certificate {
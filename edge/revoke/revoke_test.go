@@ -133,7 +133,7 @@ func mustParse(pemData string) *x509.Certificate {
 }
 
 func setup() *Service {
-	return NewService()
+	return NewService("", false)
 }
 
 func TestRevoked(t *testing.T) {
@@ -211,7 +211,7 @@ func TestBadCRLSet(t *testing.T) {
 	ldapCert.CRLDistributionPoints[0] = ""
 
 	service.crlSet[""] = nil
-	service.certIsRevokedCRL(ldapCert, "")
+	service.certIsRevokedCRL(ldapCert, nil, "")
 	if _, ok := service.crlSet[""]; ok {
 		t.Fatalf("key emptystring should be deleted from CRLSet")
 	}
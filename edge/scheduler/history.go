@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// JobsDirectory is the folder inside the agent data folder where the history of the edge job runs is stored
+	JobsDirectory = "edge_jobs"
+	// maxRunsPerJob is the number of runs kept in the history of each edge job
+	maxRunsPerJob = 10
+)
+
+// Status of an edge job run
+const (
+	RunStatusRunning  = "running"
+	RunStatusSuccess  = "success"
+	RunStatusFailed   = "failed"
+	RunStatusTimeout  = "timeout"
+	RunStatusCanceled = "canceled"
+)
+
+// JobRun contains the details of a run of an edge job executed by the agent scheduler
+type JobRun struct {
+	ID      string `json:"ID"`
+	JobID   int    `json:"JobID"`
+	Version int    `json:"Version"`
+	Status  string `json:"Status"`
+	// ExitCode is the exit code of the script, only meaningful when the script ended by itself
+	ExitCode  int   `json:"ExitCode"`
+	StartedAt int64 `json:"StartedAt"`
+	EndedAt   int64 `json:"EndedAt"`
+	// Duration is the duration of the run in milliseconds
+	Duration int64 `json:"Duration"`
+	// Error is set when the script could not be run
+	Error string `json:"Error,omitempty"`
+
+	started time.Time
+}
+
+// jobHistory stores the details and the logs of the edge job runs inside the agent data folder,
+// each run is stored as a JSON file along with a log file inside the folder of its job
+type jobHistory struct {
+	directory string
+	mu        sync.Mutex
+}
+
+func newJobHistory(dataPath string) *jobHistory {
+	return &jobHistory{
+		directory: filepath.Join(dataPath, JobsDirectory),
+	}
+}
+
+// start records the start of a run and returns the file where the output of the run must be written
+func (history *jobHistory) start(jobID, version int) (*JobRun, *os.File, error) {
+	err := os.MkdirAll(history.jobDirectory(jobID), 0700)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startedAt := time.Now()
+
+	run := &JobRun{
+		// The identifiers are sorted by start time
+		ID:        strconv.FormatInt(startedAt.UnixNano(), 10),
+		JobID:     jobID,
+		Version:   version,
+		Status:    RunStatusRunning,
+		StartedAt: startedAt.Unix(),
+		started:   startedAt,
+	}
+
+	logFile, err := os.OpenFile(history.logPath(jobID, run.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = history.save(run)
+	if err != nil {
+		logFile.Close()
+		return nil, nil, err
+	}
+
+	return run, logFile, nil
+}
+
+// finish records the end of a run and removes the oldest runs of the job
+func (history *jobHistory) finish(run *JobRun) error {
+	run.EndedAt = time.Now().Unix()
+	run.Duration = time.Since(run.started).Milliseconds()
+
+	err := history.save(run)
+	if err != nil {
+		return err
+	}
+
+	runs, err := history.runs(run.JobID)
+	if err != nil {
+		return err
+	}
+
+	for len(runs) > maxRunsPerJob {
+		os.Remove(history.logPath(run.JobID, runs[0].ID))
+		os.Remove(history.runPath(run.JobID, runs[0].ID))
+
+		runs = runs[1:]
+	}
+
+	return nil
+}
+
+// runs returns the runs of a job, the oldest first
+func (history *jobHistory) runs(jobID int) ([]JobRun, error) {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(history.jobDirectory(jobID), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]JobRun, 0, len(files))
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		var run JobRun
+		if err := json.Unmarshal(data, &run); err != nil {
+			continue
+		}
+
+		runs = append(runs, run)
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+
+	return runs, nil
+}
+
+// logs returns the logs of the runs of a job, the oldest first, each run being preceded by a summary
+func (history *jobHistory) logs(jobID int) ([]byte, error) {
+	runs, err := history.runs(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs bytes.Buffer
+
+	for _, run := range runs {
+		fmt.Fprintf(&logs, "=== run %s started at %s: %s", run.ID, time.Unix(run.StartedAt, 0).UTC().Format(time.RFC3339), run.Status)
+
+		switch run.Status {
+		case RunStatusRunning:
+		case RunStatusSuccess, RunStatusFailed:
+			fmt.Fprintf(&logs, " (exit code %d, %s)", run.ExitCode, time.Duration(run.Duration)*time.Millisecond)
+		default:
+			fmt.Fprintf(&logs, " (%s)", time.Duration(run.Duration)*time.Millisecond)
+		}
+
+		if run.Error != "" {
+			fmt.Fprintf(&logs, ": %s", run.Error)
+		}
+
+		logs.WriteString(" ===\n")
+
+		content, err := os.ReadFile(history.logPath(jobID, run.ID))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		logs.Write(content)
+
+		if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+			logs.WriteString("\n")
+		}
+	}
+
+	return logs.Bytes(), nil
+}
+
+// remove removes the history of a job
+func (history *jobHistory) remove(jobID int) error {
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	return os.RemoveAll(history.jobDirectory(jobID))
+}
+
+func (history *jobHistory) save(run *JobRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	history.mu.Lock()
+	defer history.mu.Unlock()
+
+	return os.WriteFile(history.runPath(run.JobID, run.ID), data, 0600)
+}
+
+func (history *jobHistory) jobDirectory(jobID int) string {
+	return filepath.Join(history.directory, strconv.Itoa(jobID))
+}
+
+func (history *jobHistory) runPath(jobID int, runID string) string {
+	return filepath.Join(history.jobDirectory(jobID), runID+".json")
+}
+
+func (history *jobHistory) logPath(jobID int, runID string) string {
+	return filepath.Join(history.jobDirectory(jobID), runID+".log")
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobHistoryKeepsLastRuns(t *testing.T) {
+	history := newJobHistory(t.TempDir())
+
+	for i := 0; i < maxRunsPerJob+3; i++ {
+		run, logFile, err := history.start(1, 2)
+		require.NoError(t, err)
+
+		_, err = logFile.WriteString("output\n")
+		require.NoError(t, err)
+		require.NoError(t, logFile.Close())
+
+		run.Status = RunStatusSuccess
+		require.NoError(t, history.finish(run))
+	}
+
+	runs, err := history.runs(1)
+	require.NoError(t, err)
+	require.Len(t, runs, maxRunsPerJob)
+
+	for i, run := range runs {
+		require.Equal(t, 1, run.JobID)
+		require.Equal(t, 2, run.Version)
+		require.Equal(t, RunStatusSuccess, run.Status)
+
+		if i > 0 {
+			require.Less(t, runs[i-1].ID, run.ID)
+		}
+	}
+
+	logs, err := history.logs(1)
+	require.NoError(t, err)
+	require.Equal(t, maxRunsPerJob, strings.Count(string(logs), "=== run "))
+	require.Equal(t, maxRunsPerJob, strings.Count(string(logs), "output\n"))
+
+	require.NoError(t, history.remove(1))
+
+	runs, err = history.runs(1)
+	require.NoError(t, err)
+	require.Empty(t, runs)
+}
+
+func TestJobHistoryLogsFailedRun(t *testing.T) {
+	history := newJobHistory(t.TempDir())
+
+	run, logFile, err := history.start(3, 1)
+	require.NoError(t, err)
+
+	_, err = logFile.WriteString("no newline")
+	require.NoError(t, err)
+	require.NoError(t, logFile.Close())
+
+	run.Status = RunStatusFailed
+	run.ExitCode = 127
+	require.NoError(t, history.finish(run))
+
+	logs, err := history.logs(3)
+	require.NoError(t, err)
+	require.Contains(t, string(logs), ": failed (exit code 127, ")
+	require.True(t, strings.HasSuffix(string(logs), "no newline\n"))
+
+	logs, err = history.logs(4)
+	require.NoError(t, err)
+	require.Empty(t, logs)
+}
@@ -0,0 +1,410 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	jobPath = "/usr/local/sbin:/usr/local/bin:/sbin:/bin:/usr/sbin:/usr/bin"
+	// jobWaitDelay is the time given to the processes of a stopped run to release its output before the run ends
+	jobWaitDelay = 5 * time.Second
+	// agentSchedulerSupported is true when the agent scheduler can run the scripts on the host
+	agentSchedulerSupported = true
+)
+
+// JobScheduler is a service that runs the schedules inside the agent, without relying on the cron of the host.
+// The scripts are run inside the namespaces of the host with nsenter when the agent shares the PID namespace
+// of the host, inside a chroot of the host filesystem otherwise.
+// The details and the logs of the last runs of each schedule are kept inside the agent data folder.
+type JobScheduler struct {
+	logsManager *LogsManager
+	history     *jobHistory
+	cron        *cron.Cron
+	jobs        map[int]*scheduledJob
+	useNsenter  bool
+	mu          sync.Mutex
+}
+
+// scheduledJob is a schedule registered in the cron of the JobScheduler
+type scheduledJob struct {
+	schedule  agent.Schedule
+	entryID   cron.EntryID
+	scheduler *JobScheduler
+	running   bool
+	queued    bool
+	removed   bool
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+}
+
+// NewJobScheduler returns a pointer to a new instance of JobScheduler and starts its cron.
+func NewJobScheduler(logsManager *LogsManager, dataPath string) *JobScheduler {
+	scheduler := &JobScheduler{
+		logsManager: logsManager,
+		history:     newJobHistory(dataPath),
+		cron:        cron.New(),
+		jobs:        make(map[int]*scheduledJob),
+		useNsenter:  canUseNsenter(),
+	}
+
+	logsManager.setLogSource(scheduler.history.logs)
+
+	log.Info().Bool("nsenter", scheduler.useNsenter).Msg("starting the agent scheduler for the Edge jobs")
+
+	// The cron file written by the cron scheduler would keep running the jobs alongside the agent scheduler
+	err := filesystem.RemoveFile(fmt.Sprintf("%s%s/%s", agent.HostRoot, cronDirectory, cronFile))
+	if err == nil {
+		log.Info().Msg("removed the cron file of the Edge jobs scheduled by the cron scheduler")
+	} else if !os.IsNotExist(err) {
+		log.Warn().Err(err).Msg("unable to remove the cron file of the Edge jobs scheduled by the cron scheduler")
+	}
+
+	scheduler.cron.Start()
+
+	return scheduler
+}
+
+// Schedule registers the schedules that are new or have a new version and unregisters the schedules
+// that are not part of the list anymore.
+func (scheduler *JobScheduler) Schedule(schedules []agent.Schedule) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	schedulesMap := map[int]agent.Schedule{}
+	for _, schedule := range schedules {
+		schedulesMap[schedule.ID] = schedule
+	}
+
+	for id := range scheduler.jobs {
+		if _, exists := schedulesMap[id]; !exists {
+			log.Debug().Int("schedule_id", id).Msg("removing schedule")
+
+			scheduler.removeJob(id, true)
+		}
+	}
+
+	var errs []error
+	collectLogs := false
+
+	for _, schedule := range schedules {
+		job, exists := scheduler.jobs[schedule.ID]
+		if exists && job.schedule.Version == schedule.Version {
+			job.schedule.CollectLogs = schedule.CollectLogs
+		} else {
+			log.Debug().
+				Int("schedule_id", schedule.ID).
+				Int("version", schedule.Version).
+				Msg("found a new schedule or a schedule with new version")
+
+			if exists {
+				scheduler.removeJob(schedule.ID, false)
+			}
+
+			if err := scheduler.addJob(schedule); err != nil {
+				log.Error().Int("schedule_id", schedule.ID).Err(err).Msg("unable to schedule the job")
+
+				errs = append(errs, err)
+
+				continue
+			}
+		}
+
+		if schedule.CollectLogs {
+			log.Debug().
+				Int("schedule_id", schedule.ID).
+				Int("version", schedule.Version).
+				Msg("found schedule with logs to collect")
+
+			collectLogs = true
+		}
+	}
+
+	if collectLogs {
+		scheduler.processScheduleLogsCollection()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (scheduler *JobScheduler) AddSchedule(schedule agent.Schedule) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	if _, exists := scheduler.jobs[schedule.ID]; exists {
+		scheduler.removeJob(schedule.ID, false)
+	}
+
+	return scheduler.addJob(schedule)
+}
+
+func (scheduler *JobScheduler) RemoveSchedule(schedule agent.Schedule) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	scheduler.removeJob(schedule.ID, true)
+
+	return nil
+}
+
+func (scheduler *JobScheduler) ProcessScheduleLogsCollection() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	scheduler.processScheduleLogsCollection()
+}
+
+func (scheduler *JobScheduler) processScheduleLogsCollection() {
+	logsToCollect := []int{}
+
+	for _, job := range scheduler.jobs {
+		if job.schedule.CollectLogs {
+			logsToCollect = append(logsToCollect, job.schedule.ID)
+			job.schedule.CollectLogs = false
+		}
+	}
+
+	// The logs manager may be busy sending the logs of a previous request
+	go scheduler.logsManager.HandleReceivedLogsRequests(logsToCollect)
+}
+
+func (scheduler *JobScheduler) addJob(schedule agent.Schedule) error {
+	switch schedule.ConcurrencyPolicy {
+	case "", agent.JobConcurrencyPolicySkip, agent.JobConcurrencyPolicyQueue, agent.JobConcurrencyPolicyReplace:
+	default:
+		return fmt.Errorf("unsupported concurrency policy: %s", schedule.ConcurrencyPolicy)
+	}
+
+	if schedule.Timeout < 0 {
+		return errors.New("the timeout cannot be negative")
+	}
+
+	cronSchedule, err := cron.ParseStandard(schedule.CronExpression)
+	if err != nil {
+		return err
+	}
+
+	decodedScript, err := base64.RawStdEncoding.DecodeString(schedule.Script)
+	if err != nil {
+		return err
+	}
+
+	err = filesystem.WriteFile(agent.HostRoot+agent.ScheduleScriptDirectory, scriptName(schedule.ID), decodedScript, 0744)
+	if err != nil {
+		return err
+	}
+
+	job := &scheduledJob{
+		schedule:  schedule,
+		scheduler: scheduler,
+	}
+	job.entryID = scheduler.cron.Schedule(cronSchedule, cron.FuncJob(job.trigger))
+
+	scheduler.jobs[schedule.ID] = job
+
+	return nil
+}
+
+// removeJob unregisters a job and stops its current run, the history of the job is removed when removeHistory is true
+func (scheduler *JobScheduler) removeJob(id int, removeHistory bool) {
+	job, exists := scheduler.jobs[id]
+	if !exists {
+		return
+	}
+
+	scheduler.cron.Remove(job.entryID)
+	delete(scheduler.jobs, id)
+
+	job.stop()
+
+	if removeHistory {
+		if err := scheduler.history.remove(id); err != nil {
+			log.Warn().Int("schedule_id", id).Err(err).Msg("unable to remove the history of the schedule")
+		}
+	}
+}
+
+// command returns the command running a script on the host
+func (scheduler *JobScheduler) command(ctx context.Context, scriptPath string) *exec.Cmd {
+	var cmd *exec.Cmd
+
+	if scheduler.useNsenter {
+		cmd = exec.CommandContext(ctx, "nsenter", "--target", "1", "--mount", "--uts", "--ipc", "--net", "--pid", "--", "/bin/sh", "-c", scriptPath)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", scriptPath)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Chroot: agent.HostRoot}
+		cmd.Dir = "/"
+	}
+
+	cmd.Env = []string{"SHELL=/bin/sh", "PATH=" + jobPath, "HOME=/root"}
+
+	// Stop the processes started by the script as well
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = jobWaitDelay
+
+	return cmd
+}
+
+// trigger is called by the cron when the job is due, it applies the concurrency policy of the job
+// when a previous run is still running
+func (job *scheduledJob) trigger() {
+	job.mu.Lock()
+
+	if job.removed {
+		job.mu.Unlock()
+		return
+	}
+
+	if job.running {
+		switch job.schedule.ConcurrencyPolicy {
+		case agent.JobConcurrencyPolicyQueue:
+			job.queued = true
+		case agent.JobConcurrencyPolicyReplace:
+			job.queued = true
+
+			if job.cancel != nil {
+				job.cancel()
+			}
+		default:
+			log.Info().Int("schedule_id", job.schedule.ID).Msg("skipping the run of the schedule, the previous run is still running")
+		}
+
+		job.mu.Unlock()
+		return
+	}
+
+	job.running = true
+	job.mu.Unlock()
+
+	for {
+		job.run()
+
+		job.mu.Lock()
+		if !job.queued || job.removed {
+			job.running = false
+			job.mu.Unlock()
+
+			return
+		}
+
+		job.queued = false
+		job.mu.Unlock()
+	}
+}
+
+// stop cancels the current run of the job and prevents any further run
+func (job *scheduledJob) stop() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.removed = true
+	job.queued = false
+
+	if job.cancel != nil {
+		job.cancel()
+	}
+}
+
+func (job *scheduledJob) run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	if job.schedule.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(job.schedule.Timeout)*time.Second)
+	}
+	defer cancel()
+
+	// The job may have been removed before the cancel function of this run was set
+	job.mu.Lock()
+	if job.removed {
+		job.mu.Unlock()
+		return
+	}
+	job.cancel = cancel
+	job.mu.Unlock()
+
+	history := job.scheduler.history
+
+	run, logFile, err := history.start(job.schedule.ID, job.schedule.Version)
+	if err != nil {
+		log.Error().Int("schedule_id", job.schedule.ID).Err(err).Msg("unable to record the run of the schedule")
+
+		return
+	}
+	defer logFile.Close()
+
+	log.Debug().Int("schedule_id", job.schedule.ID).Str("run_id", run.ID).Msg("running schedule")
+
+	cmd := job.scheduler.command(ctx, agent.ScheduleScriptDirectory+"/"+scriptName(job.schedule.ID))
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		run.Status = RunStatusTimeout
+	case errors.Is(ctx.Err(), context.Canceled):
+		run.Status = RunStatusCanceled
+	case err == nil:
+		run.Status = RunStatusSuccess
+	case errors.As(err, &exitErr):
+		run.Status = RunStatusFailed
+		run.ExitCode = exitErr.ExitCode()
+	default:
+		run.Status = RunStatusFailed
+		run.ExitCode = -1
+		run.Error = err.Error()
+	}
+
+	if err := history.finish(run); err != nil {
+		log.Error().Int("schedule_id", job.schedule.ID).Err(err).Msg("unable to record the end of the run of the schedule")
+	}
+
+	log.Debug().
+		Int("schedule_id", job.schedule.ID).
+		Str("run_id", run.ID).
+		Str("status", run.Status).
+		Int("exit_code", run.ExitCode).
+		Msg("schedule run ended")
+}
+
+func scriptName(scheduleID int) string {
+	return fmt.Sprintf("schedule_%d", scheduleID)
+}
+
+// canUseNsenter returns true when the nsenter binary is available and the agent shares the PID namespace
+// of the host, in which case the process 1 belongs to the host and has a different mount namespace
+func canUseNsenter() bool {
+	if _, err := exec.LookPath("nsenter"); err != nil {
+		return false
+	}
+
+	hostNamespace, err := os.Readlink("/proc/1/ns/mnt")
+	if err != nil {
+		return false
+	}
+
+	agentNamespace, err := os.Readlink("/proc/self/ns/mnt")
+
+	return err == nil && hostNamespace != agentNamespace
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemovedJobDoesNotRun(t *testing.T) {
+	scheduler := &JobScheduler{history: newJobHistory(t.TempDir())}
+
+	job := &scheduledJob{
+		schedule:  agent.Schedule{ID: 1, Version: 1},
+		scheduler: scheduler,
+	}
+
+	// The job is removed after being triggered but before its run starts
+	job.stop()
+	job.run()
+
+	runs, err := scheduler.history.runs(1)
+	require.NoError(t, err)
+	require.Empty(t, runs)
+}
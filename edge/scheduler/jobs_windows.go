@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+package scheduler
+
+import "github.com/portainer/agent"
+
+// agentSchedulerSupported is false on Windows, NewScheduler refuses the agent scheduler
+const agentSchedulerSupported = false
+
+type JobScheduler struct {
+}
+
+func NewJobScheduler(logsManager *LogsManager, dataPath string) *JobScheduler {
+	return &JobScheduler{}
+}
+
+func (scheduler *JobScheduler) Schedule(schedules []agent.Schedule) error {
+	if len(schedules) > 0 {
+		warnSchedulesUnsupported()
+	}
+
+	return nil
+}
+
+func (scheduler *JobScheduler) AddSchedule(schedule agent.Schedule) error {
+	return errSchedulesUnsupported
+}
+
+func (scheduler *JobScheduler) RemoveSchedule(schedule agent.Schedule) error {
+	return nil
+}
+
+func (scheduler *JobScheduler) ProcessScheduleLogsCollection() {
+}
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/edge/client"
@@ -13,15 +14,35 @@ import (
 type LogsManager struct {
 	portainerClient client.PortainerClient
 	jobsCh          chan []int
+	logSource       func(jobID int) ([]byte, error)
+	mu              sync.Mutex
 }
 
 func NewLogsManager(cli client.PortainerClient) *LogsManager {
 	return &LogsManager{
 		portainerClient: cli,
 		jobsCh:          make(chan []int),
+		logSource:       readScheduleLogFile,
 	}
 }
 
+// setLogSource replaces the function used to read the logs of the jobs,
+// the logs are read from the files written by the cron jobs by default
+func (manager *LogsManager) setLogSource(source func(jobID int) ([]byte, error)) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.logSource = source
+}
+
+func (manager *LogsManager) readLogs(jobID int) ([]byte, error) {
+	manager.mu.Lock()
+	source := manager.logSource
+	manager.mu.Unlock()
+
+	return source(jobID)
+}
+
 func (manager *LogsManager) Start() {
 	log.Debug().Msg("logs manager started")
 
@@ -33,28 +54,13 @@ func (manager *LogsManager) loop() {
 		for _, jobID := range <-manager.jobsCh {
 			log.Debug().Int("job_identifier", jobID).Msg("started job log collection")
 
-			logFileLocation := fmt.Sprintf("%s%s/schedule_%d.log", agent.HostRoot, agent.ScheduleScriptDirectory, jobID)
-			exist, err := filesystem.FileExists(logFileLocation)
+			file, err := manager.readLogs(jobID)
 			if err != nil {
 				log.Error().Err(err).Msg("failed fetching log file")
 
 				continue
 			}
 
-			var file []byte
-			if !exist {
-				file = []byte("")
-
-				log.Debug().Int("job_identifier", jobID).Msg("file doesn't exist")
-			} else {
-				file, err = filesystem.ReadFromFile(logFileLocation)
-				if err != nil {
-					log.Error().Err(err).Msg("failed fetching log file")
-
-					continue
-				}
-			}
-
 			edgeJobStatus := agent.EdgeJobStatus{
 				JobID:          jobID,
 				LogFileContent: string(file),
@@ -74,3 +80,20 @@ func (manager *LogsManager) HandleReceivedLogsRequests(jobs []int) {
 		manager.jobsCh <- jobs
 	}
 }
+
+// readScheduleLogFile reads the log file written by the cron job of a schedule
+func readScheduleLogFile(jobID int) ([]byte, error) {
+	logFileLocation := fmt.Sprintf("%s%s/schedule_%d.log", agent.HostRoot, agent.ScheduleScriptDirectory, jobID)
+	exist, err := filesystem.FileExists(logFileLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exist {
+		log.Debug().Int("job_identifier", jobID).Msg("file doesn't exist")
+
+		return []byte(""), nil
+	}
+
+	return filesystem.ReadFromFile(logFileLocation)
+}
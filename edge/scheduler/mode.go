@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Schedulers that can be selected to run the Edge jobs
+const (
+	SchedulerAuto  = "auto"
+	SchedulerCron  = "cron"
+	SchedulerAgent = "agent"
+)
+
+// NewScheduler returns the scheduler used to run the Edge jobs.
+// The auto mode selects the cron scheduler when the host has a cron.d folder and the agent scheduler otherwise.
+// The agent scheduler is not available on Windows, where the Edge jobs are refused.
+func NewScheduler(mode string, logsManager *LogsManager, dataPath string) (agent.Scheduler, error) {
+	switch mode {
+	case SchedulerCron:
+		return NewCronManager(logsManager), nil
+	case SchedulerAgent:
+		if !agentSchedulerSupported {
+			return nil, errors.New("the agent scheduler is not supported on this platform")
+		}
+
+		return NewJobScheduler(logsManager, dataPath), nil
+	case "", SchedulerAuto:
+		if !agentSchedulerSupported {
+			log.Warn().Msg("the Edge jobs are not supported on this platform, they will be refused")
+
+			return NewCronManager(logsManager), nil
+		}
+
+		exists, err := filesystem.FileExists(agent.HostRoot + "/etc/cron.d")
+		if err != nil {
+			log.Warn().Err(err).Msg("unable to check if the host has a cron.d folder")
+		}
+
+		if exists {
+			return NewCronManager(logsManager), nil
+		}
+
+		log.Info().Msg("the host has no cron.d folder, the Edge jobs are run by the agent scheduler")
+
+		return NewJobScheduler(logsManager, dataPath), nil
+	}
+
+	return nil, fmt.Errorf("unsupported Edge job scheduler: %s", mode)
+}
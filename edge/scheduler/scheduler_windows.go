@@ -3,7 +3,28 @@
 
 package scheduler
 
-import "github.com/portainer/agent"
+import (
+	"errors"
+	"sync"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errSchedulesUnsupported is returned when schedules are sent to an agent running on Windows,
+// both schedulers run the scripts on a Linux host
+var errSchedulesUnsupported = errors.New("the Edge jobs are not supported on Windows")
+
+// unsupportedWarning ensures that the schedules received on every poll are only reported once
+var unsupportedWarning sync.Once
+
+// warnSchedulesUnsupported reports once that the schedules are ignored, they are received on every poll
+func warnSchedulesUnsupported() {
+	unsupportedWarning.Do(func() {
+		log.Warn().Err(errSchedulesUnsupported).Msg("the Edge job schedules are ignored")
+	})
+}
 
 type CronManager struct {
 }
@@ -13,11 +34,15 @@ func NewCronManager(logsManager *LogsManager) *CronManager {
 }
 
 func (manager *CronManager) Schedule(schedules []agent.Schedule) error {
+	if len(schedules) > 0 {
+		warnSchedulesUnsupported()
+	}
+
 	return nil
 }
 
 func (manager *CronManager) AddSchedule(schedule agent.Schedule) error {
-	return nil
+	return errSchedulesUnsupported
 }
 
 func (manager *CronManager) RemoveSchedule(schedule agent.Schedule) error {
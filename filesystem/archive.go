@@ -0,0 +1,476 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// ArchiveFormatTarGz is the format used for gzip compressed tar archives
+	ArchiveFormatTarGz = "tar.gz"
+	// ArchiveFormatZip is the format used for zip archives
+	ArchiveFormatZip = "zip"
+)
+
+// ErrArchiveTooLarge is returned when the content of an archive exceeds the maximum allowed size
+var ErrArchiveTooLarge = errors.New("archive content exceeds the maximum allowed size")
+
+// IsValidArchiveFormat returns true if the format is a supported archive format
+func IsValidArchiveFormat(format string) bool {
+	return format == ArchiveFormatTarGz || format == ArchiveFormatZip
+}
+
+// DirectorySize returns the size of the regular files inside a directory and its sub-directories
+func DirectorySize(directoryPath string) (int64, error) {
+	var size int64
+
+	err := filepath.WalkDir(directoryPath, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		size += info.Size()
+
+		return nil
+	})
+
+	return size, err
+}
+
+// WriteArchive writes the content of a directory to w using the specified archive format.
+// The entries are relative to the directory, symbolic links are archived as links in tar archives
+// and skipped in zip archives, other special files are always skipped.
+func WriteArchive(w io.Writer, directoryPath, format string) error {
+	switch format {
+	case ArchiveFormatTarGz:
+		return writeTarGzArchive(w, directoryPath)
+	case ArchiveFormatZip:
+		return writeZipArchive(w, directoryPath)
+	}
+
+	return fmt.Errorf("unsupported archive format: %s", format)
+}
+
+func writeTarGzArchive(w io.Writer, directoryPath string) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	err := filepath.WalkDir(directoryPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(directoryPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err = os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+		case !entry.IsDir() && !entry.Type().IsRegular():
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+
+		// The archived directory is stored as the ./ entry so that its metadata can be restored
+		if name == "." {
+			header.Name = "./"
+		}
+
+		err = tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return copyFileSizeTo(tarWriter, filePath, header.Size)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tarWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+func writeZipArchive(w io.Writer, directoryPath string) error {
+	zipWriter := zip.NewWriter(w)
+
+	err := filepath.WalkDir(directoryPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(directoryPath, filePath)
+		if err != nil || name == "." {
+			return err
+		}
+
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+
+		if entry.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		fileWriter, err := zipWriter.CreateHeader(header)
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		return copyFileTo(fileWriter, filePath)
+	})
+	if err != nil {
+		return err
+	}
+
+	return zipWriter.Close()
+}
+
+func copyFileTo(w io.Writer, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+
+	return err
+}
+
+// copyFileSizeTo copies exactly size bytes of a file to w. The files modified while they are archived are
+// truncated or padded with zeros to the size recorded in their header.
+func copyFileSizeTo(w io.Writer, filePath string, size int64) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	written, err := io.CopyN(w, file, size)
+	if errors.Is(err, io.EOF) {
+		_, err = io.CopyN(w, zeroReader{}, size-written)
+	}
+
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+
+	return len(p), nil
+}
+
+// ExtractTarGzArchive extracts a gzip compressed tar archive inside the destination directory.
+// An error is returned when an entry would be written outside of the destination directory or when
+// the extracted content exceeds maxSize bytes (no limit when maxSize is 0).
+func ExtractTarGzArchive(r io.Reader, destination string, maxSize int64) error {
+	return extractTarGzArchive(r, newArchiveExtractor(destination, maxSize))
+}
+
+// ExtractTarGzArchiveWithMetadata extracts a gzip compressed tar archive like ExtractTarGzArchive and also restores
+// the ownership, the exact permissions and the modification time of the extracted entries.
+// It is used to restore backups, where the content must be identical to the archived one.
+func ExtractTarGzArchiveWithMetadata(r io.Reader, destination string, maxSize int64) error {
+	extractor := newArchiveExtractor(destination, maxSize)
+	extractor.preserveMetadata = true
+
+	return extractTarGzArchive(r, extractor)
+}
+
+func extractTarGzArchive(r io.Reader, extractor *archiveExtractor) error {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+
+	// The metadata of the directories is restored once their content is extracted,
+	// otherwise it would be altered by the creation of their entries
+	var directories []*tar.Header
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = extractor.createDirectory(header.Name, header.FileInfo().Mode())
+		case tar.TypeReg:
+			err = extractor.createFile(header.Name, header.FileInfo().Mode(), tarReader)
+		case tar.TypeSymlink:
+			err = extractor.createSymlink(header.Name, header.Linkname)
+		default:
+			// Hard links, devices and other special files are not extracted
+			continue
+		}
+
+		if err == nil && extractor.preserveMetadata {
+			if header.Typeflag == tar.TypeDir {
+				directories = append(directories, header)
+				continue
+			}
+
+			err = extractor.restoreMetadata(header)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(directories) - 1; i >= 0; i-- {
+		err = extractor.restoreMetadata(directories[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExtractZipArchive extracts a zip archive inside the destination directory.
+// An error is returned when an entry would be written outside of the destination directory or when
+// the extracted content exceeds maxSize bytes (no limit when maxSize is 0).
+func ExtractZipArchive(r io.ReaderAt, size int64, destination string, maxSize int64) error {
+	zipReader, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+
+	extractor := newArchiveExtractor(destination, maxSize)
+
+	for _, file := range zipReader.File {
+		mode := file.Mode()
+
+		switch {
+		case mode.IsDir():
+			err = extractor.createDirectory(file.Name, mode)
+		case mode.IsRegular():
+			err = extractor.extractZipFile(file)
+		default:
+			// Symbolic links and special files are not extracted from zip archives
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type archiveExtractor struct {
+	destination      string
+	maxSize          int64
+	written          int64
+	preserveMetadata bool
+}
+
+func newArchiveExtractor(destination string, maxSize int64) *archiveExtractor {
+	return &archiveExtractor{
+		destination: filepath.Clean(destination),
+		maxSize:     maxSize,
+	}
+}
+
+// targetPath returns the path of an archive entry inside the destination directory.
+// It rejects the entries that would escape the destination, either with '..' elements
+// or through a symbolic link that already exists inside the destination.
+func (extractor *archiveExtractor) targetPath(name string) (string, error) {
+	if !isValidPath(name) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid archive entry %q. Ensure that the path do not contain '..' elements", name)
+	}
+
+	relativePath := filepath.Clean(filepath.FromSlash(strings.TrimLeft(name, "/")))
+	if relativePath == "." {
+		return extractor.destination, nil
+	}
+
+	target := extractor.destination
+	for _, element := range strings.Split(filepath.Dir(relativePath), string(filepath.Separator)) {
+		if element == "." {
+			continue
+		}
+
+		target = filepath.Join(target, element)
+
+		info, err := os.Lstat(target)
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("invalid archive entry %q. The path goes through a symbolic link", name)
+		}
+	}
+
+	return filepath.Join(extractor.destination, relativePath), nil
+}
+
+func (extractor *archiveExtractor) createDirectory(name string, mode fs.FileMode) error {
+	target, err := extractor.targetPath(name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(target, mode.Perm()|0700)
+}
+
+func (extractor *archiveExtractor) createFile(name string, mode fs.FileMode, r io.Reader) error {
+	target, err := extractor.targetPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	// An existing symbolic link is replaced rather than followed
+	if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		err = os.Remove(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := r
+	if extractor.maxSize > 0 {
+		// Read one more byte than allowed to detect the archives exceeding the limit
+		reader = io.LimitReader(r, extractor.maxSize-extractor.written+1)
+	}
+
+	written, err := io.Copy(file, reader)
+	extractor.written += written
+	if err != nil {
+		return err
+	}
+
+	if extractor.maxSize > 0 && extractor.written > extractor.maxSize {
+		return ErrArchiveTooLarge
+	}
+
+	return nil
+}
+
+func (extractor *archiveExtractor) createSymlink(name, linkname string) error {
+	// Only relative links that stay inside the destination are allowed
+	if filepath.IsAbs(linkname) || !isValidPath(filepath.Join(filepath.Dir(name), linkname)) {
+		return fmt.Errorf("invalid symbolic link %q pointing to %q", name, linkname)
+	}
+
+	target, err := extractor.targetPath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(linkname, target)
+}
+
+// restoreMetadata applies the ownership, permissions and modification time of a tar entry to the extracted file.
+// Only the ownership is restored for symbolic links.
+func (extractor *archiveExtractor) restoreMetadata(header *tar.Header) error {
+	target, err := extractor.targetPath(header.Name)
+	if err != nil {
+		return err
+	}
+
+	err = setFileOwner(target, header.Uid, header.Gid)
+	if err != nil || header.Typeflag == tar.TypeSymlink {
+		return err
+	}
+
+	err = os.Chmod(target, header.FileInfo().Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky))
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, header.ModTime, header.ModTime)
+}
+
+func (extractor *archiveExtractor) extractZipFile(file *zip.File) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return extractor.createFile(file.Name, file.Mode(), reader)
+}
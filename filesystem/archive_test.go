@@ -0,0 +1,119 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "dir", "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "dir", "sub", "file.txt"), []byte("content"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "root.txt"), []byte("root"), 0644))
+
+	for _, format := range []string{ArchiveFormatTarGz, ArchiveFormatZip} {
+		var archive bytes.Buffer
+		require.NoError(t, WriteArchive(&archive, source, format))
+
+		destination := t.TempDir()
+		if format == ArchiveFormatZip {
+			require.NoError(t, ExtractZipArchive(bytes.NewReader(archive.Bytes()), int64(archive.Len()), destination, 0))
+		} else {
+			require.NoError(t, ExtractTarGzArchive(&archive, destination, 0))
+		}
+
+		content, err := os.ReadFile(filepath.Join(destination, "dir", "sub", "file.txt"))
+		require.NoError(t, err, format)
+		require.Equal(t, "content", string(content))
+	}
+}
+
+func TestCopyFileSizeTo(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	// The files that grew or shrank since their header was written are truncated or padded
+	var buffer bytes.Buffer
+	require.NoError(t, copyFileSizeTo(&buffer, filePath, 4))
+	require.Equal(t, "cont", buffer.String())
+
+	buffer.Reset()
+	require.NoError(t, copyFileSizeTo(&buffer, filePath, 9))
+	require.Equal(t, "content\x00\x00", buffer.String())
+}
+
+func TestExtractTarGzArchiveRejectsUnsafeEntries(t *testing.T) {
+	tests := map[string]tar.Header{
+		"path traversal":        {Name: "../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		"absolute symlink":      {Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"},
+		"escaping symlink":      {Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"},
+		"nested path traversal": {Name: "dir/../../escape.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	}
+
+	for name, header := range tests {
+		destination := t.TempDir()
+
+		err := ExtractTarGzArchive(buildTarGz(t, header), filepath.Join(destination, "target"), 0)
+		require.Error(t, err, name)
+
+		_, err = os.Stat(filepath.Join(destination, "escape.txt"))
+		require.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestExtractTarGzArchiveRejectsWritesThroughSymlinks(t *testing.T) {
+	destination := t.TempDir()
+	outside := t.TempDir()
+
+	archive := buildTarGz(t,
+		tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "."},
+		tar.Header{Name: "link/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	)
+	require.NoError(t, os.Symlink(outside, filepath.Join(destination, "outside")))
+
+	require.Error(t, ExtractTarGzArchive(archive, destination, 0))
+
+	archive = buildTarGz(t, tar.Header{Name: "outside/file.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1})
+	require.Error(t, ExtractTarGzArchive(archive, destination, 0))
+
+	_, err := os.Stat(filepath.Join(outside, "file.txt"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestExtractTarGzArchiveSizeLimit(t *testing.T) {
+	archive := buildTarGz(t,
+		tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		tar.Header{Name: "b.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+	)
+
+	err := ExtractTarGzArchive(archive, t.TempDir(), 1)
+	require.ErrorIs(t, err, ErrArchiveTooLarge)
+}
+
+// buildTarGz creates a gzip compressed tar archive, regular files contain a single byte
+func buildTarGz(t *testing.T, headers ...tar.Header) *bytes.Buffer {
+	var archive bytes.Buffer
+
+	gzipWriter := gzip.NewWriter(&archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, header := range headers {
+		require.NoError(t, tarWriter.WriteHeader(&header))
+
+		if header.Typeflag == tar.TypeReg {
+			_, err := tarWriter.Write([]byte("x"))
+			require.NoError(t, err)
+		}
+	}
+
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	return &archive
+}
@@ -1,11 +1,15 @@
 package filesystem
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"os"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,6 +22,27 @@ type FileInfo struct {
 	Size    int64  `json:"Size"`
 	Dir     bool   `json:"Dir"`
 	ModTime int64  `json:"ModTime"`
+	// Mode contains the permission bits of the file in octal notation (e.g. 0755)
+	Mode string `json:"Mode"`
+	UID  int    `json:"UID"`
+	GID  int    `json:"GID"`
+	// Symlink is true when the file is a symbolic link, the other fields then describe the link itself
+	Symlink    bool   `json:"Symlink"`
+	LinkTarget string `json:"LinkTarget,omitempty"`
+	// Path is the path of the file relative to the searched directory, it is only set in search results
+	Path string `json:"Path,omitempty"`
+}
+
+// ListOptions are the options used to sort and paginate the files of a directory
+type ListOptions struct {
+	// SortBy is one of name (default), size or modTime
+	SortBy string
+	// Descending reverses the sort order
+	Descending bool
+	// Start is the index of the first returned file
+	Start int
+	// Limit is the maximum number of returned files, all the files are returned when it is 0
+	Limit int
 }
 
 // FileDetails is a wrapper around a *os.File and contains extra information on the file
@@ -68,6 +93,24 @@ func OpenFile(filePath string) (*FileDetails, error) {
 	return fileDetails, nil
 }
 
+// FileChecksum returns the hex encoded SHA-256 checksum of the content of a file
+func FileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 // RemoveFile will remove a file
 func RemoveFile(filePath string) error {
 	return os.Remove(filePath)
@@ -75,30 +118,88 @@ func RemoveFile(filePath string) error {
 
 // ListFilesInsideDirectory returns a slice of FileInfo for each file in the specified directory inside a volume
 func ListFilesInsideDirectory(directoryPath string) ([]FileInfo, error) {
-	files, err := os.ReadDir(directoryPath)
+	files, _, err := ListFilesInsideDirectoryWithOptions(directoryPath, ListOptions{})
+
+	return files, err
+}
+
+// ListFilesInsideDirectoryWithOptions returns a sorted page of FileInfo for the files in the specified directory
+// and the total number of files in the directory. When the files are sorted by name, the details of the files
+// are only retrieved for the returned page so that large directories can be browsed efficiently.
+func ListFilesInsideDirectoryWithOptions(directoryPath string, options ListOptions) ([]FileInfo, int, error) {
+	entries, err := os.ReadDir(directoryPath)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	fileList := make([]FileInfo, 0)
+	total := len(entries)
 
-	for _, f := range files {
-		fi, err := f.Info()
-		if err != nil {
-			return nil, err
+	sortByName := options.SortBy == "" || options.SortBy == SortByName
+	if sortByName {
+		// The entries are already sorted by name
+		if options.Descending {
+			slices.Reverse(entries)
 		}
 
-		file := FileInfo{
-			Name:    f.Name(),
-			Size:    fi.Size(),
-			Dir:     f.IsDir(),
-			ModTime: fi.ModTime().Unix(),
+		entries = paginate(entries, options.Start, options.Limit)
+	}
+
+	fileList := make([]FileInfo, 0, len(entries))
+
+	for _, entry := range entries {
+		file, err := newFileInfo(path.Join(directoryPath, entry.Name()), entry)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// The file was removed while the directory was being listed
+				continue
+			}
+
+			return nil, 0, err
 		}
 
 		fileList = append(fileList, file)
 	}
 
-	return fileList, nil
+	if sortByName {
+		return fileList, total, nil
+	}
+
+	err = sortFiles(fileList, options.SortBy, options.Descending)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return paginate(fileList, options.Start, options.Limit), total, nil
+}
+
+func newFileInfo(filePath string, entry fs.DirEntry) (FileInfo, error) {
+	fi, err := entry.Info()
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return buildFileInfo(filePath, fi), nil
+}
+
+func buildFileInfo(filePath string, fi fs.FileInfo) FileInfo {
+	uid, gid := fileOwner(fi)
+
+	file := FileInfo{
+		Name:    fi.Name(),
+		Size:    fi.Size(),
+		Dir:     fi.IsDir(),
+		ModTime: fi.ModTime().Unix(),
+		Mode:    formatMode(fi.Mode()),
+		UID:     uid,
+		GID:     gid,
+		Symlink: fi.Mode()&fs.ModeSymlink != 0,
+	}
+
+	if file.Symlink {
+		file.LinkTarget, _ = os.Readlink(filePath)
+	}
+
+	return file
 }
 
 // RenameFile will rename a file
@@ -0,0 +1,303 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// SortByName sorts the files by name
+	SortByName = "name"
+	// SortBySize sorts the files by size
+	SortBySize = "size"
+	// SortByModTime sorts the files by modification time
+	SortByModTime = "modTime"
+)
+
+// ErrSearchLimitReached is returned by SearchFiles when the maximum number of results is reached
+var ErrSearchLimitReached = errors.New("search result limit reached")
+
+// StatFile returns the FileInfo of a file, symbolic links are not followed
+func StatFile(filePath string) (FileInfo, error) {
+	fi, err := os.Lstat(filePath)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return buildFileInfo(filePath, fi), nil
+}
+
+// CreateDirectory creates a directory along with any necessary parents
+func CreateDirectory(directoryPath string, mode os.FileMode) error {
+	return os.MkdirAll(directoryPath, mode)
+}
+
+// CopyPath copies a file or a directory recursively. The permissions of the copied files
+// are preserved and symbolic links are copied as links.
+func CopyPath(source, destination string) error {
+	if isSubPath(source, destination) {
+		return errors.New("unable to copy a directory inside itself")
+	}
+
+	return filepath.WalkDir(source, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(source, filePath)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destination, relativePath)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+
+			return os.Symlink(link, target)
+		case entry.Type().IsRegular():
+			return copyFile(filePath, target, info.Mode().Perm())
+		}
+
+		// Special files (devices, sockets...) are not copied
+		return nil
+	})
+}
+
+func copyFile(source, destination string, mode os.FileMode) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destinationFile, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	defer destinationFile.Close()
+
+	_, err = io.Copy(destinationFile, sourceFile)
+
+	return err
+}
+
+// MovePath moves a file or a directory. When the source and the destination are not on the same
+// device (e.g. two different volumes), the source is copied then removed.
+func MovePath(source, destination string) error {
+	if isSubPath(source, destination) {
+		return errors.New("unable to move a directory inside itself")
+	}
+
+	err := os.Rename(source, destination)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	err = CopyPath(source, destination)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(source)
+}
+
+// ChangeMode changes the permissions of a file, and of the files inside it when recursive is true.
+// Symbolic links are not followed.
+func ChangeMode(filePath string, mode os.FileMode, recursive bool) error {
+	return walkPath(filePath, recursive, func(filePath string, entry fs.DirEntry) error {
+		if entry.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+
+		return os.Chmod(filePath, mode)
+	})
+}
+
+// ChangeOwner changes the owner of a file, and of the files inside it when recursive is true.
+// A negative uid or gid is not changed, symbolic links themselves are updated instead of their targets.
+func ChangeOwner(filePath string, uid, gid int, recursive bool) error {
+	return walkPath(filePath, recursive, func(filePath string, _ fs.DirEntry) error {
+		return os.Lchown(filePath, uid, gid)
+	})
+}
+
+func walkPath(filePath string, recursive bool, fn func(filePath string, entry fs.DirEntry) error) error {
+	if !recursive {
+		info, err := os.Lstat(filePath)
+		if err != nil {
+			return err
+		}
+
+		return fn(filePath, fs.FileInfoToDirEntry(info))
+	}
+
+	return filepath.WalkDir(filePath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return fn(filePath, entry)
+	})
+}
+
+// SearchFiles returns the files inside a directory and its sub-directories whose name matches
+// the pattern. The pattern supports the path.Match syntax and is case-insensitive, a pattern
+// without wildcards matches the names containing it. ErrSearchLimitReached is returned along
+// with the results when more than maxResults files match.
+func SearchFiles(directoryPath, pattern string, maxResults int) ([]FileInfo, error) {
+	pattern = strings.ToLower(pattern)
+	if !strings.ContainsAny(pattern, "*?[") {
+		pattern = "*" + pattern + "*"
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid search pattern: %w", err)
+	}
+
+	results := make([]FileInfo, 0)
+
+	err := filepath.WalkDir(directoryPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable directories are skipped rather than failing the whole search
+			if entry != nil && entry.IsDir() && filePath != directoryPath {
+				return filepath.SkipDir
+			}
+
+			return err
+		}
+
+		if filePath == directoryPath {
+			return nil
+		}
+
+		if matched, _ := path.Match(pattern, strings.ToLower(entry.Name())); !matched {
+			return nil
+		}
+
+		if len(results) >= maxResults {
+			return ErrSearchLimitReached
+		}
+
+		file, err := newFileInfo(filePath, entry)
+		if err != nil {
+			return nil
+		}
+
+		file.Path, _ = filepath.Rel(directoryPath, filePath)
+		results = append(results, file)
+
+		return nil
+	})
+
+	return results, err
+}
+
+// ParseMode parses permissions expressed in octal notation (e.g. 0755)
+func ParseMode(mode string) (os.FileMode, error) {
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || value > 07777 {
+		return 0, fmt.Errorf("invalid mode %q, it must be expressed in octal notation (e.g. 0755)", mode)
+	}
+
+	fileMode := os.FileMode(value & 0777)
+	if value&04000 != 0 {
+		fileMode |= os.ModeSetuid
+	}
+	if value&02000 != 0 {
+		fileMode |= os.ModeSetgid
+	}
+	if value&01000 != 0 {
+		fileMode |= os.ModeSticky
+	}
+
+	return fileMode, nil
+}
+
+func formatMode(mode os.FileMode) string {
+	value := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		value |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		value |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		value |= 01000
+	}
+
+	return fmt.Sprintf("%04o", value)
+}
+
+func sortFiles(files []FileInfo, sortBy string, descending bool) error {
+	var less func(a, b FileInfo) bool
+
+	switch sortBy {
+	case SortByName:
+		less = func(a, b FileInfo) bool { return a.Name < b.Name }
+	case SortBySize:
+		less = func(a, b FileInfo) bool { return a.Size < b.Size }
+	case SortByModTime:
+		less = func(a, b FileInfo) bool { return a.ModTime < b.ModTime }
+	default:
+		return fmt.Errorf("invalid sort field %q", sortBy)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if descending {
+			return less(files[j], files[i])
+		}
+
+		return less(files[i], files[j])
+	})
+
+	return nil
+}
+
+func paginate[T any](items []T, start, limit int) []T {
+	if start <= 0 && limit <= 0 {
+		return items
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	if start >= len(items) {
+		return items[:0]
+	}
+
+	end := len(items)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+
+	return items[start:end]
+}
+
+// isSubPath returns true if target is parent or a sub-path of parent
+func isSubPath(parent, target string) bool {
+	relativePath, err := filepath.Rel(filepath.Clean(parent), filepath.Clean(target))
+
+	return err == nil && relativePath != ".." && !strings.HasPrefix(relativePath, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,98 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFilesInsideDirectoryWithOptions(t *testing.T) {
+	directory := t.TempDir()
+
+	for i, name := range []string{"c", "a", "d", "b"} {
+		require.NoError(t, os.WriteFile(filepath.Join(directory, name), make([]byte, 4-i), 0644))
+	}
+	require.NoError(t, os.Symlink("a", filepath.Join(directory, "link")))
+
+	files, total, err := ListFilesInsideDirectoryWithOptions(directory, ListOptions{Start: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 5, total)
+	require.Equal(t, []string{"b", "c"}, fileNames(files))
+
+	files, _, err = ListFilesInsideDirectoryWithOptions(directory, ListOptions{SortBy: SortBySize, Descending: true, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c", "a"}, fileNames(files))
+
+	files, _, err = ListFilesInsideDirectoryWithOptions(directory, ListOptions{Start: 4})
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.True(t, files[0].Symlink)
+	require.Equal(t, "a", files[0].LinkTarget)
+
+	_, _, err = ListFilesInsideDirectoryWithOptions(directory, ListOptions{SortBy: "owner"})
+	require.Error(t, err)
+}
+
+func TestCopyAndMovePath(t *testing.T) {
+	directory := t.TempDir()
+	source := filepath.Join(directory, "source")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "sub", "file"), []byte("content"), 0600))
+
+	require.Error(t, CopyPath(source, filepath.Join(source, "sub", "copy")))
+
+	require.NoError(t, CopyPath(source, filepath.Join(directory, "copy")))
+
+	file, err := StatFile(filepath.Join(directory, "copy", "sub", "file"))
+	require.NoError(t, err)
+	require.Equal(t, "0600", file.Mode)
+
+	require.Error(t, MovePath(source, filepath.Join(source, "moved")))
+	require.NoError(t, MovePath(source, filepath.Join(directory, "moved")))
+
+	exists, err := FileExists(source)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestSearchFiles(t *testing.T) {
+	directory := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(directory, "logs", "old"), 0755))
+	for _, name := range []string{"logs/app.LOG", "logs/old/app.log", "config.yml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(directory, name), nil, 0644))
+	}
+
+	files, err := SearchFiles(directory, "*.log", 10)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	files, err = SearchFiles(directory, "conf", 10)
+	require.NoError(t, err)
+	require.Equal(t, "config.yml", files[0].Path)
+
+	files, err = SearchFiles(directory, "app", 1)
+	require.ErrorIs(t, err, ErrSearchLimitReached)
+	require.Len(t, files, 1)
+}
+
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("2755")
+	require.NoError(t, err)
+	require.Equal(t, "2755", formatMode(mode))
+
+	_, err = ParseMode("999")
+	require.Error(t, err)
+}
+
+func fileNames(files []FileInfo) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package filesystem
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the user and group identifiers of the file owner
+func fileOwner(fi fs.FileInfo) (uid, gid int) {
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1
+	}
+
+	return int(stat.Uid), int(stat.Gid)
+}
+
+// setFileOwner changes the owner of a file, symbolic links themselves are updated instead of their targets
+func setFileOwner(filePath string, uid, gid int) error {
+	return os.Lchown(filePath, uid, gid)
+}
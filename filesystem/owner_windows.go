@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package filesystem
+
+import "io/fs"
+
+// fileOwner returns -1 as the file ownership is not exposed through user and group identifiers on Windows
+func fileOwner(fi fs.FileInfo) (uid, gid int) {
+	return -1, -1
+}
+
+// setFileOwner does nothing as the file ownership is not expressed through user and group identifiers on Windows
+func setFileOwner(filePath string, uid, gid int) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statListingFormat is the format of the lines printed by the command returned by StatListingCommand:
+// the raw mode in hexadecimal, the size, the modification time, the owner and group identifiers and the path
+const statListingFormat = "%f %s %Y %u %g %n"
+
+// File types of the raw mode printed by stat
+const (
+	statTypeMask      = 0170000
+	statTypeDirectory = 0040000
+	statTypeSymlink   = 0120000
+	statTypeRegular   = 0100000
+)
+
+// StatListingCommand returns the command printing the details of the files located directly inside a directory,
+// its output is read by ListStatOutput. The command only relies on find and stat, which are available in most
+// container images, including the images based on BusyBox.
+func StatListingCommand(directoryPath string) []string {
+	return []string{"find", directoryPath, "-mindepth", "1", "-maxdepth", "1", "-exec", "stat", "-c", statListingFormat, "{}", "+"}
+}
+
+// ListStatOutput reads the output of the command returned by StatListingCommand and returns a sorted page of the
+// files along with the total number of files. At most maxReadSize bytes of the output are read (no limit when 0),
+// ErrListingTruncated is returned along with the files found so far when the output is larger. The lines that
+// cannot be parsed, such as the lines of the file names containing a line break, are ignored.
+func ListStatOutput(r io.Reader, options ListOptions, maxReadSize int64) ([]FileInfo, int, error) {
+	reader := &limitedReader{reader: r, remaining: maxReadSize}
+	if maxReadSize <= 0 {
+		reader.remaining = math.MaxInt64
+	}
+
+	lineReader := bufio.NewReader(reader)
+	truncated := false
+
+	files := make([]FileInfo, 0)
+
+	for {
+		line, err := lineReader.ReadString('\n')
+
+		// The incomplete line read before reaching the limit is ignored
+		if errors.Is(err, errReadLimitReached) {
+			truncated = true
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, 0, err
+		}
+
+		file, ok := parseStatLine(strings.TrimSuffix(line, "\n"))
+		if ok {
+			files = append(files, file)
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	files, total, err := sortAndPaginate(files, options)
+	if err == nil && truncated {
+		err = ErrListingTruncated
+	}
+
+	return files, total, err
+}
+
+func parseStatLine(line string) (FileInfo, bool) {
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) != 6 {
+		return FileInfo{}, false
+	}
+
+	var values [5]int64
+	for i, base := range []int{16, 10, 10, 10, 10} {
+		value, err := strconv.ParseInt(fields[i], base, 64)
+		if err != nil {
+			return FileInfo{}, false
+		}
+
+		values[i] = value
+	}
+
+	// The details are converted in the same way as the entries of the tar archives
+	header := &tar.Header{
+		Name:     path.Base(fields[5]),
+		Mode:     values[0],
+		Size:     values[1],
+		ModTime:  time.Unix(values[2], 0),
+		Uid:      int(values[3]),
+		Gid:      int(values[4]),
+		Typeflag: tar.TypeChar,
+	}
+
+	switch values[0] & statTypeMask {
+	case statTypeDirectory:
+		header.Typeflag = tar.TypeDir
+	case statTypeSymlink:
+		header.Typeflag = tar.TypeSymlink
+	case statTypeRegular:
+		header.Typeflag = tar.TypeReg
+	}
+
+	return tarFileInfo(header), true
+}
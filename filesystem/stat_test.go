@@ -0,0 +1,42 @@
+package filesystem
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListStatOutput(t *testing.T) {
+	output := strings.Join([]string{
+		"41ed 4096 1700000000 0 0 /etc/ssl",
+		"81a4 1 1700000001 1000 1000 /etc/passwd",
+		"a1ff 27 1700000002 0 0 /etc/localtime",
+		"81a4 1 1700000003 0 0 /etc/file with spaces",
+		"invalid line",
+		"",
+	}, "\n")
+
+	files, total, err := ListStatOutput(strings.NewReader(output), ListOptions{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Equal(t, []string{"file with spaces", "localtime", "passwd", "ssl"}, []string{files[0].Name, files[1].Name, files[2].Name, files[3].Name})
+	require.True(t, files[1].Symlink)
+	require.Equal(t, 1000, files[2].UID)
+	require.Equal(t, "0644", files[2].Mode)
+	require.Equal(t, int64(1700000001), files[2].ModTime)
+	require.True(t, files[3].Dir)
+	require.False(t, files[3].Symlink)
+
+	files, total, err = ListStatOutput(strings.NewReader(output), ListOptions{SortBy: SortBySize, Descending: true, Limit: 1}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Len(t, files, 1)
+	require.Equal(t, "ssl", files[0].Name)
+
+	// The line cut by the limit is not listed
+	files, total, err = ListStatOutput(strings.NewReader(output), ListOptions{}, 50)
+	require.ErrorIs(t, err, ErrListingTruncated)
+	require.Equal(t, 1, total)
+	require.Equal(t, "ssl", files[0].Name)
+}
@@ -0,0 +1,171 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"time"
+)
+
+var (
+	// ErrNotRegularFile is returned when a tar archive does not start with a regular file
+	ErrNotRegularFile = errors.New("the archive does not contain a regular file")
+	// ErrListingTruncated is returned along with the files read so far when the archive of a directory is larger
+	// than the maximum size read by ListTarDirectory
+	ErrListingTruncated = errors.New("the directory listing is truncated")
+)
+
+// ListTarDirectory reads a tar archive of a directory, such as the archives returned by the Docker archive API,
+// and returns a sorted page of the files located directly inside the directory along with the total number of files.
+// The archive contains the whole directory tree, only the headers of its entries are kept. At most maxReadSize bytes
+// of the archive are read (no limit when 0), ErrListingTruncated is returned along with the files found so far when
+// the archive is larger.
+func ListTarDirectory(r io.Reader, options ListOptions, maxReadSize int64) ([]FileInfo, int, error) {
+	reader := &limitedReader{reader: r, remaining: maxReadSize}
+	if maxReadSize <= 0 {
+		reader.remaining = math.MaxInt64
+	}
+
+	tarReader := tar.NewReader(reader)
+	truncated := false
+
+	root := ""
+	files := make([]FileInfo, 0)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		} else if errors.Is(err, errReadLimitReached) {
+			truncated = true
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		name := path.Clean(header.Name)
+
+		// The first entry is the directory itself
+		if root == "" {
+			root = name
+			continue
+		}
+
+		if path.Dir(name) != root {
+			continue
+		}
+
+		files = append(files, tarFileInfo(header))
+	}
+
+	files, total, err := sortAndPaginate(files, options)
+	if err == nil && truncated {
+		err = ErrListingTruncated
+	}
+
+	return files, total, err
+}
+
+// sortAndPaginate returns the requested page of files along with the total number of files
+func sortAndPaginate(files []FileInfo, options ListOptions) ([]FileInfo, int, error) {
+	sortBy := options.SortBy
+	if sortBy == "" {
+		sortBy = SortByName
+	}
+
+	err := sortFiles(files, sortBy, options.Descending)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return paginate(files, options.Start, options.Limit), len(files), nil
+}
+
+var errReadLimitReached = errors.New("read limit reached")
+
+// limitedReader returns errReadLimitReached once remaining bytes were read
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, errReadLimitReached
+	}
+
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+
+	return n, err
+}
+
+// ReadTarFile reads a tar archive of a single regular file, such as the archives returned by the Docker archive API,
+// and returns the details of the file along with a reader of its content
+func ReadTarFile(r io.Reader) (FileInfo, io.Reader, error) {
+	tarReader := tar.NewReader(r)
+
+	header, err := tarReader.Next()
+	if err == io.EOF {
+		return FileInfo{}, nil, ErrNotRegularFile
+	} else if err != nil {
+		return FileInfo{}, nil, err
+	}
+
+	if header.Typeflag != tar.TypeReg {
+		return FileInfo{}, nil, ErrNotRegularFile
+	}
+
+	return tarFileInfo(header), tarReader, nil
+}
+
+// WriteTarFile writes a tar archive containing a single regular file to w, size is the size of its content
+func WriteTarFile(w io.Writer, filename string, size int64, mode fs.FileMode, content io.Reader) error {
+	tarWriter := tar.NewWriter(w)
+
+	err := tarWriter.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filename,
+		Size:     size,
+		Mode:     int64(mode.Perm()),
+		ModTime:  time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tarWriter, content, size)
+	if err != nil {
+		return err
+	}
+
+	return tarWriter.Close()
+}
+
+func tarFileInfo(header *tar.Header) FileInfo {
+	fi := header.FileInfo()
+
+	file := FileInfo{
+		Name:    fi.Name(),
+		Size:    fi.Size(),
+		Dir:     fi.IsDir(),
+		ModTime: fi.ModTime().Unix(),
+		Mode:    formatMode(fi.Mode()),
+		UID:     header.Uid,
+		GID:     header.Gid,
+		Symlink: header.Typeflag == tar.TypeSymlink,
+	}
+
+	if file.Symlink {
+		file.LinkTarget = header.Linkname
+	}
+
+	return file
+}
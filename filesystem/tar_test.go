@@ -0,0 +1,67 @@
+package filesystem
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListTarDirectory(t *testing.T) {
+	var archive bytes.Buffer
+
+	tarWriter := tar.NewWriter(&archive)
+	for _, header := range []tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/ssl/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/ssl/cert.pem", Typeflag: tar.TypeReg, Mode: 0644, Size: 1},
+		{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644, Size: 1, Uid: 1000},
+		{Name: "etc/localtime", Typeflag: tar.TypeSymlink, Linkname: "/usr/share/zoneinfo/UTC"},
+	} {
+		require.NoError(t, tarWriter.WriteHeader(&header))
+		if header.Typeflag == tar.TypeReg {
+			_, err := tarWriter.Write([]byte("x"))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tarWriter.Close())
+
+	files, total, err := ListTarDirectory(bytes.NewReader(archive.Bytes()), ListOptions{}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Equal(t, []string{"localtime", "passwd", "ssl"}, []string{files[0].Name, files[1].Name, files[2].Name})
+	require.True(t, files[0].Symlink)
+	require.Equal(t, "/usr/share/zoneinfo/UTC", files[0].LinkTarget)
+	require.Equal(t, 1000, files[1].UID)
+	require.Equal(t, "0644", files[1].Mode)
+	require.True(t, files[2].Dir)
+
+	files, total, err = ListTarDirectory(bytes.NewReader(archive.Bytes()), ListOptions{Descending: true, Limit: 1}, 0)
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+	require.Len(t, files, 1)
+	require.Equal(t, "ssl", files[0].Name)
+
+	// Only the entries read before the limit are listed, each header uses a 512 bytes block
+	files, total, err = ListTarDirectory(bytes.NewReader(archive.Bytes()), ListOptions{}, 3*512)
+	require.ErrorIs(t, err, ErrListingTruncated)
+	require.Equal(t, 1, total)
+	require.Equal(t, "ssl", files[0].Name)
+}
+
+func TestTarFileRoundTrip(t *testing.T) {
+	var archive bytes.Buffer
+	require.NoError(t, WriteTarFile(&archive, "file.txt", 7, 0600, strings.NewReader("content")))
+
+	file, content, err := ReadTarFile(&archive)
+	require.NoError(t, err)
+	require.Equal(t, "file.txt", file.Name)
+	require.Equal(t, "0600", file.Mode)
+
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(data))
+}
@@ -0,0 +1,402 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/identifier"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// UploadsDirectory is the folder inside the agent data folder where the partial uploads are stored
+	UploadsDirectory = "uploads"
+	// UploadExpiration is the duration of inactivity after which a partial upload is removed
+	UploadExpiration = 24 * time.Hour
+	// uploadCleanupInterval is the interval used to remove the expired uploads
+	uploadCleanupInterval = time.Hour
+)
+
+var (
+	// ErrUploadNotFound is returned when the upload does not exist or has expired
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffsetMismatch is returned when a chunk does not start at the current offset of the upload
+	ErrUploadOffsetMismatch = errors.New("chunk offset does not match the upload offset")
+	// ErrUploadSizeExceeded is returned when a chunk goes beyond the declared size of the upload
+	ErrUploadSizeExceeded = errors.New("chunk exceeds the declared upload size")
+	// ErrUploadIncomplete is returned when an upload is finalized before all of its content is received
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	// ErrUploadChecksumMismatch is returned when the content of an upload does not match the expected checksum
+	ErrUploadChecksumMismatch = errors.New("upload checksum mismatch")
+	// ErrUploadDestinationExists is returned when the destination file exists and must not be overwritten
+	ErrUploadDestinationExists = errors.New("upload destination already exists")
+)
+
+// Upload represents a resumable upload, the content is written to a partial file inside the agent
+// data folder and moved to its destination once the upload is finalized.
+type Upload struct {
+	ID string `json:"ID"`
+	// Destination is the full path of the uploaded file
+	Destination string `json:"Destination"`
+	Filename    string `json:"Filename"`
+	Size        int64  `json:"Size"`
+	// Offset is the number of bytes received so far, the next chunk must start at this offset
+	Offset    int64 `json:"Offset"`
+	Overwrite bool  `json:"Overwrite"`
+	CreatedAt int64 `json:"CreatedAt"`
+	UpdatedAt int64 `json:"UpdatedAt"`
+}
+
+// UploadService is used to manage resumable uploads. The state of the uploads is persisted
+// inside the agent data folder so that they can be resumed after a connection drop or a restart.
+type UploadService struct {
+	directory string
+	locks     map[string]*uploadLock
+	mu        sync.Mutex
+}
+
+// uploadLock serializes the operations on an upload, it is removed once no operation uses it
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewUploadService returns a pointer to an UploadService storing the uploads inside the specified data folder
+func NewUploadService(dataPath string) *UploadService {
+	return &UploadService{
+		directory: filepath.Join(dataPath, UploadsDirectory),
+		locks:     make(map[string]*uploadLock),
+	}
+}
+
+// Start removes the expired uploads periodically until the context is done
+func (service *UploadService) Start(ctx context.Context) {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			service.removeExpiredUploads()
+		}
+	}
+}
+
+// Initiate creates a new upload of size bytes for the file filename inside the destination folder
+func (service *UploadService) Initiate(folder, filename string, size int64, overwrite bool) (*Upload, error) {
+	if filename == "" || strings.ContainsAny(filename, `/\`) || filename == "." || filename == ".." {
+		return nil, fmt.Errorf("invalid filename %q", filename)
+	}
+
+	if size < 0 {
+		return nil, errors.New("invalid upload size")
+	}
+
+	destination := filepath.Join(folder, filename)
+
+	if !overwrite {
+		exists, err := FileExists(destination)
+		if err != nil {
+			return nil, err
+		} else if exists {
+			return nil, ErrUploadDestinationExists
+		}
+	}
+
+	err := os.MkdirAll(service.directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	service.removeExpiredUploads()
+
+	id, err := identifier.New()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	upload := &Upload{
+		ID:          id,
+		Destination: destination,
+		Filename:    filename,
+		Size:        size,
+		Overwrite:   overwrite,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(service.statePath(id), data, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(service.partPath(id), nil, 0600)
+	if err != nil {
+		os.Remove(service.statePath(id))
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// Get returns an upload and its current offset
+func (service *UploadService) Get(id string) (*Upload, error) {
+	unlock, err := service.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return service.load(id)
+}
+
+// WriteChunk appends the content of r to the upload. The chunk must start at the current offset of the upload,
+// ErrUploadOffsetMismatch is returned otherwise along with the upload so that the client can resume from its offset.
+func (service *UploadService) WriteChunk(id string, offset int64, r io.Reader) (*Upload, error) {
+	unlock, err := service.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	upload, err := service.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset != upload.Offset {
+		return upload, ErrUploadOffsetMismatch
+	}
+
+	file, err := os.OpenFile(service.partPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Read one more byte than allowed to detect the chunks exceeding the declared size
+	written, err := io.Copy(file, io.LimitReader(r, upload.Size-upload.Offset+1))
+	if err == nil && upload.Offset+written > upload.Size {
+		// Only keep the content that fits in the declared size, the upload cannot be reported as complete otherwise
+		err = file.Truncate(upload.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ErrUploadSizeExceeded
+		written = upload.Size - upload.Offset
+	}
+
+	// The content received before an error is kept so that the upload can be resumed from there
+	syncErr := file.Sync()
+	if err == nil {
+		err = syncErr
+	}
+
+	upload.Offset += written
+	upload.UpdatedAt = time.Now().Unix()
+
+	return upload, err
+}
+
+// Finalize verifies the SHA-256 checksum (hex encoded) of a complete upload and moves it to its destination
+func (service *UploadService) Finalize(id, checksum string) (*Upload, error) {
+	unlock, err := service.lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	upload, err := service.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if upload.Offset != upload.Size {
+		return nil, ErrUploadIncomplete
+	}
+
+	actualChecksum, err := FileChecksum(service.partPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(actualChecksum, checksum) {
+		return nil, ErrUploadChecksumMismatch
+	}
+
+	exists, err := FileExists(upload.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		if !upload.Overwrite {
+			return nil, ErrUploadDestinationExists
+		}
+
+		err = os.Remove(upload.Destination)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(upload.Destination), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = MovePath(service.partPath(id), upload.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Chmod(upload.Destination, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	service.remove(id)
+
+	return upload, nil
+}
+
+// Abort removes an upload and its partial content
+func (service *UploadService) Abort(id string) error {
+	unlock, err := service.lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := service.load(id); err != nil {
+		return err
+	}
+
+	service.remove(id)
+
+	return nil
+}
+
+// lock serializes the operations on an upload, it returns the function used to release the lock
+func (service *UploadService) lock(id string) (func(), error) {
+	if !identifier.IsValid(id) {
+		return nil, ErrUploadNotFound
+	}
+
+	service.mu.Lock()
+	lock, ok := service.locks[id]
+	if !ok {
+		lock = &uploadLock{}
+		service.locks[id] = lock
+	}
+	lock.refs++
+	service.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		service.mu.Lock()
+		defer service.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(service.locks, id)
+		}
+	}, nil
+}
+
+func (service *UploadService) load(id string) (*Upload, error) {
+	data, err := os.ReadFile(service.statePath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var upload Upload
+	err = json.Unmarshal(data, &upload)
+	if err != nil {
+		return nil, err
+	}
+
+	// The offset is the size of the partial file so that it is always accurate, even after a crash
+	partInfo, err := os.Stat(service.partPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	upload.Offset = partInfo.Size()
+	upload.UpdatedAt = partInfo.ModTime().Unix()
+
+	return &upload, nil
+}
+
+// remove must be called while holding the lock of the upload
+func (service *UploadService) remove(id string) {
+	os.Remove(service.partPath(id))
+	os.Remove(service.statePath(id))
+}
+
+// removeExpiredUploads removes the uploads that have not received any content for UploadExpiration
+func (service *UploadService) removeExpiredUploads() {
+	stateFiles, err := filepath.Glob(filepath.Join(service.directory, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, stateFile := range stateFiles {
+		service.removeIfExpired(strings.TrimSuffix(filepath.Base(stateFile), ".json"))
+	}
+}
+
+func (service *UploadService) removeIfExpired(id string) {
+	unlock, err := service.lock(id)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	// The partial file of an upload being initiated is not created yet, the state file is used instead
+	info, err := os.Stat(service.partPath(id))
+	if os.IsNotExist(err) {
+		info, err = os.Stat(service.statePath(id))
+	}
+
+	if err == nil && time.Since(info.ModTime()) < UploadExpiration {
+		return
+	}
+
+	log.Info().Str("upload_id", id).Msg("removing expired upload")
+
+	service.remove(id)
+}
+
+func (service *UploadService) statePath(id string) string {
+	return filepath.Join(service.directory, id+".json")
+}
+
+func (service *UploadService) partPath(id string) string {
+	return filepath.Join(service.directory, id+".part")
+}
@@ -0,0 +1,101 @@
+package filesystem
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumableUpload(t *testing.T) {
+	destination := t.TempDir()
+	service := NewUploadService(t.TempDir())
+
+	content := "hello resumable world"
+	checksum := sha256.Sum256([]byte(content))
+
+	upload, err := service.Initiate(destination, "file.txt", int64(len(content)), false)
+	require.NoError(t, err)
+
+	upload, err = service.WriteChunk(upload.ID, 0, strings.NewReader(content[:5]))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), upload.Offset)
+
+	// A chunk sent again after a connection drop is rejected with the offset to resume from
+	upload, err = service.WriteChunk(upload.ID, 0, strings.NewReader(content[:5]))
+	require.ErrorIs(t, err, ErrUploadOffsetMismatch)
+	require.Equal(t, int64(5), upload.Offset)
+
+	// The upload can be resumed by another service instance (i.e. after a restart)
+	service = NewUploadService(filepath.Dir(service.directory))
+
+	upload, err = service.Get(upload.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), upload.Offset)
+
+	_, err = service.Finalize(upload.ID, hex.EncodeToString(checksum[:]))
+	require.ErrorIs(t, err, ErrUploadIncomplete)
+
+	_, err = service.WriteChunk(upload.ID, 5, strings.NewReader(content[5:]+"extra"))
+	require.ErrorIs(t, err, ErrUploadSizeExceeded)
+
+	_, err = service.Finalize(upload.ID, strings.Repeat("0", 64))
+	require.ErrorIs(t, err, ErrUploadChecksumMismatch)
+
+	_, err = service.Finalize(upload.ID, hex.EncodeToString(checksum[:]))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(destination, "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	_, err = service.Get(upload.ID)
+	require.ErrorIs(t, err, ErrUploadNotFound)
+
+	// The locks of the uploads are released once they are not used anymore
+	require.Empty(t, service.locks)
+}
+
+func TestRemoveExpiredUploads(t *testing.T) {
+	service := NewUploadService(t.TempDir())
+
+	expired, err := service.Initiate(t.TempDir(), "expired.txt", 10, false)
+	require.NoError(t, err)
+
+	active, err := service.Initiate(t.TempDir(), "active.txt", 10, false)
+	require.NoError(t, err)
+
+	modTime := time.Now().Add(-UploadExpiration - time.Minute)
+	require.NoError(t, os.Chtimes(service.partPath(expired.ID), modTime, modTime))
+
+	service.removeExpiredUploads()
+
+	_, err = service.Get(expired.ID)
+	require.ErrorIs(t, err, ErrUploadNotFound)
+
+	_, err = service.Get(active.ID)
+	require.NoError(t, err)
+
+	require.Empty(t, service.locks)
+}
+
+func TestUploadInitiateValidation(t *testing.T) {
+	destination := t.TempDir()
+	service := NewUploadService(t.TempDir())
+
+	_, err := service.Initiate(destination, "../file.txt", 1, false)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(destination, "existing"), nil, 0644))
+
+	_, err = service.Initiate(destination, "existing", 1, false)
+	require.ErrorIs(t, err, ErrUploadDestinationExists)
+
+	_, err = service.Get("../../etc/passwd")
+	require.ErrorIs(t, err, ErrUploadNotFound)
+}
@@ -0,0 +1,18 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+func (handler *Handler) agentEvents(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.clusterService == nil {
+		return httperror.NewError(http.StatusServiceUnavailable, "Agent management is not available when running the agent on a standalone engine", errors.New("Agent management is disabled"))
+	}
+
+	events := handler.clusterService.MemberEvents()
+	return response.JSON(w, events)
+}
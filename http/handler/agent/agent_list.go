@@ -13,6 +13,6 @@ func (handler *Handler) agentList(w http.ResponseWriter, r *http.Request) *httpe
 		return httperror.NewError(http.StatusServiceUnavailable, "Agent management is not available when running the agent on a standalone engine", errors.New("Agent management is disabled"))
 	}
 
-	members := handler.clusterService.Members()
+	members := handler.clusterService.MemberDetails()
 	return response.JSON(w, members)
 }
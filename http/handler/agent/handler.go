@@ -25,6 +25,8 @@ func NewHandler(cs agent.ClusterService, notaryService *security.NotaryService)
 
 	h.Handle("/agents",
 		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.agentList))).Methods(http.MethodGet)
+	h.Handle("/agents/events",
+		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.agentEvents))).Methods(http.MethodGet)
 
 	return h
 }
@@ -0,0 +1,49 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker/backup"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type backupCreatePayload struct {
+	VolumeName string
+	// PauseContainers pauses the running containers using the volume while it is archived
+	PauseContainers bool
+	// Storage is either local (default) or s3
+	Storage string
+}
+
+func (payload *backupCreatePayload) Validate(r *http.Request) error {
+	if len(payload.VolumeName) == 0 {
+		return errors.New("VolumeName is invalid")
+	}
+	if payload.Storage != "" && payload.Storage != backup.StorageLocal && payload.Storage != backup.StorageS3 {
+		return errors.New("Storage is invalid")
+	}
+	return nil
+}
+
+// POST request on /backups
+// Creates a backup of a volume, the request returns once the archive is stored
+func (handler *Handler) backupCreate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload backupCreatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	createdBackup, err := handler.backupService.Create(r.Context(), payload.VolumeName, backup.CreateOptions{
+		PauseContainers: payload.PauseContainers,
+		Storage:         payload.Storage,
+	})
+	if err != nil {
+		return backupError("Unable to create backup", err)
+	}
+
+	return response.JSON(rw, createdBackup)
+}
@@ -0,0 +1,25 @@
+package backup
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// DELETE request on /backups/{id}
+// Removes a backup along with its archive
+func (handler *Handler) backupDelete(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	backupID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid backup identifier route variable", err)
+	}
+
+	err = handler.backupService.Delete(r.Context(), backupID)
+	if err != nil {
+		return backupError("Unable to remove backup", err)
+	}
+
+	return response.Empty(rw)
+}
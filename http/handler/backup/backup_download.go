@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /backups/{id}/download
+// Streams the tar.gz archive of a backup, including the backups stored on S3
+func (handler *Handler) backupDownload(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	backupID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid backup identifier route variable", err)
+	}
+
+	archive, backup, err := handler.backupService.Open(r.Context(), backupID)
+	if err != nil {
+		return backupError("Unable to open backup", err)
+	}
+	defer archive.Close()
+
+	rw.Header().Set("Content-Type", "application/gzip")
+	rw.Header().Set("Content-Length", strconv.FormatInt(backup.Size, 10))
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s-%s.tar.gz", backup.VolumeName, backup.ID)))
+
+	// The response is already being streamed, errors can only be logged
+	_, err = io.Copy(rw, archive)
+	if err != nil {
+		log.Error().Err(err).Str("backup_id", backup.ID).Msg("unable to stream the backup archive")
+	}
+
+	return nil
+}
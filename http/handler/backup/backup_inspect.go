@@ -0,0 +1,24 @@
+package backup
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /backups/{id}
+func (handler *Handler) backupInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	backupID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid backup identifier route variable", err)
+	}
+
+	backup, err := handler.backupService.Get(backupID)
+	if err != nil {
+		return backupError("Unable to retrieve backup", err)
+	}
+
+	return response.JSON(rw, backup)
+}
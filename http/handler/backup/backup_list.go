@@ -0,0 +1,22 @@
+package backup
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /backups?volume=:name
+// Lists the backups of a volume, or all the backups when no volume is specified, the most recent first
+func (handler *Handler) backupList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeName, _ := request.RetrieveQueryParameter(r, "volume", true)
+
+	backups, err := handler.backupService.List(volumeName)
+	if err != nil {
+		return httperror.InternalServerError("Unable to list backups", err)
+	}
+
+	return response.JSON(rw, backups)
+}
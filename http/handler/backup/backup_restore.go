@@ -0,0 +1,54 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent/docker/backup"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type backupRestorePayload struct {
+	// VolumeName is the volume where the backup is restored, it is created when it does not exist.
+	// The volume of the backup is used when empty.
+	VolumeName string
+	// Overwrite removes the existing content of the volume before restoring the backup
+	Overwrite bool
+	// PauseContainers pauses the running containers using the volume while the backup is restored
+	PauseContainers bool
+}
+
+func (payload *backupRestorePayload) Validate(r *http.Request) error {
+	if payload.VolumeName != "" && !backup.IsValidVolumeName(payload.VolumeName) {
+		return errors.New("VolumeName is invalid")
+	}
+	return nil
+}
+
+// POST request on /backups/{id}/restore
+// Restores a backup into a new or existing volume
+func (handler *Handler) backupRestore(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	backupID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid backup identifier route variable", err)
+	}
+
+	var payload backupRestorePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	err = handler.backupService.Restore(r.Context(), backupID, backup.RestoreOptions{
+		VolumeName:      payload.VolumeName,
+		Overwrite:       payload.Overwrite,
+		PauseContainers: payload.PauseContainers,
+	})
+	if err != nil {
+		return backupError("Unable to restore backup", err)
+	}
+
+	return response.Empty(rw)
+}
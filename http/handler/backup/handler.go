@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/portainer/agent/docker/backup"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler is the HTTP handler used to handle volume backup operations.
+type Handler struct {
+	*mux.Router
+	backupService *backup.Service
+}
+
+// NewHandler returns a pointer to an Handler
+// It sets the associated handle functions for all the volume backup related HTTP endpoints.
+// The backups are stored on the node where they are created, the requests must target this node.
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, backupService *backup.Service) *Handler {
+	h := &Handler{
+		Router:        mux.NewRouter(),
+		backupService: backupService,
+	}
+
+	h.Handle("/backups",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupList)))).Methods(http.MethodGet)
+	h.Handle("/backups",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupCreate)))).Methods(http.MethodPost)
+	h.Handle("/backups/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupInspect)))).Methods(http.MethodGet)
+	h.Handle("/backups/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupDelete)))).Methods(http.MethodDelete)
+	h.Handle("/backups/{id}/download",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupDownload)))).Methods(http.MethodGet)
+	h.Handle("/backups/{id}/restore",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.backupRestore)))).Methods(http.MethodPost)
+
+	return h
+}
+
+// backupError converts the errors of the backup service to HTTP errors
+func backupError(message string, err error) *httperror.HandlerError {
+	switch {
+	case errors.Is(err, backup.ErrBackupNotFound):
+		return httperror.NotFound("Unable to find the backup", err)
+	case errors.Is(err, backup.ErrVolumeNotFound):
+		return httperror.NotFound("Unable to find the volume", err)
+	case errors.Is(err, backup.ErrVolumeNotEmpty):
+		return httperror.Conflict("The volume is not empty, the backup can only be restored by overwriting its content", err)
+	case errors.Is(err, backup.ErrInvalidVolumeName):
+		return httperror.BadRequest("Invalid volume name", err)
+	case errors.Is(err, backup.ErrS3NotConfigured):
+		return httperror.BadRequest("No S3 storage is configured on the agent", err)
+	}
+
+	return httperror.InternalServerError(message, err)
+}
@@ -0,0 +1,132 @@
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /browse/archive?volumeID=:id&path=:path&format=:format
+// Streams the content of a directory as a tar.gz (default) or zip archive
+func (handler *Handler) browseArchiveGet(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	directoryPath, err := request.RetrieveQueryParameter(r, "path", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	format, err := retrieveArchiveFormat(r)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: format", err)
+	}
+
+	if volumeID != "" {
+		directoryPath, err = filesystem.BuildPathToFileInsideVolume(volumeID, directoryPath)
+		if err != nil {
+			return httperror.BadRequest("Invalid volume", err)
+		}
+	} else if directoryPath == "" {
+		return httperror.BadRequest("Invalid query parameter: path", errors.New("a path is required when no volume is specified"))
+	}
+
+	size, err := filesystem.DirectorySize(directoryPath)
+	if err != nil {
+		return httperror.InternalServerError("Unable to read directory", err)
+	}
+
+	if handler.archiveMaxSize > 0 && size > handler.archiveMaxSize {
+		return httperror.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Directory content exceeds the maximum archive size of %d bytes", handler.archiveMaxSize), filesystem.ErrArchiveTooLarge)
+	}
+
+	archiveName := path.Base(directoryPath)
+	if volumeID != "" && archiveName == "_data" {
+		archiveName = volumeID
+	}
+	archiveName += "." + format
+
+	rw.Header().Set("Content-Type", archiveContentType(format))
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveName))
+
+	// The response is already being streamed, errors can only be logged
+	err = filesystem.WriteArchive(rw, directoryPath, format)
+	if err != nil {
+		log.Error().Err(err).Str("path", directoryPath).Msg("unable to stream the directory archive")
+	}
+
+	return nil
+}
+
+// POST request on /browse/archive?volumeID=:id&format=:format
+// Extracts an uploaded tar.gz (default) or zip archive inside the target directory
+func (handler *Handler) browseArchivePut(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+
+	format, err := retrieveArchiveFormat(r)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: format", err)
+	}
+
+	file, fileheader, err := r.FormFile("file")
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+	defer file.Close()
+
+	destination := ""
+	if vs := r.Form["Path"]; len(vs) > 0 {
+		destination = vs[0]
+	} else {
+		return httperror.BadRequest("Invalid request payload", errors.New("invalid file path"))
+	}
+
+	if volumeID != "" {
+		destination, err = filesystem.BuildPathToFileInsideVolume(volumeID, destination)
+		if err != nil {
+			return httperror.BadRequest("Invalid volume", err)
+		}
+	}
+
+	switch format {
+	case filesystem.ArchiveFormatZip:
+		err = filesystem.ExtractZipArchive(file, fileheader.Size, destination, handler.archiveMaxSize)
+	default:
+		err = filesystem.ExtractTarGzArchive(file, destination, handler.archiveMaxSize)
+	}
+
+	if errors.Is(err, filesystem.ErrArchiveTooLarge) {
+		return httperror.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Archive content exceeds the maximum size of %d bytes", handler.archiveMaxSize), err)
+	} else if err != nil {
+		return httperror.BadRequest("Unable to extract archive", err)
+	}
+
+	return response.Empty(rw)
+}
+
+func retrieveArchiveFormat(r *http.Request) (string, error) {
+	format, _ := request.RetrieveQueryParameter(r, "format", true)
+	if format == "" {
+		return filesystem.ArchiveFormatTarGz, nil
+	}
+
+	if !filesystem.IsValidArchiveFormat(format) {
+		return "", fmt.Errorf("unsupported archive format %q, must be one of %s or %s", format, filesystem.ArchiveFormatTarGz, filesystem.ArchiveFormatZip)
+	}
+
+	return format, nil
+}
+
+func archiveContentType(format string) string {
+	if format == filesystem.ArchiveFormatZip {
+		return "application/zip"
+	}
+
+	return "application/gzip"
+}
@@ -0,0 +1,112 @@
+package browse
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type browseChmodPayload struct {
+	Path string
+	// Mode is expressed in octal notation (e.g. 0644)
+	Mode      string
+	Recursive bool
+
+	mode os.FileMode
+}
+
+func (payload *browseChmodPayload) Validate(r *http.Request) error {
+	if len(payload.Path) == 0 {
+		return errors.New("Path is invalid")
+	}
+
+	mode, err := filesystem.ParseMode(payload.Mode)
+	if err != nil {
+		return err
+	}
+	payload.mode = mode
+
+	return nil
+}
+
+type browseChownPayload struct {
+	Path string
+	// UID and GID are not changed when they are not specified
+	UID       *int
+	GID       *int
+	Recursive bool
+}
+
+func (payload *browseChownPayload) Validate(r *http.Request) error {
+	if len(payload.Path) == 0 {
+		return errors.New("Path is invalid")
+	}
+	if payload.UID == nil && payload.GID == nil {
+		return errors.New("At least one of UID or GID must be specified")
+	}
+	if (payload.UID != nil && *payload.UID < 0) || (payload.GID != nil && *payload.GID < 0) {
+		return errors.New("UID and GID must be positive")
+	}
+	return nil
+}
+
+// PUT request on /browse/chmod?volumeID=:id
+func (handler *Handler) browseChmod(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseChmodPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	payload.Path, err = buildPath(volumeID, payload.Path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	err = filesystem.ChangeMode(payload.Path, payload.mode, payload.Recursive)
+	if os.IsNotExist(err) {
+		return httperror.NotFound("Unable to find file", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to change file mode", err)
+	}
+
+	return response.Empty(rw)
+}
+
+// PUT request on /browse/chown?volumeID=:id
+func (handler *Handler) browseChown(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseChownPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	payload.Path, err = buildPath(volumeID, payload.Path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	uid, gid := -1, -1
+	if payload.UID != nil {
+		uid = *payload.UID
+	}
+	if payload.GID != nil {
+		gid = *payload.GID
+	}
+
+	err = filesystem.ChangeOwner(payload.Path, uid, gid, payload.Recursive)
+	if os.IsNotExist(err) {
+		return httperror.NotFound("Unable to find file", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to change file owner", err)
+	}
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,237 @@
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/portainer/agent/docker"
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/rs/zerolog/log"
+)
+
+// The files of a container are accessed through the Docker archive API so that the files outside of
+// the volumes can be browsed. The requests must target the node hosting the container.
+
+// GET request on /browse/containers/{id}/ls?path=:path&sort=:sort&order=:order&start=:start&limit=:limit
+// The sort, order and pagination parameters are the same as the ones of /browse/ls
+func (handler *Handler) browseContainerList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	directoryPath, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	sortBy, _ := request.RetrieveQueryParameter(r, "sort", true)
+	if sortBy != "" && sortBy != filesystem.SortByName && sortBy != filesystem.SortBySize && sortBy != filesystem.SortByModTime {
+		return httperror.BadRequest("Invalid query parameter: sort", errors.New("sort must be one of name, size or modTime"))
+	}
+
+	order, _ := request.RetrieveQueryParameter(r, "order", true)
+	if order != "" && order != "asc" && order != "desc" {
+		return httperror.BadRequest("Invalid query parameter: order", errors.New("order must be either asc or desc"))
+	}
+
+	start, err := request.RetrieveNumericQueryParameter(r, "start", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: start", err)
+	}
+
+	limit, err := request.RetrieveNumericQueryParameter(r, "limit", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: limit", err)
+	}
+
+	stat, err := docker.ContainerStatPath(containerID, directoryPath)
+	if err != nil {
+		return containerFileError("Unable to read the directory inside the container", err)
+	}
+
+	if !stat.Mode.IsDir() {
+		return httperror.BadRequest("Invalid query parameter: path", errors.New("the path is not a directory"))
+	}
+
+	options := filesystem.ListOptions{
+		SortBy:     sortBy,
+		Descending: order == "desc",
+		Start:      start,
+		Limit:      limit,
+	}
+
+	// The directory is listed with find and stat inside the container so that only its own entries are read,
+	// its archive, which contains the whole directory tree, is only used when the command cannot be run
+	files, total, err := listContainerDirectory(containerID, directoryPath, options, handler.archiveMaxSize)
+	if err != nil && !errors.Is(err, filesystem.ErrListingTruncated) {
+		log.Debug().Err(err).Str("container_id", containerID).Msg("unable to list the directory with stat, falling back to its archive")
+
+		files, total, err = listContainerArchive(containerID, directoryPath, options, handler.archiveMaxSize)
+	}
+
+	// The output is read up to the maximum archive size, the listing of larger directories is partial
+	if errors.Is(err, filesystem.ErrListingTruncated) {
+		rw.Header().Set("X-Listing-Truncated", "true")
+	} else if err != nil {
+		return containerFileError("Unable to list files inside specified directory", err)
+	}
+
+	rw.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	return response.JSON(rw, files)
+}
+
+// listContainerDirectory lists a directory by running find and stat inside the container
+func listContainerDirectory(containerID, directoryPath string, options filesystem.ListOptions, maxReadSize int64) ([]filesystem.FileInfo, int, error) {
+	output, err := docker.ContainerExecOutput(containerID, filesystem.StatListingCommand(directoryPath))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer output.Close()
+
+	files, total, err := filesystem.ListStatOutput(output, options, maxReadSize)
+	if err != nil && !errors.Is(err, filesystem.ErrListingTruncated) {
+		return nil, 0, err
+	}
+
+	// stat does not print the targets of the symbolic links, they are only requested for the returned page
+	for i := range files {
+		if !files[i].Symlink {
+			continue
+		}
+
+		linkStat, statErr := docker.ContainerStatPath(containerID, path.Join(directoryPath, files[i].Name))
+		if statErr == nil {
+			files[i].LinkTarget = linkStat.LinkTarget
+		}
+	}
+
+	return files, total, err
+}
+
+// listContainerArchive lists a directory by reading its archive, which contains the whole directory tree
+func listContainerArchive(containerID, directoryPath string, options filesystem.ListOptions, maxReadSize int64) ([]filesystem.FileInfo, int, error) {
+	archive, _, err := docker.CopyFromContainer(containerID, directoryPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer archive.Close()
+
+	return filesystem.ListTarDirectory(archive, options, maxReadSize)
+}
+
+// GET request on /browse/containers/{id}/get?path=:path
+// Downloads a file from a container, directories are downloaded as tar archives
+func (handler *Handler) browseContainerGet(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	filePath, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	archive, stat, err := docker.CopyFromContainer(containerID, filePath)
+	if err != nil {
+		return containerFileError("Unable to read the file inside the container", err)
+	}
+	defer archive.Close()
+
+	content := io.Reader(archive)
+	filename := stat.Name
+
+	if stat.Mode.IsDir() {
+		filename += ".tar"
+
+		rw.Header().Set("Content-Type", "application/x-tar")
+	} else {
+		var file filesystem.FileInfo
+
+		file, content, err = filesystem.ReadTarFile(archive)
+		if errors.Is(err, filesystem.ErrNotRegularFile) {
+			return httperror.BadRequest("Invalid query parameter: path", errors.New("the path is neither a regular file nor a directory"))
+		} else if err != nil {
+			return httperror.InternalServerError("Unable to read the file inside the container", err)
+		}
+
+		rw.Header().Set("Content-Type", "application/octet-stream")
+		rw.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+	}
+
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// The response is already being streamed, errors can only be logged
+	_, err = io.Copy(rw, content)
+	if err != nil {
+		log.Error().Err(err).Str("container_id", containerID).Str("path", filePath).Msg("unable to stream the container file")
+	}
+
+	return nil
+}
+
+// POST request on /browse/containers/{id}/put
+// Uploads a file inside a directory of a container, the multipart form contains the file and the Path of the directory
+func (handler *Handler) browseContainerPut(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	containerID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid container identifier route variable", err)
+	}
+
+	file, fileheader, err := r.FormFile("file")
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+	defer file.Close()
+
+	destination := ""
+	if vs := r.Form["Path"]; len(vs) > 0 {
+		destination = vs[0]
+	} else {
+		return httperror.BadRequest("Invalid request payload", errors.New("invalid file path"))
+	}
+
+	filename := path.Base(fileheader.Filename)
+	if filename == "." || filename == ".." || filename == "/" {
+		return httperror.BadRequest("Invalid filename", fmt.Errorf("invalid filename %q", fileheader.Filename))
+	}
+
+	archive, writer := io.Pipe()
+
+	go func() {
+		writer.CloseWithError(filesystem.WriteTarFile(writer, filename, fileheader.Size, 0644, file))
+	}()
+
+	err = docker.CopyToContainer(containerID, destination, archive)
+	archive.Close()
+	if err != nil {
+		return containerFileError("Unable to copy the file inside the container", err)
+	}
+
+	return response.Empty(rw)
+}
+
+// containerFileError converts the errors of the Docker archive API to HTTP errors
+func containerFileError(message string, err error) *httperror.HandlerError {
+	switch {
+	case errdefs.IsNotFound(err):
+		return httperror.NotFound("Unable to find the container or the path inside the container", err)
+	case errdefs.IsInvalidParameter(err):
+		return httperror.BadRequest(message, err)
+	case errdefs.IsForbidden(err):
+		return httperror.Forbidden(message, err)
+	}
+
+	return httperror.InternalServerError(message, err)
+}
@@ -0,0 +1,99 @@
+package browse
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type browseCopyPayload struct {
+	Source      string
+	Destination string
+}
+
+func (payload *browseCopyPayload) Validate(r *http.Request) error {
+	if len(payload.Source) == 0 {
+		return errors.New("Source path is invalid")
+	}
+	if len(payload.Destination) == 0 {
+		return errors.New("Destination path is invalid")
+	}
+	return nil
+}
+
+// resolve builds the source and destination paths and ensures that the destination does not exist
+func (payload *browseCopyPayload) resolve(volumeID string) *httperror.HandlerError {
+	var err error
+
+	payload.Source, err = buildPath(volumeID, payload.Source)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	payload.Destination, err = buildPath(volumeID, payload.Destination)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	exists, err := filesystem.FileExists(payload.Destination)
+	if err != nil {
+		return httperror.InternalServerError("Unable to check the destination path", err)
+	} else if exists {
+		return httperror.Conflict("The destination path already exists", errors.New("destination already exists"))
+	}
+
+	return nil
+}
+
+// POST request on /browse/copy?volumeID=:id
+// Copies a file or a directory recursively
+func (handler *Handler) browseCopy(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseCopyPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	if httpErr := payload.resolve(volumeID); httpErr != nil {
+		return httpErr
+	}
+
+	err = filesystem.CopyPath(payload.Source, payload.Destination)
+	if os.IsNotExist(err) {
+		return httperror.NotFound("Unable to find the source path", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to copy file", err)
+	}
+
+	return response.Empty(rw)
+}
+
+// PUT request on /browse/move?volumeID=:id
+// Moves a file or a directory, possibly to another directory
+func (handler *Handler) browseMove(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseCopyPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	if httpErr := payload.resolve(volumeID); httpErr != nil {
+		return httpErr
+	}
+
+	err = filesystem.MovePath(payload.Source, payload.Destination)
+	if os.IsNotExist(err) {
+		return httperror.NotFound("Unable to find the source path", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to move file", err)
+	}
+
+	return response.Empty(rw)
+}
@@ -1,7 +1,9 @@
 package browse
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/portainer/agent/filesystem"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
@@ -9,7 +11,10 @@ import (
 	"github.com/portainer/portainer/pkg/libhttp/response"
 )
 
-// GET request on /browse/ls?volumeID=:id&path=:path
+// GET request on /browse/ls?volumeID=:id&path=:path&sort=:sort&order=:order&start=:start&limit=:limit
+// The files are sorted by name, size or modTime (name by default) in asc or desc order (asc by default).
+// When start or limit are specified, a page of files is returned and the total number of files
+// is available in the X-Total-Count header.
 func (handler *Handler) browseList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
 	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
 	path, err := request.RetrieveQueryParameter(r, "path", false)
@@ -17,6 +22,26 @@ func (handler *Handler) browseList(rw http.ResponseWriter, r *http.Request) *htt
 		return httperror.BadRequest("Invalid query parameter: path", err)
 	}
 
+	sortBy, _ := request.RetrieveQueryParameter(r, "sort", true)
+	if sortBy != "" && sortBy != filesystem.SortByName && sortBy != filesystem.SortBySize && sortBy != filesystem.SortByModTime {
+		return httperror.BadRequest("Invalid query parameter: sort", errors.New("sort must be one of name, size or modTime"))
+	}
+
+	order, _ := request.RetrieveQueryParameter(r, "order", true)
+	if order != "" && order != "asc" && order != "desc" {
+		return httperror.BadRequest("Invalid query parameter: order", errors.New("order must be either asc or desc"))
+	}
+
+	start, err := request.RetrieveNumericQueryParameter(r, "start", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: start", err)
+	}
+
+	limit, err := request.RetrieveNumericQueryParameter(r, "limit", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: limit", err)
+	}
+
 	if volumeID != "" {
 		path, err = filesystem.BuildPathToFileInsideVolume(volumeID, path)
 		if err != nil {
@@ -24,11 +49,18 @@ func (handler *Handler) browseList(rw http.ResponseWriter, r *http.Request) *htt
 		}
 	}
 
-	files, err := filesystem.ListFilesInsideDirectory(path)
+	files, total, err := filesystem.ListFilesInsideDirectoryWithOptions(path, filesystem.ListOptions{
+		SortBy:     sortBy,
+		Descending: order == "desc",
+		Start:      start,
+		Limit:      limit,
+	})
 	if err != nil {
 		return httperror.InternalServerError("Unable to list files inside specified directory", err)
 	}
 
+	rw.Header().Set("X-Total-Count", strconv.Itoa(total))
+
 	return response.JSON(rw, files)
 }
 
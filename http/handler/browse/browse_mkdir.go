@@ -0,0 +1,59 @@
+package browse
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+type browseMkdirPayload struct {
+	Path string
+	// Mode is expressed in octal notation, defaults to 0755
+	Mode string
+
+	mode os.FileMode
+}
+
+func (payload *browseMkdirPayload) Validate(r *http.Request) error {
+	if len(payload.Path) == 0 {
+		return errors.New("Path is invalid")
+	}
+
+	payload.mode = 0755
+	if payload.Mode != "" {
+		mode, err := filesystem.ParseMode(payload.Mode)
+		if err != nil {
+			return err
+		}
+		payload.mode = mode
+	}
+
+	return nil
+}
+
+// POST request on /browse/mkdir?volumeID=:id
+func (handler *Handler) browseMkdir(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseMkdirPayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	payload.Path, err = buildPath(volumeID, payload.Path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	err = filesystem.CreateDirectory(payload.Path, payload.mode)
+	if err != nil {
+		return httperror.InternalServerError("Unable to create directory", err)
+	}
+
+	return response.Empty(rw)
+}
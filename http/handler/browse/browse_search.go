@@ -0,0 +1,62 @@
+package browse
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+const (
+	defaultSearchLimit = 1000
+	maxSearchLimit     = 10000
+)
+
+// GET request on /browse/search?volumeID=:id&path=:path&pattern=:pattern&limit=:limit
+// Searches the files whose name matches the pattern inside a directory and its sub-directories.
+// The X-Search-Truncated header is set to true when more files than the limit match.
+func (handler *Handler) browseSearch(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	path, err := request.RetrieveQueryParameter(r, "path", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	pattern, err := request.RetrieveQueryParameter(r, "pattern", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: pattern", err)
+	}
+
+	limit, err := request.RetrieveNumericQueryParameter(r, "limit", true)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: limit", err)
+	}
+
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	} else if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	if volumeID == "" && path == "" {
+		return httperror.BadRequest("Invalid query parameter: path", errors.New("a path is required when no volume is specified"))
+	}
+
+	path, err = buildPath(volumeID, path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	files, err := filesystem.SearchFiles(path, pattern, limit)
+	if err != nil && !errors.Is(err, filesystem.ErrSearchLimitReached) {
+		return httperror.InternalServerError("Unable to search files", err)
+	}
+
+	rw.Header().Set("X-Search-Truncated", strconv.FormatBool(err != nil))
+
+	return response.JSON(rw, files)
+}
@@ -0,0 +1,35 @@
+package browse
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /browse/stat?volumeID=:id&path=:path
+// Returns the details of a file, symbolic links are not followed so that their target can be inspected
+func (handler *Handler) browseStat(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	path, err := request.RetrieveQueryParameter(r, "path", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: path", err)
+	}
+
+	path, err = buildPath(volumeID, path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	file, err := filesystem.StatFile(path)
+	if os.IsNotExist(err) {
+		return httperror.NotFound("Unable to find file", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to retrieve file details", err)
+	}
+
+	return response.JSON(rw, file)
+}
@@ -0,0 +1,200 @@
+package browse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// maxUploadChunkSize is the maximum size of a chunk, it keeps each request well within the server read timeout
+const maxUploadChunkSize = 64 << 20 // 64 MB
+
+type browseUploadInitiatePayload struct {
+	// Path is the folder where the file is uploaded
+	Path     string
+	Filename string
+	Size     int64
+	// Overwrite replaces the destination file if it already exists
+	Overwrite bool
+}
+
+func (payload *browseUploadInitiatePayload) Validate(r *http.Request) error {
+	if len(payload.Path) == 0 {
+		return errors.New("Path is invalid")
+	}
+	if len(payload.Filename) == 0 {
+		return errors.New("Filename is invalid")
+	}
+	if payload.Size < 0 {
+		return errors.New("Size is invalid")
+	}
+	return nil
+}
+
+type browseUploadFinalizePayload struct {
+	// Checksum is the hex encoded SHA-256 checksum of the uploaded file
+	Checksum string
+}
+
+func (payload *browseUploadFinalizePayload) Validate(r *http.Request) error {
+	if len(payload.Checksum) == 0 {
+		return errors.New("Checksum is invalid")
+	}
+	return nil
+}
+
+type browseUploadResponse struct {
+	*filesystem.Upload
+	// NodeName is the node storing the upload, it must be targeted by all the requests related to the upload
+	NodeName string `json:"NodeName"`
+}
+
+// POST request on /browse/upload?volumeID=:id
+// Initiates a resumable upload, the content is then sent in chunks and the upload is finalized with its checksum
+func (handler *Handler) browseUploadInitiate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	volumeID, _ := request.RetrieveQueryParameter(r, "volumeID", true)
+	var payload browseUploadInitiatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	payload.Path, err = buildPath(volumeID, payload.Path)
+	if err != nil {
+		return httperror.BadRequest("Invalid volume", err)
+	}
+
+	upload, err := handler.uploadService.Initiate(payload.Path, payload.Filename, payload.Size, payload.Overwrite)
+	if errors.Is(err, filesystem.ErrUploadDestinationExists) {
+		return httperror.Conflict("The destination file already exists", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to initiate upload", err)
+	}
+
+	return handler.uploadResponse(rw, upload)
+}
+
+// GET request on /browse/upload/:id
+// Returns the upload along with the offset from which it must be resumed
+func (handler *Handler) browseUploadInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	uploadID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid upload identifier route variable", err)
+	}
+
+	upload, err := handler.uploadService.Get(uploadID)
+	if err != nil {
+		return uploadError(err, "Unable to retrieve upload")
+	}
+
+	return handler.uploadResponse(rw, upload)
+}
+
+// PUT request on /browse/upload/:id?offset=:offset
+// Appends the request body to the upload, the offset must match the current offset of the upload
+func (handler *Handler) browseUploadChunk(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	uploadID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid upload identifier route variable", err)
+	}
+
+	offsetValue, err := request.RetrieveQueryParameter(r, "offset", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: offset", err)
+	}
+
+	offset, err := strconv.ParseInt(offsetValue, 10, 64)
+	if err != nil || offset < 0 {
+		return httperror.BadRequest("Invalid query parameter: offset", errors.New("offset must be a positive integer"))
+	}
+
+	if r.ContentLength > maxUploadChunkSize {
+		return httperror.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Chunks cannot exceed %d bytes", maxUploadChunkSize), errors.New("chunk too large"))
+	}
+
+	r.Body = http.MaxBytesReader(rw, r.Body, maxUploadChunkSize)
+
+	upload, err := handler.uploadService.WriteChunk(uploadID, offset, r.Body)
+	if err != nil {
+		if errors.Is(err, filesystem.ErrUploadOffsetMismatch) {
+			return httperror.Conflict(fmt.Sprintf("Invalid chunk offset, the upload must be resumed from offset %d", upload.Offset), err)
+		}
+
+		return uploadError(err, "Unable to write upload chunk")
+	}
+
+	return handler.uploadResponse(rw, upload)
+}
+
+// POST request on /browse/upload/:id/finalize
+// Verifies the checksum of the upload and moves the file to its destination
+func (handler *Handler) browseUploadFinalize(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	uploadID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid upload identifier route variable", err)
+	}
+
+	var payload browseUploadFinalizePayload
+	err = request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	upload, err := handler.uploadService.Finalize(uploadID, payload.Checksum)
+	if err != nil {
+		return uploadError(err, "Unable to finalize upload")
+	}
+
+	return handler.uploadResponse(rw, upload)
+}
+
+// DELETE request on /browse/upload/:id
+// Aborts an upload and removes its partial content
+func (handler *Handler) browseUploadAbort(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	uploadID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid upload identifier route variable", err)
+	}
+
+	err = handler.uploadService.Abort(uploadID)
+	if err != nil {
+		return uploadError(err, "Unable to abort upload")
+	}
+
+	return response.Empty(rw)
+}
+
+func (handler *Handler) uploadResponse(rw http.ResponseWriter, upload *filesystem.Upload) *httperror.HandlerError {
+	nodeName := ""
+	if handler.runtimeConfiguration != nil {
+		nodeName = handler.runtimeConfiguration.NodeName
+	}
+
+	return response.JSON(rw, browseUploadResponse{Upload: upload, NodeName: nodeName})
+}
+
+func uploadError(err error, message string) *httperror.HandlerError {
+	switch {
+	case errors.Is(err, filesystem.ErrUploadNotFound):
+		return httperror.NotFound("Unable to find upload", err)
+	case errors.Is(err, filesystem.ErrUploadSizeExceeded):
+		return httperror.NewError(http.StatusRequestEntityTooLarge, "The chunk exceeds the declared upload size", err)
+	case errors.Is(err, filesystem.ErrUploadIncomplete), errors.Is(err, filesystem.ErrUploadChecksumMismatch):
+		return httperror.BadRequest(message, err)
+	case errors.Is(err, filesystem.ErrUploadDestinationExists):
+		return httperror.Conflict("The destination file already exists", err)
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return httperror.NewError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Chunks cannot exceed %d bytes", maxUploadChunkSize), err)
+	}
+
+	return httperror.InternalServerError(message, err)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
@@ -12,13 +14,22 @@ import (
 // Handler is the HTTP handler used to handle volume browsing operations.
 type Handler struct {
 	*mux.Router
+	runtimeConfiguration *agent.RuntimeConfig
+	uploadService        *filesystem.UploadService
+	archiveMaxSize       int64
 }
 
 // NewHandler returns a pointer to an Handler
 // It sets the associated handle functions for all the Browse related HTTP endpoints.
-func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService) *Handler {
+// The archives created and extracted by the handler are limited to archiveMaxSize bytes (no limit when 0).
+// The node name of the runtime configuration is returned to the clients of resumable uploads so that all the
+// chunks of an upload are sent to the node storing it.
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, runtimeConfiguration *agent.RuntimeConfig, uploadService *filesystem.UploadService, archiveMaxSize int64) *Handler {
 	h := &Handler{
-		Router: mux.NewRouter(),
+		Router:               mux.NewRouter(),
+		runtimeConfiguration: runtimeConfiguration,
+		uploadService:        uploadService,
+		archiveMaxSize:       archiveMaxSize,
 	}
 
 	h.Handle("/browse/ls",
@@ -31,6 +42,40 @@ func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryServ
 		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseRename)))).Methods(http.MethodPut)
 	h.Handle("/browse/put",
 		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browsePut)))).Methods(http.MethodPost)
+	h.Handle("/browse/archive",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseArchiveGet)))).Methods(http.MethodGet)
+	h.Handle("/browse/archive",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseArchivePut)))).Methods(http.MethodPost)
+	h.Handle("/browse/stat",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseStat)))).Methods(http.MethodGet)
+	h.Handle("/browse/search",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseSearch)))).Methods(http.MethodGet)
+	h.Handle("/browse/mkdir",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseMkdir)))).Methods(http.MethodPost)
+	h.Handle("/browse/copy",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseCopy)))).Methods(http.MethodPost)
+	h.Handle("/browse/move",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseMove)))).Methods(http.MethodPut)
+	h.Handle("/browse/chmod",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseChmod)))).Methods(http.MethodPut)
+	h.Handle("/browse/chown",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseChown)))).Methods(http.MethodPut)
+	h.Handle("/browse/upload",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseUploadInitiate)))).Methods(http.MethodPost)
+	h.Handle("/browse/upload/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseUploadInspect)))).Methods(http.MethodGet)
+	h.Handle("/browse/upload/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseUploadChunk)))).Methods(http.MethodPut)
+	h.Handle("/browse/upload/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseUploadAbort)))).Methods(http.MethodDelete)
+	h.Handle("/browse/upload/{id}/finalize",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseUploadFinalize)))).Methods(http.MethodPost)
+	h.Handle("/browse/containers/{id}/ls",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseContainerList)))).Methods(http.MethodGet)
+	h.Handle("/browse/containers/{id}/get",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseContainerGet)))).Methods(http.MethodGet)
+	h.Handle("/browse/containers/{id}/put",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browseContainerPut)))).Methods(http.MethodPost)
 	return h
 }
 
@@ -53,3 +98,13 @@ func NewHandlerV1(agentProxy *proxy.AgentProxy, notaryService *security.NotarySe
 		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.browsePutV1)))).Methods(http.MethodPost)
 	return h
 }
+
+// buildPath returns the path of a file inside a volume when a volume is specified,
+// the path is returned as is otherwise
+func buildPath(volumeID, filePath string) (string, error) {
+	if volumeID == "" {
+		return filePath, nil
+	}
+
+	return filesystem.BuildPathToFileInsideVolume(volumeID, filePath)
+}
@@ -1,8 +1,10 @@
 package docker
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/portainer/agent"
@@ -10,6 +12,7 @@ import (
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/response"
 
+	"github.com/docker/docker/api/types/filters"
 	"github.com/rs/zerolog/log"
 )
 
@@ -19,6 +22,24 @@ func (handler *Handler) dockerOperation(rw http.ResponseWriter, request *http.Re
 		return nil
 	}
 
+	// The requests other than GET may modify the resources of the targeted node, its cached responses are removed
+	// before the request so that they are not served while it is in progress and after it for the responses
+	// retrieved meanwhile
+	if request.Method != http.MethodGet {
+		targetNodeName := request.Header.Get(agent.HTTPTargetHeaderName)
+		if targetNodeName == "" {
+			targetNodeName = handler.runtimeConfiguration.NodeName
+		}
+
+		handler.clusterProxy.InvalidateNodeCache(targetNodeName)
+		defer handler.clusterProxy.InvalidateNodeCache(targetNodeName)
+	}
+
+	// The resources of standalone hosts are not aggregated, the requests are only routed to the targeted node
+	if handler.runtimeConfiguration.DockerConfig.EngineType != agent.EngineTypeSwarm {
+		return handler.executeOperationOnNode(rw, request)
+	}
+
 	managerOperationHeader := request.Header.Get(agent.HTTPManagerOperationHeaderName)
 
 	if managerOperationHeader != "" {
@@ -40,6 +61,11 @@ func (handler *Handler) dispatchOperation(rw http.ResponseWriter, request *http.
 		return handler.executeOperationOnCluster(rw, request)
 	case path == "/networks" && request.Method == http.MethodGet:
 		return handler.executeOperationOnCluster(rw, request)
+	case path == "/events" && request.Method == http.MethodGet:
+		return handler.executeEventsOperationOnCluster(rw, request)
+	case proxy.IsSummaryOperation(request) && request.Header.Get(agent.HTTPTargetHeaderName) == "":
+		// The disk usage and prune operations targeting a node are only executed on that node
+		return handler.executeOperationOnCluster(rw, request)
 	case strings.HasPrefix(path, "/services"):
 		return handler.executeOperationOnManagerNode(rw, request)
 	case strings.HasPrefix(path, "/tasks"):
@@ -71,7 +97,7 @@ func (handler *Handler) executeOperationOnManagerNode(rw http.ResponseWriter, re
 
 			return httperror.InternalServerError("The agent was unable to contact any other agent located on a manager node", errors.New("Unable to find an agent on any manager node"))
 		}
-		proxy.AgentHTTPRequest(rw, request, targetMember, handler.useTLS)
+		proxy.AgentHTTPRequest(rw, request, targetMember, handler.useTLS, handler.certificateManager)
 	}
 	return nil
 }
@@ -92,7 +118,7 @@ func (handler *Handler) executeOperationOnNode(rw http.ResponseWriter, request *
 			return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
 		}
 
-		proxy.AgentHTTPRequest(rw, request, targetMember, handler.useTLS)
+		proxy.AgentHTTPRequest(rw, request, targetMember, handler.useTLS, handler.certificateManager)
 	}
 	return nil
 }
@@ -105,12 +131,83 @@ func (handler *Handler) executeOperationOnCluster(rw http.ResponseWriter, reques
 		return nil
 	}
 
+	quorum := request.Header.Get(agent.HTTPClusterQuorumHeaderName)
+	if err := proxy.ValidateQuorum(quorum); err != nil {
+		return httperror.BadRequest("Invalid header: "+agent.HTTPClusterQuorumHeaderName, err)
+	}
+
+	envelope, _ := strconv.ParseBool(request.Header.Get(agent.HTTPClusterEnvelopeHeaderName))
+	stream, _ := strconv.ParseBool(request.Header.Get(agent.HTTPClusterStreamHeaderName))
+
 	clusterMembers := handler.clusterService.Members()
 
-	data, err := handler.clusterProxy.ClusterOperation(request, clusterMembers)
-	if err != nil {
+	// Disk usage and prune operations return a single object, their responses are merged
+	if proxy.IsSummaryOperation(request) {
+		data, report, err := handler.clusterProxy.ClusterSummaryOperation(request, clusterMembers, quorum)
+
+		return writeClusterOperationResponse(rw, data, report, err, envelope)
+	}
+
+	// The objects of each node are written as soon as the node responds when requested, the report is sent in a trailer
+	if stream && !envelope && !handler.clusterProxy.RequiresQuorum(quorum) {
+		report, err := handler.clusterProxy.StreamClusterOperation(rw, request, clusterMembers)
+		if err != nil {
+			return httperror.InternalServerError("Unable to execute cluster operation", err)
+		}
+
+		setClusterReportHeader(rw, report)
+
+		return nil
+	}
+
+	data, report, err := handler.clusterProxy.ClusterOperation(request, clusterMembers, quorum)
+
+	return writeClusterOperationResponse(rw, data, report, err, envelope)
+}
+
+func writeClusterOperationResponse(rw http.ResponseWriter, data any, report proxy.ClusterOperationReport, err error, envelope bool) *httperror.HandlerError {
+	setClusterReportHeader(rw, report)
+
+	if errors.Is(err, proxy.ErrQuorumNotMet) {
+		return httperror.NewError(http.StatusServiceUnavailable, "Not enough nodes responded to the cluster operation", err)
+	} else if err != nil {
 		return httperror.InternalServerError("Unable to execute cluster operation", err)
 	}
 
+	// The envelope allows the clients to retrieve the nodes that failed without parsing the header
+	if envelope {
+		return response.JSON(rw, clusterOperationEnvelope{Data: data, Nodes: report})
+	}
+
 	return response.JSON(rw, data)
 }
+
+func (handler *Handler) executeEventsOperationOnCluster(rw http.ResponseWriter, request *http.Request) *httperror.HandlerError {
+	if request.Header.Get(agent.HTTPTargetHeaderName) != "" {
+		return handler.executeOperationOnNode(rw, request)
+	}
+
+	// Reject invalid filters before the streams are opened, every node would reject them
+	if _, err := filters.FromJSON(request.URL.Query().Get("filters")); err != nil {
+		return httperror.BadRequest("Invalid query parameter: filters", err)
+	}
+
+	err := handler.clusterProxy.StreamClusterEvents(rw, request, handler.clusterService.Members)
+	if err != nil {
+		return httperror.InternalServerError("Unable to stream the cluster events", err)
+	}
+
+	return nil
+}
+
+func setClusterReportHeader(rw http.ResponseWriter, report proxy.ClusterOperationReport) {
+	if reportHeader, err := json.Marshal(report); err == nil {
+		rw.Header().Set(agent.HTTPResponseClusterNodesHeaderName, string(reportHeader))
+	}
+}
+
+// clusterOperationEnvelope wraps the response of a cluster operation along with the nodes that took part in it
+type clusterOperationEnvelope struct {
+	Data  any                          `json:"Data"`
+	Nodes proxy.ClusterOperationReport `json:"Nodes"`
+}
@@ -3,6 +3,7 @@ package docker
 import (
 	"github.com/gorilla/mux"
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
@@ -16,18 +17,20 @@ type Handler struct {
 	clusterService       agent.ClusterService
 	runtimeConfiguration *agent.RuntimeConfig
 	useTLS               bool
+	certificateManager   *crypto.CertificateManager
 }
 
 // NewHandler returns a new instance of Handler.
 // It sets the associated handle functions for all the Docker related HTTP endpoints.
-func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfig, notaryService *security.NotaryService, useTLS bool) *Handler {
+func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfig, notaryService *security.NotaryService, clusterProxy *proxy.ClusterProxy, useTLS bool, certificateManager *crypto.CertificateManager) *Handler {
 	h := &Handler{
 		Router:               mux.NewRouter(),
 		dockerProxy:          proxy.NewLocalProxy(),
-		clusterProxy:         proxy.NewClusterProxy(useTLS),
+		clusterProxy:         clusterProxy,
 		clusterService:       clusterService,
 		runtimeConfiguration: config,
 		useTLS:               useTLS,
+		certificateManager:   certificateManager,
 	}
 
 	h.PathPrefix("/").Handler(notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.dockerOperation)))
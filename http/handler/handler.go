@@ -7,9 +7,13 @@ import (
 	"strings"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	dockerbackup "github.com/portainer/agent/docker/backup"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/filesystem"
 	httpagenthandler "github.com/portainer/agent/http/handler/agent"
+	"github.com/portainer/agent/http/handler/backup"
 	"github.com/portainer/agent/http/handler/browse"
 	"github.com/portainer/agent/http/handler/docker"
 	"github.com/portainer/agent/http/handler/dockerhub"
@@ -18,16 +22,20 @@ import (
 	"github.com/portainer/agent/http/handler/kubernetes"
 	"github.com/portainer/agent/http/handler/kubernetesproxy"
 	"github.com/portainer/agent/http/handler/ping"
+	httprecording "github.com/portainer/agent/http/handler/recording"
+	"github.com/portainer/agent/http/handler/trust"
 	"github.com/portainer/agent/http/handler/websocket"
 	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
 	kubecli "github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/recording"
 )
 
 // Handler is the main handler of the application.
 // Redirection to sub handlers is done in the ServeHTTP function.
 type Handler struct {
 	agentHandler           *httpagenthandler.Handler
+	backupHandler          *backup.Handler
 	browseHandler          *browse.Handler
 	browseHandlerV1        *browse.Handler
 	dockerProxyHandler     *docker.Handler
@@ -38,6 +46,9 @@ type Handler struct {
 	webSocketHandler       *websocket.Handler
 	hostHandler            *host.Handler
 	pingHandler            *ping.Handler
+	recordingHandler       *httprecording.Handler
+	trustHandler           *trust.Handler
+	policyService          *security.PolicyService
 	containerPlatform      agent.ContainerPlatform
 }
 
@@ -50,7 +61,12 @@ type Config struct {
 	KubeClient           *kubecli.KubeClient
 	KubernetesDeployer   *exec.KubernetesDeployer
 	EdgeManager          *edge.Manager
+	BackupService        *dockerbackup.Service
+	PolicyService        *security.PolicyService
+	UploadService        *filesystem.UploadService
 	RuntimeConfiguration *agent.RuntimeConfig
+	AgentOptions         *agent.Options
+	CertificateManager   *crypto.CertificateManager
 	UseTLS               bool
 	ContainerPlatform    agent.ContainerPlatform
 }
@@ -59,23 +75,68 @@ var dockerAPIVersionRegexp = regexp.MustCompile(`(/v[0-9]\.[0-9]*)?`)
 
 // NewHandler returns a pointer to a Handler.
 func NewHandler(config *Config) *Handler {
-	agentProxy := proxy.NewAgentProxy(config.ClusterService, config.RuntimeConfiguration, config.UseTLS)
-	notaryService := security.NewNotaryService(config.SignatureService, true)
+	agentProxy := proxy.NewAgentProxy(config.ClusterService, config.RuntimeConfiguration, config.UseTLS, config.CertificateManager)
+	notaryService := security.NewNotaryService(config.SignatureService, true, security.NotaryServiceOptions{
+		MaxSkew: config.AgentOptions.SignatureMaxSkew,
+		Strict:  config.AgentOptions.SignatureStrict,
+	})
 
-	return &Handler{
+	// The terminal sessions are only recorded when enabled
+	var recordingService *recording.Service
+	if config.AgentOptions.RecordingEnabled {
+		recordingService = recording.NewService(recording.Config{
+			DataPath: config.AgentOptions.DataPath,
+			MaxAge:   config.AgentOptions.RecordingMaxAge,
+			MaxSize:  config.AgentOptions.RecordingMaxSize,
+		})
+	}
+
+	sessionLimits := websocket.SessionLimits{
+		IdleTimeout: config.AgentOptions.WebsocketIdleTimeout,
+		MaxDuration: config.AgentOptions.WebsocketMaxDuration,
+		MaxSessions: config.AgentOptions.WebsocketMaxSessions,
+	}
+
+	clusterProxy := proxy.NewClusterProxy(config.UseTLS, proxy.ClusterProxyConfig{
+		NodeTimeout:        config.AgentOptions.ClusterNodeTimeout,
+		Quorum:             config.AgentOptions.ClusterQuorum,
+		CacheTTL:           config.AgentOptions.ClusterCacheTTL,
+		LocalNodeName:      config.RuntimeConfiguration.NodeName,
+		CertificateManager: config.CertificateManager,
+	})
+
+	// The cached responses of a node are invalidated when its resources are modified
+	if config.ClusterService != nil {
+		config.ClusterService.SubscribeEvents(agent.ClusterEventResourcesChanged, clusterProxy.HandleResourcesChangedEvent)
+	}
+
+	h := &Handler{
 		agentHandler:           httpagenthandler.NewHandler(config.ClusterService, notaryService),
-		browseHandler:          browse.NewHandler(agentProxy, notaryService),
+		browseHandler:          browse.NewHandler(agentProxy, notaryService, config.RuntimeConfiguration, config.UploadService, config.AgentOptions.BrowseArchiveMaxSize),
 		browseHandlerV1:        browse.NewHandlerV1(agentProxy, notaryService),
-		dockerProxyHandler:     docker.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.UseTLS),
+		dockerProxyHandler:     docker.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, clusterProxy, config.UseTLS, config.CertificateManager),
 		dockerhubHandler:       dockerhub.NewHandler(notaryService),
-		keyHandler:             key.NewHandler(notaryService, config.EdgeManager),
+		keyHandler:             key.NewHandler(notaryService, config.SignatureService, config.EdgeManager),
 		kubernetesHandler:      kubernetes.NewHandler(notaryService, config.KubernetesDeployer),
 		kubernetesProxyHandler: kubernetesproxy.NewHandler(notaryService),
-		webSocketHandler:       websocket.NewHandler(config.ClusterService, config.RuntimeConfiguration, notaryService, config.KubeClient),
+		webSocketHandler:       websocket.NewHandler(config.ClusterService, config.RuntimeConfiguration, config.CertificateManager, agentProxy, notaryService, config.KubeClient, recordingService, sessionLimits),
 		hostHandler:            host.NewHandler(config.SystemService, agentProxy, notaryService),
 		pingHandler:            ping.NewHandler(),
+		trustHandler:           trust.NewHandler(config.SignatureService, config.ClusterService, notaryService),
+		policyService:          config.PolicyService,
 		containerPlatform:      config.ContainerPlatform,
 	}
+
+	// Volume backups are only available on the Docker platform
+	if config.BackupService != nil {
+		h.backupHandler = backup.NewHandler(agentProxy, notaryService, config.BackupService)
+	}
+
+	if recordingService != nil {
+		h.recordingHandler = httprecording.NewHandler(agentProxy, notaryService, recordingService)
+	}
+
+	return h
 }
 
 func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
@@ -85,6 +146,12 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 	}
 
 	request.URL.Path = dockerAPIVersionRegexp.ReplaceAllString(request.URL.Path, "")
+
+	// API version 3 only changes the request signature scheme, it shares the routes of version 2
+	if strings.HasPrefix(request.URL.Path, "/v3/") {
+		request.URL.Path = "/v2" + strings.TrimPrefix(request.URL.Path, "/v3")
+	}
+
 	rw.Header().Set(agent.HTTPResponseAgentHeaderName, agent.Version)
 	rw.Header().Set(agent.HTTPResponseAgentApiVersion, agent.APIVersion)
 
@@ -96,6 +163,15 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 	}
 	rw.Header().Set(agent.HTTPResponseAgentPlatform, strconv.Itoa(int(agentPlatformIdentifier)))
 
+	if h.policyService != nil {
+		h.policyService.EnforcePolicy(http.HandlerFunc(h.dispatch)).ServeHTTP(rw, request)
+		return
+	}
+
+	h.dispatch(rw, request)
+}
+
+func (h *Handler) dispatch(rw http.ResponseWriter, request *http.Request) {
 	switch {
 	case strings.HasPrefix(request.URL.Path, "/v1"):
 		h.ServeHTTPV1(rw, request)
@@ -109,8 +185,14 @@ func (h *Handler) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
 		h.hostHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/browse"):
 		h.browseHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/backups") && h.backupHandler != nil:
+		h.backupHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/recordings") && h.recordingHandler != nil:
+		h.recordingHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/websocket"):
 		h.webSocketHandler.ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/trust"):
+		h.trustHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/kubernetes"):
 		h.kubernetesProxyHandler.ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/"):
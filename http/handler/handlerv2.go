@@ -18,8 +18,14 @@ func (h *Handler) ServeHTTPV2(rw http.ResponseWriter, request *http.Request) {
 		http.StripPrefix("/v2", h.hostHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/browse"):
 		http.StripPrefix("/v2", h.browseHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/backups") && h.backupHandler != nil:
+		http.StripPrefix("/v2", h.backupHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/recordings") && h.recordingHandler != nil:
+		http.StripPrefix("/v2", h.recordingHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/websocket"):
 		http.StripPrefix("/v2", h.webSocketHandler).ServeHTTP(rw, request)
+	case strings.HasPrefix(request.URL.Path, "/v2/trust"):
+		http.StripPrefix("/v2", h.trustHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/v2/kubernetes"):
 		http.StripPrefix("/v2", h.kubernetesHandler).ServeHTTP(rw, request)
 	case strings.HasPrefix(request.URL.Path, "/"):
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/portainer/agent"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/http/security"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
@@ -12,23 +13,28 @@ import (
 // Handler is the HTTP handler used to handle Edge key operations.
 type Handler struct {
 	*mux.Router
-	edgeManager *edge.Manager
+	edgeManager      *edge.Manager
+	signatureService agent.DigitalSignatureService
 }
 
 // NewHandler returns a pointer to an Handler
 // It sets the associated handle functions for all the Edge key related HTTP endpoints.
 // This handler is meant to be used when the agent is started in Edge mode, all the API endpoints will return
 // a HTTP 503 service not available if edge mode is disabled.
-func NewHandler(notaryService *security.NotaryService, edgeManager *edge.Manager) *Handler {
+// The key rotation requests must be signed by Portainer.
+func NewHandler(notaryService *security.NotaryService, signatureService agent.DigitalSignatureService, edgeManager *edge.Manager) *Handler {
 	h := &Handler{
-		Router:      mux.NewRouter(),
-		edgeManager: edgeManager,
+		Router:           mux.NewRouter(),
+		edgeManager:      edgeManager,
+		signatureService: signatureService,
 	}
 
 	h.Handle("/key",
 		httperror.LoggerHandler(h.keyInspect)).Methods(http.MethodGet)
 	h.Handle("/key",
 		httperror.LoggerHandler(h.keyCreate)).Methods(http.MethodPost)
+	h.Handle("/key/rotate",
+		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.keyRotate))).Methods(http.MethodPost)
 
 	return h
 }
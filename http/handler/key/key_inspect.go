@@ -10,6 +10,9 @@ import (
 
 type keyInspectResponse struct {
 	Key string `json:"key"`
+	// Signature and PublicKey are set once the key was rotated, the other agents of the cluster verify them
+	Signature string `json:"signature,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
 }
 
 func (handler *Handler) keyInspect(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
@@ -22,8 +25,11 @@ func (handler *Handler) keyInspect(w http.ResponseWriter, r *http.Request) *http
 	}
 
 	edgeKey := handler.edgeManager.GetKey()
+	signature, publicKey := handler.edgeManager.GetKeySignature()
 
 	return response.JSON(w, keyInspectResponse{
-		Key: edgeKey,
+		Key:       edgeKey,
+		Signature: signature,
+		PublicKey: publicKey,
 	})
 }
@@ -0,0 +1,68 @@
+package key
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/portainer/agent"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/rs/zerolog/log"
+)
+
+type keyRotatePayload struct {
+	// Key is the new Edge key associated to the agent
+	Key string
+	// Signature is the signature of the new key, created with the private key associated to the public key
+	// used to sign the request
+	Signature string
+}
+
+func (payload *keyRotatePayload) Validate(r *http.Request) error {
+	if payload.Key == "" {
+		return errors.New("invalid key")
+	}
+
+	if payload.Signature == "" {
+		return errors.New("invalid key signature")
+	}
+
+	return nil
+}
+
+// POST request on /key/rotate
+func (handler *Handler) keyRotate(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	if handler.edgeManager == nil {
+		return httperror.NewError(http.StatusServiceUnavailable, "Edge key management is disabled on non Edge agent", errors.New("Edge key management is disabled"))
+	}
+
+	if !handler.edgeManager.IsKeySet() {
+		return httperror.NotFound("No key associated to this agent", errors.New("Edge key unavailable"))
+	}
+
+	var payload keyRotatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	publicKey := r.Header.Get(agent.HTTPPublicKeyHeaderName)
+
+	valid, err := handler.signatureService.VerifyContentSignature(payload.Signature, publicKey, payload.Key)
+	if err != nil {
+		return httperror.Forbidden("Invalid key signature", err)
+	} else if !valid {
+		return httperror.Forbidden("Invalid key signature", errors.New("Unauthorized"))
+	}
+
+	log.Info().Msg("received Edge key rotation request")
+
+	err = handler.edgeManager.RotateKey(payload.Key, payload.Signature, publicKey)
+	if err != nil {
+		return httperror.InternalServerError("Unable to rotate the Edge key", err)
+	}
+
+	return response.Empty(w)
+}
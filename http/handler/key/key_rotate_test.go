@@ -0,0 +1,65 @@
+package key
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/edge"
+	"github.com/portainer/agent/internals/mocks"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestKeyRotateVerifiesKeySignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	// https://portainer:9443|portainer:8000|fingerprint|1
+	currentKey := "aHR0cHM6Ly9wb3J0YWluZXI6OTQ0M3xwb3J0YWluZXI6ODAwMHxmaW5nZXJwcmludHwx"
+	// https://portainer.example.com|portainer.example.com:8000|fingerprint|1
+	newKey := "aHR0cHM6Ly9wb3J0YWluZXIuZXhhbXBsZS5jb218cG9ydGFpbmVyLmV4YW1wbGUuY29tOjgwMDB8ZmluZ2VycHJpbnR8MQ"
+
+	edgeManager := edge.NewManager(&edge.ManagerParameters{Options: &agent.Options{DataPath: t.TempDir()}})
+	require.NoError(t, edgeManager.SetKey(currentKey))
+
+	signatureService := mocks.NewMockDigitalSignatureService(ctrl)
+
+	handler := &Handler{edgeManager: edgeManager, signatureService: signatureService}
+
+	newRequest := func(signature string) *http.Request {
+		payload, err := json.Marshal(keyRotatePayload{Key: newKey, Signature: signature})
+		require.NoError(t, err)
+
+		request := httptest.NewRequest(http.MethodPost, "/key/rotate", bytes.NewReader(payload))
+		request.Header.Set(agent.HTTPPublicKeyHeaderName, "public-key")
+
+		return request
+	}
+
+	// The key is not rotated when its signature is invalid
+	signatureService.EXPECT().VerifyContentSignature("invalid", "public-key", newKey).Return(false, nil)
+	signatureService.EXPECT().VerifyContentSignature("malformed", "public-key", newKey).Return(false, errors.New("malformed signature"))
+
+	for _, signature := range []string{"invalid", "malformed"} {
+		err := handler.keyRotate(httptest.NewRecorder(), newRequest(signature))
+		require.NotNil(t, err, signature)
+		require.Equal(t, http.StatusForbidden, err.StatusCode, signature)
+		require.Equal(t, currentKey, edgeManager.GetKey(), signature)
+	}
+
+	signatureService.EXPECT().VerifyContentSignature("valid", "public-key", newKey).Return(true, nil)
+
+	err := handler.keyRotate(httptest.NewRecorder(), newRequest("valid"))
+	require.Nil(t, err)
+	require.Equal(t, newKey, edgeManager.GetKey())
+
+	// The signature is kept for the other agents of the cluster
+	signature, publicKey := edgeManager.GetKeySignature()
+	require.Equal(t, "valid", signature)
+	require.Equal(t, "public-key", publicKey)
+}
@@ -0,0 +1,50 @@
+package recording
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/portainer/agent/http/proxy"
+	"github.com/portainer/agent/http/security"
+	"github.com/portainer/agent/recording"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler is the HTTP handler used to handle terminal session recording operations.
+type Handler struct {
+	*mux.Router
+	recordingService *recording.Service
+}
+
+// NewHandler returns a pointer to an Handler
+// It sets the associated handle functions for all the session recording related HTTP endpoints.
+// The recordings are stored on the node where the sessions were opened, the requests must target this node.
+func NewHandler(agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, recordingService *recording.Service) *Handler {
+	h := &Handler{
+		Router:           mux.NewRouter(),
+		recordingService: recordingService,
+	}
+
+	h.Handle("/recordings",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.recordingList)))).Methods(http.MethodGet)
+	h.Handle("/recordings/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.recordingInspect)))).Methods(http.MethodGet)
+	h.Handle("/recordings/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.recordingDelete)))).Methods(http.MethodDelete)
+	h.Handle("/recordings/{id}/download",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.recordingDownload)))).Methods(http.MethodGet)
+
+	return h
+}
+
+// recordingError converts the errors of the recording service to HTTP errors
+func recordingError(message string, err error) *httperror.HandlerError {
+	if errors.Is(err, recording.ErrRecordingNotFound) {
+		return httperror.NotFound("Unable to find the recording", err)
+	} else if errors.Is(err, recording.ErrRecordingActive) {
+		return httperror.Conflict("The session is still in progress, its recording cannot be removed", err)
+	}
+
+	return httperror.InternalServerError(message, err)
+}
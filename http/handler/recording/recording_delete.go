@@ -0,0 +1,25 @@
+package recording
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// DELETE request on /recordings/{id}
+// Removes a recorded terminal session
+func (handler *Handler) recordingDelete(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	recordingID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid recording identifier route variable", err)
+	}
+
+	err = handler.recordingService.Delete(recordingID)
+	if err != nil {
+		return recordingError("Unable to remove recording", err)
+	}
+
+	return response.Empty(rw)
+}
@@ -0,0 +1,38 @@
+package recording
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/rs/zerolog/log"
+)
+
+// GET request on /recordings/{id}/download
+// Streams the asciinema v2 recording of a terminal session, the sessions in progress can be downloaded as well
+func (handler *Handler) recordingDownload(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	recordingID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid recording identifier route variable", err)
+	}
+
+	file, session, err := handler.recordingService.Open(recordingID)
+	if err != nil {
+		return recordingError("Unable to open recording", err)
+	}
+	defer file.Close()
+
+	rw.Header().Set("Content-Type", "application/x-asciicast")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", session.ID+".cast"))
+
+	// The response is already being streamed, errors can only be logged
+	_, err = io.Copy(rw, file)
+	if err != nil {
+		log.Error().Err(err).Str("recording_id", session.ID).Msg("unable to stream the session recording")
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package recording
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /recordings/{id}
+// Returns the details of a recorded terminal session
+func (handler *Handler) recordingInspect(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	recordingID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid recording identifier route variable", err)
+	}
+
+	session, err := handler.recordingService.Get(recordingID)
+	if err != nil {
+		return recordingError("Unable to retrieve recording", err)
+	}
+
+	return response.JSON(rw, session)
+}
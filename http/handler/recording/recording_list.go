@@ -0,0 +1,19 @@
+package recording
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /recordings
+// Lists the recorded terminal sessions, the most recent first
+func (handler *Handler) recordingList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	sessions, err := handler.recordingService.List()
+	if err != nil {
+		return httperror.InternalServerError("Unable to list recordings", err)
+	}
+
+	return response.JSON(rw, sessions)
+}
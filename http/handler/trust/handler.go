@@ -0,0 +1,39 @@
+package trust
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/http/security"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+)
+
+// Handler is the HTTP handler used to manage the Portainer public keys trusted by the agent.
+type Handler struct {
+	*mux.Router
+	signatureService agent.DigitalSignatureService
+	clusterService   agent.ClusterService
+}
+
+// NewHandler returns a pointer to an Handler
+// It sets the associated handle functions for all the trusted keys related HTTP endpoints.
+// When the agent is part of a cluster, the key rotations are applied on every member of the cluster.
+func NewHandler(signatureService agent.DigitalSignatureService, clusterService agent.ClusterService, notaryService *security.NotaryService) *Handler {
+	h := &Handler{
+		Router:           mux.NewRouter(),
+		signatureService: signatureService,
+		clusterService:   clusterService,
+	}
+
+	h.Handle("/trust/keys",
+		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.trustedKeyList))).Methods(http.MethodGet)
+	h.Handle("/trust/rotate",
+		notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.trustedKeyRotate))).Methods(http.MethodPost)
+
+	if clusterService != nil {
+		clusterService.SubscribeEvents(agent.ClusterEventTrustedKeyRotated, h.handleTrustedKeyRotatedEvent)
+	}
+
+	return h
+}
@@ -0,0 +1,13 @@
+package trust
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /trust/keys
+func (handler *Handler) trustedKeyList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return response.JSON(rw, handler.signatureService.TrustedKeys())
+}
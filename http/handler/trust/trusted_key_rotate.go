@@ -0,0 +1,116 @@
+package trust
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+
+	"github.com/rs/zerolog/log"
+)
+
+type trustedKeyRotatePayload struct {
+	// NewPublicKey is the hexadecimal encoded public key that will be trusted by the agent
+	NewPublicKey string
+	// Signature is the signature of the new public key, created with the private key associated to
+	// the public key used to sign the request
+	Signature string
+	// GracePeriod is the number of seconds during which the current key will still be trusted.
+	// Defaults to 24 hours when not specified, use a negative value to revoke the current key immediately
+	GracePeriod int64
+}
+
+// trustedKeyRotatedEvent is the payload of the cluster event broadcast after a key rotation, the members of the
+// cluster verify the signature of the new key with their own trusted keys before applying the rotation
+type trustedKeyRotatedEvent struct {
+	NodeName         string
+	CurrentPublicKey string
+	NewPublicKey     string
+	Signature        string
+	GracePeriod      time.Duration
+}
+
+func (payload *trustedKeyRotatePayload) Validate(r *http.Request) error {
+	if payload.NewPublicKey == "" {
+		return errors.New("invalid new public key")
+	}
+
+	if payload.Signature == "" {
+		return errors.New("invalid new public key signature")
+	}
+
+	return nil
+}
+
+// POST request on /trust/rotate
+func (handler *Handler) trustedKeyRotate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	var payload trustedKeyRotatePayload
+	err := request.DecodeAndValidateJSONPayload(r, &payload)
+	if err != nil {
+		return httperror.BadRequest("Invalid request payload", err)
+	}
+
+	gracePeriod := agent.DefaultKeyRotationGracePeriod
+	if payload.GracePeriod > 0 {
+		gracePeriod = time.Duration(payload.GracePeriod) * time.Second
+	} else if payload.GracePeriod < 0 {
+		gracePeriod = 0
+	}
+
+	currentKey := r.Header.Get(agent.HTTPPublicKeyHeaderName)
+
+	err = handler.signatureService.RotateKey(currentKey, payload.NewPublicKey, payload.Signature, gracePeriod)
+	if err != nil {
+		return httperror.Forbidden("Unable to rotate the public key", err)
+	}
+
+	if handler.clusterService != nil {
+		handler.broadcastRotation(currentKey, payload.NewPublicKey, payload.Signature, gracePeriod)
+	}
+
+	return response.JSON(rw, handler.signatureService.TrustedKeys())
+}
+
+func (handler *Handler) broadcastRotation(currentKey, newKey, signature string, gracePeriod time.Duration) {
+	event, err := json.Marshal(trustedKeyRotatedEvent{
+		NodeName:         handler.clusterService.GetRuntimeConfiguration().NodeName,
+		CurrentPublicKey: currentKey,
+		NewPublicKey:     newKey,
+		Signature:        signature,
+		GracePeriod:      gracePeriod,
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to encode the public key rotation event")
+
+		return
+	}
+
+	err = handler.clusterService.BroadcastEvent(agent.ClusterEventTrustedKeyRotated, event)
+	if err != nil {
+		log.Warn().Err(err).Msg("unable to notify the cluster of the public key rotation")
+	}
+}
+
+// handleTrustedKeyRotatedEvent applies the key rotation of another member of the cluster
+func (handler *Handler) handleTrustedKeyRotatedEvent(payload []byte) {
+	var event trustedKeyRotatedEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Warn().Err(err).Msg("unable to decode the public key rotation event")
+
+		return
+	}
+
+	if event.NodeName == handler.clusterService.GetRuntimeConfiguration().NodeName {
+		return
+	}
+
+	err := handler.signatureService.RotateKey(event.CurrentPublicKey, event.NewPublicKey, event.Signature, event.GracePeriod)
+	if err != nil {
+		log.Error().Err(err).Str("node_name", event.NodeName).Msg("unable to apply the public key rotation of the cluster member")
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"github.com/portainer/portainer/pkg/libhttp/request"
 
 	"github.com/asaskevich/govalidator"
-	"github.com/gorilla/websocket"
 )
 
 func (handler *Handler) websocketOperation(
@@ -24,8 +23,9 @@ func (handler *Handler) websocketOperation(
 		return operation(w, r)
 	}
 
+	// The requests without target are handled by the local agent, like the requests redirected by the agent proxy
 	agentTargetHeader := r.Header.Get(agent.HTTPTargetHeaderName)
-	if agentTargetHeader == handler.runtimeConfiguration.NodeName {
+	if agentTargetHeader == "" || agentTargetHeader == handler.runtimeConfiguration.NodeName {
 		return operation(w, r)
 	}
 
@@ -34,7 +34,7 @@ func (handler *Handler) websocketOperation(
 		return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
 	}
 
-	proxy.WebsocketRequest(w, r, targetMember)
+	proxy.WebsocketRequest(w, r, targetMember, handler.certificateManager)
 	return nil
 }
 
@@ -53,6 +53,18 @@ func (handler *Handler) handleAttachRequest(w http.ResponseWriter, r *http.Reque
 
 	r.Header.Del("Origin")
 
+	activity, httpErr := handler.startSession(r, "attach", attachID)
+	if httpErr != nil {
+		return httpErr
+	}
+	defer activity.end()
+
+	recorder, err := handler.startRecording(r, "attach", attachID, "")
+	if err != nil {
+		return httperror.InternalServerError("Unable to start the recording of the session", err)
+	}
+	defer recorder.Close()
+
 	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket attach operation: unable to upgrade connection", err)
@@ -60,7 +72,7 @@ func (handler *Handler) handleAttachRequest(w http.ResponseWriter, r *http.Reque
 	}
 	defer websocketConn.Close()
 
-	err = hijackAttachStartOperation(websocketConn, attachID)
+	err = hijackAttachStartOperation(newTerminalSession(websocketConn, recorder, activity, false), attachID)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket attach operation", err)
 	}
@@ -69,7 +81,7 @@ func (handler *Handler) handleAttachRequest(w http.ResponseWriter, r *http.Reque
 }
 
 func hijackStartOperation(
-	websocketConn *websocket.Conn,
+	session *terminalSession,
 	opID string,
 	operation func(string) (*http.Request, error),
 ) error {
@@ -77,6 +89,7 @@ func hijackStartOperation(
 	if err != nil {
 		return err
 	}
+	defer dial.Close()
 
 	// When we set up a TCP connection for hijack, there could be long periods
 	// of inactivity (a long running command with no output) that in certain
@@ -93,11 +106,11 @@ func hijackStartOperation(
 		return err
 	}
 
-	return hijackRequest(websocketConn, dial, startRequest)
+	return hijackRequest(session, dial, startRequest)
 }
 
-func hijackAttachStartOperation(websocketConn *websocket.Conn, attachID string) error {
-	return hijackStartOperation(websocketConn, attachID, createAttachStartRequest)
+func hijackAttachStartOperation(session *terminalSession, attachID string) error {
+	return hijackStartOperation(session, attachID, createAttachStartRequest)
 }
 
 func createAttachStartRequest(attachID string) (*http.Request, error) {
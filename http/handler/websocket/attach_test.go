@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/internals/mocks"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestWebsocketOperationWithoutTargetIsLocal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	clusterService := mocks.NewMockClusterService(ctrl)
+
+	handler := &Handler{
+		clusterService:       clusterService,
+		runtimeConfiguration: &agent.RuntimeConfig{NodeName: "node1"},
+	}
+
+	for _, target := range []string{"", "node1"} {
+		called := false
+
+		request := httptest.NewRequest(http.MethodGet, "/websocket/exec", nil)
+		if target != "" {
+			request.Header.Set(agent.HTTPTargetHeaderName, target)
+		}
+
+		err := handler.websocketOperation(httptest.NewRecorder(), request, func(http.ResponseWriter, *http.Request) *httperror.HandlerError {
+			called = true
+
+			return nil
+		})
+		require.Nil(t, err)
+		require.True(t, called, target)
+	}
+
+	// An unknown target is rejected
+	clusterService.EXPECT().GetMemberByNodeName("node2").Return(nil)
+
+	request := httptest.NewRequest(http.MethodGet, "/websocket/exec", nil)
+	request.Header.Set(agent.HTTPTargetHeaderName, "node2")
+
+	err := handler.websocketOperation(httptest.NewRecorder(), request, func(http.ResponseWriter, *http.Request) *httperror.HandlerError {
+		t.Fatal("the operation must not be executed locally")
+
+		return nil
+	})
+	require.NotNil(t, err)
+}
@@ -3,13 +3,15 @@ package websocket
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/portainer/agent/docker"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
 
 	"github.com/asaskevich/govalidator"
-	"github.com/gorilla/websocket"
 )
 
 func (handler *Handler) websocketExec(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
@@ -26,22 +28,68 @@ func (handler *Handler) handleExecRequest(rw http.ResponseWriter, r *http.Reques
 		return httperror.BadRequest("Invalid query parameter: id (must be hexadecimal identifier)", err)
 	}
 
+	framed, err := retrieveTerminalProtocol(r)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: protocol", err)
+	}
+
+	activity, httpErr := handler.startSession(r, "exec", execID)
+	if httpErr != nil {
+		return httpErr
+	}
+	defer activity.end()
+
+	recorder, err := handler.startRecording(r, "exec", execID, "")
+	if err != nil {
+		return httperror.InternalServerError("Unable to start the recording of the session", err)
+	}
+	defer recorder.Close()
+
 	websocketConn, err := handler.connectionUpgrader.Upgrade(rw, r, nil)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket exec operation: unable to upgrade connection", err)
 	}
 	defer websocketConn.Close()
 
-	err = hijackExecStartOperation(websocketConn, execID)
+	session := newTerminalSession(websocketConn, recorder, activity, framed)
+	session.resize = func(width, height uint16) error {
+		return docker.ContainerExecResize(execID, uint(width), uint(height))
+	}
+
+	err = hijackExecStartOperation(session, execID)
 	if err != nil {
 		return httperror.InternalServerError("An error occurred during websocket exec hijack operation", err)
 	}
 
+	if framed {
+		exitCode, err := execExitCode(execID)
+		session.writeExit(exitCode, err)
+	}
+
 	return nil
 }
 
-func hijackExecStartOperation(websocketConn *websocket.Conn, execID string) error {
-	return hijackStartOperation(websocketConn, execID, createExecStartRequest)
+func hijackExecStartOperation(session *terminalSession, execID string) error {
+	return hijackStartOperation(session, execID, createExecStartRequest)
+}
+
+// execExitCode returns the exit code of the process of an exec instance.
+// The Docker daemon can report the end of the process shortly after closing its output.
+func execExitCode(execID string) (int, error) {
+	for i := 0; i < 10; i++ {
+		inspect, err := docker.ContainerExecInspect(execID)
+		if err != nil {
+			return 0, err
+		}
+
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return 0, errors.New("the process is still running")
 }
 
 func createExecStartRequest(execID string) (*http.Request, error) {
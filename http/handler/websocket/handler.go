@@ -1,9 +1,15 @@
 package websocket
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/http/proxy"
 	"github.com/portainer/agent/http/security"
 	"github.com/portainer/agent/kubernetes"
+	"github.com/portainer/agent/recording"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 
 	"github.com/gorilla/mux"
@@ -17,7 +23,10 @@ type (
 		clusterService       agent.ClusterService
 		connectionUpgrader   websocket.Upgrader
 		runtimeConfiguration *agent.RuntimeConfig
+		certificateManager   *crypto.CertificateManager
 		kubeClient           *kubernetes.KubeClient
+		recordingService     *recording.Service
+		sessionManager       *sessionManager
 	}
 
 	execStartOperationPayload struct {
@@ -27,17 +36,52 @@ type (
 )
 
 // NewHandler returns a new instance of Handler.
-func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfig, notaryService *security.NotaryService, kubeClient *kubernetes.KubeClient) *Handler {
+// The terminal sessions are recorded when recordingService is not nil and the limits are enforced on all the sessions.
+func NewHandler(clusterService agent.ClusterService, config *agent.RuntimeConfig, certificateManager *crypto.CertificateManager, agentProxy *proxy.AgentProxy, notaryService *security.NotaryService, kubeClient *kubernetes.KubeClient, recordingService *recording.Service, limits SessionLimits) *Handler {
 	h := &Handler{
 		Router:               mux.NewRouter(),
 		connectionUpgrader:   websocket.Upgrader{},
 		clusterService:       clusterService,
 		runtimeConfiguration: config,
+		certificateManager:   certificateManager,
 		kubeClient:           kubeClient,
+		recordingService:     recordingService,
+		sessionManager:       newSessionManager(limits),
 	}
 
 	h.Handle("/websocket/attach", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketAttach)))
 	h.Handle("/websocket/exec", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketExec)))
 	h.Handle("/websocket/pod", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketPodExec)))
+	h.Handle("/websocket/portforward", notaryService.DigitalSignatureVerification(httperror.LoggerHandler(h.websocketPortForward)))
+	h.Handle("/websocket/sessions",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.sessionList)))).Methods(http.MethodGet)
+	h.Handle("/websocket/sessions/{id}",
+		notaryService.DigitalSignatureVerification(agentProxy.Redirect(httperror.LoggerHandler(h.sessionTerminate)))).Methods(http.MethodDelete)
 	return h
 }
+
+// startRecording starts the recording of a terminal session when the recording is enabled, a nil Recorder is returned otherwise
+func (handler *Handler) startRecording(r *http.Request, sessionType, target, command string) (*recording.Recorder, error) {
+	if handler.recordingService == nil {
+		return nil, nil
+	}
+
+	return handler.recordingService.Start(recording.Session{
+		Type:       sessionType,
+		Target:     target,
+		Command:    command,
+		RemoteAddr: r.RemoteAddr,
+	})
+}
+
+// startSession registers a websocket session, the requests are rejected once the maximum number of sessions is reached
+func (handler *Handler) startSession(r *http.Request, sessionType, target string) (*activeSession, *httperror.HandlerError) {
+	session, err := handler.sessionManager.start(sessionType, target, r.RemoteAddr)
+	if errors.Is(err, errTooManySessions) {
+		return nil, httperror.NewError(http.StatusTooManyRequests, "Unable to open a new session, the maximum number of sessions is reached", err)
+	} else if err != nil {
+		return nil, httperror.InternalServerError("Unable to register the session", err)
+	}
+
+	return session, nil
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -23,7 +22,7 @@ const (
 )
 
 func hijackRequest(
-	websocketConn *websocket.Conn,
+	session *terminalSession,
 	conn net.Conn,
 	request *http.Request,
 ) error {
@@ -39,8 +38,8 @@ func hijackRequest(
 	}
 
 	errorChan := make(chan error, 1)
-	go readWebSocketToTCP(websocketConn, conn, errorChan)
-	go writeTCPToWebSocket(websocketConn, conn, errorChan)
+	go readWebSocketToTCP(session, conn, errorChan)
+	go writeTCPToWebSocket(session, conn, errorChan)
 
 	err = <-errorChan
 	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
@@ -70,9 +69,9 @@ func sendHTTPRequest(conn net.Conn, req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func readWebSocketToTCP(websocketConn *websocket.Conn, tcpConn net.Conn, errorChan chan error) {
+func readWebSocketToTCP(session *terminalSession, tcpConn net.Conn, errorChan chan error) {
 	for {
-		messageType, p, err := websocketConn.ReadMessage()
+		p, err := session.readInput()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway) {
 				log.Debug().Msgf("Unexpected close error: %v\n", err)
@@ -82,34 +81,31 @@ func readWebSocketToTCP(websocketConn *websocket.Conn, tcpConn net.Conn, errorCh
 			return
 		}
 
-		if messageType == websocket.TextMessage || messageType == websocket.BinaryMessage {
-			if _, err := tcpConn.Write(p); err != nil {
-				log.Debug().Msgf("Error writing to TCP connection: %v\n", err)
-				errorChan <- err
+		if _, err := tcpConn.Write(p); err != nil {
+			log.Debug().Msgf("Error writing to TCP connection: %v\n", err)
+			errorChan <- err
 
-				return
-			}
+			return
 		}
+
+		session.recorder.Input(p)
 	}
 }
 
-func writeTCPToWebSocket(websocketConn *websocket.Conn, tcpConn net.Conn, errorChan chan error) {
-	var mu sync.Mutex
+func writeTCPToWebSocket(session *terminalSession, tcpConn net.Conn, errorChan chan error) {
 	out := make([]byte, readerBufferSize)
-	input := make(chan string)
+	input := make(chan []byte)
 	pingTicker := time.NewTicker(pingPeriod)
 	defer pingTicker.Stop()
-	defer websocketConn.Close()
+	defer session.conn.Close()
 
-	websocketConn.SetReadLimit(2048)
-	websocketConn.SetPongHandler(func(string) error {
+	session.conn.SetReadLimit(2048)
+	session.conn.SetPongHandler(func(string) error {
 		return nil
 	})
 
-	websocketConn.SetPingHandler(func(data string) error {
-		websocketConn.SetWriteDeadline(time.Now().Add(writeWait))
-
-		return websocketConn.WriteMessage(websocket.PongMessage, []byte(data))
+	session.conn.SetPingHandler(func(data string) error {
+		return session.write(websocket.PongMessage, []byte(data))
 	})
 
 	reader := bufio.NewReader(tcpConn)
@@ -127,15 +123,16 @@ func writeTCPToWebSocket(websocketConn *websocket.Conn, tcpConn net.Conn, errorC
 				return
 			}
 
-			processedOutput := validString(string(out[:n]))
-			input <- processedOutput
+			data := make([]byte, n)
+			copy(data, out[:n])
+			input <- data
 		}
 	}()
 
 	for {
 		select {
-		case msg := <-input:
-			err := wswrite(websocketConn, &mu, msg)
+		case data := <-input:
+			err := session.writeOutput(messageTypeStdout, data)
 			if err != nil {
 				log.Debug().Msgf("error writing to websocket: %v", err)
 				errorChan <- err
@@ -143,7 +140,7 @@ func writeTCPToWebSocket(websocketConn *websocket.Conn, tcpConn net.Conn, errorC
 				return
 			}
 		case <-pingTicker.C:
-			if err := wsping(websocketConn, &mu); err != nil {
+			if err := session.ping(); err != nil {
 				log.Debug().Msgf("error writing to websocket during pong response: %v", err)
 				errorChan <- err
 
@@ -152,21 +149,3 @@ func writeTCPToWebSocket(websocketConn *websocket.Conn, tcpConn net.Conn, errorC
 		}
 	}
 }
-
-func wswrite(websocketConn *websocket.Conn, mu *sync.Mutex, msg string) error {
-	mu.Lock()
-	defer mu.Unlock()
-
-	websocketConn.SetWriteDeadline(time.Now().Add(writeWait))
-
-	return websocketConn.WriteMessage(websocket.TextMessage, []byte(msg))
-}
-
-func wsping(websocketConn *websocket.Conn, mu *sync.Mutex) error {
-	mu.Lock()
-	defer mu.Unlock()
-
-	websocketConn.SetWriteDeadline(time.Now().Add(writeWait))
-
-	return websocketConn.WriteMessage(websocket.PingMessage, nil)
-}
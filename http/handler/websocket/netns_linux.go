@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
+)
+
+// dialNetworkNamespace opens a TCP connection from inside the network namespace found at the first available path.
+// The socket stays in the namespace it was created in, the thread used to create it is switched back to the
+// namespace of the agent or discarded when it cannot be.
+func dialNetworkNamespace(namespacePaths []string, address string) (net.Conn, error) {
+	var namespace *os.File
+	var errs []error
+
+	for _, path := range namespacePaths {
+		file, err := os.Open(path)
+		if err == nil {
+			namespace = file
+
+			break
+		}
+
+		errs = append(errs, err)
+	}
+
+	if namespace == nil {
+		return nil, fmt.Errorf("%w: %w", errNetworkNamespaceUnavailable, errors.Join(errs...))
+	}
+	defer namespace.Close()
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	resultChan := make(chan dialResult, 1)
+
+	go func() {
+		runtime.LockOSThread()
+
+		agentNamespace, err := os.Open(fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			resultChan <- dialResult{err: fmt.Errorf("%w: %w", errNetworkNamespaceUnavailable, err)}
+
+			return
+		}
+		defer agentNamespace.Close()
+
+		if err := unix.Setns(int(namespace.Fd()), unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			resultChan <- dialResult{err: fmt.Errorf("%w: %w", errNetworkNamespaceUnavailable, err)}
+
+			return
+		}
+
+		conn, err := net.DialTimeout("tcp", address, portForwardDialTimeout)
+		resultChan <- dialResult{conn: conn, err: err}
+
+		// The thread exits along with the goroutine when it is left locked
+		if err := unix.Setns(int(agentNamespace.Fd()), unix.CLONE_NEWNET); err != nil {
+			log.Warn().Err(err).Msg("unable to switch back to the network namespace of the agent, discarding the thread")
+
+			return
+		}
+
+		runtime.UnlockOSThread()
+	}()
+
+	result := <-resultChan
+
+	return result.conn, result.err
+}
@@ -0,0 +1,35 @@
+//go:build linux
+// +build linux
+
+package websocket
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialNetworkNamespace(t *testing.T) {
+	listener := newEchoListener(t)
+
+	_, err := dialNetworkNamespace([]string{"/var/run/docker/netns/missing"}, listener.Addr().String())
+	require.ErrorIs(t, err, errNetworkNamespaceUnavailable)
+
+	// Entering a network namespace requires the CAP_SYS_ADMIN capability
+	conn, err := dialNetworkNamespace([]string{"/var/run/docker/netns/missing", "/proc/self/ns/net"}, listener.Addr().String())
+	if errors.Is(err, errNetworkNamespaceUnavailable) {
+		t.Skip("unable to enter the network namespace: ", err)
+	}
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	buffer := make([]byte, 4)
+	_, err = io.ReadFull(conn, buffer)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buffer))
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package websocket
+
+import "net"
+
+// dialNetworkNamespace is only supported on Linux
+func dialNetworkNamespace(namespacePaths []string, address string) (net.Conn, error) {
+	return nil, errNetworkNamespaceUnavailable
+}
@@ -1,11 +1,15 @@
 package websocket
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/kubernetes"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 	"github.com/portainer/portainer/pkg/libhttp/request"
 
@@ -13,6 +17,10 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// websocketPodExec starts an exec process inside a pod container and streams it over the websocket.
+// The command query parameter is either a JSON array of arguments or a space separated command.
+// The tty query parameter (defaults to true) can only be disabled with the v2 protocol, the error
+// output is then sent in separate stderr messages.
 func (handler *Handler) websocketPodExec(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
 	namespace, err := request.RetrieveQueryParameter(r, "namespace", false)
 	if err != nil {
@@ -34,9 +42,42 @@ func (handler *Handler) websocketPodExec(w http.ResponseWriter, r *http.Request)
 		return httperror.BadRequest("Invalid query parameter: command", err)
 	}
 
+	commandArray, err := parseCommand(command)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: command", err)
+	}
+
+	tty := true
+	if value, _ := request.RetrieveQueryParameter(r, "tty", true); value != "" {
+		tty, err = strconv.ParseBool(value)
+		if err != nil {
+			return httperror.BadRequest("Invalid query parameter: tty", err)
+		}
+	}
+
+	framed, err := retrieveTerminalProtocol(r)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: protocol", err)
+	}
+
+	// The error output can only be separated with the framed protocol
+	if !tty && !framed {
+		return httperror.BadRequest("Invalid query parameter: tty", errors.New("tty can only be disabled with the v2 protocol"))
+	}
+
 	token := r.Header.Get(agent.HTTPKubernetesSATokenHeaderName)
 
-	commandArray := strings.Split(command, " ")
+	activity, httpErr := handler.startSession(r, "pod", namespace+"/"+podName+"/"+containerName)
+	if httpErr != nil {
+		return httpErr
+	}
+	defer activity.end()
+
+	recorder, err := handler.startRecording(r, "pod", namespace+"/"+podName+"/"+containerName, command)
+	if err != nil {
+		return httperror.InternalServerError("Unable to start the recording of the session", err)
+	}
+	defer recorder.Close()
 
 	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -44,20 +85,50 @@ func (handler *Handler) websocketPodExec(w http.ResponseWriter, r *http.Request)
 	}
 	defer websocketConn.Close()
 
+	session := newTerminalSession(websocketConn, recorder, activity, framed)
+
+	sizeQueue := kubernetes.NewTerminalSizeQueue()
+	defer sizeQueue.Close()
+
+	session.resize = func(width, height uint16) error {
+		sizeQueue.Resize(width, height)
+
+		return nil
+	}
+
 	stdinReader, stdinWriter := io.Pipe()
 	defer stdinWriter.Close()
-	stdoutReader, stdoutWriter := io.Pipe()
-	defer stdoutWriter.Close()
 
 	errorChan := make(chan error, 1)
-	go streamFromWebsocketToWriter(websocketConn, stdinWriter, errorChan)
-	go streamFromReaderToWebsocket(websocketConn, stdoutReader, errorChan)
+	go func() {
+		streamFromWebsocketToWriter(session, stdinWriter, errorChan)
+
+		// Closing the input ends the shells once the client is gone
+		stdinWriter.Close()
+	}()
+
+	options := kubernetes.ExecProcessOptions{
+		Stdin:             stdinReader,
+		Stdout:            &terminalOutput{session: session, stream: messageTypeStdout},
+		Tty:               tty,
+		TerminalSizeQueue: sizeQueue,
+	}
 
-	err = handler.kubeClient.StartExecProcess(token, namespace, podName, containerName, commandArray, stdinReader, stdoutWriter)
+	if !tty {
+		options.Stderr = &terminalOutput{session: session, stream: messageTypeStderr}
+	}
+
+	exitCode, err := handler.kubeClient.StartExecProcess(token, namespace, podName, containerName, commandArray, options)
+	session.writeExit(exitCode, err)
 	if err != nil {
 		return httperror.InternalServerError("Unable to start exec process inside container", err)
 	}
 
+	// The framed protocol reports the end of the process, the raw protocol waits for the client to close the session
+	if framed {
+		return nil
+	}
+
 	err = <-errorChan
 	if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
 		log.Error().Err(err).Msg("websocket error")
@@ -65,3 +136,22 @@ func (handler *Handler) websocketPodExec(w http.ResponseWriter, r *http.Request)
 
 	return nil
 }
+
+// parseCommand returns the arguments of the command of an exec process.
+// The command is either a JSON array of arguments or a string split on spaces.
+func parseCommand(command string) ([]string, error) {
+	if !strings.HasPrefix(strings.TrimSpace(command), "[") {
+		return strings.Split(command, " "), nil
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(command), &args); err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 {
+		return nil, errors.New("the command must contain at least one argument")
+	}
+
+	return args, nil
+}
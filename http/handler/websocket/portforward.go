@@ -0,0 +1,268 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/docker"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/docker/docker/api/types"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// defaultPortForwardIdleTimeout is the duration without any traffic after which a forwarded port is closed
+	defaultPortForwardIdleTimeout = 5 * time.Minute
+	maxPortForwardIdleTimeout     = 24 * time.Hour
+	portForwardDialTimeout        = 10 * time.Second
+	portForwardBufferSize         = 32 * 1024
+)
+
+// errNetworkNamespaceUnavailable is returned when the network namespace of a container cannot be entered
+var errNetworkNamespaceUnavailable = errors.New("the network namespace of the container is not available")
+
+func (handler *Handler) websocketPortForward(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return handler.websocketOperation(w, r, handler.handlePortForwardRequest)
+}
+
+// handlePortForwardRequest tunnels a TCP stream over the websocket, the data is exchanged in binary messages.
+// The target is either a container (id and port query parameters), reached from inside its network namespace, or a pod
+// (namespace, podName and port query parameters), reached through the portforward subresource of the Kubernetes API.
+// The optional network query parameter selects the network of the container, the optional idleTimeout query parameter
+// (a duration such as 30m) overrides the duration without traffic after which the tunnel is closed.
+func (handler *Handler) handlePortForwardRequest(w http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	port, err := request.RetrieveNumericQueryParameter(r, "port", false)
+	if err != nil {
+		return httperror.BadRequest("Invalid query parameter: port", err)
+	}
+
+	if port < 1 || port > 65535 {
+		return httperror.BadRequest("Invalid query parameter: port", errors.New("port must be between 1 and 65535"))
+	}
+
+	idleTimeout := defaultPortForwardIdleTimeout
+	if value, _ := request.RetrieveQueryParameter(r, "idleTimeout", true); value != "" {
+		idleTimeout, err = time.ParseDuration(value)
+		if err != nil || idleTimeout <= 0 || idleTimeout > maxPortForwardIdleTimeout {
+			return httperror.BadRequest("Invalid query parameter: idleTimeout", errors.New("idleTimeout must be a positive duration of at most 24h"))
+		}
+	}
+
+	podName, _ := request.RetrieveQueryParameter(r, "podName", true)
+	containerID, _ := request.RetrieveQueryParameter(r, "id", true)
+
+	activity, httpErr := handler.startSession(r, "portforward", podName+containerID)
+	if httpErr != nil {
+		return httpErr
+	}
+	defer activity.end()
+
+	var target io.ReadWriteCloser
+	var targetName string
+
+	if podName != "" {
+		namespace, err := request.RetrieveQueryParameter(r, "namespace", false)
+		if err != nil {
+			return httperror.BadRequest("Invalid query parameter: namespace", err)
+		}
+
+		if handler.kubeClient == nil {
+			return httperror.BadRequest("Unable to forward a pod port", errors.New("the agent is not running on Kubernetes"))
+		}
+
+		token := r.Header.Get(agent.HTTPKubernetesSATokenHeaderName)
+
+		target, err = handler.kubeClient.PortForward(token, namespace, podName, port)
+		if err != nil {
+			return httperror.InternalServerError("Unable to forward the pod port", err)
+		}
+
+		targetName = namespace + "/" + podName
+	} else {
+		if !govalidator.IsHexadecimal(containerID) {
+			return httperror.BadRequest("Invalid query parameter: id (must be hexadecimal identifier)", errors.New("a container id or a pod name is required"))
+		}
+
+		networkName, _ := request.RetrieveQueryParameter(r, "network", true)
+
+		container, err := docker.ContainerInspect(containerID)
+		if err != nil {
+			return httperror.BadRequest("Unable to find the container", err)
+		}
+
+		target, err = dialContainer(container, networkName, port)
+		if err != nil {
+			return httperror.InternalServerError("Unable to connect to the container port", err)
+		}
+
+		targetName = containerID
+	}
+	defer target.Close()
+
+	websocketConn, err := handler.connectionUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return httperror.InternalServerError("Unable to upgrade the connection", err)
+	}
+	defer websocketConn.Close()
+
+	activity.attach(websocketConn)
+
+	log.Info().Str("target", targetName).Int("port", port).Str("remote_addr", r.RemoteAddr).Msg("port forwarding started")
+
+	err = forwardPort(websocketConn, target, activity, idleTimeout)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		log.Debug().Err(err).Str("target", targetName).Int("port", port).Msg("port forwarding ended with an error")
+	}
+
+	log.Info().Str("target", targetName).Int("port", port).Msg("port forwarding ended")
+
+	return nil
+}
+
+// dialContainer connects to a port of a running container. The connection is opened from inside the network namespace
+// of the container when the agent can enter it, so that the containers of networks isolated from the agent can be
+// reached, through the loopback interface unless a network is specified. The IP address of the container is dialed
+// from the network of the agent otherwise.
+func dialContainer(container types.ContainerJSON, networkName string, port int) (net.Conn, error) {
+	if container.State == nil || !container.State.Running {
+		return nil, errors.New("the container is not running")
+	}
+
+	address, addressErr := containerAddress(container, networkName)
+
+	if addressErr == nil || networkName == "" {
+		namespaceAddress := address
+		if networkName == "" {
+			namespaceAddress = "127.0.0.1"
+		}
+
+		conn, err := dialNetworkNamespace(networkNamespacePaths(container), net.JoinHostPort(namespaceAddress, strconv.Itoa(port)))
+		if !errors.Is(err, errNetworkNamespaceUnavailable) {
+			return conn, err
+		}
+
+		log.Debug().Err(err).Str("container_id", container.ID).Msg("dialing the IP address of the container")
+	}
+
+	if addressErr != nil {
+		return nil, addressErr
+	}
+
+	return net.DialTimeout("tcp", net.JoinHostPort(address, strconv.Itoa(port)), portForwardDialTimeout)
+}
+
+// networkNamespacePaths returns the paths of the network namespace of a container inside the host filesystem
+func networkNamespacePaths(container types.ContainerJSON) []string {
+	var paths []string
+
+	if container.NetworkSettings != nil && container.NetworkSettings.SandboxKey != "" {
+		paths = append(paths, agent.HostRoot+container.NetworkSettings.SandboxKey)
+	}
+
+	if container.State.Pid > 0 {
+		paths = append(paths, fmt.Sprintf("%s/proc/%d/ns/net", agent.HostRoot, container.State.Pid))
+	}
+
+	return paths
+}
+
+// containerAddress returns the IP address of a container, inside the specified network when not empty
+func containerAddress(container types.ContainerJSON, networkName string) (string, error) {
+	if container.NetworkSettings == nil {
+		return "", errors.New("the container is not connected to any network")
+	}
+
+	for name, settings := range container.NetworkSettings.Networks {
+		if (networkName == "" || name == networkName) && settings.IPAddress != "" {
+			return settings.IPAddress, nil
+		}
+	}
+
+	if networkName != "" {
+		return "", errors.New("the container has no IP address in the specified network")
+	}
+
+	return "", errors.New("the container has no IP address")
+}
+
+// forwardPort copies the data between the websocket and the target until either side is closed
+// or no data is exchanged during idleTimeout
+func forwardPort(websocketConn *websocket.Conn, target io.ReadWriteCloser, activity *activeSession, idleTimeout time.Duration) error {
+	idleTimer := time.AfterFunc(idleTimeout, func() {
+		log.Debug().Msg("closing idle port forwarding")
+
+		target.Close()
+		websocketConn.Close()
+	})
+	defer idleTimer.Stop()
+
+	errorChan := make(chan error, 2)
+
+	go func() {
+		for {
+			messageType, p, err := websocketConn.ReadMessage()
+			if err != nil {
+				errorChan <- err
+
+				return
+			}
+
+			if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+				continue
+			}
+
+			idleTimer.Reset(idleTimeout)
+			activity.touch()
+
+			if _, err := target.Write(p); err != nil {
+				errorChan <- err
+
+				return
+			}
+		}
+	}()
+
+	go func() {
+		out := make([]byte, portForwardBufferSize)
+
+		for {
+			n, err := target.Read(out)
+			if n > 0 {
+				idleTimer.Reset(idleTimeout)
+				activity.touch()
+
+				websocketConn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := websocketConn.WriteMessage(websocket.BinaryMessage, out[:n]); err != nil {
+					errorChan <- err
+
+					return
+				}
+			}
+
+			if err != nil {
+				errorChan <- err
+
+				return
+			}
+		}
+	}()
+
+	err := <-errorChan
+
+	// Tell the client that the target closed the connection
+	if errors.Is(err, io.EOF) {
+		websocketConn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+	}
+
+	return err
+}
@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// newEchoListener returns a TCP listener sending back the data it receives
+func newEchoListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	return listener
+}
+
+// newPortForwardServer returns the URL of a websocket forwarded to target
+func newPortForwardServer(t *testing.T, target func() (io.ReadWriteCloser, error), idleTimeout time.Duration) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := target()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		upgrader := websocket.Upgrader{}
+
+		websocketConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer websocketConn.Close()
+
+		forwardPort(websocketConn, conn, nil, idleTimeout)
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestForwardPort(t *testing.T) {
+	listener := newEchoListener(t)
+
+	url := newPortForwardServer(t, func() (io.ReadWriteCloser, error) {
+		return net.Dial("tcp", listener.Addr().String())
+	}, time.Minute)
+
+	clientConn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	require.NoError(t, clientConn.WriteMessage(websocket.BinaryMessage, []byte("ping")))
+
+	messageType, data, err := clientConn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, messageType)
+	require.Equal(t, "ping", string(data))
+}
+
+func TestForwardPortClosesIdleTunnel(t *testing.T) {
+	listener := newEchoListener(t)
+
+	url := newPortForwardServer(t, func() (io.ReadWriteCloser, error) {
+		return net.Dial("tcp", listener.Addr().String())
+	}, 100*time.Millisecond)
+
+	clientConn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	start := time.Now()
+	clientConn.SetReadDeadline(start.Add(5 * time.Second))
+
+	// The tunnel is closed by the agent before the deadline of the client
+	_, _, err = clientConn.ReadMessage()
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestDialContainer(t *testing.T) {
+	listener := newEchoListener(t)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	container := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "abc",
+			State: &types.ContainerState{Running: true},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			NetworkSettingsBase: types.NetworkSettingsBase{SandboxKey: "/var/run/docker/netns/missing"},
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {IPAddress: "127.0.0.1"},
+			},
+		},
+	}
+
+	// The IP address of the container is dialed when its network namespace is not available
+	conn, err := dialContainer(container, "", port)
+	require.NoError(t, err)
+	conn.Close()
+
+	_, err = dialContainer(container, "other", port)
+	require.EqualError(t, err, "the container has no IP address in the specified network")
+
+	container.State.Running = false
+	_, err = dialContainer(container, "", port)
+	require.EqualError(t, err, "the container is not running")
+}
+
+func TestHandlePortForwardRequestValidation(t *testing.T) {
+	handler := &Handler{sessionManager: newSessionManager(SessionLimits{})}
+
+	for _, query := range []string{
+		"id=abc",
+		"id=abc&port=0",
+		"id=abc&port=65536",
+		"id=abc&port=80&idleTimeout=48h",
+		"id=abc&port=80&idleTimeout=-1s",
+		"id=not-hexadecimal&port=80",
+		"podName=pod&port=80",
+		"podName=pod&namespace=default&port=80",
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/websocket/portforward?"+query, nil)
+
+		err := handler.handlePortForwardRequest(httptest.NewRecorder(), request)
+		require.NotNil(t, err, query)
+		require.Equal(t, http.StatusBadRequest, err.StatusCode, query)
+	}
+
+	// The sessions of the rejected requests are released
+	require.Empty(t, handler.sessionManager.list())
+}
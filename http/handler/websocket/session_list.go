@@ -0,0 +1,14 @@
+package websocket
+
+import (
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// GET request on /websocket/sessions
+// Lists the active websocket sessions of the node, the oldest first
+func (handler *Handler) sessionList(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	return response.JSON(rw, handler.sessionManager.list())
+}
@@ -0,0 +1,28 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+	"github.com/portainer/portainer/pkg/libhttp/response"
+)
+
+// DELETE request on /websocket/sessions/{id}
+// Terminates an active websocket session, the client is notified before the websocket is closed
+func (handler *Handler) sessionTerminate(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+	sessionID, err := request.RetrieveRouteVariableValue(r, "id")
+	if err != nil {
+		return httperror.BadRequest("Invalid session identifier route variable", err)
+	}
+
+	err = handler.sessionManager.terminate(sessionID)
+	if errors.Is(err, errSessionNotFound) {
+		return httperror.NotFound("Unable to find the session", err)
+	} else if err != nil {
+		return httperror.InternalServerError("Unable to terminate the session", err)
+	}
+
+	return response.Empty(rw)
+}
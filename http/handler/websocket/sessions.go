@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/identifier"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// errTooManySessions is returned when the maximum number of concurrent sessions is reached
+	errTooManySessions = errors.New("too many active websocket sessions")
+	// errSessionNotFound is returned when a session does not exist or has already ended
+	errSessionNotFound = errors.New("websocket session not found")
+)
+
+const (
+	terminationIdle     = "the session was idle for too long"
+	terminationDuration = "the session reached its maximum duration"
+	terminationForced   = "the session was terminated by an administrator"
+)
+
+// SessionLimits are the limits enforced on the websocket sessions of the agent, a zero value disables a limit
+type SessionLimits struct {
+	// IdleTimeout is the duration without any client input after which a session is closed, port forwarding sessions
+	// are also kept open by the data sent by the target
+	IdleTimeout time.Duration
+	// MaxDuration is the duration after which a session is closed
+	MaxDuration time.Duration
+	// MaxSessions is the maximum number of concurrent sessions on the node
+	MaxSessions int
+}
+
+// SessionInfo contains the details of an active websocket session
+type SessionInfo struct {
+	ID string `json:"ID"`
+	// Type is the type of the session: exec, attach, pod or portforward
+	Type         string `json:"Type"`
+	Target       string `json:"Target"`
+	RemoteAddr   string `json:"RemoteAddr"`
+	StartedAt    int64  `json:"StartedAt"`
+	LastActivity int64  `json:"LastActivity"`
+}
+
+// sessionManager keeps track of the active websocket sessions and enforces the session limits
+type sessionManager struct {
+	limits   SessionLimits
+	sessions map[string]*activeSession
+	mu       sync.Mutex
+}
+
+// activeSession is a websocket session tracked by the sessionManager.
+// A nil activeSession is valid and tracks nothing.
+type activeSession struct {
+	manager      *sessionManager
+	info         SessionInfo
+	conn         *websocket.Conn
+	lastActivity time.Time
+	idleTimer    *time.Timer
+	maxTimer     *time.Timer
+	terminated   string
+	ended        bool
+	mu           sync.Mutex
+}
+
+func newSessionManager(limits SessionLimits) *sessionManager {
+	return &sessionManager{
+		limits:   limits,
+		sessions: make(map[string]*activeSession),
+	}
+}
+
+// start registers a new session, the session must be ended once closed
+func (manager *sessionManager) start(sessionType, target, remoteAddr string) (*activeSession, error) {
+	id, err := identifier.New()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	session := &activeSession{
+		manager: manager,
+		info: SessionInfo{
+			ID:         id,
+			Type:       sessionType,
+			Target:     target,
+			RemoteAddr: remoteAddr,
+			StartedAt:  now.Unix(),
+		},
+		lastActivity: now,
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if manager.limits.MaxSessions > 0 && len(manager.sessions) >= manager.limits.MaxSessions {
+		return nil, errTooManySessions
+	}
+
+	manager.sessions[id] = session
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	if manager.limits.IdleTimeout > 0 {
+		session.idleTimer = time.AfterFunc(manager.limits.IdleTimeout, session.checkIdle)
+	}
+
+	if manager.limits.MaxDuration > 0 {
+		session.maxTimer = time.AfterFunc(manager.limits.MaxDuration, func() {
+			session.terminate(terminationDuration)
+		})
+	}
+
+	return session, nil
+}
+
+// list returns the active sessions, the oldest first
+func (manager *sessionManager) list() []SessionInfo {
+	manager.mu.Lock()
+	sessions := make([]SessionInfo, 0, len(manager.sessions))
+	for _, session := range manager.sessions {
+		sessions = append(sessions, session.details())
+	}
+	manager.mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt < sessions[j].StartedAt
+	})
+
+	return sessions
+}
+
+// terminate closes an active session
+func (manager *sessionManager) terminate(id string) error {
+	manager.mu.Lock()
+	session, ok := manager.sessions[id]
+	manager.mu.Unlock()
+
+	if !ok {
+		return errSessionNotFound
+	}
+
+	session.terminate(terminationForced)
+
+	return nil
+}
+
+func (manager *sessionManager) remove(id string) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	delete(manager.sessions, id)
+}
+
+// attach binds the websocket of the session, so that it can be closed when a limit is reached
+func (session *activeSession) attach(conn *websocket.Conn) {
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	session.conn = conn
+	reason := session.terminated
+	session.mu.Unlock()
+
+	// The session was terminated before the websocket was opened
+	if reason != "" {
+		closeWebsocket(conn, reason)
+	}
+}
+
+// touch records some traffic on the session
+func (session *activeSession) touch() {
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	session.lastActivity = time.Now()
+	session.mu.Unlock()
+}
+
+// end unregisters the session once closed
+func (session *activeSession) end() {
+	if session == nil {
+		return
+	}
+
+	session.mu.Lock()
+	session.ended = true
+
+	if session.idleTimer != nil {
+		session.idleTimer.Stop()
+	}
+
+	if session.maxTimer != nil {
+		session.maxTimer.Stop()
+	}
+	session.mu.Unlock()
+
+	session.manager.remove(session.info.ID)
+}
+
+func (session *activeSession) details() SessionInfo {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	info := session.info
+	info.LastActivity = session.lastActivity.Unix()
+
+	return info
+}
+
+// checkIdle terminates the session when no traffic happened during the idle timeout, it checks again later otherwise
+func (session *activeSession) checkIdle() {
+	session.mu.Lock()
+	if session.ended {
+		session.mu.Unlock()
+		return
+	}
+
+	remaining := session.manager.limits.IdleTimeout - time.Since(session.lastActivity)
+	if remaining > 0 {
+		session.idleTimer.Reset(remaining)
+		session.mu.Unlock()
+
+		return
+	}
+	session.mu.Unlock()
+
+	session.terminate(terminationIdle)
+}
+
+func (session *activeSession) terminate(reason string) {
+	session.mu.Lock()
+	if session.ended || session.terminated != "" {
+		session.mu.Unlock()
+		return
+	}
+
+	session.terminated = reason
+	conn := session.conn
+	session.mu.Unlock()
+
+	log.Info().
+		Str("session_id", session.info.ID).
+		Str("type", session.info.Type).
+		Str("target", session.info.Target).
+		Str("reason", reason).
+		Msg("terminating websocket session")
+
+	if conn != nil {
+		closeWebsocket(conn, reason)
+	}
+}
+
+// closeWebsocket tells the client why the session is closed before closing the websocket,
+// which ends the streams of the session
+func closeWebsocket(conn *websocket.Conn, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), time.Now().Add(writeWait))
+	conn.Close()
+}
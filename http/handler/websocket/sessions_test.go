@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManagerMaxSessions(t *testing.T) {
+	manager := newSessionManager(SessionLimits{MaxSessions: 1})
+
+	session, err := manager.start("exec", "exec-id", "127.0.0.1")
+	require.NoError(t, err)
+
+	_, err = manager.start("exec", "exec-id", "127.0.0.1")
+	require.ErrorIs(t, err, errTooManySessions)
+
+	session.end()
+
+	_, err = manager.start("exec", "exec-id", "127.0.0.1")
+	require.NoError(t, err)
+}
+
+func TestSessionManagerIdleTimeout(t *testing.T) {
+	manager := newSessionManager(SessionLimits{IdleTimeout: 200 * time.Millisecond})
+
+	session, err := manager.start("pod", "default/pod/container", "127.0.0.1")
+	require.NoError(t, err)
+	defer session.end()
+
+	// The activity postpones the termination
+	for i := 0; i < 4; i++ {
+		time.Sleep(50 * time.Millisecond)
+		session.touch()
+	}
+
+	session.mu.Lock()
+	require.Empty(t, session.terminated)
+	session.mu.Unlock()
+
+	require.Eventually(t, func() bool {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		return session.terminated == terminationIdle
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestSessionManagerTerminate(t *testing.T) {
+	manager := newSessionManager(SessionLimits{})
+
+	session, err := manager.start("attach", "container-id", "127.0.0.1")
+	require.NoError(t, err)
+
+	sessions := manager.list()
+	require.Len(t, sessions, 1)
+	require.Equal(t, session.info.ID, sessions[0].ID)
+
+	require.NoError(t, manager.terminate(session.info.ID))
+	require.Equal(t, terminationForced, session.terminated)
+
+	session.end()
+
+	require.Empty(t, manager.list())
+	require.ErrorIs(t, manager.terminate(session.info.ID), errSessionNotFound)
+}
@@ -3,15 +3,13 @@ package websocket
 import (
 	"io"
 	"unicode/utf8"
-
-	"github.com/gorilla/websocket"
 )
 
 const readerBufferSize = 2048
 
-func streamFromWebsocketToWriter(websocketConn *websocket.Conn, writer io.Writer, errorChan chan error) {
+func streamFromWebsocketToWriter(session *terminalSession, writer io.Writer, errorChan chan error) {
 	for {
-		_, in, err := websocketConn.ReadMessage()
+		in, err := session.readInput()
 		if err != nil {
 			errorChan <- err
 
@@ -23,24 +21,8 @@ func streamFromWebsocketToWriter(websocketConn *websocket.Conn, writer io.Writer
 
 			break
 		}
-	}
-}
 
-func streamFromReaderToWebsocket(websocketConn *websocket.Conn, reader io.Reader, errorChan chan error) {
-	for {
-		out := make([]byte, readerBufferSize)
-		if _, err := reader.Read(out); err != nil {
-			errorChan <- err
-
-			break
-		}
-
-		processedOutput := validString(string(out))
-		if err := websocketConn.WriteMessage(websocket.TextMessage, []byte(processedOutput)); err != nil {
-			errorChan <- err
-
-			break
-		}
+		session.recorder.Input(in)
 	}
 }
 
@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/recording"
+	"github.com/portainer/portainer/pkg/libhttp/request"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+// The terminal websockets support two protocols, selected with the protocol query parameter:
+//   - the raw protocol, used by default, where the messages contain the terminal input and output as is
+//   - the framed protocol (protocol=v2), where every message is a JSON terminalMessage. It allows the
+//     client to resize the terminal, separates the error output and reports the exit code of the process.
+const (
+	terminalProtocolRaw    = "raw"
+	terminalProtocolFramed = "v2"
+)
+
+const (
+	messageTypeStdin  = "stdin"
+	messageTypeResize = "resize"
+	messageTypeStdout = "stdout"
+	messageTypeStderr = "stderr"
+	messageTypeExit   = "exit"
+)
+
+// terminalMessage is a message of the framed protocol.
+// The client sends stdin and resize messages, the agent sends stdout, stderr and a final exit message.
+type terminalMessage struct {
+	Type   string `json:"type"`
+	Data   string `json:"data,omitempty"`
+	Width  uint16 `json:"width,omitempty"`
+	Height uint16 `json:"height,omitempty"`
+	// Code is the exit code of the process, only set in exit messages
+	Code *int `json:"code,omitempty"`
+	// Error is set in exit messages when the process could not be run or its exit code is unknown
+	Error string `json:"error,omitempty"`
+}
+
+// terminalSession holds the websocket of a terminal session, it encodes and decodes the messages
+// of the selected protocol and serializes the writes to the websocket.
+type terminalSession struct {
+	conn     *websocket.Conn
+	recorder *recording.Recorder
+	activity *activeSession
+	framed   bool
+	// resize is called when the client resizes the terminal, only available with the framed protocol
+	resize func(width, height uint16) error
+	mu     sync.Mutex
+}
+
+// retrieveTerminalProtocol returns true when the request selects the framed protocol
+func retrieveTerminalProtocol(r *http.Request) (bool, error) {
+	protocol, _ := request.RetrieveQueryParameter(r, "protocol", true)
+
+	switch protocol {
+	case "", terminalProtocolRaw:
+		return false, nil
+	case terminalProtocolFramed:
+		return true, nil
+	}
+
+	return false, errors.New("protocol must be either raw or v2")
+}
+
+func newTerminalSession(conn *websocket.Conn, recorder *recording.Recorder, activity *activeSession, framed bool) *terminalSession {
+	activity.attach(conn)
+
+	return &terminalSession{
+		conn:     conn,
+		recorder: recorder,
+		activity: activity,
+		framed:   framed,
+	}
+}
+
+// readInput returns the next input sent by the client, the resize messages are handled internally
+func (session *terminalSession) readInput() ([]byte, error) {
+	for {
+		messageType, p, err := session.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		session.activity.touch()
+
+		if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+			continue
+		}
+
+		if !session.framed {
+			return p, nil
+		}
+
+		var message terminalMessage
+		if err := json.Unmarshal(p, &message); err != nil {
+			log.Debug().Err(err).Msg("ignoring invalid terminal message")
+
+			continue
+		}
+
+		switch message.Type {
+		case messageTypeStdin:
+			return []byte(message.Data), nil
+		case messageTypeResize:
+			session.resizeTerminal(message.Width, message.Height)
+		default:
+			log.Debug().Str("type", message.Type).Msg("ignoring unknown terminal message")
+		}
+	}
+}
+
+func (session *terminalSession) resizeTerminal(width, height uint16) {
+	if width == 0 || height == 0 || session.resize == nil {
+		return
+	}
+
+	session.recorder.Resize(uint(width), uint(height))
+
+	if err := session.resize(width, height); err != nil {
+		log.Debug().Err(err).Msg("unable to resize the terminal")
+	}
+}
+
+// writeOutput sends the output of the process to the client, stream is either stdout or stderr
+// The output does not count as activity, a process printing continuously would otherwise keep an unattended session open
+func (session *terminalSession) writeOutput(stream string, data []byte) error {
+	session.recorder.Output(data)
+
+	output := validString(string(data))
+	if !session.framed {
+		return session.write(websocket.TextMessage, []byte(output))
+	}
+
+	return session.writeMessage(terminalMessage{Type: stream, Data: output})
+}
+
+// writeExit reports the end of the process to the client, it does nothing with the raw protocol
+func (session *terminalSession) writeExit(code int, exitErr error) {
+	if !session.framed {
+		return
+	}
+
+	message := terminalMessage{Type: messageTypeExit}
+	if exitErr != nil {
+		message.Error = exitErr.Error()
+	} else {
+		message.Code = &code
+	}
+
+	if err := session.writeMessage(message); err != nil {
+		log.Debug().Err(err).Msg("unable to send the exit code of the terminal session")
+	}
+}
+
+func (session *terminalSession) ping() error {
+	return session.write(websocket.PingMessage, nil)
+}
+
+func (session *terminalSession) writeMessage(message terminalMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return session.write(websocket.TextMessage, data)
+}
+
+func (session *terminalSession) write(messageType int, data []byte) error {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	return session.conn.WriteMessage(messageType, data)
+}
+
+// terminalOutput is an io.Writer sending the output of a process to the client
+type terminalOutput struct {
+	session *terminalSession
+	stream  string
+}
+
+func (output *terminalOutput) Write(p []byte) (int, error) {
+	if err := output.session.writeOutput(output.stream, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
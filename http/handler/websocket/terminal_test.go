@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminalOutputDoesNotPostponeIdleTimeout(t *testing.T) {
+	manager := newSessionManager(SessionLimits{IdleTimeout: 200 * time.Millisecond})
+
+	activity, err := manager.start("exec", "exec-id", "127.0.0.1")
+	require.NoError(t, err)
+	defer activity.end()
+
+	sessionChan := make(chan *terminalSession, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		sessionChan <- newTerminalSession(conn, nil, activity, false)
+	}))
+	defer server.Close()
+
+	clientConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer clientConn.Close()
+
+	go func() {
+		for {
+			if _, _, err := clientConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	session := <-sessionChan
+
+	// A process printing continuously does not keep the session open
+	require.Eventually(t, func() bool {
+		session.writeOutput(messageTypeStdout, []byte("output"))
+
+		activity.mu.Lock()
+		defer activity.mu.Unlock()
+
+		return activity.terminated == terminationIdle
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 
 	"github.com/rs/zerolog/log"
@@ -12,17 +13,20 @@ import (
 
 // AgentProxy enables redirection to different nodes
 type AgentProxy struct {
-	clusterService agent.ClusterService
-	runtimeConfig  *agent.RuntimeConfig
-	useTLS         bool
+	clusterService     agent.ClusterService
+	runtimeConfig      *agent.RuntimeConfig
+	useTLS             bool
+	certificateManager *crypto.CertificateManager
 }
 
-// NewAgentProxy returns a pointer to a new AgentProxy object
-func NewAgentProxy(clusterService agent.ClusterService, config *agent.RuntimeConfig, useTLS bool) *AgentProxy {
+// NewAgentProxy returns a pointer to a new AgentProxy object.
+// The certificate of certificateManager is presented to the agents requiring a client certificate.
+func NewAgentProxy(clusterService agent.ClusterService, config *agent.RuntimeConfig, useTLS bool, certificateManager *crypto.CertificateManager) *AgentProxy {
 	return &AgentProxy{
-		clusterService: clusterService,
-		runtimeConfig:  config,
-		useTLS:         useTLS,
+		clusterService:     clusterService,
+		runtimeConfig:      config,
+		useTLS:             useTLS,
+		certificateManager: certificateManager,
 	}
 }
 
@@ -51,7 +55,7 @@ func (p *AgentProxy) Redirect(next http.Handler) http.Handler {
 			return httperror.InternalServerError("The agent was unable to contact any other agent", errors.New("Unable to find the targeted agent"))
 		}
 
-		AgentHTTPRequest(rw, r, targetMember, p.useTLS)
+		AgentHTTPRequest(rw, r, targetMember, p.useTLS, p.certificateManager)
 
 		return nil
 	})
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourcePaths associates the resources notified by the Docker events to the paths of the cluster operations
+var resourcePaths = map[string][]string{
+	"container": {"/containers/json", "/system/df"},
+	"image":     {"/images/json", "/system/df"},
+	"volume":    {"/volumes", "/system/df"},
+	"network":   {"/networks"},
+	"builder":   {"/system/df"},
+}
+
+// responseCache keeps the responses of the nodes to the cluster operations during a short time.
+// A nil responseCache is valid and caches nothing.
+type responseCache struct {
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	// generations is incremented for a node each time its entries are invalidated, the responses retrieved
+	// before an invalidation are not cached as they may be outdated
+	generations map[string]uint64
+	mu          sync.Mutex
+}
+
+type cacheEntry struct {
+	nodeName  string
+	path      string
+	body      []byte
+	expiresAt time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &responseCache{
+		ttl:         ttl,
+		entries:     make(map[string]cacheEntry),
+		generations: make(map[string]uint64),
+	}
+}
+
+func (cache *responseCache) get(key string) ([]byte, bool) {
+	if cache == nil {
+		return nil, false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.body, true
+}
+
+// generation returns the current generation of the entries of a node, it must be retrieved before requesting
+// the node and given to set along with the response
+func (cache *responseCache) generation(nodeName string) uint64 {
+	if cache == nil {
+		return 0
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	// The node is registered so that the invalidations of every node also apply to its requests in progress
+	generation, ok := cache.generations[nodeName]
+	if !ok {
+		cache.generations[nodeName] = 0
+	}
+
+	return generation
+}
+
+// set caches the response of a node, the response is dropped when the entries of the node were invalidated
+// since the generation was retrieved
+func (cache *responseCache) set(nodeName, path, key string, body []byte, generation uint64) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.generations[nodeName] != generation {
+		return
+	}
+
+	now := time.Now()
+
+	for key, entry := range cache.entries {
+		if now.After(entry.expiresAt) {
+			delete(cache.entries, key)
+		}
+	}
+
+	cache.entries[key] = cacheEntry{
+		nodeName:  nodeName,
+		path:      path,
+		body:      body,
+		expiresAt: now.Add(cache.ttl),
+	}
+}
+
+// invalidate removes the entries of a node related to the resources, the entries of every node are removed
+// when nodeName is empty
+func (cache *responseCache) invalidate(nodeName string, resources []string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.nextGeneration(nodeName)
+
+	for key, entry := range cache.entries {
+		if nodeName != "" && entry.nodeName != nodeName {
+			continue
+		}
+
+		if entryRelatedTo(entry, resources) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// invalidateNode removes all the entries of a node
+func (cache *responseCache) invalidateNode(nodeName string) {
+	if cache == nil {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.nextGeneration(nodeName)
+
+	for key, entry := range cache.entries {
+		if entry.nodeName == nodeName {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// nextGeneration increments the generation of a node, or of every node when nodeName is empty,
+// the caller must hold the lock
+func (cache *responseCache) nextGeneration(nodeName string) {
+	if nodeName != "" {
+		cache.generations[nodeName]++
+
+		return
+	}
+
+	for name := range cache.generations {
+		cache.generations[name]++
+	}
+}
+
+func entryRelatedTo(entry cacheEntry, resources []string) bool {
+	for _, resource := range resources {
+		for _, path := range resourcePaths[resource] {
+			if strings.HasPrefix(entry.path, path) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
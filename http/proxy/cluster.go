@@ -2,10 +2,14 @@ package proxy
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -15,95 +19,313 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-const defaultClusterRequestTimeout = 120
+// Quorums that can be required for a cluster operation, a number of nodes can also be specified
+const (
+	QuorumAll      = "all"
+	QuorumMajority = "majority"
+)
+
+const (
+	clusterMaxIdleConnsPerHost = 4
+	clusterIdleConnTimeout     = 90 * time.Second
+)
+
+// ErrQuorumNotMet is returned when fewer nodes than the required quorum responded to a cluster operation
+var ErrQuorumNotMet = errors.New("the quorum of nodes required by the cluster operation was not met")
 
 // ClusterProxy is a service used to execute the same requests on multiple targets.
 type ClusterProxy struct {
 	client     *http.Client
 	pingClient *http.Client
 	useTLS     bool
+	config     ClusterProxyConfig
+	cache      *responseCache
+	// localTransport sends the requests of the local member to the local Docker API
+	localTransport http.RoundTripper
+}
+
+// ClusterProxyConfig is the configuration of the cluster operations
+type ClusterProxyConfig struct {
+	// NodeTimeout is the duration after which a node that did not respond is considered failed, no timeout when 0
+	NodeTimeout time.Duration
+	// Quorum is the default minimum number of nodes that must respond to a cluster operation:
+	// all, majority or a number of nodes. Partial responses are accepted when empty.
+	Quorum string
+	// CacheTTL is the duration during which the responses of the nodes to the GET requests are cached,
+	// the responses are not cached when 0
+	CacheTTL time.Duration
+	// LocalNodeName is the name of the local member, its requests are sent to the local Docker API directly.
+	// The signature of a request is verified once when it enters the agent, sending it back through the agent API
+	// would be rejected as its nonce was already used.
+	LocalNodeName string
+	// CertificateManager provides the certificate presented to the agents requiring a client certificate,
+	// no certificate is presented when it is nil
+	CertificateManager *crypto.CertificateManager
+}
+
+// ClusterOperationReport describes the nodes that responded and the nodes that failed during a cluster operation.
+// The nodes whose response was served from the cache were not contacted, they are reported as cached.
+type ClusterOperationReport struct {
+	Responded []string      `json:"Responded"`
+	Cached    []string      `json:"Cached"`
+	Failed    []NodeFailure `json:"Failed"`
+}
+
+// NodeFailure describes why a node failed during a cluster operation
+type NodeFailure struct {
+	NodeName string `json:"NodeName"`
+	Error    string `json:"Error"`
+}
+
+func newClusterOperationReport() ClusterOperationReport {
+	return ClusterOperationReport{
+		Responded: []string{},
+		Cached:    []string{},
+		Failed:    []NodeFailure{},
+	}
+}
+
+func (report *ClusterOperationReport) add(result agentRequestResult) {
+	if result.err != nil {
+		log.Warn().
+			Str("node", result.nodeName).
+			Err(result.err).
+			Msg("unable to retrieve node resources for aggregation")
+
+		report.Failed = append(report.Failed, NodeFailure{NodeName: result.nodeName, Error: result.err.Error()})
+
+		return
+	}
+
+	if result.cached {
+		report.Cached = append(report.Cached, result.nodeName)
+
+		return
+	}
+
+	report.Responded = append(report.Responded, result.nodeName)
+}
+
+func (report *ClusterOperationReport) sort() {
+	sort.Strings(report.Responded)
+	sort.Strings(report.Cached)
+	sort.Slice(report.Failed, func(i, j int) bool {
+		return report.Failed[i].NodeName < report.Failed[j].NodeName
+	})
 }
 
 // NewClusterProxy returns a pointer to a ClusterProxy.
 // It also sets the default values used in the underlying http.Client.
-func NewClusterProxy(useTLS bool) *ClusterProxy {
-	tlsConfig := crypto.CreateTLSConfiguration()
-	tlsConfig.InsecureSkipVerify = true
+// The connections to the agents are kept alive between the cluster operations.
+func NewClusterProxy(useTLS bool, config ClusterProxyConfig) *ClusterProxy {
+	tlsConfig := crypto.CreateAgentClientTLSConfiguration(config.CertificateManager)
+
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: clusterMaxIdleConnsPerHost,
+		IdleConnTimeout:     clusterIdleConnTimeout,
+	}
 
 	return &ClusterProxy{
 		client: &http.Client{
-			Timeout: time.Second * defaultClusterRequestTimeout,
-			Transport: &http.Transport{
-				TLSClientConfig:   tlsConfig,
-				DisableKeepAlives: true,
-			},
+			Transport: transport,
 		},
 		pingClient: &http.Client{
-			Timeout: time.Second * 3,
-			Transport: &http.Transport{
-				TLSClientConfig:   tlsConfig,
-				DisableKeepAlives: true,
-			},
+			Timeout:   time.Second * 3,
+			Transport: transport,
 		},
-		useTLS: useTLS,
+		useTLS:         useTLS,
+		config:         config,
+		cache:          newResponseCache(config.CacheTTL),
+		localTransport: NewLocalProxy().transport,
 	}
 }
 
+// nodeResponseParser returns the objects contained in the body of the response of a node to a request
+type nodeResponseParser func(body []byte, request *http.Request, nodeName string) ([]json.RawMessage, error)
+
 type agentRequestResult struct {
-	responseContent []any
-	err             error
-	nodeName        string
+	items    []json.RawMessage
+	err      error
+	nodeName string
+	// cached is true when the response was served from the cache
+	cached bool
+}
+
+// ValidateQuorum returns an error when the quorum is neither empty, all, majority nor a positive number of nodes
+func ValidateQuorum(quorum string) error {
+	_, err := requiredNodes(quorum, 0)
+
+	return err
+}
+
+// requiredNodes returns the number of nodes that must respond to a cluster operation executed on nodeCount nodes
+func requiredNodes(quorum string, nodeCount int) (int, error) {
+	switch quorum {
+	case "":
+		return 0, nil
+	case QuorumAll:
+		return nodeCount, nil
+	case QuorumMajority:
+		return nodeCount/2 + 1, nil
+	}
+
+	count, err := strconv.Atoi(quorum)
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid quorum %q, it must be all, majority or a positive number of nodes", quorum)
+	}
+
+	return count, nil
+}
+
+// RequiresQuorum returns true when a quorum must be met by a cluster operation, the default quorum is used
+// when quorum is empty. The response of such an operation cannot be streamed, as its status depends on the nodes
+// that responded.
+func (clusterProxy *ClusterProxy) RequiresQuorum(quorum string) bool {
+	return quorum != "" || clusterProxy.config.Quorum != ""
 }
 
 // ClusterOperation will copy and execute the specified request on a set of agents.
-// It aggregates the data of each request's response in a single response object.
-func (clusterProxy *ClusterProxy) ClusterOperation(request *http.Request, clusterMembers []agent.ClusterMember) (any, error) {
+// It aggregates the data of each request's response in a single response object and reports
+// the nodes that responded and the nodes that failed. ErrQuorumNotMet is returned along with the report
+// when fewer nodes than required by the quorum responded, the default quorum is used when quorum is empty.
+// The cache is not used when a quorum is required, so that only the nodes that were reached count.
+func (clusterProxy *ClusterProxy) ClusterOperation(request *http.Request, clusterMembers []agent.ClusterMember, quorum string) (any, ClusterOperationReport, error) {
+	report := newClusterOperationReport()
+
+	if quorum == "" {
+		quorum = clusterProxy.config.Quorum
+	}
 
-	memberCount := len(clusterMembers)
+	required, err := requiredNodes(quorum, len(clusterMembers))
+	if err != nil {
+		return nil, report, err
+	}
 
-	dataChannel := make(chan agentRequestResult, memberCount)
+	results, err := clusterProxy.executeRequestOnCluster(request, clusterMembers, nodeListItems, required == 0)
+	if err != nil {
+		return nil, report, err
+	}
 
-	clusterProxy.executeRequestOnCluster(request, clusterMembers, dataChannel)
+	aggregatedData := make([]json.RawMessage, 0)
 
-	close(dataChannel)
+	for result := range results {
+		report.add(result)
 
-	aggregatedData := make([]any, 0, memberCount)
+		aggregatedData = append(aggregatedData, result.items...)
+	}
 
-	for result := range dataChannel {
-		if result.err != nil {
-			log.Warn().
-				Str("node", result.nodeName).
-				Err(result.err).
-				Msg("unable to retrieve node resources for aggregation")
+	report.sort()
 
-			continue
-		}
+	if len(report.Responded) < required {
+		return nil, report, fmt.Errorf("%w: %d of %d nodes responded, %d required", ErrQuorumNotMet, len(report.Responded), len(clusterMembers), required)
+	}
+
+	responseData := reproduceDockerAPIResponse(aggregatedData, request.URL.Path)
+
+	return responseData, report, nil
+}
+
+// StreamClusterOperation will copy and execute the specified request on a set of agents.
+// The objects returned by each agent are written to the response as soon as the agent responds,
+// the report of the nodes that responded and the nodes that failed is returned once all the agents responded.
+// The report must be sent in a trailer, the HTTPResponseClusterNodesHeaderName trailer is declared by this function.
+// An error is only returned when nothing was written to the response.
+func (clusterProxy *ClusterProxy) StreamClusterOperation(rw http.ResponseWriter, request *http.Request, clusterMembers []agent.ClusterMember) (ClusterOperationReport, error) {
+	report := newClusterOperationReport()
+
+	results, err := clusterProxy.executeRequestOnCluster(request, clusterMembers, nodeListItems, true)
+	if err != nil {
+		return report, err
+	}
+
+	prefix, suffix := aggregatedResponseDelimiters(request.URL.Path)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Trailer", agent.HTTPResponseClusterNodesHeaderName)
+	rw.WriteHeader(http.StatusOK)
+
+	writer := &streamWriter{writer: rw}
+	writer.write([]byte(prefix))
 
-		for _, item := range result.responseContent {
-			decoratedObject := decorateObject(item, result.nodeName)
-			aggregatedData = append(aggregatedData, decoratedObject)
+	separator := []byte{}
+
+	for result := range results {
+		report.add(result)
+
+		for _, item := range result.items {
+			writer.write(separator)
+			writer.write(item)
+
+			separator = []byte(",")
 		}
+
+		writer.flush()
 	}
 
-	responseData := reproduceDockerAPIResponse(aggregatedData, request.URL.Path)
+	writer.write([]byte(suffix))
+	report.sort()
+
+	if writer.err != nil {
+		log.Debug().Err(writer.err).Msg("unable to write the cluster operation response")
+	}
 
-	return responseData, nil
+	return report, nil
 }
 
-func (clusterProxy *ClusterProxy) executeRequestOnCluster(request *http.Request, clusterMembers []agent.ClusterMember, ch chan agentRequestResult) {
+// InvalidateCache removes the cached responses of a node related to the specified resources
+// (container, image, volume, network or builder), the responses of every node are removed when nodeName is empty
+func (clusterProxy *ClusterProxy) InvalidateCache(nodeName string, resources []string) {
+	clusterProxy.cache.invalidate(nodeName, resources)
+}
+
+// InvalidateNodeCache removes all the cached responses of a node, it is used when a request that may modify
+// the resources of the node goes through this agent
+func (clusterProxy *ClusterProxy) InvalidateNodeCache(nodeName string) {
+	clusterProxy.cache.invalidateNode(nodeName)
+}
+
+// HandleResourcesChangedEvent invalidates the cached responses of the node that broadcast the event
+func (clusterProxy *ClusterProxy) HandleResourcesChangedEvent(payload []byte) {
+	var event agent.ResourcesChangedEvent
+
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Debug().Err(err).Msg("ignoring invalid resources changed event")
+
+		return
+	}
+
+	clusterProxy.InvalidateCache(event.NodeName, event.Resources)
+}
+
+// executeRequestOnCluster executes the request on every member concurrently,
+// the returned channel receives the result of each member and is closed once all the members responded.
+// The cached responses of the members are used when useCache is set.
+func (clusterProxy *ClusterProxy) executeRequestOnCluster(request *http.Request, clusterMembers []agent.ClusterMember, parse nodeResponseParser, useCache bool) (<-chan agentRequestResult, error) {
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan agentRequestResult, len(clusterMembers))
 
 	wg := &sync.WaitGroup{}
 
 	for i := range clusterMembers {
 		wg.Add(1)
 		member := clusterMembers[i]
-		go clusterProxy.copyAndExecuteRequest(request, &member, ch, wg)
+		go clusterProxy.copyAndExecuteRequest(request, body, &member, parse, useCache, ch, wg)
 	}
 
-	wg.Wait()
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	return ch, nil
 }
 
-func (clusterProxy *ClusterProxy) pingAgent(request *http.Request, member *agent.ClusterMember) error {
+func (clusterProxy *ClusterProxy) pingAgent(ctx context.Context, request *http.Request, member *agent.ClusterMember) error {
 	agentScheme := "http"
 	if request.TLS != nil {
 		agentScheme = "https"
@@ -111,7 +333,7 @@ func (clusterProxy *ClusterProxy) pingAgent(request *http.Request, member *agent
 
 	agentURL := fmt.Sprintf("%s://%s:%s/ping", agentScheme, member.IPAddress, member.Port)
 
-	pingRequest, err := http.NewRequest(http.MethodGet, agentURL, nil)
+	pingRequest, err := http.NewRequestWithContext(ctx, http.MethodGet, agentURL, nil)
 	if err != nil {
 		return err
 	}
@@ -131,44 +353,100 @@ func (clusterProxy *ClusterProxy) pingAgent(request *http.Request, member *agent
 	return nil
 }
 
-func (clusterProxy *ClusterProxy) copyAndExecuteRequest(request *http.Request, member *agent.ClusterMember, ch chan agentRequestResult, wg *sync.WaitGroup) {
+func (clusterProxy *ClusterProxy) copyAndExecuteRequest(request *http.Request, body []byte, member *agent.ClusterMember, parse nodeResponseParser, useCache bool, ch chan agentRequestResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	err := clusterProxy.pingAgent(request, member)
+	responseBody, cached, err := clusterProxy.retrieveNodeResponse(request, body, member, useCache)
 	if err != nil {
 		ch <- agentRequestResult{err: err, nodeName: member.NodeName}
 		return
 	}
 
-	requestCopy, err := copyRequest(request, member, clusterProxy.useTLS)
+	items, err := parse(responseBody, request, member.NodeName)
 	if err != nil {
 		ch <- agentRequestResult{err: err, nodeName: member.NodeName}
 		return
 	}
 
-	response, err := clusterProxy.client.Do(requestCopy)
+	ch <- agentRequestResult{err: nil, items: items, nodeName: member.NodeName, cached: cached}
+}
+
+// retrieveNodeResponse returns the body of the response of a member to the request, from the cache when useCache
+// is set and a recent response of the member is available. It returns true when the response comes from the cache.
+func (clusterProxy *ClusterProxy) retrieveNodeResponse(request *http.Request, body []byte, member *agent.ClusterMember, useCache bool) ([]byte, bool, error) {
+	cacheable := request.Method == http.MethodGet
+	cacheKey := member.NodeName + " " + request.URL.RequestURI()
+
+	// The other requests may modify the resources of the node, its responses in progress must not be cached
+	// and its cached responses are removed once the request is done
+	if !cacheable {
+		clusterProxy.cache.invalidateNode(member.NodeName)
+		defer clusterProxy.cache.invalidateNode(member.NodeName)
+	}
+
+	if cacheable && useCache {
+		if responseBody, ok := clusterProxy.cache.get(cacheKey); ok {
+			return responseBody, true, nil
+		}
+	}
+
+	generation := clusterProxy.cache.generation(member.NodeName)
+
+	ctx := request.Context()
+	if clusterProxy.config.NodeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, clusterProxy.config.NodeTimeout)
+		defer cancel()
+	}
+
+	response, err := clusterProxy.doNodeRequest(ctx, request, body, member)
 	if err != nil {
-		ch <- agentRequestResult{err: err, nodeName: member.NodeName}
-		return
+		return nil, false, err
 	}
 	defer response.Body.Close()
 
-	data, err := responseToJSONArray(response, request.URL.Path)
+	responseBody, err := io.ReadAll(response.Body)
 	if err != nil {
-		ch <- agentRequestResult{err: err, nodeName: member.NodeName}
-		return
+		return nil, false, err
+	}
+
+	if cacheable && response.StatusCode == http.StatusOK {
+		clusterProxy.cache.set(member.NodeName, request.URL.Path, cacheKey, responseBody, generation)
 	}
 
-	ch <- agentRequestResult{err: nil, responseContent: data, nodeName: member.NodeName}
+	return responseBody, false, nil
 }
 
-func copyRequest(request *http.Request, member *agent.ClusterMember, useTLS bool) (*http.Request, error) {
-	body, err := io.ReadAll(request.Body)
+// doNodeRequest sends a copy of the request to a member, the requests of the local member are sent to the local
+// Docker API without going through the agent API again
+func (clusterProxy *ClusterProxy) doNodeRequest(ctx context.Context, request *http.Request, body []byte, member *agent.ClusterMember) (*http.Response, error) {
+	if clusterProxy.config.LocalNodeName != "" && member.NodeName == clusterProxy.config.LocalNodeName {
+		localRequest, err := http.NewRequestWithContext(ctx, request.Method, "http://unixsocket"+request.URL.RequestURI(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		localRequest.Header = cloneHeader(request.Header)
+
+		return clusterProxy.localTransport.RoundTrip(localRequest)
+	}
+
+	err := clusterProxy.pingAgent(ctx, request, member)
 	if err != nil {
 		return nil, err
 	}
 
-	url := request.URL
+	requestCopy, err := copyRequest(ctx, request, body, member, clusterProxy.useTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	return clusterProxy.client.Do(requestCopy)
+}
+
+func copyRequest(ctx context.Context, request *http.Request, body []byte, member *agent.ClusterMember, useTLS bool) (*http.Request, error) {
+	// The request is copied for every node concurrently, its URL must not be modified
+	url := *request.URL
 	url.Host = member.IPAddress + ":" + member.Port
 
 	url.Scheme = "http"
@@ -176,7 +454,7 @@ func copyRequest(request *http.Request, member *agent.ClusterMember, useTLS bool
 		url.Scheme = "https"
 	}
 
-	requestCopy, err := http.NewRequest(request.Method, url.String(), bytes.NewReader(body))
+	requestCopy, err := http.NewRequestWithContext(ctx, request.Method, url.String(), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -196,12 +474,22 @@ func cloneHeader(h http.Header) http.Header {
 	return h2
 }
 
-func decorateObject(object any, nodeName string) any {
-	metadata := agent.Metadata{}
-	metadata.Agent.NodeName = nodeName
+// streamWriter writes the aggregated response, the writes are ignored once a write failed
+type streamWriter struct {
+	writer http.ResponseWriter
+	err    error
+}
 
-	JSONObject := object.(map[string]any)
-	JSONObject[agent.ResponseMetadataKey] = metadata
+func (writer *streamWriter) write(data []byte) {
+	if writer.err != nil || len(data) == 0 {
+		return
+	}
 
-	return JSONObject
+	_, writer.err = writer.writer.Write(data)
+}
+
+func (writer *streamWriter) flush() {
+	if flusher, ok := writer.writer.(http.Flusher); ok && writer.err == nil {
+		flusher.Flush()
+	}
 }
@@ -0,0 +1,348 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/http/security"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAgent starts an agent answering the pings and handling the requests sent to the node with handler
+func newTestAgent(t *testing.T, nodeName string, handler http.HandlerFunc) agent.ClusterMember {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		require.Equal(t, nodeName, r.Header.Get(agent.HTTPTargetHeaderName))
+
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	return agent.ClusterMember{IPAddress: host, Port: port, NodeName: nodeName}
+}
+
+// listContainers responds with a container named after the node after the delay,
+// the requests are counted when requests is not nil
+func listContainers(nodeName string, delay time.Duration, requests *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if requests != nil {
+			requests.Add(1)
+		}
+
+		time.Sleep(delay)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"Id":"` + nodeName + `"}]`))
+	}
+}
+
+func TestClusterOperationReportsFailedNodes(t *testing.T) {
+	members := []agent.ClusterMember{
+		newTestAgent(t, "node1", listContainers("node1", 0, nil)),
+		newTestAgent(t, "node2", listContainers("node2", 0, nil)),
+		newTestAgent(t, "slow", listContainers("slow", time.Second, nil)),
+		{IPAddress: "127.0.0.1", Port: "1", NodeName: "down"},
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{NodeTimeout: 200 * time.Millisecond})
+
+	request := httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+
+	data, report, err := clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Len(t, data, 2)
+	require.Equal(t, []string{"node1", "node2"}, report.Responded)
+	require.Len(t, report.Failed, 2)
+	require.Equal(t, "down", report.Failed[0].NodeName)
+	require.Equal(t, "slow", report.Failed[1].NodeName)
+	require.NotEmpty(t, report.Failed[1].Error)
+
+	// The URL of the original request must not be modified by the copies
+	require.Empty(t, request.URL.Host)
+
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+
+	_, report, err = clusterProxy.ClusterOperation(request, members, QuorumMajority)
+	require.True(t, errors.Is(err, ErrQuorumNotMet))
+	require.Len(t, report.Responded, 2)
+
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+
+	_, _, err = clusterProxy.ClusterOperation(request, members, "2")
+	require.NoError(t, err)
+}
+
+func TestValidateQuorum(t *testing.T) {
+	for _, quorum := range []string{"", QuorumAll, QuorumMajority, "1", "5"} {
+		require.NoError(t, ValidateQuorum(quorum), quorum)
+	}
+
+	for _, quorum := range []string{"0", "-1", "half", "1.5"} {
+		require.Error(t, ValidateQuorum(quorum), quorum)
+	}
+
+	required, err := requiredNodes(QuorumMajority, 4)
+	require.NoError(t, err)
+	require.Equal(t, 3, required)
+
+	required, err = requiredNodes(QuorumAll, 4)
+	require.NoError(t, err)
+	require.Equal(t, 4, required)
+}
+
+func TestStreamClusterOperation(t *testing.T) {
+	members := []agent.ClusterMember{
+		newTestAgent(t, "node1", listContainers("node1", 0, nil)),
+		{IPAddress: "127.0.0.1", Port: "1", NodeName: "down"},
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{NodeTimeout: time.Second})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+
+	report, err := clusterProxy.StreamClusterOperation(recorder, request, members)
+	require.NoError(t, err)
+	require.Equal(t, []string{"node1"}, report.Responded)
+	require.Len(t, report.Failed, 1)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, agent.HTTPResponseClusterNodesHeaderName, recorder.Header().Get("Trailer"))
+	require.JSONEq(t, `[{"Portainer":{"Agent":{"NodeName":"node1"}},"Id":"node1"}]`, recorder.Body.String())
+}
+
+func TestClusterOperationCache(t *testing.T) {
+	requests := &atomic.Int32{}
+	member := newTestAgent(t, "node1", listContainers("node1", 0, requests))
+	members := []agent.ClusterMember{member}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{CacheTTL: time.Minute})
+
+	request := httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	data, report, err := clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+	require.Equal(t, []string{"node1"}, report.Responded)
+
+	// The node served from the cache was not contacted
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	data, report, err = clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Len(t, data, 1)
+	require.Empty(t, report.Responded)
+	require.Equal(t, []string{"node1"}, report.Cached)
+
+	require.Equal(t, int32(1), requests.Load())
+
+	// The nodes must be reached when a quorum is required
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	_, report, err = clusterProxy.ClusterOperation(request, members, QuorumAll)
+	require.NoError(t, err)
+	require.Equal(t, []string{"node1"}, report.Responded)
+	require.Equal(t, int32(2), requests.Load())
+
+	// Other resources and other nodes do not invalidate the containers of the node
+	clusterProxy.HandleResourcesChangedEvent([]byte(`{"NodeName":"node1","Resources":["image"]}`))
+	clusterProxy.InvalidateCache("node2", []string{"container"})
+
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	_, _, err = clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), requests.Load())
+
+	clusterProxy.HandleResourcesChangedEvent([]byte(`{"NodeName":"node1","Resources":["container"]}`))
+
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	_, _, err = clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), requests.Load())
+
+	// The requests that may modify the resources of a node remove its cached responses
+	request = httptest.NewRequest(http.MethodPost, "/containers/prune", nil)
+	_, _, err = clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(4), requests.Load())
+
+	request = httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	_, _, err = clusterProxy.ClusterOperation(request, members, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(5), requests.Load())
+}
+
+func TestResponseCacheGenerations(t *testing.T) {
+	cache := newResponseCache(time.Minute)
+
+	// A response retrieved before an invalidation of its node is not cached
+	generation := cache.generation("node1")
+	cache.invalidateNode("node1")
+	cache.set("node1", "/containers/json", "node1 /containers/json", []byte("[]"), generation)
+
+	_, ok := cache.get("node1 /containers/json")
+	require.False(t, ok)
+
+	generation = cache.generation("node1")
+	cache.set("node1", "/containers/json", "node1 /containers/json", []byte("[]"), generation)
+
+	_, ok = cache.get("node1 /containers/json")
+	require.True(t, ok)
+
+	// The invalidations of every node also apply to the responses in progress
+	generation = cache.generation("node1")
+	cache.invalidate("", []string{"image"})
+	cache.set("node1", "/images/json", "node1 /images/json", []byte("[]"), generation)
+
+	_, ok = cache.get("node1 /images/json")
+	require.False(t, ok)
+
+	cache.invalidateNode("node1")
+
+	_, ok = cache.get("node1 /containers/json")
+	require.False(t, ok)
+}
+
+func TestDecorateItems(t *testing.T) {
+	items, err := responseItems([]byte(`[{"Id":"a"}, {} ,{ }]`), "/containers/json")
+	require.NoError(t, err)
+
+	items, err = decorateItems(items, "node1")
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+
+	for _, item := range items {
+		var object map[string]any
+		require.NoError(t, json.Unmarshal(item, &object))
+		require.Equal(t, map[string]any{"Agent": map[string]any{"NodeName": "node1"}}, object[agent.ResponseMetadataKey])
+	}
+
+	items, err = responseItems([]byte(`{"Volumes":null,"Warnings":null}`), "/volumes")
+	require.NoError(t, err)
+	require.Empty(t, items)
+
+	_, err = responseItems([]byte(`{"message":"page not found"}`), "/containers/json")
+	require.EqualError(t, err, "page not found")
+
+	_, err = decorateItems([]json.RawMessage{json.RawMessage(`"a"`)}, "node1")
+	require.Error(t, err)
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func signTestRequest(t *testing.T, r *http.Request, privateKey *ecdsa.PrivateKey, publicKey string) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := "fan-out-nonce"
+
+	digest := strings.Join([]string{timestamp, nonce, r.Method, r.URL.Path, ""}, "|")
+	hash := sha256.Sum256([]byte(agent.PortainerAgentSignatureMessage + "|" + digest))
+
+	sigR, sigS, err := ecdsa.Sign(rand.Reader, privateKey, hash[:])
+	require.NoError(t, err)
+
+	signature := make([]byte, 64)
+	sigR.FillBytes(signature[:32])
+	sigS.FillBytes(signature[32:])
+
+	r.Header.Set(agent.HTTPPublicKeyHeaderName, publicKey)
+	r.Header.Set(agent.HTTPSignatureHeaderName, base64.RawStdEncoding.EncodeToString(signature))
+	r.Header.Set(agent.HTTPSignatureTimestampHeaderName, timestamp)
+	r.Header.Set(agent.HTTPSignatureNonceHeaderName, nonce)
+}
+
+func TestClusterOperationWithReplayProtectedSignature(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	publicKey := hex.EncodeToString(der)
+
+	newSignedTestAgent := func(nodeName string, notaryService *security.NotaryService) agent.ClusterMember {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/ping" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			notaryService.DigitalSignatureVerification(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`[{"Id":"` + nodeName + `"}]`))
+			})).ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+
+		host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+		require.NoError(t, err)
+
+		return agent.ClusterMember{IPAddress: host, Port: port, NodeName: nodeName}
+	}
+
+	newNotaryService := func() *security.NotaryService {
+		signatureService, err := crypto.NewECDSAService("", t.TempDir())
+		require.NoError(t, err)
+
+		return security.NewNotaryService(signatureService, true, security.NotaryServiceOptions{MaxSkew: time.Minute, Strict: true})
+	}
+
+	// The local agent verifies the signature of the request before executing it on the cluster
+	localNotaryService := newNotaryService()
+
+	members := []agent.ClusterMember{
+		newSignedTestAgent("local", localNotaryService),
+		newSignedTestAgent("remote", newNotaryService()),
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{NodeTimeout: time.Second, LocalNodeName: "local"})
+	clusterProxy.localTransport = roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		recorder := httptest.NewRecorder()
+		recorder.Write([]byte(`[{"Id":"local"}]`))
+
+		return recorder.Result(), nil
+	})
+
+	var report ClusterOperationReport
+
+	handler := localNotaryService.DigitalSignatureVerification(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+
+		_, report, err = clusterProxy.ClusterOperation(r, members, QuorumAll)
+		require.NoError(t, err)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	signTestRequest(t, request, privateKey, publicKey)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, []string{"local", "remote"}, report.Responded)
+	require.Empty(t, report.Failed)
+}
@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+// eventsMembersRefreshInterval is the interval used to look for the members that joined or left the cluster
+// during a cluster events stream
+const eventsMembersRefreshInterval = 5 * time.Second
+
+// nodeEventsStreamEnd is sent when the events stream of a node ends
+type nodeEventsStreamEnd struct {
+	nodeName string
+	err      error
+	// rejected is set when the node refused the request, the stream is not reopened in that case
+	rejected bool
+	// lastEventTime is the time of the last event received from the node, in nanoseconds
+	lastEventTime int64
+}
+
+// StreamClusterEvents multiplexes the events streams of the members of the cluster into the response,
+// each event is decorated with the name of the node it comes from. The query parameters of the request
+// (since, until and filters) are forwarded to every member.
+// The members are retrieved every few seconds: a stream is opened on the members that joined the cluster and the
+// stream of the members that left the cluster is closed. The stream of a member that is interrupted is reopened
+// from its last event.
+// It returns when the client disconnects, or when the streams of all the members ended if until is specified.
+// An error is only returned when nothing was written to the response.
+func (clusterProxy *ClusterProxy) StreamClusterEvents(rw http.ResponseWriter, request *http.Request, members func() []agent.ClusterMember) error {
+	if request.Method != http.MethodGet {
+		return errors.New("the events can only be retrieved with a GET request")
+	}
+
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	writer := &streamWriter{writer: rw}
+	writer.flush()
+
+	until := request.URL.Query().Get("until")
+
+	events := make(chan json.RawMessage)
+	ends := make(chan nodeEventsStreamEnd)
+
+	streams := map[string]context.CancelFunc{}
+	// completed contains the members whose stream ended because the until time was reached or the request was rejected
+	completed := map[string]bool{}
+	// interrupted contains the time of the last event of the members whose stream was interrupted
+	interrupted := map[string]int64{}
+
+	refresh := func() {
+		clusterMembers := members()
+
+		current := make(map[string]bool, len(clusterMembers))
+
+		for i := range clusterMembers {
+			member := clusterMembers[i]
+			current[member.NodeName] = true
+
+			if streams[member.NodeName] != nil || completed[member.NodeName] {
+				continue
+			}
+
+			lastEventTime, resumed := interrupted[member.NodeName]
+			delete(interrupted, member.NodeName)
+
+			if !resumed {
+				log.Debug().Str("node", member.NodeName).Msg("opening the events stream of the cluster member")
+			}
+
+			streamCtx, streamCancel := context.WithCancel(ctx)
+			streams[member.NodeName] = streamCancel
+
+			go clusterProxy.streamNodeEvents(streamCtx, request, &member, lastEventTime, events, ends)
+		}
+
+		for nodeName, streamCancel := range streams {
+			if !current[nodeName] {
+				log.Debug().Str("node", nodeName).Msg("closing the events stream of the member that left the cluster")
+
+				streamCancel()
+				delete(streams, nodeName)
+			}
+		}
+
+		for nodeName := range interrupted {
+			if !current[nodeName] {
+				delete(interrupted, nodeName)
+			}
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(eventsMembersRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if until != "" && len(streams) == 0 && len(interrupted) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			refresh()
+		case event := <-events:
+			writer.write(event)
+			writer.write([]byte("\n"))
+			writer.flush()
+
+			if writer.err != nil {
+				log.Debug().Err(writer.err).Msg("unable to write the cluster events stream")
+
+				return nil
+			}
+		case end := <-ends:
+			streamCancel, ok := streams[end.nodeName]
+			if !ok {
+				// The member left the cluster
+				continue
+			}
+
+			streamCancel()
+			delete(streams, end.nodeName)
+
+			if end.rejected {
+				log.Warn().Str("node", end.nodeName).Err(end.err).Msg("the cluster member rejected the events request")
+
+				completed[end.nodeName] = true
+
+				continue
+			}
+
+			if end.err == nil && until != "" {
+				completed[end.nodeName] = true
+
+				continue
+			}
+
+			log.Warn().
+				Str("node", end.nodeName).
+				AnErr("error", end.err).
+				Msg("the events stream of the cluster member was interrupted, it will be reopened")
+
+			interrupted[end.nodeName] = end.lastEventTime
+		}
+	}
+}
+
+// streamNodeEvents reads the events stream of a member and sends each event to the events channel until the stream
+// ends or the context is done. The stream starts after lastEventTime when specified.
+func (clusterProxy *ClusterProxy) streamNodeEvents(ctx context.Context, request *http.Request, member *agent.ClusterMember, lastEventTime int64, events chan<- json.RawMessage, ends chan<- nodeEventsStreamEnd) {
+	end := nodeEventsStreamEnd{nodeName: member.NodeName, lastEventTime: lastEventTime}
+
+	end.err = clusterProxy.readNodeEvents(ctx, request, member, &end.lastEventTime, events)
+
+	var rejectedErr *eventsRequestRejectedError
+	end.rejected = errors.As(end.err, &rejectedErr)
+
+	select {
+	case ends <- end:
+	case <-ctx.Done():
+	}
+}
+
+func (clusterProxy *ClusterProxy) readNodeEvents(ctx context.Context, request *http.Request, member *agent.ClusterMember, lastEventTime *int64, events chan<- json.RawMessage) error {
+	nodeRequest := request
+
+	// Resume the stream right after the last event received
+	if *lastEventTime > 0 {
+		since := *lastEventTime + 1
+
+		nodeRequest = request.Clone(ctx)
+
+		query := nodeRequest.URL.Query()
+		query.Set("since", formatEventTime(since))
+		nodeRequest.URL.RawQuery = query.Encode()
+	}
+
+	response, err := clusterProxy.doNodeRequest(ctx, nodeRequest, nil, member)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+
+		var dockerError struct {
+			Message string `json:"message"`
+		}
+
+		err := fmt.Errorf("unexpected status code %d", response.StatusCode)
+		if json.Unmarshal(body, &dockerError) == nil && dockerError.Message != "" {
+			err = errors.New(dockerError.Message)
+		}
+
+		// The request is invalid, reopening the stream would fail the same way
+		if response.StatusCode >= 400 && response.StatusCode < 500 {
+			return &eventsRequestRejectedError{err: err}
+		}
+
+		return err
+	}
+
+	decoder := json.NewDecoder(response.Body)
+
+	for {
+		var event json.RawMessage
+
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		decoratedEvents, err := decorateItems([]json.RawMessage{event}, member.NodeName)
+		if err != nil {
+			return err
+		}
+
+		var eventTime struct {
+			TimeNano int64 `json:"timeNano"`
+		}
+
+		if err := json.Unmarshal(event, &eventTime); err == nil && eventTime.TimeNano > *lastEventTime {
+			*lastEventTime = eventTime.TimeNano
+		}
+
+		select {
+		case events <- decoratedEvents[0]:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// formatEventTime formats a time in nanoseconds as expected by the since and until parameters of the Docker API
+func formatEventTime(timeNano int64) string {
+	return fmt.Sprintf("%d.%09d", timeNano/int64(time.Second), timeNano%int64(time.Second))
+}
+
+// eventsRequestRejectedError is returned when a node responds to the events request with a client error
+type eventsRequestRejectedError struct {
+	err error
+}
+
+func (e *eventsRequestRejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *eventsRequestRejectedError) Unwrap() error {
+	return e.err
+}
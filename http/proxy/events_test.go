@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamClusterEvents(t *testing.T) {
+	streamEvents := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/events", r.URL.Path)
+		require.Equal(t, "100", r.URL.Query().Get("until"))
+		require.Equal(t, `{"type":{"container":true}}`, r.URL.Query().Get("filters"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Type":"container","Action":"start","timeNano":1}` + "\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`{"Type":"container","Action":"die","timeNano":2}` + "\n"))
+	}
+
+	members := []agent.ClusterMember{
+		newTestAgent(t, "node1", streamEvents),
+		newTestAgent(t, "node2", streamEvents),
+		newTestAgent(t, "rejecting", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"invalid filter"}`))
+		}),
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{})
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, `/events?until=100&filters={"type":{"container":true}}`, nil)
+
+	done := make(chan error)
+	go func() {
+		done <- clusterProxy.StreamClusterEvents(recorder, request, func() []agent.ClusterMember { return members })
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the events stream did not end once the until time was reached")
+	}
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	actionsByNode := map[string][]string{}
+
+	scanner := bufio.NewScanner(strings.NewReader(recorder.Body.String()))
+	for scanner.Scan() {
+		var event struct {
+			Portainer agent.Metadata
+			Action    string
+		}
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+
+		nodeName := event.Portainer.Agent.NodeName
+		actionsByNode[nodeName] = append(actionsByNode[nodeName], event.Action)
+	}
+
+	require.Equal(t, map[string][]string{
+		"node1": {"start", "die"},
+		"node2": {"start", "die"},
+	}, actionsByNode)
+}
+
+func TestFormatEventTime(t *testing.T) {
+	require.Equal(t, "1700000000.000000042", formatEventTime(1700000000000000042))
+	require.Equal(t, "0.000000001", formatEventTime(1))
+}
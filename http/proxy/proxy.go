@@ -12,8 +12,9 @@ import (
 	"github.com/koding/websocketproxy"
 )
 
-// AgentHTTPRequest redirects a HTTP request to another agent.
-func AgentHTTPRequest(rw http.ResponseWriter, request *http.Request, target *agent.ClusterMember, useTLS bool) {
+// AgentHTTPRequest redirects a HTTP request to another agent, the certificate of certificateManager is presented
+// to the agent when it requires a client certificate.
+func AgentHTTPRequest(rw http.ResponseWriter, request *http.Request, target *agent.ClusterMember, useTLS bool, certificateManager *crypto.CertificateManager) {
 	urlCopy := request.URL
 	urlCopy.Host = target.IPAddress + ":" + target.Port
 
@@ -22,11 +23,12 @@ func AgentHTTPRequest(rw http.ResponseWriter, request *http.Request, target *age
 		urlCopy.Scheme = "https"
 	}
 
-	proxyHTTPRequest(rw, request, urlCopy, target.NodeName)
+	proxyHTTPRequest(rw, request, urlCopy, target.NodeName, certificateManager)
 }
 
-// WebsocketRequest redirects a websocket request to another agent.
-func WebsocketRequest(rw http.ResponseWriter, request *http.Request, target *agent.ClusterMember) {
+// WebsocketRequest redirects a websocket request to another agent, the certificate of certificateManager is
+// presented to the agent when it requires a client certificate.
+func WebsocketRequest(rw http.ResponseWriter, request *http.Request, target *agent.ClusterMember, certificateManager *crypto.CertificateManager) {
 	urlCopy := request.URL
 	urlCopy.Host = target.IPAddress + ":" + target.Port
 
@@ -35,24 +37,29 @@ func WebsocketRequest(rw http.ResponseWriter, request *http.Request, target *age
 		urlCopy.Scheme = "wss"
 	}
 
-	proxyWebsocketRequest(rw, request, urlCopy, target.NodeName)
+	proxyWebsocketRequest(rw, request, urlCopy, target.NodeName, certificateManager)
 }
 
-func proxyHTTPRequest(rw http.ResponseWriter, request *http.Request, target *url.URL, targetNode string) {
-	proxy := newAgentReverseProxy(target, targetNode)
+func proxyHTTPRequest(rw http.ResponseWriter, request *http.Request, target *url.URL, targetNode string, certificateManager *crypto.CertificateManager) {
+	proxy := newAgentReverseProxy(target, targetNode, certificateManager)
 	proxy.ServeHTTP(rw, request)
 }
 
-func proxyWebsocketRequest(rw http.ResponseWriter, request *http.Request, target *url.URL, targetNode string) {
+func proxyWebsocketRequest(rw http.ResponseWriter, request *http.Request, target *url.URL, targetNode string, certificateManager *crypto.CertificateManager) {
 	proxy := websocketproxy.NewProxy(target)
 	proxy.Director = func(incoming *http.Request, out http.Header) {
 		out.Set(agent.HTTPSignatureHeaderName, request.Header.Get(agent.HTTPSignatureHeaderName))
 		out.Set(agent.HTTPPublicKeyHeaderName, request.Header.Get(agent.HTTPPublicKeyHeaderName))
+
+		for _, header := range []string{agent.HTTPSignatureTimestampHeaderName, agent.HTTPSignatureNonceHeaderName, agent.HTTPSignatureBodyHashHeaderName} {
+			if value := request.Header.Get(header); value != "" {
+				out.Set(header, value)
+			}
+		}
 		out.Set(agent.HTTPTargetHeaderName, targetNode)
 	}
 
-	tlsConfig := crypto.CreateTLSConfiguration()
-	tlsConfig.InsecureSkipVerify = true
+	tlsConfig := crypto.CreateAgentClientTLSConfiguration(certificateManager)
 
 	proxy.Dialer = &websocket.Dialer{
 		TLSClientConfig: tlsConfig,
@@ -61,7 +68,7 @@ func proxyWebsocketRequest(rw http.ResponseWriter, request *http.Request, target
 	proxy.ServeHTTP(rw, request)
 }
 
-func newAgentReverseProxy(target *url.URL, targetNode string) *httputil.ReverseProxy {
+func newAgentReverseProxy(target *url.URL, targetNode string, certificateManager *crypto.CertificateManager) *httputil.ReverseProxy {
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
 		req.URL.Scheme = target.Scheme
@@ -76,8 +83,7 @@ func newAgentReverseProxy(target *url.URL, targetNode string) *httputil.ReverseP
 		req.Header.Set(agent.HTTPTargetHeaderName, targetNode)
 	}
 
-	tlsConfig := crypto.CreateTLSConfiguration()
-	tlsConfig.InsecureSkipVerify = true
+	tlsConfig := crypto.CreateAgentClientTLSConfiguration(certificateManager)
 
 	return &httputil.ReverseProxy{
 		Director: director,
@@ -1,16 +1,18 @@
 package proxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/portainer/agent"
+
 	"github.com/rs/zerolog/log"
 )
 
-func reproduceDockerAPIResponse(data []any, requestPath string) any {
+func reproduceDockerAPIResponse(data []json.RawMessage, requestPath string) any {
 	// VolumeList operation returns an object, not an array.
 	if strings.HasPrefix(requestPath, "/volumes") {
 		responseObject := make(map[string]any)
@@ -21,54 +23,99 @@ func reproduceDockerAPIResponse(data []any, requestPath string) any {
 	return data
 }
 
-func responseToJSONArray(response *http.Response, requestPath string) ([]any, error) {
-	responseObject, err := getResponseBodyAsGenericJSON(response)
-	if err != nil {
-		return nil, err
+// aggregatedResponseDelimiters returns what must be written before and after the objects of a streamed response
+func aggregatedResponseDelimiters(requestPath string) (string, string) {
+	// VolumeList operation returns an object, not an array.
+	if strings.HasPrefix(requestPath, "/volumes") {
+		return `{"Volumes":[`, "]}\n"
 	}
 
-	obj, ok := responseObject.(map[string]any)
-	if ok && obj["message"] != nil {
-		return nil, errors.New(obj["message"].(string))
+	return "[", "]\n"
+}
+
+// responseItems returns the objects listed in the body of a response of the Docker API, without decoding them
+func responseItems(body []byte, requestPath string) ([]json.RawMessage, error) {
+	var errorResponse struct {
+		Message string `json:"message"`
 	}
 
-	var responseData []any
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) && json.Unmarshal(body, &errorResponse) == nil && errorResponse.Message != "" {
+		return nil, errors.New(errorResponse.Message)
+	}
 
 	// VolumeList operation returns an object, not an array.
 	// We need to extract the volume list from the "Volumes" property.
 	// Note that the content of the "Volumes" property might be null if no volumes
 	// are found, we replace it with an empty array in that case.
 	if strings.HasPrefix(requestPath, "/volumes") {
-		obj := responseObject.(map[string]any)
-		volumeObj := obj["Volumes"]
-		if volumeObj != nil {
-			responseData = volumeObj.([]any)
-		} else {
-			responseData = make([]any, 0)
+		var volumeList struct {
+			Volumes []json.RawMessage `json:"Volumes"`
 		}
-	} else {
-		responseData, ok = responseObject.([]any)
-		if !ok {
-			log.Error().
-				Str("response", fmt.Sprintf("%+v", responseData)).
-				Msg("unexpected response from Docker daemon")
 
-			return nil, errors.New("invalid response from Docker daemon")
+		if err := json.Unmarshal(body, &volumeList); err != nil {
+			return nil, err
+		}
+
+		if volumeList.Volumes == nil {
+			return make([]json.RawMessage, 0), nil
 		}
+
+		return volumeList.Volumes, nil
 	}
 
-	return responseData, nil
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		log.Error().
+			Err(err).
+			Int("response_size", len(body)).
+			Msg("unexpected response from Docker daemon")
+
+		return nil, errors.New("invalid response from Docker daemon")
+	}
+
+	return items, nil
 }
 
-func getResponseBodyAsGenericJSON(response *http.Response) (any, error) {
-	var data any
+// nodeListItems returns the objects listed in the response of a node, decorated with the name of the node
+func nodeListItems(body []byte, request *http.Request, nodeName string) ([]json.RawMessage, error) {
+	items, err := responseItems(body, request.URL.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return decorateItems(items, nodeName)
+}
 
-	// TODO: resource duplication error: it seems that the body size is different here
-	// from the size returned in socket.go
-	err := json.NewDecoder(response.Body).Decode(&data)
+// decorateItems adds the agent metadata to each object, the objects are not decoded
+func decorateItems(items []json.RawMessage, nodeName string) ([]json.RawMessage, error) {
+	metadata := agent.Metadata{}
+	metadata.Agent.NodeName = nodeName
+
+	encodedMetadata, err := json.Marshal(metadata)
 	if err != nil {
 		return nil, err
 	}
 
-	return data, nil
+	prefix := `{"` + agent.ResponseMetadataKey + `":` + string(encodedMetadata)
+
+	decoratedItems := make([]json.RawMessage, 0, len(items))
+
+	for _, item := range items {
+		if len(item) < 2 || item[0] != '{' {
+			return nil, errors.New("invalid response from Docker daemon")
+		}
+
+		decoratedItem := make([]byte, 0, len(prefix)+len(item)+1)
+		decoratedItem = append(decoratedItem, prefix...)
+
+		// An empty object only needs the metadata
+		if !bytes.HasPrefix(bytes.TrimSpace(item[1:]), []byte("}")) {
+			decoratedItem = append(decoratedItem, ',')
+		}
+
+		decoratedItem = append(decoratedItem, item[1:]...)
+		decoratedItems = append(decoratedItems, decoratedItem)
+	}
+
+	return decoratedItems, nil
 }
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/portainer/agent"
+)
+
+// pruneResources associates the prune operations to the resources they remove
+var pruneResources = map[string]string{
+	"/containers/prune": "container",
+	"/images/prune":     "image",
+	"/volumes/prune":    "volume",
+	"/build/prune":      "builder",
+}
+
+// summaryMetadata is added to the aggregated response of a summary operation
+type summaryMetadata struct {
+	// Nodes contains the response of each node, without the lists of objects that are part of the aggregated lists
+	Nodes map[string]map[string]json.RawMessage `json:"Nodes"`
+}
+
+// IsSummaryOperation returns true when the request retrieves the disk usage or prunes the resources of a node,
+// the responses of such requests can be aggregated by ClusterSummaryOperation
+func IsSummaryOperation(request *http.Request) bool {
+	if request.URL.Path == "/system/df" {
+		return request.Method == http.MethodGet
+	}
+
+	_, prune := pruneResources[request.URL.Path]
+
+	return prune && request.Method == http.MethodPost
+}
+
+// ClusterSummaryOperation will copy and execute a disk usage or prune request on a set of agents.
+// The objects returned by the agents are merged in a single object: the numbers are summed
+// (LayersSize, SpaceReclaimed) and the lists are concatenated, each object of the lists being decorated
+// with the name of its node. The response of each node is available under the Portainer.Nodes property.
+// The nodes that responded and the nodes that failed are reported like ClusterOperation does, the cache is not used
+// when a quorum is required.
+func (clusterProxy *ClusterProxy) ClusterSummaryOperation(request *http.Request, clusterMembers []agent.ClusterMember, quorum string) (any, ClusterOperationReport, error) {
+	report := newClusterOperationReport()
+
+	if quorum == "" {
+		quorum = clusterProxy.config.Quorum
+	}
+
+	required, err := requiredNodes(quorum, len(clusterMembers))
+	if err != nil {
+		return nil, report, err
+	}
+
+	results, err := clusterProxy.executeRequestOnCluster(request, clusterMembers, nodeSummary, required == 0)
+	if err != nil {
+		return nil, report, err
+	}
+
+	summary := newSummaryAggregator()
+
+	for result := range results {
+		if result.err == nil {
+			result.err = summary.add(result.nodeName, result.items[0])
+		}
+
+		report.add(result)
+
+		// The resources were removed even if the response of the node could not be aggregated
+		if resource, ok := pruneResources[request.URL.Path]; ok && len(result.items) > 0 {
+			clusterProxy.InvalidateCache(result.nodeName, []string{resource})
+		}
+	}
+
+	report.sort()
+
+	if len(report.Responded) < required {
+		return nil, report, fmt.Errorf("%w: %d of %d nodes responded, %d required", ErrQuorumNotMet, len(report.Responded), len(clusterMembers), required)
+	}
+
+	return summary.response(), report, nil
+}
+
+// nodeSummary returns the object returned by a node to a summary operation
+func nodeSummary(body []byte, _ *http.Request, _ string) ([]json.RawMessage, error) {
+	var errorResponse struct {
+		Message string `json:"message"`
+	}
+
+	if json.Unmarshal(body, &errorResponse) == nil && errorResponse.Message != "" {
+		return nil, errors.New(errorResponse.Message)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil, errors.New("invalid response from Docker daemon")
+	}
+
+	return []json.RawMessage{body}, nil
+}
+
+// summaryAggregator merges the objects returned by the nodes to a summary operation
+type summaryAggregator struct {
+	totals   map[string]int64
+	lists    map[string][]json.RawMessage
+	values   map[string]json.RawMessage
+	metadata summaryMetadata
+}
+
+func newSummaryAggregator() *summaryAggregator {
+	return &summaryAggregator{
+		totals:   map[string]int64{},
+		lists:    map[string][]json.RawMessage{},
+		values:   map[string]json.RawMessage{},
+		metadata: summaryMetadata{Nodes: map[string]map[string]json.RawMessage{}},
+	}
+}
+
+func (aggregator *summaryAggregator) add(nodeName string, object json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(object, &fields); err != nil {
+		return err
+	}
+
+	nodeFields := make(map[string]json.RawMessage, len(fields))
+
+	for key, value := range fields {
+		value = bytes.TrimSpace(value)
+
+		switch {
+		case len(value) > 0 && value[0] == '[':
+			var items []json.RawMessage
+			if err := json.Unmarshal(value, &items); err != nil {
+				return err
+			}
+
+			objects, err := decorateItems(items, nodeName)
+			if err != nil {
+				// The lists of identifiers cannot be decorated, they are also kept in the response of the node
+				// so that the node of each identifier is known
+				aggregator.lists[key] = append(aggregator.lists[key], items...)
+				nodeFields[key] = value
+
+				continue
+			}
+
+			aggregator.lists[key] = append(aggregator.lists[key], objects...)
+		case bytes.Equal(value, []byte("null")):
+			if _, ok := aggregator.lists[key]; !ok {
+				aggregator.values[key] = value
+			}
+
+			nodeFields[key] = value
+		default:
+			number, err := strconv.ParseInt(string(value), 10, 64)
+			if err == nil {
+				aggregator.totals[key] += number
+			} else if _, exists := aggregator.values[key]; !exists {
+				aggregator.values[key] = value
+			}
+
+			nodeFields[key] = value
+		}
+	}
+
+	aggregator.metadata.Nodes[nodeName] = nodeFields
+
+	return nil
+}
+
+func (aggregator *summaryAggregator) response() map[string]any {
+	response := make(map[string]any, len(aggregator.values)+len(aggregator.totals)+len(aggregator.lists)+1)
+
+	for key, value := range aggregator.values {
+		response[key] = value
+	}
+
+	for key, total := range aggregator.totals {
+		response[key] = total
+	}
+
+	for key, list := range aggregator.lists {
+		response[key] = list
+	}
+
+	response[agent.ResponseMetadataKey] = aggregator.metadata
+
+	return response
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+// respondJSON responds with the JSON body
+func respondJSON(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+}
+
+func TestClusterSummaryOperationPrune(t *testing.T) {
+	members := []agent.ClusterMember{
+		newTestAgent(t, "node1", respondJSON(`{"ContainersDeleted":["a","b"],"SpaceReclaimed":100}`)),
+		newTestAgent(t, "node2", respondJSON(`{"ContainersDeleted":null,"SpaceReclaimed":0}`)),
+		newTestAgent(t, "node3", respondJSON(`{"ContainersDeleted":["c"],"SpaceReclaimed":20}`)),
+		newTestAgent(t, "failing", respondJSON(`{"message":"a prune operation is already running"}`)),
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{})
+
+	request := httptest.NewRequest(http.MethodPost, "/containers/prune", nil)
+	require.True(t, IsSummaryOperation(request))
+
+	data, report, err := clusterProxy.ClusterSummaryOperation(request, members, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"node1", "node2", "node3"}, report.Responded)
+	require.Equal(t, []NodeFailure{{NodeName: "failing", Error: "a prune operation is already running"}}, report.Failed)
+
+	var response struct {
+		ContainersDeleted []string
+		SpaceReclaimed    int64
+		Portainer         struct {
+			Nodes map[string]map[string]json.RawMessage
+		}
+	}
+
+	encodedData, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(encodedData, &response))
+
+	require.ElementsMatch(t, []string{"a", "b", "c"}, response.ContainersDeleted)
+	require.Equal(t, int64(120), response.SpaceReclaimed)
+	require.Len(t, response.Portainer.Nodes, 3)
+	require.JSONEq(t, `["a","b"]`, string(response.Portainer.Nodes["node1"]["ContainersDeleted"]))
+	require.JSONEq(t, `100`, string(response.Portainer.Nodes["node1"]["SpaceReclaimed"]))
+
+	_, _, err = clusterProxy.ClusterSummaryOperation(request, members, QuorumAll)
+	require.ErrorIs(t, err, ErrQuorumNotMet)
+}
+
+func TestClusterSummaryOperationDiskUsage(t *testing.T) {
+	members := []agent.ClusterMember{
+		newTestAgent(t, "node1", respondJSON(`{"LayersSize":10,"Images":[{"Id":"image1"}],"Containers":[],"Volumes":[{"Name":"volume1"}],"BuildCache":null}`)),
+		newTestAgent(t, "node2", respondJSON(`{"LayersSize":5,"Images":[{"Id":"image2"}],"Containers":[{"Id":"container2"}],"Volumes":[],"BuildCache":null}`)),
+	}
+
+	clusterProxy := NewClusterProxy(false, ClusterProxyConfig{NodeTimeout: time.Second})
+
+	request := httptest.NewRequest(http.MethodGet, "/system/df", nil)
+	require.True(t, IsSummaryOperation(request))
+
+	data, report, err := clusterProxy.ClusterSummaryOperation(request, members, "")
+	require.NoError(t, err)
+	require.Len(t, report.Responded, 2)
+
+	var response struct {
+		LayersSize int64
+		Images     []map[string]any
+		Containers []map[string]any
+		Volumes    []map[string]any
+		BuildCache []map[string]any
+		Portainer  struct {
+			Nodes map[string]map[string]json.RawMessage
+		}
+	}
+
+	encodedData, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(encodedData, &response))
+
+	require.Equal(t, int64(15), response.LayersSize)
+	require.Len(t, response.Images, 2)
+	require.Len(t, response.Volumes, 1)
+	require.Nil(t, response.BuildCache)
+	require.Equal(t, "container2", response.Containers[0]["Id"])
+	require.Equal(t, map[string]any{"Agent": map[string]any{"NodeName": "node2"}}, response.Containers[0][agent.ResponseMetadataKey])
+
+	// The objects are only part of the aggregated lists
+	require.Equal(t, map[string]json.RawMessage{
+		"LayersSize": json.RawMessage("5"),
+		"BuildCache": json.RawMessage("null"),
+	}, response.Portainer.Nodes["node2"])
+}
+
+func TestIsSummaryOperation(t *testing.T) {
+	require.False(t, IsSummaryOperation(httptest.NewRequest(http.MethodGet, "/containers/prune", nil)))
+	require.False(t, IsSummaryOperation(httptest.NewRequest(http.MethodPost, "/networks/prune", nil)))
+	require.True(t, IsSummaryOperation(httptest.NewRequest(http.MethodPost, "/build/prune", nil)))
+}
@@ -0,0 +1,52 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceCache keeps track of the nonces of the signed requests received by the agent
+// for as long as their signature timestamp is accepted.
+type nonceCache struct {
+	nonces    map[string]time.Time
+	retention time.Duration
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+func newNonceCache(retention time.Duration) *nonceCache {
+	return &nonceCache{
+		nonces:    make(map[string]time.Time),
+		retention: retention,
+		lastPrune: time.Now(),
+	}
+}
+
+// add registers a nonce and returns false if it was already registered
+func (cache *nonceCache) add(nonce string, timestamp time.Time) bool {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(cache.lastPrune) > cache.retention/2 {
+		cache.prune(now)
+	}
+
+	if _, ok := cache.nonces[nonce]; ok {
+		return false
+	}
+
+	cache.nonces[nonce] = timestamp.Add(cache.retention)
+
+	return true
+}
+
+func (cache *nonceCache) prune(now time.Time) {
+	for nonce, expiresAt := range cache.nonces {
+		if now.After(expiresAt) {
+			delete(cache.nonces, nonce)
+		}
+	}
+
+	cache.lastPrune = now
+}
@@ -1,22 +1,57 @@
 package security
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/portainer/agent"
 	httperror "github.com/portainer/portainer/pkg/libhttp/error"
 )
 
+// maxSignedBodySize is the maximum size of the request bodies verified against their signed hash, the body is
+// read before the signature of the request is verified
+const maxSignedBodySize = 64 << 20 // 64 MB
+
+var signedPathVersionRegexp = regexp.MustCompile(`^(/v[0-9]\.[0-9]*)?(/v[1-3](/|$))?`)
+
 type NotaryService struct {
 	signatureService      agent.DigitalSignatureService
 	signatureVerification bool
+	maxSkew               time.Duration
+	strict                bool
+	nonces                *nonceCache
 }
 
-func NewNotaryService(signatureService agent.DigitalSignatureService, signatureVerification bool) *NotaryService {
+// NotaryServiceOptions are the options used to configure the verification of replay protected signatures
+type NotaryServiceOptions struct {
+	// MaxSkew is the maximum difference between the timestamp of a signed request and the agent clock
+	MaxSkew time.Duration
+	// Strict rejects the requests that are signed with the legacy signature scheme
+	Strict bool
+}
+
+func NewNotaryService(signatureService agent.DigitalSignatureService, signatureVerification bool, options NotaryServiceOptions) *NotaryService {
+	maxSkew := options.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew, _ = time.ParseDuration(agent.DefaultSignatureMaxSkew)
+	}
+
 	return &NotaryService{
 		signatureVerification: signatureVerification,
 		signatureService:      signatureService,
+		maxSkew:               maxSkew,
+		strict:                options.Strict,
+		// A nonce must be remembered as long as its timestamp is accepted, in both directions
+		nonces: newNonceCache(2 * maxSkew),
 	}
 }
 
@@ -30,7 +65,17 @@ func (service *NotaryService) DigitalSignatureVerification(next http.Handler) ht
 				return httperror.Forbidden("Missing request signature headers", errors.New("Unauthorized"))
 			}
 
-			valid, err := service.signatureService.VerifySignature(signatureHeaderValue, publicKeyHeaderValue)
+			var valid bool
+			var err error
+
+			if r.Header.Get(agent.HTTPSignatureTimestampHeaderName) != "" {
+				valid, err = service.verifyRequestSignature(r, signatureHeaderValue, publicKeyHeaderValue)
+			} else if service.strict {
+				return httperror.Forbidden("Missing replay protected request signature headers", errors.New("Unauthorized"))
+			} else {
+				valid, err = service.signatureService.VerifySignature(signatureHeaderValue, publicKeyHeaderValue)
+			}
+
 			if err != nil {
 				return httperror.Forbidden("Invalid request signature", err)
 			} else if !valid {
@@ -42,3 +87,86 @@ func (service *NotaryService) DigitalSignatureVerification(next http.Handler) ht
 		return nil
 	})
 }
+
+// verifyRequestSignature verifies a request signed with the replay protected signature scheme.
+// The signed request digest has the following format: <timestamp>|<nonce>|<method>|<path>|<body_hash>
+// where the path does not include the query and the Docker and agent API version prefixes, and the body
+// hash is empty when the request does not include the body hash header.
+func (service *NotaryService) verifyRequestSignature(r *http.Request, signature, publicKey string) (bool, error) {
+	timestampHeaderValue := r.Header.Get(agent.HTTPSignatureTimestampHeaderName)
+	nonce := r.Header.Get(agent.HTTPSignatureNonceHeaderName)
+	bodyHash := strings.ToLower(r.Header.Get(agent.HTTPSignatureBodyHashHeaderName))
+
+	timestamp, err := strconv.ParseInt(timestampHeaderValue, 10, 64)
+	if err != nil {
+		return false, errors.New("invalid signature timestamp")
+	}
+
+	skew := time.Since(time.Unix(timestamp, 0))
+	if skew > service.maxSkew || skew < -service.maxSkew {
+		return false, fmt.Errorf("signature timestamp is outside of the accepted window of %s", service.maxSkew)
+	}
+
+	if nonce == "" {
+		return false, errors.New("missing signature nonce")
+	}
+
+	if bodyHash != "" {
+		err := verifyBodyHash(r, bodyHash)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	requestDigest := strings.Join([]string{timestampHeaderValue, nonce, r.Method, signedPath(r), bodyHash}, "|")
+
+	valid, err := service.signatureService.VerifyRequestSignature(signature, publicKey, requestDigest)
+	if err != nil || !valid {
+		return valid, err
+	}
+
+	// The nonce is only consumed once the signature is known to be valid, so that
+	// unauthenticated requests cannot be used to burn the nonces of legitimate ones
+	if !service.nonces.add(nonce, time.Unix(timestamp, 0)) {
+		return false, errors.New("signature nonce already used")
+	}
+
+	return true, nil
+}
+
+// signedPath returns the path of the request as it was sent by the client, without the Docker and agent
+// API version prefixes, so that the same signature can be verified when the request is forwarded to another agent.
+func signedPath(r *http.Request) string {
+	requestPath := r.URL.EscapedPath()
+	if r.RequestURI != "" {
+		requestPath, _, _ = strings.Cut(r.RequestURI, "?")
+	}
+
+	return "/" + strings.TrimPrefix(signedPathVersionRegexp.ReplaceAllString(requestPath, ""), "/")
+}
+
+func verifyBodyHash(r *http.Request, expectedHash string) error {
+	var body []byte
+
+	if r.Body != nil {
+		var err error
+		var maxBytesErr *http.MaxBytesError
+
+		body, err = io.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBodySize))
+		if errors.As(err, &maxBytesErr) {
+			return fmt.Errorf("request body exceeds the maximum size of %d bytes for a signed body hash", maxSignedBodySize)
+		} else if err != nil {
+			return err
+		}
+		r.Body.Close()
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.Sum256(body)
+	if hex.EncodeToString(hash[:]) != expectedHash {
+		return errors.New("request body does not match the signed body hash")
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+type testSigner struct {
+	privateKey *ecdsa.PrivateKey
+	publicKey  string
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+
+	return &testSigner{privateKey: privateKey, publicKey: hex.EncodeToString(der)}
+}
+
+func (signer *testSigner) signRequest(t *testing.T, r *http.Request, timestamp time.Time, nonce, signedPath, body string) {
+	timestampValue := strconv.FormatInt(timestamp.Unix(), 10)
+
+	bodyHash := ""
+	if body != "" {
+		hash := sha256.Sum256([]byte(body))
+		bodyHash = hex.EncodeToString(hash[:])
+		r.Header.Set(agent.HTTPSignatureBodyHashHeaderName, bodyHash)
+	}
+
+	digest := strings.Join([]string{timestampValue, nonce, r.Method, signedPath, bodyHash}, "|")
+	hash := sha256.Sum256([]byte(agent.PortainerAgentSignatureMessage + "|" + digest))
+
+	sigR, sigS, err := ecdsa.Sign(rand.Reader, signer.privateKey, hash[:])
+	require.NoError(t, err)
+
+	signature := make([]byte, 64)
+	sigR.FillBytes(signature[:32])
+	sigS.FillBytes(signature[32:])
+
+	r.Header.Set(agent.HTTPPublicKeyHeaderName, signer.publicKey)
+	r.Header.Set(agent.HTTPSignatureHeaderName, base64.RawStdEncoding.EncodeToString(signature))
+	r.Header.Set(agent.HTTPSignatureTimestampHeaderName, timestampValue)
+	r.Header.Set(agent.HTTPSignatureNonceHeaderName, nonce)
+}
+
+func newTestNotaryService(t *testing.T, strict bool) *NotaryService {
+	signatureService, err := crypto.NewECDSAService("", t.TempDir())
+	require.NoError(t, err)
+
+	return NewNotaryService(signatureService, true, NotaryServiceOptions{MaxSkew: time.Minute, Strict: strict})
+}
+
+func TestReplayProtectedSignature(t *testing.T) {
+	service := newTestNotaryService(t, false)
+	signer := newTestSigner(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v3/browse/ls?volumeID=data", nil)
+	signer.signRequest(t, r, time.Now(), "nonce-1", "/browse/ls", "")
+
+	valid, err := service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	// The same request cannot be replayed
+	_, err = service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.Error(t, err)
+}
+
+func TestReplayProtectedSignatureRejectsTampering(t *testing.T) {
+	service := newTestNotaryService(t, false)
+	signer := newTestSigner(t)
+
+	// Signed for another path
+	r := httptest.NewRequest(http.MethodDelete, "/browse/delete", nil)
+	signer.signRequest(t, r, time.Now(), "nonce-1", "/browse/ls", "")
+
+	valid, _ := service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.False(t, valid)
+
+	// Outside of the skew window
+	r = httptest.NewRequest(http.MethodGet, "/browse/ls", nil)
+	signer.signRequest(t, r, time.Now().Add(-time.Hour), "nonce-2", "/browse/ls", "")
+
+	_, err := service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.Error(t, err)
+
+	// Body does not match the signed hash
+	r = httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(`{"Image": "evil"}`))
+	signer.signRequest(t, r, time.Now(), "nonce-3", "/containers/create", `{"Image": "nginx"}`)
+
+	_, err = service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.Error(t, err)
+}
+
+func TestReplayProtectedSignatureRejectsOversizedBody(t *testing.T) {
+	service := newTestNotaryService(t, false)
+	signer := newTestSigner(t)
+
+	body := strings.Repeat("a", maxSignedBodySize+1)
+
+	r := httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(body))
+	signer.signRequest(t, r, time.Now(), "nonce-1", "/containers/create", body)
+
+	_, err := service.verifyRequestSignature(r, r.Header.Get(agent.HTTPSignatureHeaderName), signer.publicKey)
+	require.ErrorContains(t, err, "maximum size")
+}
+
+func TestStrictModeRejectsLegacySignature(t *testing.T) {
+	service := newTestNotaryService(t, true)
+
+	handlerCalled := false
+	handler := service.DigitalSignatureVerification(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		handlerCalled = true
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/containers/json", nil)
+	r.Header.Set(agent.HTTPPublicKeyHeaderName, "key")
+	r.Header.Set(agent.HTTPSignatureHeaderName, "signature")
+
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.False(t, handlerCalled)
+}
+
+func TestSignedPath(t *testing.T) {
+	tests := map[string]string{
+		"/v2/browse/ls?volumeID=1": "/browse/ls",
+		"/v1.41/containers/json":   "/containers/json",
+		"/containers/json":         "/containers/json",
+		"/v3/websocket/exec":       "/websocket/exec",
+		"/v2":                      "/",
+	}
+
+	for requestURI, expected := range tests {
+		r := httptest.NewRequest(http.MethodGet, requestURI, nil)
+		require.Equal(t, expected, signedPath(r), requestURI)
+	}
+}
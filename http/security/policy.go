@@ -0,0 +1,326 @@
+package security
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/portainer/agent"
+	"github.com/portainer/agent/filesystem"
+	httperror "github.com/portainer/portainer/pkg/libhttp/error"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// PolicyActionAllow allows the operations matched by a policy rule
+	PolicyActionAllow = "allow"
+	// PolicyActionDeny denies the operations matched by a policy rule
+	PolicyActionDeny = "deny"
+
+	defaultPolicyDeniedMessage = "Operation denied by the agent policy"
+
+	// maxPolicyPayloadSize is the maximum size of the container and service configurations read by the policy,
+	// the payload is read before the signature of the request is verified
+	maxPolicyPayloadSize = 4 << 20 // 4 MB
+)
+
+// apiVersionPrefixRegexp matches the agent API version prefix (/v2) and the Docker API version prefix (/v1.41)
+var apiVersionPrefixRegexp = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)?(/|$)`)
+
+type (
+	// OperationPolicy is the local policy used to restrict the operations that can be executed through the agent.
+	// It is loaded from the agent data folder and evaluated regardless of the signature of the request.
+	OperationPolicy struct {
+		// Rules are evaluated in order, the first rule matching the request decides whether it is allowed or denied
+		Rules []PolicyRule `json:"Rules"`
+		// Containers restricts the content of container and service creation requests
+		Containers ContainerPolicy `json:"Containers"`
+	}
+
+	// PolicyRule matches requests by HTTP method and path
+	PolicyRule struct {
+		// Action is either "allow" or "deny"
+		Action string `json:"Action"`
+		// Methods is the list of HTTP methods matched by the rule, all methods are matched when empty
+		Methods []string `json:"Methods"`
+		// Path is a regular expression matched against the request path, without the API version prefix
+		Path string `json:"Path"`
+		// Message is the message returned to the client when the rule denies a request
+		Message string `json:"Message"`
+
+		pathRegexp *regexp.Regexp
+	}
+
+	// ContainerPolicy restricts the container configurations accepted by the agent
+	ContainerPolicy struct {
+		// DenyPrivileged denies the creation of privileged containers
+		DenyPrivileged bool `json:"DenyPrivileged"`
+		// DeniedBindSources is a list of host paths (path.Match patterns are supported) that cannot be bind mounted
+		DeniedBindSources []string `json:"DeniedBindSources"`
+	}
+
+	// PolicyService is used to enforce the local operation policy of the agent.
+	PolicyService struct {
+		policy OperationPolicy
+	}
+
+	containerCreatePayload struct {
+		HostConfig *struct {
+			Privileged bool
+			Binds      []string
+			Mounts     []mountPayload
+		}
+	}
+
+	serviceCreatePayload struct {
+		TaskTemplate *struct {
+			ContainerSpec *struct {
+				Mounts []mountPayload
+			}
+		}
+	}
+
+	mountPayload struct {
+		Type   string
+		Source string
+	}
+)
+
+// NewPolicyService returns a pointer to a PolicyService.
+// The policy is loaded from the policy file inside the specified data folder,
+// every operation is allowed when the file does not exist.
+func NewPolicyService(dataPath string) (*PolicyService, error) {
+	service := &PolicyService{}
+
+	policyFilePath := path.Join(dataPath, agent.PolicyFile)
+
+	exists, err := filesystem.FileExists(policyFilePath)
+	if err != nil || !exists {
+		return service, err
+	}
+
+	data, err := filesystem.ReadFromFile(policyFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	err = service.load(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", policyFilePath, err)
+	}
+
+	log.Info().
+		Str("policy_file", policyFilePath).
+		Int("rules", len(service.policy.Rules)).
+		Msg("agent operation policy loaded")
+
+	return service, nil
+}
+
+func (service *PolicyService) load(data []byte) error {
+	var policy OperationPolicy
+
+	err := json.Unmarshal(data, &policy)
+	if err != nil {
+		return err
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+
+		if rule.Action != PolicyActionAllow && rule.Action != PolicyActionDeny {
+			return fmt.Errorf("invalid action %q for rule %d", rule.Action, i)
+		}
+
+		rule.pathRegexp, err = regexp.Compile(rule.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path for rule %d: %w", i, err)
+		}
+	}
+
+	for _, source := range policy.Containers.DeniedBindSources {
+		if _, err := path.Match(source, ""); err != nil {
+			return fmt.Errorf("invalid denied bind source %q: %w", source, err)
+		}
+	}
+
+	service.policy = policy
+
+	return nil
+}
+
+// EnforcePolicy rejects the requests that are not permitted by the operation policy
+// with a HTTP 403 before passing them to the next handler.
+func (service *PolicyService) EnforcePolicy(next http.Handler) http.Handler {
+	return httperror.LoggerHandler(func(rw http.ResponseWriter, r *http.Request) *httperror.HandlerError {
+		if err := service.Evaluate(r); err != nil {
+			return err
+		}
+
+		next.ServeHTTP(rw, r)
+		return nil
+	})
+}
+
+// Evaluate returns a HTTP 403 error if the request is denied by the operation policy.
+func (service *PolicyService) Evaluate(r *http.Request) *httperror.HandlerError {
+	operationPath := normalizeOperationPath(r.URL.Path)
+
+	for _, rule := range service.policy.Rules {
+		if !rule.matches(r.Method, operationPath) {
+			continue
+		}
+
+		if rule.Action == PolicyActionAllow {
+			break
+		}
+
+		message := rule.Message
+		if message == "" {
+			message = defaultPolicyDeniedMessage
+		}
+
+		return service.deny(r, message, fmt.Sprintf("%s %s denied by policy rule %q", r.Method, operationPath, rule.Path))
+	}
+
+	return service.evaluateContainerPolicy(r, operationPath)
+}
+
+func (service *PolicyService) evaluateContainerPolicy(r *http.Request, operationPath string) *httperror.HandlerError {
+	containerPolicy := service.policy.Containers
+	if !containerPolicy.DenyPrivileged && len(containerPolicy.DeniedBindSources) == 0 {
+		return nil
+	}
+
+	if r.Method != http.MethodPost || r.Body == nil {
+		return nil
+	}
+
+	isContainerCreate := operationPath == "/containers/create"
+	isServiceCreate := operationPath == "/services/create" || (strings.HasPrefix(operationPath, "/services/") && strings.HasSuffix(operationPath, "/update"))
+	if !isContainerCreate && !isServiceCreate {
+		return nil
+	}
+
+	var maxBytesErr *http.MaxBytesError
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxPolicyPayloadSize))
+	if errors.As(err, &maxBytesErr) {
+		return service.deny(r, "The configuration is too large to be checked, the request is denied by the agent policy", "payload exceeds the maximum size checked by the policy")
+	} else if err != nil {
+		return httperror.BadRequest("Unable to read request body", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var mounts []mountPayload
+	var binds []string
+
+	if isContainerCreate {
+		var payload containerCreatePayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return service.deny(r, "Unable to parse the container configuration, the request is denied by the agent policy", "invalid container creation payload")
+		} else if payload.HostConfig == nil {
+			return nil
+		}
+
+		if containerPolicy.DenyPrivileged && payload.HostConfig.Privileged {
+			return service.deny(r, "Privileged containers are denied by the agent policy", "privileged container creation denied by policy")
+		}
+
+		binds = payload.HostConfig.Binds
+		mounts = payload.HostConfig.Mounts
+	} else {
+		var payload serviceCreatePayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return service.deny(r, "Unable to parse the service configuration, the request is denied by the agent policy", "invalid service creation payload")
+		} else if payload.TaskTemplate == nil || payload.TaskTemplate.ContainerSpec == nil {
+			return nil
+		}
+
+		mounts = payload.TaskTemplate.ContainerSpec.Mounts
+	}
+
+	for _, bind := range binds {
+		// Binds use the source:destination[:options] format, named volumes do not start with a slash
+		source := strings.SplitN(bind, ":", 2)[0]
+		if !strings.HasPrefix(source, "/") {
+			continue
+		}
+
+		if containerPolicy.isDeniedBindSource(source) {
+			return service.deny(r, fmt.Sprintf("Bind mount of %s is denied by the agent policy", source), "bind mount denied by policy")
+		}
+	}
+
+	for _, mount := range mounts {
+		if mount.Type != "bind" {
+			continue
+		}
+
+		if containerPolicy.isDeniedBindSource(mount.Source) {
+			return service.deny(r, fmt.Sprintf("Bind mount of %s is denied by the agent policy", mount.Source), "bind mount denied by policy")
+		}
+	}
+
+	return nil
+}
+
+func (service *PolicyService) deny(r *http.Request, message, reason string) *httperror.HandlerError {
+	log.Warn().
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Str("reason", reason).
+		Msg("request denied by the agent operation policy")
+
+	return httperror.Forbidden(message, errors.New(reason))
+}
+
+// normalizeOperationPath cleans the request path and removes its API version prefixes so that equivalent paths
+// are matched by the same rules
+func normalizeOperationPath(requestPath string) string {
+	operationPath := path.Clean("/" + requestPath)
+
+	for apiVersionPrefixRegexp.MatchString(operationPath) {
+		operationPath = path.Clean("/" + apiVersionPrefixRegexp.ReplaceAllString(operationPath, ""))
+	}
+
+	return operationPath
+}
+
+func (rule *PolicyRule) matches(method, operationPath string) bool {
+	if len(rule.Methods) > 0 {
+		methodMatch := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				methodMatch = true
+				break
+			}
+		}
+
+		if !methodMatch {
+			return false
+		}
+	}
+
+	return rule.pathRegexp.MatchString(operationPath)
+}
+
+func (policy *ContainerPolicy) isDeniedBindSource(source string) bool {
+	source = path.Clean(source)
+
+	for _, denied := range policy.DeniedBindSources {
+		if matched, _ := path.Match(path.Clean(denied), source); matched {
+			return true
+		}
+	}
+
+	return false
+}
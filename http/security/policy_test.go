@@ -0,0 +1,125 @@
+package security
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `{
+	"Rules": [
+		{"Action": "allow", "Methods": ["GET"], "Path": "^/browse/ls$"},
+		{"Action": "deny", "Path": "^/browse", "Message": "Volume browsing is disabled on this device"},
+		{"Action": "deny", "Methods": ["POST"], "Path": "^/containers/[^/]+/exec$"}
+	],
+	"Containers": {
+		"DenyPrivileged": true,
+		"DeniedBindSources": ["/", "/etc/*"]
+	}
+}`
+
+func newTestPolicyService(t *testing.T) *PolicyService {
+	service := &PolicyService{}
+	require.NoError(t, service.load([]byte(testPolicy)))
+
+	return service
+}
+
+func TestPolicyRules(t *testing.T) {
+	service := newTestPolicyService(t)
+
+	tests := []struct {
+		method  string
+		path    string
+		allowed bool
+	}{
+		{http.MethodGet, "/v2/browse/ls", true},
+		{http.MethodGet, "/browse/get", false},
+		{http.MethodDelete, "/v1/browse/volume/delete", false},
+		{http.MethodPost, "/containers/abc/exec", false},
+		{http.MethodGet, "/containers/abc/exec", true},
+		{http.MethodGet, "/containers/json", true},
+		{http.MethodGet, "/browse/ls/../get", false},
+		{http.MethodGet, "//browse/get", false},
+		{http.MethodPost, "/v2/v1.41/containers/abc/exec", false},
+		{http.MethodPost, "/containers/abc/./exec/", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+
+		err := service.Evaluate(r)
+		require.Equal(t, test.allowed, err == nil, "%s %s", test.method, test.path)
+
+		if err != nil {
+			require.Equal(t, http.StatusForbidden, err.StatusCode)
+		}
+	}
+}
+
+func TestPolicyContainerCreate(t *testing.T) {
+	service := newTestPolicyService(t)
+
+	tests := []struct {
+		path    string
+		body    string
+		allowed bool
+	}{
+		{"/containers/create", `{"Image": "nginx"}`, true},
+		{"/containers/create", `{"HostConfig": {"Privileged": true}}`, false},
+		{"/containers/create", `{"HostConfig": {"Binds": ["/:/host"]}}`, false},
+		{"/containers/create", `{"HostConfig": {"Binds": ["/etc/passwd:/passwd:ro"]}}`, false},
+		{"/containers/create", `{"HostConfig": {"Binds": ["/srv/data:/data", "named:/named"]}}`, true},
+		{"/containers/create", `{"HostConfig": {"Mounts": [{"Type": "bind", "Source": "/"}]}}`, false},
+		{"/containers/create", `{"HostConfig": {"Mounts": [{"Type": "volume", "Source": "/"}]}}`, true},
+		{"/services/create", `{"TaskTemplate": {"ContainerSpec": {"Mounts": [{"Type": "bind", "Source": "/etc/shadow"}]}}}`, false},
+		{"/services/xyz/update", `{"TaskTemplate": {"ContainerSpec": {"Mounts": [{"Type": "bind", "Source": "/srv"}]}}}`, true},
+		{"/v1.41/containers/create", `{"HostConfig": {"Privileged": true}}`, false},
+		{"/containers//create", `{"HostConfig": {"Privileged": true}}`, false},
+		{"/containers/./create", `{"HostConfig": {"Privileged": true}}`, false},
+		{"/containers/create", `{"HostConfig": `, false},
+		{"/services/create", `[]`, false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+
+		err := service.Evaluate(r)
+		require.Equal(t, test.allowed, err == nil, "%s %s", test.path, test.body)
+
+		// The body must still be readable by the next handler
+		body, readErr := io.ReadAll(r.Body)
+		require.NoError(t, readErr)
+		require.Equal(t, test.body, string(body))
+	}
+}
+
+func TestPolicyDeniesOversizedPayload(t *testing.T) {
+	service := newTestPolicyService(t)
+
+	body := `{"Image": "nginx", "Labels": {"padding": "` + strings.Repeat("a", maxPolicyPayloadSize) + `"}}`
+	r := httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(body))
+
+	err := service.Evaluate(r)
+	require.NotNil(t, err)
+	require.Equal(t, http.StatusForbidden, err.StatusCode)
+}
+
+func TestPolicyInvalidRule(t *testing.T) {
+	service := &PolicyService{}
+
+	require.Error(t, service.load([]byte(`{"Rules": [{"Action": "reject", "Path": "^/"}]}`)))
+	require.Error(t, service.load([]byte(`{"Rules": [{"Action": "deny", "Path": "("}]}`)))
+}
+
+func TestPolicyMissingFile(t *testing.T) {
+	service, err := NewPolicyService(t.TempDir())
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/containers/create", strings.NewReader(`{"HostConfig": {"Privileged": true}}`))
+	require.Nil(t, service.Evaluate(r))
+}
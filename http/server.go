@@ -8,9 +8,12 @@ import (
 
 	"github.com/portainer/agent"
 	"github.com/portainer/agent/crypto"
+	"github.com/portainer/agent/docker/backup"
 	"github.com/portainer/agent/edge"
 	"github.com/portainer/agent/exec"
+	"github.com/portainer/agent/filesystem"
 	"github.com/portainer/agent/http/handler"
+	"github.com/portainer/agent/http/security"
 	"github.com/portainer/agent/kubernetes"
 	httpError "github.com/portainer/portainer/pkg/libhttp/error"
 
@@ -24,7 +27,11 @@ type APIServer struct {
 	systemService      agent.SystemService
 	clusterService     agent.ClusterService
 	signatureService   agent.DigitalSignatureService
+	policyService      *security.PolicyService
+	uploadService      *filesystem.UploadService
+	certificateManager *crypto.CertificateManager
 	edgeManager        *edge.Manager
+	backupService      *backup.Service
 	agentTags          *agent.RuntimeConfig
 	agentOptions       *agent.Options
 	kubeClient         *kubernetes.KubeClient
@@ -40,7 +47,11 @@ type APIServerConfig struct {
 	SystemService        agent.SystemService
 	ClusterService       agent.ClusterService
 	SignatureService     agent.DigitalSignatureService
+	PolicyService        *security.PolicyService
+	UploadService        *filesystem.UploadService
+	CertificateManager   *crypto.CertificateManager
 	EdgeManager          *edge.Manager
+	BackupService        *backup.Service
 	KubeClient           *kubernetes.KubeClient
 	KubernetesDeployer   *exec.KubernetesDeployer
 	RuntimeConfiguration *agent.RuntimeConfig
@@ -56,7 +67,11 @@ func NewAPIServer(config *APIServerConfig) *APIServer {
 		systemService:      config.SystemService,
 		clusterService:     config.ClusterService,
 		signatureService:   config.SignatureService,
+		policyService:      config.PolicyService,
+		uploadService:      config.UploadService,
+		certificateManager: config.CertificateManager,
 		edgeManager:        config.EdgeManager,
+		backupService:      config.BackupService,
 		agentTags:          config.RuntimeConfiguration,
 		agentOptions:       config.AgentOptions,
 		kubeClient:         config.KubeClient,
@@ -71,8 +86,13 @@ func (server *APIServer) Start(edgeMode bool) error {
 		SystemService:        server.systemService,
 		ClusterService:       server.clusterService,
 		SignatureService:     server.signatureService,
+		PolicyService:        server.policyService,
+		UploadService:        server.uploadService,
 		RuntimeConfiguration: server.agentTags,
+		AgentOptions:         server.agentOptions,
+		CertificateManager:   server.certificateManager,
 		EdgeManager:          server.edgeManager,
+		BackupService:        server.backupService,
 		KubeClient:           server.kubeClient,
 		KubernetesDeployer:   server.kubernetesDeployer,
 		UseTLS:               !edgeMode,
@@ -99,11 +119,12 @@ func (server *APIServer) Start(edgeMode bool) error {
 		return httpServer.ListenAndServe()
 	}
 
-	httpServer.TLSConfig = crypto.CreateTLSConfiguration()
+	// The certificates are provided by the certificate manager so that they can be reloaded without a restart
+	httpServer.TLSConfig = server.certificateManager.TLSConfig()
 
 	go server.securityShutdown(httpServer)
 
-	return httpServer.ListenAndServeTLS(agent.TLSCertPath, agent.TLSKeyPath)
+	return httpServer.ListenAndServeTLS("", "")
 }
 
 func (server *APIServer) securityShutdown(httpServer *http.Server) {
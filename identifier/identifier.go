@@ -0,0 +1,30 @@
+// Package identifier generates the random identifiers of the resources managed by the agent, the identifiers
+// are also used to name the files of these resources.
+package identifier
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// identifierRegexp matches the identifiers returned by New
+var identifierRegexp = regexp.MustCompile(`^[a-f0-9]{32}$`)
+
+// New returns a random identifier made of 32 hexadecimal characters
+func New() (string, error) {
+	id := make([]byte, 16)
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// IsValid returns true when id has the format of the identifiers returned by New. The identifiers received from
+// the clients must be checked before they are used in a file path.
+func IsValid(id string) bool {
+	return identifierRegexp.MatchString(id)
+}
@@ -0,0 +1,21 @@
+package identifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	id, err := New()
+	require.NoError(t, err)
+	require.True(t, IsValid(id))
+
+	otherID, err := New()
+	require.NoError(t, err)
+	require.NotEqual(t, id, otherID)
+
+	for _, id := range []string{"", "../etc/passwd", "0123456789ABCDEF0123456789ABCDEF", "0123456789abcdef"} {
+		require.False(t, IsValid(id), id)
+	}
+}
@@ -42,6 +42,20 @@ func (m *MockClusterService) EXPECT() *MockClusterServiceMockRecorder {
 	return m.recorder
 }
 
+// BroadcastEvent mocks base method.
+func (m *MockClusterService) BroadcastEvent(name string, payload []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BroadcastEvent", name, payload)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BroadcastEvent indicates an expected call of BroadcastEvent.
+func (mr *MockClusterServiceMockRecorder) BroadcastEvent(name, payload any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BroadcastEvent", reflect.TypeOf((*MockClusterService)(nil).BroadcastEvent), name, payload)
+}
+
 // Create mocks base method.
 func (m *MockClusterService) Create(advertiseAddr string, joinAddr []string, probeTimeout, probeInterval time.Duration) error {
 	m.ctrl.T.Helper()
@@ -124,6 +138,34 @@ func (mr *MockClusterServiceMockRecorder) Leave() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Leave", reflect.TypeOf((*MockClusterService)(nil).Leave))
 }
 
+// MemberDetails mocks base method.
+func (m *MockClusterService) MemberDetails() []agent.ClusterMemberDetails {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MemberDetails")
+	ret0, _ := ret[0].([]agent.ClusterMemberDetails)
+	return ret0
+}
+
+// MemberDetails indicates an expected call of MemberDetails.
+func (mr *MockClusterServiceMockRecorder) MemberDetails() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MemberDetails", reflect.TypeOf((*MockClusterService)(nil).MemberDetails))
+}
+
+// MemberEvents mocks base method.
+func (m *MockClusterService) MemberEvents() []agent.ClusterMemberEvent {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MemberEvents")
+	ret0, _ := ret[0].([]agent.ClusterMemberEvent)
+	return ret0
+}
+
+// MemberEvents indicates an expected call of MemberEvents.
+func (mr *MockClusterServiceMockRecorder) MemberEvents() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MemberEvents", reflect.TypeOf((*MockClusterService)(nil).MemberEvents))
+}
+
 // Members mocks base method.
 func (m *MockClusterService) Members() []agent.ClusterMember {
 	m.ctrl.T.Helper()
@@ -138,6 +180,18 @@ func (mr *MockClusterServiceMockRecorder) Members() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Members", reflect.TypeOf((*MockClusterService)(nil).Members))
 }
 
+// SubscribeEvents mocks base method.
+func (m *MockClusterService) SubscribeEvents(name string, handler func([]byte)) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SubscribeEvents", name, handler)
+}
+
+// SubscribeEvents indicates an expected call of SubscribeEvents.
+func (mr *MockClusterServiceMockRecorder) SubscribeEvents(name, handler any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubscribeEvents", reflect.TypeOf((*MockClusterService)(nil).SubscribeEvents), name, handler)
+}
+
 // UpdateRuntimeConfiguration mocks base method.
 func (m *MockClusterService) UpdateRuntimeConfiguration(runtimeConfiguration *agent.RuntimeConfig) error {
 	m.ctrl.T.Helper()
@@ -189,6 +243,64 @@ func (mr *MockDigitalSignatureServiceMockRecorder) IsAssociated() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAssociated", reflect.TypeOf((*MockDigitalSignatureService)(nil).IsAssociated))
 }
 
+// RotateKey mocks base method.
+func (m *MockDigitalSignatureService) RotateKey(currentKey, newKey, newKeySignature string, gracePeriod time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateKey", currentKey, newKey, newKeySignature, gracePeriod)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RotateKey indicates an expected call of RotateKey.
+func (mr *MockDigitalSignatureServiceMockRecorder) RotateKey(currentKey, newKey, newKeySignature, gracePeriod any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateKey", reflect.TypeOf((*MockDigitalSignatureService)(nil).RotateKey), currentKey, newKey, newKeySignature, gracePeriod)
+}
+
+// TrustedKeys mocks base method.
+func (m *MockDigitalSignatureService) TrustedKeys() []agent.TrustedKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TrustedKeys")
+	ret0, _ := ret[0].([]agent.TrustedKey)
+	return ret0
+}
+
+// TrustedKeys indicates an expected call of TrustedKeys.
+func (mr *MockDigitalSignatureServiceMockRecorder) TrustedKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TrustedKeys", reflect.TypeOf((*MockDigitalSignatureService)(nil).TrustedKeys))
+}
+
+// VerifyContentSignature mocks base method.
+func (m *MockDigitalSignatureService) VerifyContentSignature(signature, key, content string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyContentSignature", signature, key, content)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyContentSignature indicates an expected call of VerifyContentSignature.
+func (mr *MockDigitalSignatureServiceMockRecorder) VerifyContentSignature(signature, key, content any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyContentSignature", reflect.TypeOf((*MockDigitalSignatureService)(nil).VerifyContentSignature), signature, key, content)
+}
+
+// VerifyRequestSignature mocks base method.
+func (m *MockDigitalSignatureService) VerifyRequestSignature(signature, key, requestDigest string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyRequestSignature", signature, key, requestDigest)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyRequestSignature indicates an expected call of VerifyRequestSignature.
+func (mr *MockDigitalSignatureServiceMockRecorder) VerifyRequestSignature(signature, key, requestDigest any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyRequestSignature", reflect.TypeOf((*MockDigitalSignatureService)(nil).VerifyRequestSignature), signature, key, requestDigest)
+}
+
 // VerifySignature mocks base method.
 func (m *MockDigitalSignatureService) VerifySignature(signature, key string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -272,6 +384,21 @@ func (mr *MockDockerInfoServiceMockRecorder) GetServiceNameFromDockerEngine(cont
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetServiceNameFromDockerEngine", reflect.TypeOf((*MockDockerInfoService)(nil).GetServiceNameFromDockerEngine), containerName)
 }
 
+// GetSwarmTopologyFromDockerEngine mocks base method.
+func (m *MockDockerInfoService) GetSwarmTopologyFromDockerEngine(containerName string) (*agent.SwarmTopology, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSwarmTopologyFromDockerEngine", containerName)
+	ret0, _ := ret[0].(*agent.SwarmTopology)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSwarmTopologyFromDockerEngine indicates an expected call of GetSwarmTopologyFromDockerEngine.
+func (mr *MockDockerInfoServiceMockRecorder) GetSwarmTopologyFromDockerEngine(containerName any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSwarmTopologyFromDockerEngine", reflect.TypeOf((*MockDockerInfoService)(nil).GetSwarmTopologyFromDockerEngine), containerName)
+}
+
 // MockDeployer is a mock of Deployer interface.
 type MockDeployer struct {
 	ctrl     *gomock.Controller
@@ -14,7 +14,7 @@ import (
 
 // KubeClient can be used to query the Kubernetes API
 type KubeClient struct {
-	cli *kubernetes.Clientset
+	cli kubernetes.Interface
 }
 
 // NewKubeClient returns a pointer to a new KubeClient instance
@@ -30,6 +30,16 @@ func NewKubeClient() (*KubeClient, error) {
 	return kubeCli, nil
 }
 
+// ServerVersion returns the version of the Kubernetes API server
+func (kcl *KubeClient) ServerVersion() (string, error) {
+	version, err := kcl.cli.Discovery().ServerVersion()
+	if err != nil {
+		return "", err
+	}
+
+	return version.GitVersion, nil
+}
+
 func buildLocalClient() (*kubernetes.Clientset, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
@@ -39,14 +49,25 @@ func buildLocalClient() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+// ExecProcessOptions are the streams and terminal settings of an exec process
+type ExecProcessOptions struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	// Stderr is required when Tty is false, the error output is merged with the standard output otherwise
+	Stderr io.Writer
+	Tty    bool
+	// TerminalSizeQueue is used to resize the terminal of the process, only used when Tty is true
+	TerminalSizeQueue *TerminalSizeQueue
+}
+
 // StartExecProcess will start an exec process inside a container located inside a pod inside a specific namespace
-// using the specified command. The stdin parameter will be bound to the stdin process and the stdout process will write
-// to the stdout parameter.
+// using the specified command. The process is bound to the streams of the options and the function returns
+// the exit code of the process once it has ended.
 // This function only works against a local endpoint using an in-cluster config.
-func (kcl *KubeClient) StartExecProcess(token, namespace, podName, containerName string, command []string, stdin io.Reader, stdout io.Writer) error {
+func (kcl *KubeClient) StartExecProcess(token, namespace, podName, containerName string, command []string, options ExecProcessOptions) (int, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if token != "" {
@@ -66,26 +87,35 @@ func (kcl *KubeClient) StartExecProcess(token, namespace, podName, containerName
 		Command:   command,
 		Stdin:     true,
 		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
+		Stderr:    options.Tty || options.Stderr != nil,
+		TTY:       options.Tty,
 	}, scheme.ParameterCodec)
 
 	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  options.Stdin,
+		Stdout: options.Stdout,
+		Stderr: options.Stderr,
+		Tty:    options.Tty,
 	}
 
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  stdin,
-		Stdout: stdout,
-		Tty:    true,
-	})
+	if options.Tty && options.TerminalSizeQueue != nil {
+		streamOptions.TerminalSizeQueue = options.TerminalSizeQueue
+	}
+
+	err = exec.Stream(streamOptions)
 	if err != nil {
 		var exitError utilexec.ExitError
 		if !errors.As(err, &exitError) {
-			return errors.New("unable to start exec process")
+			return 0, errors.New("unable to start exec process")
 		}
+
+		return exitError.ExitStatus(), nil
 	}
 
-	return nil
+	return 0, nil
 }
@@ -0,0 +1,49 @@
+package kubernetes
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// namespaceFile contains the namespace of the pod, it is mounted along with the service account token
+	namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	// defaultNamespace is the namespace in which the agent is deployed by default
+	defaultNamespace = "portainer"
+)
+
+// GetAgentNamespace returns the namespace of the pod of the agent
+func GetAgentNamespace() string {
+	namespace, err := os.ReadFile(namespaceFile)
+	if err != nil || strings.TrimSpace(string(namespace)) == "" {
+		return defaultNamespace
+	}
+
+	return strings.TrimSpace(string(namespace))
+}
+
+// GetServiceEndpointAddresses returns the IP addresses of the endpoints of a service, including the endpoints
+// that are not ready yet
+func (kcl *KubeClient) GetServiceEndpointAddresses(namespace, serviceName string) ([]string, error) {
+	endpoints, err := kcl.cli.CoreV1().Endpoints(namespace).Get(context.TODO(), serviceName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0)
+
+	for _, subset := range endpoints.Subsets {
+		for _, address := range subset.Addresses {
+			addresses = append(addresses, address.IP)
+		}
+
+		for _, address := range subset.NotReadyAddresses {
+			addresses = append(addresses, address.IP)
+		}
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,33 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetServiceEndpointAddresses(t *testing.T) {
+	kcl := &KubeClient{cli: fake.NewSimpleClientset(&v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Name: "portainer-agent", Namespace: "portainer"},
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses:         []v1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+				NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.3"}},
+			},
+			{
+				Addresses: []v1.EndpointAddress{{IP: "10.0.1.1"}},
+			},
+		},
+	})}
+
+	// The endpoints that are not ready yet are joined as well
+	addresses, err := kcl.GetServiceEndpointAddresses("portainer", "portainer-agent")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.1.1"}, addresses)
+
+	_, err = kcl.GetServiceEndpointAddresses("default", "portainer-agent")
+	require.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForwardStream is a TCP stream forwarded to a port of a pod
+type PortForwardStream struct {
+	conn        httpstream.Connection
+	data        httpstream.Stream
+	errorStream httpstream.Stream
+	mu          sync.Mutex
+	err         error
+	errorRead   chan struct{}
+}
+
+// PortForward opens a TCP stream to a port of a pod through the portforward subresource of the Kubernetes API.
+// The caller must close the returned stream.
+// This function only works against a local endpoint using an in-cluster config.
+func (kcl *KubeClient) PortForward(token, namespace, podName string, port int) (*PortForwardStream, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		config.BearerToken = token
+		config.BearerTokenFile = ""
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	req := kcl.cli.CoreV1().RESTClient().
+		Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("portforward")
+
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPortForwardStream(conn, port)
+}
+
+// newPortForwardStream creates the error and data streams of a port forwarding over a connection to the Kubernetes API,
+// the connection is closed when the streams cannot be created
+func newPortForwardStream(conn httpstream.Connection, port int) (*PortForwardStream, error) {
+	headers := http.Header{}
+	headers.Set(v1.StreamType, v1.StreamTypeError)
+	headers.Set(v1.PortHeader, strconv.Itoa(port))
+	headers.Set(v1.PortForwardRequestIDHeader, "0")
+
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The error stream is only read
+	errorStream.Close()
+
+	headers.Set(v1.StreamType, v1.StreamTypeData)
+
+	data, err := conn.CreateStream(headers)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	stream := &PortForwardStream{
+		conn:        conn,
+		data:        data,
+		errorStream: errorStream,
+		errorRead:   make(chan struct{}),
+	}
+
+	go stream.readError()
+
+	return stream, nil
+}
+
+// Read reads data sent by the pod, it returns the error reported by the Kubernetes API when the forwarding failed
+func (stream *PortForwardStream) Read(p []byte) (int, error) {
+	n, err := stream.data.Read(p)
+	if err == io.EOF {
+		// The error is reported once the data stream is closed
+		<-stream.errorRead
+
+		if forwardErr := stream.forwardError(); forwardErr != nil {
+			return n, forwardErr
+		}
+	}
+
+	return n, err
+}
+
+// Write sends data to the pod
+func (stream *PortForwardStream) Write(p []byte) (int, error) {
+	return stream.data.Write(p)
+}
+
+// Close closes the stream along with the connection to the Kubernetes API
+func (stream *PortForwardStream) Close() error {
+	stream.data.Close()
+
+	return stream.conn.Close()
+}
+
+func (stream *PortForwardStream) readError() {
+	defer close(stream.errorRead)
+
+	message, err := io.ReadAll(stream.errorStream)
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	switch {
+	case err != nil:
+		stream.err = fmt.Errorf("unable to read the port forwarding error stream: %w", err)
+	case len(message) > 0:
+		stream.err = errors.New(string(message))
+	}
+}
+
+func (stream *PortForwardStream) forwardError() error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	return stream.err
+}
@@ -0,0 +1,133 @@
+package kubernetes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// testStream is a stream whose close only ends the data sent to the remote side, like the streams of the Kubernetes API
+type testStream struct {
+	reader  *io.PipeReader
+	writer  *io.PipeWriter
+	headers http.Header
+}
+
+func (stream *testStream) Read(p []byte) (int, error)  { return stream.reader.Read(p) }
+func (stream *testStream) Write(p []byte) (int, error) { return stream.writer.Write(p) }
+func (stream *testStream) Close() error                { return stream.writer.Close() }
+func (stream *testStream) Reset() error                { stream.reader.Close(); return stream.writer.Close() }
+func (stream *testStream) Headers() http.Header        { return stream.headers }
+func (stream *testStream) Identifier() uint32          { return 0 }
+
+// testRemote is the remote side of a testStream
+type testRemote struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (remote *testRemote) Close() error { return remote.PipeWriter.Close() }
+
+// testConnection creates the streams of a port forwarding and keeps their remote side
+type testConnection struct {
+	remotes   map[string]*testRemote
+	failWith  error
+	closed    bool
+	closeChan chan bool
+}
+
+func newTestConnection() *testConnection {
+	return &testConnection{
+		remotes:   make(map[string]*testRemote),
+		closeChan: make(chan bool),
+	}
+}
+
+func (conn *testConnection) CreateStream(headers http.Header) (httpstream.Stream, error) {
+	if conn.failWith != nil && headers.Get(v1.StreamType) == v1.StreamTypeData {
+		return nil, conn.failWith
+	}
+
+	remoteReader, localWriter := io.Pipe()
+	localReader, remoteWriter := io.Pipe()
+	conn.remotes[headers.Get(v1.StreamType)] = &testRemote{PipeReader: remoteReader, PipeWriter: remoteWriter}
+
+	return &testStream{reader: localReader, writer: localWriter, headers: headers.Clone()}, nil
+}
+
+func (conn *testConnection) Close() error {
+	conn.closed = true
+
+	return nil
+}
+
+func (conn *testConnection) CloseChan() <-chan bool                     { return conn.closeChan }
+func (conn *testConnection) SetIdleTimeout(timeout time.Duration)       {}
+func (conn *testConnection) RemoveStreams(streams ...httpstream.Stream) {}
+
+func TestPortForwardStream(t *testing.T) {
+	conn := newTestConnection()
+
+	stream, err := newPortForwardStream(conn, 8080)
+	require.NoError(t, err)
+
+	data := conn.remotes[v1.StreamTypeData]
+	require.NotNil(t, data)
+
+	go func() {
+		buffer := make([]byte, 4)
+		io.ReadFull(data, buffer)
+		data.Write(buffer)
+		data.Close()
+	}()
+
+	_, err = stream.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	buffer := make([]byte, 4)
+	_, err = io.ReadFull(stream, buffer)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buffer))
+
+	// The end of the stream is reported once the error stream is closed without any error
+	conn.remotes[v1.StreamTypeError].Close()
+
+	_, err = stream.Read(buffer)
+	require.ErrorIs(t, err, io.EOF)
+
+	require.NoError(t, stream.Close())
+	require.True(t, conn.closed)
+}
+
+func TestPortForwardStreamReportsForwardingError(t *testing.T) {
+	conn := newTestConnection()
+
+	stream, err := newPortForwardStream(conn, 8080)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	go func() {
+		errorStream := conn.remotes[v1.StreamTypeError]
+		errorStream.Write([]byte("connection refused"))
+		errorStream.Close()
+		conn.remotes[v1.StreamTypeData].Close()
+	}()
+
+	_, err = stream.Read(make([]byte, 4))
+	require.EqualError(t, err, "connection refused")
+}
+
+func TestPortForwardStreamClosesConnectionOnError(t *testing.T) {
+	conn := newTestConnection()
+	conn.failWith = errors.New("stream refused")
+
+	_, err := newPortForwardStream(conn, 8080)
+	require.EqualError(t, err, "stream refused")
+	require.True(t, conn.closed)
+}
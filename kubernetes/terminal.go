@@ -0,0 +1,60 @@
+package kubernetes
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// TerminalSizeQueue forwards the size changes of a terminal to an exec process.
+// Only the latest size is kept when the changes are not consumed fast enough.
+type TerminalSizeQueue struct {
+	sizes     chan remotecommand.TerminalSize
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTerminalSizeQueue returns a pointer to a TerminalSizeQueue
+func NewTerminalSizeQueue() *TerminalSizeQueue {
+	return &TerminalSizeQueue{
+		sizes: make(chan remotecommand.TerminalSize, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+// Resize queues a new size of the terminal, it never blocks
+func (queue *TerminalSizeQueue) Resize(width, height uint16) {
+	size := remotecommand.TerminalSize{Width: width, Height: height}
+
+	for {
+		select {
+		case queue.sizes <- size:
+			return
+		default:
+		}
+
+		// Drop the pending size that was not consumed yet
+		select {
+		case <-queue.sizes:
+		default:
+		}
+	}
+}
+
+// Next returns the next size of the terminal, it returns nil once the queue is closed.
+// It implements the remotecommand.TerminalSizeQueue interface.
+func (queue *TerminalSizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-queue.sizes:
+		return &size
+	case <-queue.done:
+		return nil
+	}
+}
+
+// Close stops the queue, it must be called once the exec process has ended
+func (queue *TerminalSizeQueue) Close() {
+	queue.closeOnce.Do(func() {
+		close(queue.done)
+	})
+}
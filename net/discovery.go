@@ -0,0 +1,50 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// LookupSRVAddresses returns the addresses, in the host:port format, of the targets of the SRV record of name.
+// On error, it returns an empty slice and the error.
+func LookupSRVAddresses(name string) ([]string, error) {
+	addresses := make([]string, 0)
+
+	_, records, err := net.LookupSRV("", "", name)
+	if err != nil {
+		return addresses, err
+	}
+
+	for _, record := range records {
+		address := net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		addresses = append(addresses, address)
+
+		log.Debug().Str("name", name).Str("address", address).Msg("")
+	}
+
+	return addresses, nil
+}
+
+// ParseStaticAddresses returns the addresses of a comma separated list of addresses in the host or host:port format
+func ParseStaticAddresses(list string) ([]string, error) {
+	addresses := make([]string, 0)
+
+	for _, address := range strings.Split(list, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	if len(addresses) == 0 {
+		return addresses, errors.New("the list does not contain any address")
+	}
+
+	return addresses, nil
+}
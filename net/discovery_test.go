@@ -0,0 +1,19 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStaticAddresses(t *testing.T) {
+	addresses, err := ParseStaticAddresses(" 10.0.0.1:9001, agent-2 ,,[fd00::1]:9001,")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:9001", "agent-2", "[fd00::1]:9001"}, addresses)
+
+	for _, list := range []string{"", " ", ", ,"} {
+		addresses, err = ParseStaticAddresses(list)
+		require.Error(t, err, list)
+		require.Empty(t, addresses)
+	}
+}
@@ -14,10 +14,39 @@ const (
 	EnvKeyAgentHost             = "AGENT_HOST"
 	EnvKeyAgentPort             = "AGENT_PORT"
 	EnvKeyClusterAddr           = "AGENT_CLUSTER_ADDR"
+	EnvKeyClusterDiscovery      = "AGENT_CLUSTER_DISCOVERY"
+	EnvKeyClusterAdvertiseAddr  = "AGENT_CLUSTER_ADVERTISE_ADDR"
 	EnvKeyClusterProbeTimeout   = "AGENT_CLUSTER_PROBE_TIMEOUT"
 	EnvKeyClusterProbeInterval  = "AGENT_CLUSTER_PROBE_INTERVAL"
+	EnvKeyClusterKeyFile        = "AGENT_CLUSTER_KEY_FILE"
+	EnvKeyClusterKeyRollout     = "AGENT_CLUSTER_KEY_ROLLOUT"
+	EnvKeyClusterNodeTimeout    = "AGENT_CLUSTER_NODE_TIMEOUT"
+	EnvKeyClusterQuorum         = "AGENT_CLUSTER_QUORUM"
+	EnvKeyClusterCacheTTL       = "AGENT_CLUSTER_CACHE_TTL"
 	EnvKeyAgentSecret           = "AGENT_SECRET"
 	EnvKeyAgentSecurityShutdown = "AGENT_SECRET_TIMEOUT"
+	EnvKeySignatureMaxSkew      = "AGENT_SIGNATURE_MAX_SKEW"
+	EnvKeySignatureStrict       = "AGENT_SIGNATURE_STRICT"
+	EnvKeyTLSCert               = "AGENT_TLS_CERT"
+	EnvKeyTLSKey                = "AGENT_TLS_KEY"
+	EnvKeyTLSClientCA           = "AGENT_TLS_CLIENT_CA"
+	EnvKeyTLSRenewBefore        = "AGENT_TLS_RENEW_BEFORE"
+	EnvKeyBrowseArchiveMaxSize  = "AGENT_BROWSE_ARCHIVE_MAX_SIZE"
+	EnvKeyBackupRetentionCount  = "AGENT_BACKUP_RETENTION_COUNT"
+	EnvKeyBackupRetentionMaxAge = "AGENT_BACKUP_RETENTION_MAX_AGE"
+	EnvKeyBackupS3Endpoint      = "AGENT_BACKUP_S3_ENDPOINT"
+	EnvKeyBackupS3Region        = "AGENT_BACKUP_S3_REGION"
+	EnvKeyBackupS3Bucket        = "AGENT_BACKUP_S3_BUCKET"
+	EnvKeyBackupS3AccessKeyID   = "AGENT_BACKUP_S3_ACCESS_KEY_ID"
+	EnvKeyBackupS3SecretKey     = "AGENT_BACKUP_S3_SECRET_ACCESS_KEY"
+	EnvKeyBackupS3Prefix        = "AGENT_BACKUP_S3_PREFIX"
+	EnvKeyBackupS3PathStyle     = "AGENT_BACKUP_S3_FORCE_PATH_STYLE"
+	EnvKeyRecording             = "AGENT_SESSION_RECORDING"
+	EnvKeyRecordingMaxAge       = "AGENT_SESSION_RECORDING_MAX_AGE"
+	EnvKeyRecordingMaxSize      = "AGENT_SESSION_RECORDING_MAX_SIZE"
+	EnvKeyWebsocketIdleTimeout  = "AGENT_WEBSOCKET_IDLE_TIMEOUT"
+	EnvKeyWebsocketMaxDuration  = "AGENT_WEBSOCKET_MAX_DURATION"
+	EnvKeyWebsocketMaxSessions  = "AGENT_WEBSOCKET_MAX_SESSIONS"
 	EnvKeyAssetsPath            = "ASSETS_PATH"
 	EnvKeyDataPath              = "DATA_PATH"
 	EnvKeyEdge                  = "EDGE"
@@ -29,6 +58,9 @@ const (
 	EnvKeyEdgeInactivityTimeout = "EDGE_INACTIVITY_TIMEOUT"
 	EnvKeyEdgeInsecurePoll      = "EDGE_INSECURE_POLL"
 	EnvKeyEdgeTunnel            = "EDGE_TUNNEL"
+	EnvKeyEdgeJobScheduler      = "EDGE_JOB_SCHEDULER"
+	EnvKeyEdgeFailoverThreshold = "EDGE_FAILOVER_THRESHOLD"
+	EnvKeyEdgeFailbackInterval  = "EDGE_FAILBACK_INTERVAL"
 	EnvKeyEdgeTunnelHttpProxy   = "HTTP_PROXY"
 	EnvKeyEdgeTunnelHttpsProxy  = "HTTPS_PROXY"
 	EnvKeyLogLevel              = "LOG_LEVEL"
@@ -37,6 +69,7 @@ const (
 	EnvKeySSLKey                = "MTLS_SSL_KEY"
 	EnvKeySSLCACert             = "MTLS_SSL_CA"
 	EnvKeyCertRetryInterval     = "MTLS_CERT_RETRY_INTERVAL"
+	EnvKeyRevocationHardFail    = "MTLS_REVOCATION_HARD_FAIL"
 	EnvKeyAWSClientCert         = "AWS_CLIENT_CERT"
 	EnvKeyAWSClientKey          = "AWS_CLIENT_KEY"
 	EnvKeyAWSClientBundle       = "AWS_CLIENT_BUNDLE"
@@ -61,9 +94,38 @@ var (
 	fAgentServerAddr       = kingpin.Flag("host", EnvKeyAgentHost+" address on which the agent API will be exposed").Envar(EnvKeyAgentHost).Default(agent.DefaultAgentAddr).IP()
 	fAgentServerPort       = kingpin.Flag("port", EnvKeyAgentPort+" port on which the agent API will be exposed").Envar(EnvKeyAgentPort).Default(agent.DefaultAgentPort).Int()
 	fAgentSecurityShutdown = kingpin.Flag("secret-timeout", EnvKeyAgentSecurityShutdown+" the duration after which the agent will be shutdown if not associated or secured by AGENT_SECRET. (defaults to 72h)").Envar(EnvKeyAgentSecurityShutdown).Default(agent.DefaultAgentSecurityShutdown).Duration()
+	fSignatureMaxSkew      = kingpin.Flag("signature-max-skew", EnvKeySignatureMaxSkew+" maximum difference between the timestamp of a replay protected request signature and the agent clock (defaults to 5m)").Envar(EnvKeySignatureMaxSkew).Default(agent.DefaultSignatureMaxSkew).Duration()
+	fSignatureStrict       = kingpin.Flag("signature-strict", EnvKeySignatureStrict+" reject the requests that are not signed with the replay protected signature scheme. Disabled by default, set to 1 or true to enable it").Envar(EnvKeySignatureStrict).Bool()
+	fTLSCert               = kingpin.Flag("tls-cert", EnvKeyTLSCert+" path to the certificate chain used by the agent API, a self-signed certificate is generated when not specified. The file is reloaded when it is modified").Envar(EnvKeyTLSCert).String()
+	fTLSKey                = kingpin.Flag("tls-key", EnvKeyTLSKey+" path to the key of the certificate used by the agent API").Envar(EnvKeyTLSKey).String()
+	fTLSClientCA           = kingpin.Flag("tls-client-ca", EnvKeyTLSClientCA+" path to the CA certificates used to verify client certificates. When specified, the agent API requires a valid client certificate").Envar(EnvKeyTLSClientCA).String()
+	fTLSRenewBefore        = kingpin.Flag("tls-renew-before", EnvKeyTLSRenewBefore+" duration before its expiry after which the self-signed certificate of the agent API is renewed (defaults to 720h)").Envar(EnvKeyTLSRenewBefore).Default(agent.DefaultTLSRenewBefore).Duration()
+	fBrowseArchiveMaxSize  = kingpin.Flag("browse-archive-max-size", EnvKeyBrowseArchiveMaxSize+" maximum size of the content of the archives downloaded from and uploaded to the volume browser, set to 0 to disable the limit (defaults to 10GB)").Envar(EnvKeyBrowseArchiveMaxSize).Default(agent.DefaultBrowseArchiveMaxSize).Bytes()
+	fBackupRetentionCount  = kingpin.Flag("backup-retention-count", EnvKeyBackupRetentionCount+" maximum number of backups kept for each volume, set to 0 to keep all the backups (defaults to 5)").Envar(EnvKeyBackupRetentionCount).Default(agent.DefaultBackupRetentionCount).Int()
+	fBackupRetentionMaxAge = kingpin.Flag("backup-retention-max-age", EnvKeyBackupRetentionMaxAge+" duration after which the volume backups are removed, backups do not expire when not specified").Envar(EnvKeyBackupRetentionMaxAge).Duration()
+	fBackupS3Endpoint      = kingpin.Flag("backup-s3-endpoint", EnvKeyBackupS3Endpoint+" URL of the S3-compatible storage where the volume backups can be sent").Envar(EnvKeyBackupS3Endpoint).String()
+	fBackupS3Region        = kingpin.Flag("backup-s3-region", EnvKeyBackupS3Region+" region of the S3-compatible storage (defaults to us-east-1)").Envar(EnvKeyBackupS3Region).String()
+	fBackupS3Bucket        = kingpin.Flag("backup-s3-bucket", EnvKeyBackupS3Bucket+" bucket where the volume backups are sent").Envar(EnvKeyBackupS3Bucket).String()
+	fBackupS3AccessKeyID   = kingpin.Flag("backup-s3-access-key-id", EnvKeyBackupS3AccessKeyID+" access key identifier used to authenticate against the S3-compatible storage").Envar(EnvKeyBackupS3AccessKeyID).String()
+	fBackupS3SecretKey     = kingpin.Flag("backup-s3-secret-access-key", EnvKeyBackupS3SecretKey+" secret access key used to authenticate against the S3-compatible storage").Envar(EnvKeyBackupS3SecretKey).String()
+	fBackupS3Prefix        = kingpin.Flag("backup-s3-prefix", EnvKeyBackupS3Prefix+" prefix of the keys of the volume backups inside the bucket").Envar(EnvKeyBackupS3Prefix).String()
+	fBackupS3PathStyle     = kingpin.Flag("backup-s3-force-path-style", EnvKeyBackupS3PathStyle+" use path-style URLs to access the bucket, usually required by self-hosted S3-compatible storages").Envar(EnvKeyBackupS3PathStyle).Bool()
+	fRecordingEnabled      = kingpin.Flag("session-recording", EnvKeyRecording+" record the exec, attach and pod terminal sessions in the asciinema v2 format inside the data folder. Disabled by default, set to 1 or true to enable it").Envar(EnvKeyRecording).Bool()
+	fRecordingMaxAge       = kingpin.Flag("session-recording-max-age", EnvKeyRecordingMaxAge+" duration after which the terminal session recordings are removed, set to 0 to keep all the recordings (defaults to 720h)").Envar(EnvKeyRecordingMaxAge).Default(agent.DefaultRecordingMaxAge).Duration()
+	fRecordingMaxSize      = kingpin.Flag("session-recording-max-size", EnvKeyRecordingMaxSize+" maximum size of a terminal session recording, the rest of the session is not recorded once reached. Set to 0 to disable the limit (defaults to 100MB)").Envar(EnvKeyRecordingMaxSize).Default(agent.DefaultRecordingMaxSize).Bytes()
+	fWebsocketIdleTimeout  = kingpin.Flag("websocket-idle-timeout", EnvKeyWebsocketIdleTimeout+" duration without any input from the client after which the exec, attach and port forwarding sessions are closed (port forwarding sessions are also kept open by their output), sessions never time out when not specified").Envar(EnvKeyWebsocketIdleTimeout).Duration()
+	fWebsocketMaxDuration  = kingpin.Flag("websocket-max-duration", EnvKeyWebsocketMaxDuration+" maximum duration of the exec, attach and port forwarding sessions, no limit when not specified").Envar(EnvKeyWebsocketMaxDuration).Duration()
+	fWebsocketMaxSessions  = kingpin.Flag("websocket-max-sessions", EnvKeyWebsocketMaxSessions+" maximum number of concurrent exec, attach and port forwarding sessions on the node, no limit when not specified").Envar(EnvKeyWebsocketMaxSessions).Int()
 	fClusterAddress        = kingpin.Flag("cluster-addr", EnvKeyClusterAddr+" address (in the IP:PORT format) of an existing agent to join the agent cluster. When deploying the agent as a Docker Swarm service, we can leverage the internal Docker DNS to automatically join existing agents or form a cluster by using tasks.<AGENT_SERVICE_NAME>:<AGENT_PORT> as the address").Envar(EnvKeyClusterAddr).String()
+	fClusterDiscovery      = kingpin.Flag("cluster-discovery", EnvKeyClusterDiscovery+" mechanism used to find the agents to join using "+EnvKeyClusterAddr+": dns joins the IP addresses of the host, srv joins the targets of the DNS SRV record, static joins the comma separated list of addresses and kubernetes joins the endpoints of the named service of the agent namespace. Defaults to dns on Swarm and Kubernetes, the agents running on standalone Docker hosts only form a cluster when specified").Envar(EnvKeyClusterDiscovery).Enum(agent.ClusterDiscoveryDNS, agent.ClusterDiscoverySRV, agent.ClusterDiscoveryStatic, agent.ClusterDiscoveryKubernetes)
+	fClusterAdvertise      = kingpin.Flag("cluster-advertise-addr", EnvKeyClusterAdvertiseAddr+" IP address advertised to the other agents of the cluster, required when the IP address of the agent container is not reachable from the other hosts, e.g. on standalone Docker hosts. The agent port and the gossip port (7946) must be reachable on that address").Envar(EnvKeyClusterAdvertiseAddr).String()
 	fClusterProbeTimeout   = kingpin.Flag("agent-cluster-timeout", EnvKeyClusterProbeTimeout+" timeout interval for receiving agent member probe responses (only change this setting if you know what you're doing)").Envar(EnvKeyClusterProbeTimeout).Default(agent.DefaultClusterProbeTimeout).Duration()
 	fClusterProbeInterval  = kingpin.Flag("agent-cluster-interval", EnvKeyClusterProbeInterval+" interval for repeating failed agent member probe (only change this setting if you know what you're doing)").Envar(EnvKeyClusterProbeInterval).Default(agent.DefaultClusterProbeInterval).Duration()
+	fClusterKeyFile        = kingpin.Flag("cluster-key-file", EnvKeyClusterKeyFile+" path to a file containing the base64 encoded keys (16, 24 or 32 bytes, one per line, the first one being the primary key) used to encrypt the gossip between the agents. The keys are rotated across the cluster when the file is modified. A key derived from AGENT_SECRET is used when not specified").Envar(EnvKeyClusterKeyFile).String()
+	fClusterKeyRollout     = kingpin.Flag("cluster-key-rollout", EnvKeyClusterKeyRollout+" stage of the encryption of the gossip between the agents: permissive and encrypt are used to encrypt the gossip of a running cluster, enforce rejects the unencrypted gossip and must be explicitly enabled once all the agents encrypt their gossip. Redeploy the agents with encrypt, then enforce (defaults to permissive)").Envar(EnvKeyClusterKeyRollout).Default(agent.ClusterKeyRolloutPermissive).Enum(agent.ClusterKeyRolloutEnforce, agent.ClusterKeyRolloutPermissive, agent.ClusterKeyRolloutEncrypt)
+	fClusterNodeTimeout    = kingpin.Flag("cluster-node-timeout", EnvKeyClusterNodeTimeout+" duration after which a node that did not respond is considered failed when aggregating the resources of the cluster (defaults to 30s)").Envar(EnvKeyClusterNodeTimeout).Default(agent.DefaultClusterNodeTimeout).Duration()
+	fClusterQuorum         = kingpin.Flag("cluster-quorum", EnvKeyClusterQuorum+" minimum number of nodes that must respond when aggregating the resources of the cluster, the request fails otherwise: all, majority or a number of nodes. Partial responses are accepted when not specified").Envar(EnvKeyClusterQuorum).String()
+	fClusterCacheTTL       = kingpin.Flag("cluster-cache-ttl", EnvKeyClusterCacheTTL+" duration during which the containers, images, volumes and networks of each node are cached when aggregating the resources of the cluster, the cache of a node is invalidated when its resources are modified. Set to 0 to disable the cache (defaults to 5s)").Envar(EnvKeyClusterCacheTTL).Default(agent.DefaultClusterCacheTTL).Duration()
 	fDataPath              = kingpin.Flag("data", EnvKeyDataPath+" path to the data folder").Envar(EnvKeyDataPath).Default(agent.DefaultDataPath).String()
 	fSharedSecret          = kingpin.Flag("secret", EnvKeyAgentSecret+" shared secret used in the signature verification process").Envar(EnvKeyAgentSecret).String()
 	fLogLevel              = kingpin.Flag("log-level", EnvKeyLogLevel+" defines the log output verbosity (default to INFO)").Envar(EnvKeyLogLevel).Default(agent.DefaultLogLevel).Enum("ERROR", "WARN", "INFO", "DEBUG")
@@ -81,16 +143,20 @@ var (
 	fEdgeInsecurePoll      = kingpin.Flag("edge-insecurepoll", EnvKeyEdgeInsecurePoll+" enable this option if you need the agent to poll a HTTPS Portainer instance with self-signed certificates. Disabled by default, set to 1 to enable it").Envar(EnvKeyEdgeInsecurePoll).Bool()
 	fEdgeTunnel            = kingpin.Flag("edge-tunnel", EnvKeyEdgeTunnel+" disable this option if you wish to prevent the agent from opening tunnels over websockets").Envar(EnvKeyEdgeTunnel).Default("true").Bool()
 	fEdgeTunnelHttpProxy   = kingpin.Flag("edge-tunnel-http-proxy", EnvKeyEdgeTunnelHttpProxy+" enable this option if you wish to use a proxy to open tunnels over websockets").Envar(EnvKeyEdgeTunnelHttpProxy).String()
+	fEdgeJobScheduler      = kingpin.Flag("edge-job-scheduler", EnvKeyEdgeJobScheduler+" scheduler used to run the Edge jobs: cron writes the jobs to the cron.d folder of the host, agent runs them inside the agent and keeps the history of the runs, auto uses cron when the host has a cron.d folder (defaults to auto, the Edge jobs are not supported on Windows)").Envar(EnvKeyEdgeJobScheduler).Default(agent.DefaultEdgeJobScheduler).Enum("auto", "cron", "agent")
+	fEdgeFailoverThreshold = kingpin.Flag("edge-failover-threshold", EnvKeyEdgeFailoverThreshold+" number of consecutive poll failures after which the agent fails over to the next Portainer server of the Edge key (default to 3)").Envar(EnvKeyEdgeFailoverThreshold).Default(agent.DefaultEdgeFailoverThreshold).Int()
+	fEdgeFailbackInterval  = kingpin.Flag("edge-failback-interval", EnvKeyEdgeFailbackInterval+" interval used to check if the primary Portainer server of the Edge key is healthy again after a failover (default to 1m)").Envar(EnvKeyEdgeFailbackInterval).Default(agent.DefaultEdgeFailbackInterval).Duration()
 	fEdgeTunnelHttpsProxy  = kingpin.Flag("edge-tunnel-https-proxy", EnvKeyEdgeTunnelHttpsProxy+" enable this option if you wish to use a https proxy to open tunnels over websockets").Envar(EnvKeyEdgeTunnelHttpsProxy).String()
 	fEdgeGroupsIDs         = kingpin.Flag("edge-groups", EnvKeyEdgeGroups+" a colon-separated list of Edge groups identifiers. Used for AEEC, the created environment will be added to these edge groups").Envar(EnvKeyEdgeGroups).String()
 	fEnvironmentGroupID    = kingpin.Flag("environment-group", EnvKeyEnvironmentGroup+" an Environment group identifier. Used for AEEC, the created environment will be associated to this group").Envar(EnvKeyEnvironmentGroup).Int()
 	fTagsIDs               = kingpin.Flag("tags", EnvKeyTags+" a colon-separated list of tags to associate to the environment. Used for AEEC.").Envar(EnvKeyTags).String()
 
 	// mTLS edge agent certs
-	fSSLCert           = kingpin.Flag("mtlscert", "Path to the mTLS certificate used to identify the agent to Portainer").Envar(EnvKeySSLCert).String()
-	fSSLKey            = kingpin.Flag("mtlskey", "Path to the mTLS key used to identify the agent to Portainer").Envar(EnvKeySSLKey).String()
-	fSSLCACert         = kingpin.Flag("mtlscacert", "Path to the mTLS CA certificate used to validate the Portainer server").Envar(EnvKeySSLCACert).String()
-	fCertRetryInterval = kingpin.Flag("certificate-retry-interval", "Interval used to block initialization until the certificate is available").Envar(EnvKeyCertRetryInterval).Duration()
+	fSSLCert            = kingpin.Flag("mtlscert", "Path to the mTLS certificate used to identify the agent to Portainer").Envar(EnvKeySSLCert).String()
+	fSSLKey             = kingpin.Flag("mtlskey", "Path to the mTLS key used to identify the agent to Portainer").Envar(EnvKeySSLKey).String()
+	fSSLCACert          = kingpin.Flag("mtlscacert", "Path to the mTLS CA certificate used to validate the Portainer server").Envar(EnvKeySSLCACert).String()
+	fRevocationHardFail = kingpin.Flag("mtls-revocation-hard-fail", "Reject the Portainer server certificate when its revocation status cannot be checked (CRL or OCSP unavailable and no cached revocation data)").Envar(EnvKeyRevocationHardFail).Bool()
+	fCertRetryInterval  = kingpin.Flag("certificate-retry-interval", "Interval used to block initialization until the certificate is available").Envar(EnvKeyCertRetryInterval).Duration()
 
 	// AWS IAM Roles Anywhere + ECR
 	fAWSClientCert     = kingpin.Flag("aws-cert", "Path to the x509 certificate used to authenticate against IAM Roles Anywhere").Envar(EnvKeyAWSClientCert).Default(agent.DefaultAWSClientCertPath).String()
@@ -132,9 +198,38 @@ func (parser *EnvOptionParser) Options() (*agent.Options, error) {
 		AgentServerAddr:       fAgentServerAddr.String(),
 		AgentServerPort:       strconv.Itoa(*fAgentServerPort),
 		AgentSecurityShutdown: *fAgentSecurityShutdown,
+		SignatureMaxSkew:      *fSignatureMaxSkew,
+		SignatureStrict:       *fSignatureStrict,
+		TLSCert:               *fTLSCert,
+		TLSKey:                *fTLSKey,
+		TLSClientCA:           *fTLSClientCA,
+		TLSRenewBefore:        *fTLSRenewBefore,
+		BrowseArchiveMaxSize:  int64(*fBrowseArchiveMaxSize),
+		BackupRetentionCount:  *fBackupRetentionCount,
+		BackupRetentionMaxAge: *fBackupRetentionMaxAge,
+		BackupS3Endpoint:      *fBackupS3Endpoint,
+		BackupS3Region:        *fBackupS3Region,
+		BackupS3Bucket:        *fBackupS3Bucket,
+		BackupS3AccessKeyID:   *fBackupS3AccessKeyID,
+		BackupS3SecretKey:     *fBackupS3SecretKey,
+		BackupS3Prefix:        *fBackupS3Prefix,
+		BackupS3PathStyle:     *fBackupS3PathStyle,
+		RecordingEnabled:      *fRecordingEnabled,
+		RecordingMaxAge:       *fRecordingMaxAge,
+		RecordingMaxSize:      int64(*fRecordingMaxSize),
+		WebsocketIdleTimeout:  *fWebsocketIdleTimeout,
+		WebsocketMaxDuration:  *fWebsocketMaxDuration,
+		WebsocketMaxSessions:  *fWebsocketMaxSessions,
 		ClusterAddress:        *fClusterAddress,
+		ClusterDiscovery:      *fClusterDiscovery,
+		ClusterAdvertiseAddr:  *fClusterAdvertise,
 		ClusterProbeTimeout:   *fClusterProbeTimeout,
 		ClusterProbeInterval:  *fClusterProbeInterval,
+		ClusterKeyFile:        *fClusterKeyFile,
+		ClusterKeyRollout:     *fClusterKeyRollout,
+		ClusterNodeTimeout:    *fClusterNodeTimeout,
+		ClusterQuorum:         *fClusterQuorum,
+		ClusterCacheTTL:       *fClusterCacheTTL,
 		DataPath:              *fDataPath,
 		EdgeMode:              *fEdgeMode,
 		EdgeAsyncMode:         *fEdgeAsyncMode,
@@ -146,12 +241,16 @@ func (parser *EnvOptionParser) Options() (*agent.Options, error) {
 		EdgeInsecurePoll:      *fEdgeInsecurePoll,
 		EdgeTunnel:            *fEdgeTunnel,
 		EdgeTunnelProxy:       httpProxy,
+		EdgeJobScheduler:      *fEdgeJobScheduler,
+		EdgeFailoverThreshold: *fEdgeFailoverThreshold,
+		EdgeFailbackInterval:  *fEdgeFailbackInterval,
 		LogLevel:              *fLogLevel,
 		LogMode:               *fLogMode,
 		SharedSecret:          *fSharedSecret,
 		SSLCert:               *fSSLCert,
 		SSLKey:                *fSSLKey,
 		SSLCACert:             *fSSLCACert,
+		RevocationHardFail:    *fRevocationHardFail,
 		CertRetryInterval:     *fCertRetryInterval,
 		AWSClientCert:         *fAWSClientCert,
 		AWSClientKey:          *fAWSClientKey,
@@ -0,0 +1,138 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	eventOutput = "o"
+	eventInput  = "i"
+	eventResize = "r"
+)
+
+// header is the first line of an asciinema v2 recording
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes the events of a terminal session to an asciinema v2 recording.
+// A nil Recorder is valid and records nothing, so that the callers do not need to check whether recording is enabled.
+type Recorder struct {
+	service *Service
+	session Session
+	file    *os.File
+	maxSize int64
+	start   time.Time
+	mu      sync.Mutex
+	closed  bool
+}
+
+// Input records the data sent by the operator to the process
+func (recorder *Recorder) Input(data []byte) {
+	recorder.writeEvent(eventInput, string(data))
+}
+
+// Output records the data written by the process to the terminal
+func (recorder *Recorder) Output(data []byte) {
+	recorder.writeEvent(eventOutput, string(data))
+}
+
+// Resize records a change of the size of the terminal
+func (recorder *Recorder) Resize(width, height uint) {
+	recorder.writeEvent(eventResize, fmt.Sprintf("%dx%d", width, height))
+}
+
+// Close ends the recording and stores the final details of the session
+func (recorder *Recorder) Close() {
+	if recorder == nil {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.closed {
+		return
+	}
+	recorder.closed = true
+
+	err := recorder.file.Close()
+	if err != nil {
+		log.Warn().Err(err).Str("recording_id", recorder.session.ID).Msg("unable to close session recording")
+	}
+
+	recorder.session.EndedAt = time.Now().Unix()
+
+	err = recorder.service.save(&recorder.session)
+	if err != nil {
+		log.Warn().Err(err).Str("recording_id", recorder.session.ID).Msg("unable to save session recording details")
+	}
+
+	recorder.service.setActive(recorder.session.ID, false)
+}
+
+func (recorder *Recorder) writeHeader(width, height int) error {
+	data, err := json.Marshal(header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: recorder.start.Unix(),
+		Title:     recorder.session.Command,
+		Env:       map[string]string{"TERM": "xterm"},
+	})
+	if err != nil {
+		return err
+	}
+
+	return recorder.write(append(data, '\n'))
+}
+
+func (recorder *Recorder) writeEvent(eventType, data string) {
+	if recorder == nil || len(data) == 0 {
+		return
+	}
+
+	// The invalid UTF-8 sequences are replaced by the JSON encoder
+	line, err := json.Marshal([]any{time.Since(recorder.start).Seconds(), eventType, data})
+	if err != nil {
+		return
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.closed || recorder.session.Truncated {
+		return
+	}
+
+	if recorder.maxSize > 0 && recorder.session.Size+int64(len(line))+1 > recorder.maxSize {
+		recorder.session.Truncated = true
+
+		log.Warn().Str("recording_id", recorder.session.ID).Msg("session recording reached its maximum size, the rest of the session is not recorded")
+
+		return
+	}
+
+	err = recorder.write(append(line, '\n'))
+	if err != nil {
+		log.Warn().Err(err).Str("recording_id", recorder.session.ID).Msg("unable to write session recording")
+	}
+}
+
+func (recorder *Recorder) write(data []byte) error {
+	n, err := recorder.file.Write(data)
+	recorder.session.Size += int64(n)
+
+	return err
+}
@@ -0,0 +1,300 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent/identifier"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// RecordingsDirectory is the folder inside the agent data folder where the session recordings are stored
+	RecordingsDirectory = "recordings"
+
+	defaultTerminalWidth  = 80
+	defaultTerminalHeight = 24
+)
+
+// ErrRecordingNotFound is returned when a recording does not exist
+var ErrRecordingNotFound = errors.New("recording not found")
+
+// ErrRecordingActive is returned when removing the recording of a session that is still in progress
+var ErrRecordingActive = errors.New("the session is still being recorded")
+
+// Session contains the details of a recorded terminal session
+type Session struct {
+	ID string `json:"ID"`
+	// Type is the type of the session: exec, attach or pod
+	Type string `json:"Type"`
+	// Target identifies the recorded process: the exec instance, the container or the pod container
+	Target string `json:"Target"`
+	// Command is the command executed in the session, when known
+	Command    string `json:"Command,omitempty"`
+	RemoteAddr string `json:"RemoteAddr"`
+	StartedAt  int64  `json:"StartedAt"`
+	// EndedAt is 0 while the session is in progress
+	EndedAt int64 `json:"EndedAt"`
+	Size    int64 `json:"Size"`
+	// Truncated is true when the recording reached its maximum size, the rest of the session was not recorded
+	Truncated bool `json:"Truncated"`
+}
+
+// Config is the configuration of the recording service
+type Config struct {
+	DataPath string
+	// MaxAge is the duration after which the recordings are removed, no limit when 0
+	MaxAge time.Duration
+	// MaxSize is the maximum size of a recording in bytes, no limit when 0
+	MaxSize int64
+}
+
+// Service is used to record the terminal sessions opened through the websockets of the agent.
+// The recordings are stored in the asciinema v2 format inside the agent data folder.
+type Service struct {
+	directory string
+	maxAge    time.Duration
+	maxSize   int64
+	mu        sync.Mutex
+	// active contains the identifiers of the sessions being recorded, their recordings cannot be removed
+	active map[string]struct{}
+}
+
+// NewService returns a pointer to a Service
+func NewService(config Config) *Service {
+	return &Service{
+		directory: filepath.Join(config.DataPath, RecordingsDirectory),
+		maxAge:    config.MaxAge,
+		maxSize:   config.MaxSize,
+		active:    make(map[string]struct{}),
+	}
+}
+
+// Start starts the recording of a terminal session, the returned Recorder must be closed when the session ends
+func (service *Service) Start(session Session) (*Recorder, error) {
+	err := os.MkdirAll(service.directory, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	service.removeExpiredRecordings()
+
+	session.ID, err = identifier.New()
+	if err != nil {
+		return nil, err
+	}
+
+	session.StartedAt = time.Now().Unix()
+
+	file, err := os.OpenFile(service.castPath(session.ID), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &Recorder{
+		service: service,
+		session: session,
+		file:    file,
+		maxSize: service.maxSize,
+		start:   time.Now(),
+	}
+
+	service.setActive(session.ID, true)
+
+	err = recorder.writeHeader(defaultTerminalWidth, defaultTerminalHeight)
+	if err == nil {
+		err = service.save(&recorder.session)
+	}
+
+	if err != nil {
+		file.Close()
+		service.setActive(session.ID, false)
+		service.remove(session.ID)
+
+		return nil, err
+	}
+
+	log.Debug().Str("recording_id", session.ID).Str("type", session.Type).Str("target", session.Target).Msg("recording terminal session")
+
+	return recorder, nil
+}
+
+// List returns the recorded sessions, the most recent first
+func (service *Service) List() ([]Session, error) {
+	metadataFiles, err := filepath.Glob(filepath.Join(service.directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(metadataFiles))
+
+	for _, metadataFile := range metadataFiles {
+		session, err := service.load(strings.TrimSuffix(filepath.Base(metadataFile), ".json"))
+		if err != nil {
+			log.Warn().Err(err).Str("file", metadataFile).Msg("unable to read recording metadata")
+			continue
+		}
+
+		sessions = append(sessions, *session)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt > sessions[j].StartedAt
+	})
+
+	return sessions, nil
+}
+
+// Get returns a recorded session
+func (service *Service) Get(id string) (*Session, error) {
+	return service.load(id)
+}
+
+// Open returns the asciinema v2 recording of a session, the caller must close it
+func (service *Service) Open(id string) (*os.File, *Session, error) {
+	session, err := service.load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(service.castPath(id))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrRecordingNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	return file, session, nil
+}
+
+// Delete removes a recording, the recordings of the sessions in progress cannot be removed
+func (service *Service) Delete(id string) error {
+	if _, err := service.load(id); err != nil {
+		return err
+	}
+
+	if service.isActive(id) {
+		return ErrRecordingActive
+	}
+
+	service.remove(id)
+
+	return nil
+}
+
+// removeExpiredRecordings removes the recordings of the sessions that ended more than MaxAge ago
+func (service *Service) removeExpiredRecordings() {
+	if service.maxAge <= 0 {
+		return
+	}
+
+	sessions, err := service.List()
+	if err != nil {
+		return
+	}
+
+	for _, session := range sessions {
+		if service.isActive(session.ID) {
+			continue
+		}
+
+		endedAt := time.Unix(session.EndedAt, 0)
+
+		// The sessions interrupted by a restart of the agent are never ended, the last write is used instead
+		if session.EndedAt == 0 {
+			info, err := os.Stat(service.castPath(session.ID))
+			if err != nil {
+				continue
+			}
+
+			endedAt = info.ModTime()
+		}
+
+		if time.Since(endedAt) < service.maxAge {
+			continue
+		}
+
+		log.Info().Str("recording_id", session.ID).Msg("removing expired session recording")
+
+		service.remove(session.ID)
+	}
+}
+
+func (service *Service) setActive(id string, active bool) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if active {
+		service.active[id] = struct{}{}
+	} else {
+		delete(service.active, id)
+	}
+}
+
+func (service *Service) isActive(id string) bool {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	_, ok := service.active[id]
+
+	return ok
+}
+
+func (service *Service) save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	return os.WriteFile(service.metadataPath(session.ID), data, 0600)
+}
+
+func (service *Service) load(id string) (*Session, error) {
+	if !identifier.IsValid(id) {
+		return nil, ErrRecordingNotFound
+	}
+
+	service.mu.Lock()
+	data, err := os.ReadFile(service.metadataPath(id))
+	service.mu.Unlock()
+
+	if os.IsNotExist(err) {
+		return nil, ErrRecordingNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (service *Service) remove(id string) {
+	os.Remove(service.castPath(id))
+
+	service.mu.Lock()
+	os.Remove(service.metadataPath(id))
+	service.mu.Unlock()
+}
+
+func (service *Service) metadataPath(id string) string {
+	return filepath.Join(service.directory, id+".json")
+}
+
+func (service *Service) castPath(id string) string {
+	return filepath.Join(service.directory, id+".cast")
+}
@@ -0,0 +1,168 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readRecording(t *testing.T, service *Service, id string) []string {
+	file, _, err := service.Open(id)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var lines []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+
+	return lines
+}
+
+func TestRecordSession(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir()})
+
+	recorder, err := service.Start(Session{Type: "exec", Target: "exec-id", Command: "sh"})
+	require.NoError(t, err)
+
+	recorder.Input([]byte("ls\r"))
+	recorder.Output([]byte("file\r\n"))
+	recorder.Close()
+	recorder.Output([]byte("ignored"))
+
+	sessions, err := service.List()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	session := sessions[0]
+	require.Equal(t, "exec", session.Type)
+	require.NotZero(t, session.EndedAt)
+	require.False(t, session.Truncated)
+
+	lines := readRecording(t, service, session.ID)
+	require.Len(t, lines, 3)
+
+	var h header
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &h))
+	require.Equal(t, 2, h.Version)
+	require.Equal(t, "sh", h.Title)
+
+	var event []any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, eventInput, event[1])
+	require.Equal(t, "ls\r", event[2])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+	require.Equal(t, eventOutput, event[1])
+	require.Equal(t, "file\r\n", event[2])
+
+	info, err := os.Stat(service.castPath(session.ID))
+	require.NoError(t, err)
+	require.Equal(t, info.Size(), session.Size)
+
+	require.NoError(t, service.Delete(session.ID))
+
+	_, err = service.Get(session.ID)
+	require.ErrorIs(t, err, ErrRecordingNotFound)
+}
+
+func TestRecordSessionMaxSize(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir(), MaxSize: 512})
+
+	recorder, err := service.Start(Session{Type: "attach", Target: "container"})
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		recorder.Output([]byte("output"))
+	}
+	recorder.Close()
+
+	session, err := service.Get(recorder.session.ID)
+	require.NoError(t, err)
+	require.True(t, session.Truncated)
+	require.LessOrEqual(t, session.Size, int64(512))
+}
+
+func TestRecordingRetention(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir(), MaxAge: time.Hour})
+
+	recorder, err := service.Start(Session{Type: "exec"})
+	require.NoError(t, err)
+	recorder.Close()
+
+	expired := recorder.session
+	expired.EndedAt = time.Now().Add(-2 * time.Hour).Unix()
+	require.NoError(t, service.save(&expired))
+
+	current, err := service.Start(Session{Type: "exec"})
+	require.NoError(t, err)
+	defer current.Close()
+
+	_, err = service.Get(expired.ID)
+	require.ErrorIs(t, err, ErrRecordingNotFound)
+
+	_, err = service.Get(current.session.ID)
+	require.NoError(t, err)
+}
+
+func TestActiveRecordingIsKept(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir(), MaxAge: time.Hour})
+
+	recorder, err := service.Start(Session{Type: "exec"})
+	require.NoError(t, err)
+
+	// An idle session is not expired while it is in progress
+	lastWrite := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(service.castPath(recorder.session.ID), lastWrite, lastWrite))
+	service.removeExpiredRecordings()
+
+	err = service.Delete(recorder.session.ID)
+	require.ErrorIs(t, err, ErrRecordingActive)
+
+	recorder.Close()
+
+	require.NoError(t, service.Delete(recorder.session.ID))
+
+	_, err = service.Get(recorder.session.ID)
+	require.ErrorIs(t, err, ErrRecordingNotFound)
+}
+
+func TestNilRecorder(t *testing.T) {
+	var recorder *Recorder
+
+	recorder.Input([]byte("input"))
+	recorder.Output([]byte("output"))
+	recorder.Close()
+}
+
+func TestInvalidRecordingID(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir()})
+
+	_, _, err := service.Open("../../etc/passwd")
+	require.ErrorIs(t, err, ErrRecordingNotFound)
+}
+
+func TestRecordResize(t *testing.T) {
+	service := NewService(Config{DataPath: t.TempDir()})
+
+	recorder, err := service.Start(Session{Type: "pod"})
+	require.NoError(t, err)
+
+	recorder.Resize(120, 40)
+	recorder.Close()
+
+	lines := readRecording(t, service, recorder.session.ID)
+	require.Len(t, lines, 2)
+
+	var event []any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	require.Equal(t, eventResize, event[1])
+	require.Equal(t, "120x40", event[2])
+}
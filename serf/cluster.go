@@ -1,13 +1,18 @@
 package serf
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/portainer/agent"
 
 	"github.com/hashicorp/logutils"
+	"github.com/hashicorp/memberlist"
 	"github.com/hashicorp/serf/serf"
 	"github.com/rs/zerolog/log"
 )
@@ -19,11 +24,18 @@ const (
 	memberTagKeyNodeRole     = "DockerNodeRole"
 	memberTagKeyEngineStatus = "DockerEngineStatus"
 	memberTagKeyEdgeKeySet   = "EdgeKeySet"
+	memberTagKeyVersion      = "AgentVersion"
+	memberTagKeyPlatform     = "Platform"
+	memberTagKeyDockerNodeID = "DockerNodeID"
 
 	memberTagValueEngineStatusSwarm      = "swarm"
 	memberTagValueEngineStatusStandalone = "standalone"
 	memberTagValueNodeRoleManager        = "manager"
 	memberTagValueNodeRoleWorker         = "worker"
+
+	eventChannelSize = 256
+	// userEventSizeLimit is the maximum size of the name and payload of a cluster event
+	userEventSizeLimit = 1024
 )
 
 // ClusterService is a service used to manage cluster related actions such as joining
@@ -31,17 +43,53 @@ const (
 type ClusterService struct {
 	runtimeConfiguration *agent.RuntimeConfig
 	cluster              *serf.Serf
+	security             SecurityConfig
+	validator            *memberValidator
+	health               *memberHealth
+	probeInterval        time.Duration
+	probeTimeout         time.Duration
+	stop                 context.CancelFunc
+	eventHandlers        map[string][]func(payload []byte)
+	mu                   sync.Mutex
+}
+
+// SecurityConfig is the configuration used to secure the gossip between the agents
+type SecurityConfig struct {
+	// Keys are the keys used to encrypt and authenticate the gossip, the first key being the primary key.
+	// The gossip is neither encrypted nor authenticated when no key is specified.
+	Keys [][]byte
+	// KeyFile is the file the keys were read from, the keys are rotated when it is modified
+	KeyFile string
+	// KeyRollout is the stage of the encryption of the gossip, see the ClusterKeyRollout constants.
+	// The unencrypted gossip is only rejected with ClusterKeyRolloutEnforce, the gossip is sent unencrypted when not specified.
+	KeyRollout string
+	// Topology is used to reject the members that conflict with what Docker reports about the tasks of the agent
+	// service, the members are not validated when not specified
+	Topology TopologyFunc
 }
 
 // NewClusterService returns a pointer to a ClusterService.
-func NewClusterService(runtimeConfiguration *agent.RuntimeConfig) *ClusterService {
-	return &ClusterService{
+func NewClusterService(runtimeConfiguration *agent.RuntimeConfig, security SecurityConfig) *ClusterService {
+	service := &ClusterService{
 		runtimeConfiguration: runtimeConfiguration,
+		security:             security,
+		health:               newMemberHealth(),
+		eventHandlers:        make(map[string][]func(payload []byte)),
+	}
+
+	if security.Topology != nil {
+		service.validator = newMemberValidator(security.Topology)
 	}
+
+	return service
 }
 
 // Leave leaves the cluster.
 func (service *ClusterService) Leave() {
+	if service.stop != nil {
+		service.stop()
+	}
+
 	if service.cluster != nil {
 		service.cluster.Leave()
 	}
@@ -72,10 +120,43 @@ func (service *ClusterService) Create(advertiseAddr string, joinAddr []string, p
 	conf.MemberlistConfig.ProbeTimeout = probeTimeout
 	conf.MemberlistConfig.ProbeInterval = probeInterval
 
+	service.probeInterval = probeInterval
+	service.probeTimeout = probeTimeout
+
 	// Override default Serf configuration with Swarm/overlay sane defaults
 	conf.ReconnectInterval = 10 * time.Second
 	conf.ReconnectTimeout = 1 * time.Minute
 
+	// The key rotation events carry public keys and signatures which do not fit in the default limit
+	conf.UserEventSizeLimit = userEventSizeLimit
+
+	if len(service.security.Keys) > 0 {
+		keyring, err := memberlist.NewKeyring(service.security.Keys, service.security.Keys[0])
+		if err != nil {
+			return err
+		}
+
+		conf.MemberlistConfig.Keyring = keyring
+
+		// The encryption is enabled on a running cluster in two stages, so that the agents can still talk
+		// to the agents that were not redeployed yet. The unencrypted gossip is only rejected when enforce is set.
+		if service.security.KeyRollout != agent.ClusterKeyRolloutEnforce {
+			conf.MemberlistConfig.GossipVerifyIncoming = false
+			conf.MemberlistConfig.GossipVerifyOutgoing = service.security.KeyRollout == agent.ClusterKeyRolloutEncrypt
+		}
+
+		if !conf.MemberlistConfig.GossipVerifyIncoming {
+			log.Warn().Str("stage", service.security.KeyRollout).Msg("the agent cluster accepts unencrypted gossip, set AGENT_CLUSTER_KEY_ROLLOUT to enforce once all the agents encrypt their gossip")
+		}
+	} else {
+		log.Warn().Msg("the agent cluster gossip is not encrypted, specify AGENT_SECRET or a gossip key file to encrypt it")
+	}
+
+	eventCh := make(chan serf.Event, eventChannelSize)
+	conf.EventCh = eventCh
+
+	go service.dispatchEvents(eventCh)
+
 	log.Debug().Str("advertise_address", advertiseAddr).Strs("join_address", joinAddr).Msg("")
 
 	cluster, err := serf.Create(conf)
@@ -92,6 +173,15 @@ func (service *ClusterService) Create(advertiseAddr string, joinAddr []string, p
 
 	service.cluster = cluster
 
+	ctx, cancel := context.WithCancel(context.Background())
+	service.stop = cancel
+
+	go service.observeMembers(ctx)
+
+	if service.security.KeyFile != "" {
+		go service.watchKeyFile(ctx, service.security.KeyFile)
+	}
+
 	return nil
 }
 
@@ -103,23 +193,82 @@ func (service *ClusterService) Members() []agent.ClusterMember {
 
 	for _, member := range members {
 		if member.Status == serf.StatusAlive {
-			clusterMember := agent.ClusterMember{
-				IPAddress:  member.Addr.String(),
-				Port:       member.Tags[memberTagKeyAgentPort],
-				NodeRole:   member.Tags[memberTagKeyNodeRole],
-				NodeName:   member.Tags[memberTagKeyNodeName],
-				EdgeKeySet: false,
-			}
-
-			if _, ok := member.Tags[memberTagKeyEdgeKeySet]; ok {
-				clusterMember.EdgeKeySet = true
-			}
-
-			clusterMembers = append(clusterMembers, clusterMember)
+			clusterMembers = append(clusterMembers, convertMemberToClusterMember(member))
+		}
+	}
+
+	return service.validator.filter(clusterMembers, true)
+}
+
+// MemberDetails returns every known member of the cluster along with its health, including the members
+// that left or failed. The members rejected by the validation of the cluster members are not returned.
+func (service *ClusterService) MemberDetails() []agent.ClusterMemberDetails {
+	members := service.cluster.Members()
+
+	// Only the alive members must be unique per node, the members of the previous agents of a node may still be known
+	clusterMembers := make([]agent.ClusterMember, 0, len(members))
+	aliveMembers := make([]agent.ClusterMember, 0, len(members))
+	otherMembers := make([]agent.ClusterMember, 0, len(members))
+	for _, member := range members {
+		clusterMember := convertMemberToClusterMember(member)
+		clusterMembers = append(clusterMembers, clusterMember)
+
+		if member.Status == serf.StatusAlive {
+			aliveMembers = append(aliveMembers, clusterMember)
+		} else {
+			otherMembers = append(otherMembers, clusterMember)
+		}
+	}
+
+	validMembers := make(map[agent.ClusterMember]bool, len(members))
+	for _, clusterMember := range service.validator.filter(aliveMembers, true) {
+		validMembers[clusterMember] = true
+	}
+
+	for _, clusterMember := range service.validator.filter(otherMembers, false) {
+		validMembers[clusterMember] = true
+	}
+
+	localCoordinate, _ := service.cluster.GetCoordinate()
+	// Each member is probed by the local agent once per round of probes, a member that was not reached
+	// during two rounds is suspect
+	suspectTimeout := 2*time.Duration(len(members))*service.probeInterval + service.probeTimeout
+	now := time.Now()
+
+	details := make([]agent.ClusterMemberDetails, 0, len(members))
+
+	for i, member := range members {
+		if !validMembers[clusterMembers[i]] {
+			continue
+		}
+
+		lastSeen := service.health.lastSeen(member.Name)
+
+		memberDetails := agent.ClusterMemberDetails{
+			ClusterMember: clusterMembers[i],
+			Status:        memberStatus(member.Status, lastSeen, now, suspectTimeout),
+			AgentVersion:  member.Tags[memberTagKeyVersion],
+			Platform:      member.Tags[memberTagKeyPlatform],
+			DockerNodeID:  member.Tags[memberTagKeyDockerNodeID],
+		}
+
+		if !lastSeen.IsZero() {
+			memberDetails.LastSeen = lastSeen.Unix()
+		}
+
+		if coord, ok := service.cluster.GetCachedCoordinate(member.Name); ok && localCoordinate != nil && member.Name != service.cluster.LocalMember().Name {
+			memberDetails.Latency = float64(localCoordinate.DistanceTo(coord).Microseconds()) / 1000
 		}
+
+		details = append(details, memberDetails)
 	}
 
-	return clusterMembers
+	return details
+}
+
+// MemberEvents returns the last membership transitions observed by the local agent, the oldest first
+func (service *ClusterService) MemberEvents() []agent.ClusterMemberEvent {
+	return service.health.history()
 }
 
 // GetMemberByRole will return the first member with the specified role.
@@ -172,11 +321,69 @@ func (service *ClusterService) UpdateRuntimeConfiguration(runtimeConfiguration *
 	return service.cluster.SetTags(tagsMap)
 }
 
+// BroadcastEvent sends an event to every member of the cluster, including the local agent
+func (service *ClusterService) BroadcastEvent(name string, payload []byte) error {
+	if service.cluster == nil {
+		return errors.New("the agent is not part of a cluster")
+	}
+
+	return service.cluster.UserEvent(name, payload, false)
+}
+
+// SubscribeEvents registers a handler called with the payload of each event named name.
+// The handlers are called sequentially and must not block.
+func (service *ClusterService) SubscribeEvents(name string, handler func(payload []byte)) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	service.eventHandlers[name] = append(service.eventHandlers[name], handler)
+}
+
+// dispatchEvents calls the handlers of the user events received from the cluster
+func (service *ClusterService) dispatchEvents(eventCh <-chan serf.Event) {
+	for event := range eventCh {
+		if memberEvent, ok := event.(serf.MemberEvent); ok {
+			service.health.recordEvent(memberEvent, time.Now())
+
+			continue
+		}
+
+		userEvent, ok := event.(serf.UserEvent)
+		if !ok {
+			continue
+		}
+
+		service.mu.Lock()
+		handlers := service.eventHandlers[userEvent.Name]
+		service.mu.Unlock()
+
+		for _, handler := range handlers {
+			handler(userEvent.Payload)
+		}
+	}
+}
+
 // GetRuntimeConfiguration returns the runtimeConfiguration associated to the service
 func (service *ClusterService) GetRuntimeConfiguration() *agent.RuntimeConfig {
 	return service.runtimeConfiguration
 }
 
+func convertMemberToClusterMember(member serf.Member) agent.ClusterMember {
+	clusterMember := agent.ClusterMember{
+		IPAddress:  member.Addr.String(),
+		Port:       member.Tags[memberTagKeyAgentPort],
+		NodeRole:   member.Tags[memberTagKeyNodeRole],
+		NodeName:   member.Tags[memberTagKeyNodeName],
+		EdgeKeySet: false,
+	}
+
+	if _, ok := member.Tags[memberTagKeyEdgeKeySet]; ok {
+		clusterMember.EdgeKeySet = true
+	}
+
+	return clusterMember
+}
+
 func convertRuntimeConfigurationToTagMap(runtimeConfiguration *agent.RuntimeConfig) map[string]string {
 	tagsMap := map[string]string{}
 
@@ -196,6 +403,12 @@ func convertRuntimeConfigurationToTagMap(runtimeConfiguration *agent.RuntimeConf
 	}
 
 	tagsMap[memberTagKeyNodeName] = runtimeConfiguration.NodeName
+	tagsMap[memberTagKeyVersion] = agent.Version
+	tagsMap[memberTagKeyPlatform] = runtime.GOOS + "/" + runtime.GOARCH
+
+	if runtimeConfiguration.DockerConfig.NodeID != "" {
+		tagsMap[memberTagKeyDockerNodeID] = runtimeConfiguration.DockerConfig.NodeID
+	}
 
 	tagsMap[memberTagKeyNodeRole] = memberTagValueNodeRoleManager
 	if runtimeConfiguration.DockerConfig.NodeRole == agent.NodeRoleWorker {
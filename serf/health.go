@@ -0,0 +1,182 @@
+package serf
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/hashicorp/serf/coordinate"
+	"github.com/hashicorp/serf/serf"
+)
+
+const (
+	// memberEventsHistorySize is the number of membership transitions kept by the agent
+	memberEventsHistorySize = 100
+	// memberObservationInterval is the interval used to check which members were reached by the local agent
+	memberObservationInterval = time.Second
+)
+
+// memberObservation is what the local agent knows about the reachability of a member
+type memberObservation struct {
+	// coordinate is the last network coordinate received from the member, serf receives a new coordinate
+	// every time the member answers a direct probe of the local agent
+	coordinate *coordinate.Coordinate
+	lastSeen   time.Time
+}
+
+// memberHealth keeps the reachability of the members and the membership transitions observed by the local agent
+type memberHealth struct {
+	observations map[string]*memberObservation
+	events       []agent.ClusterMemberEvent
+	mu           sync.Mutex
+}
+
+func newMemberHealth() *memberHealth {
+	return &memberHealth{
+		observations: make(map[string]*memberObservation),
+	}
+}
+
+// recordEvent records the membership transitions of a serf member event
+func (health *memberHealth) recordEvent(event serf.MemberEvent, now time.Time) {
+	eventType := memberEventType(event.Type)
+	if eventType == "" {
+		return
+	}
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	for _, member := range event.Members {
+		health.events = append(health.events, agent.ClusterMemberEvent{
+			Type:      eventType,
+			NodeName:  member.Tags[memberTagKeyNodeName],
+			IPAddress: member.Addr.String(),
+			Time:      now.Unix(),
+		})
+
+		switch event.Type {
+		case serf.EventMemberJoin, serf.EventMemberUpdate:
+			health.seen(member.Name, nil, now)
+		case serf.EventMemberReap:
+			delete(health.observations, member.Name)
+		}
+	}
+
+	if len(health.events) > memberEventsHistorySize {
+		health.events = append([]agent.ClusterMemberEvent{}, health.events[len(health.events)-memberEventsHistorySize:]...)
+	}
+}
+
+// observe updates the last time each alive member was reached, a member is reached when a new coordinate
+// is received from it
+func (health *memberHealth) observe(cluster *serf.Serf, now time.Time) {
+	localName := cluster.LocalMember().Name
+
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	for _, member := range cluster.Members() {
+		if member.Status != serf.StatusAlive {
+			continue
+		}
+
+		if member.Name == localName {
+			health.seen(member.Name, nil, now)
+
+			continue
+		}
+
+		coord, _ := cluster.GetCachedCoordinate(member.Name)
+
+		observation, ok := health.observations[member.Name]
+		if !ok || (coord != nil && coord != observation.coordinate) {
+			health.seen(member.Name, coord, now)
+		}
+	}
+}
+
+func (health *memberHealth) seen(name string, coord *coordinate.Coordinate, now time.Time) {
+	observation, ok := health.observations[name]
+	if !ok {
+		observation = &memberObservation{}
+		health.observations[name] = observation
+	}
+
+	if coord != nil {
+		observation.coordinate = coord
+	}
+
+	observation.lastSeen = now
+}
+
+func (health *memberHealth) lastSeen(name string) time.Time {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	if observation, ok := health.observations[name]; ok {
+		return observation.lastSeen
+	}
+
+	return time.Time{}
+}
+
+func (health *memberHealth) history() []agent.ClusterMemberEvent {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	return append([]agent.ClusterMemberEvent{}, health.events...)
+}
+
+// observeMembers observes the reachability of the members until the context is done
+func (service *ClusterService) observeMembers(ctx context.Context) {
+	ticker := time.NewTicker(memberObservationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			service.health.observe(service.cluster, now)
+		}
+	}
+}
+
+// memberStatus returns the status of a member, an alive member is suspect when it was not reached
+// during suspectTimeout
+func memberStatus(status serf.MemberStatus, lastSeen time.Time, now time.Time, suspectTimeout time.Duration) string {
+	switch status {
+	case serf.StatusAlive:
+		if !lastSeen.IsZero() && now.Sub(lastSeen) > suspectTimeout {
+			return agent.ClusterMemberStatusSuspect
+		}
+
+		return agent.ClusterMemberStatusAlive
+	case serf.StatusLeaving:
+		return agent.ClusterMemberStatusLeaving
+	case serf.StatusLeft:
+		return agent.ClusterMemberStatusLeft
+	default:
+		return agent.ClusterMemberStatusFailed
+	}
+}
+
+func memberEventType(eventType serf.EventType) string {
+	switch eventType {
+	case serf.EventMemberJoin:
+		return agent.ClusterMemberEventJoin
+	case serf.EventMemberLeave:
+		return agent.ClusterMemberEventLeave
+	case serf.EventMemberFailed:
+		return agent.ClusterMemberEventFail
+	case serf.EventMemberUpdate:
+		return agent.ClusterMemberEventUpdate
+	case serf.EventMemberReap:
+		return agent.ClusterMemberEventReap
+	}
+
+	return ""
+}
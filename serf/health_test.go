@@ -0,0 +1,66 @@
+package serf
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/hashicorp/serf/serf"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMemberEvent(eventType serf.EventType, name string) serf.MemberEvent {
+	return serf.MemberEvent{
+		Type: eventType,
+		Members: []serf.Member{{
+			Name: name + "-serf",
+			Addr: net.ParseIP("10.0.0.1"),
+			Tags: map[string]string{memberTagKeyNodeName: name},
+		}},
+	}
+}
+
+func TestMemberHealthRecordsTransitions(t *testing.T) {
+	health := newMemberHealth()
+	now := time.Unix(1700000000, 0)
+
+	health.recordEvent(newTestMemberEvent(serf.EventMemberJoin, "node1"), now)
+	health.recordEvent(newTestMemberEvent(serf.EventMemberFailed, "node1"), now.Add(time.Minute))
+	health.recordEvent(serf.MemberEvent{Type: serf.EventUser}, now)
+
+	require.Equal(t, []agent.ClusterMemberEvent{
+		{Type: agent.ClusterMemberEventJoin, NodeName: "node1", IPAddress: "10.0.0.1", Time: now.Unix()},
+		{Type: agent.ClusterMemberEventFail, NodeName: "node1", IPAddress: "10.0.0.1", Time: now.Add(time.Minute).Unix()},
+	}, health.history())
+
+	// A failed member keeps the last time it was reached
+	require.Equal(t, now, health.lastSeen("node1-serf"))
+
+	health.recordEvent(newTestMemberEvent(serf.EventMemberReap, "node1"), now.Add(time.Hour))
+	require.True(t, health.lastSeen("node1-serf").IsZero())
+}
+
+func TestMemberHealthHistorySize(t *testing.T) {
+	health := newMemberHealth()
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < memberEventsHistorySize+10; i++ {
+		health.recordEvent(newTestMemberEvent(serf.EventMemberUpdate, "node1"), now.Add(time.Duration(i)*time.Second))
+	}
+
+	history := health.history()
+	require.Len(t, history, memberEventsHistorySize)
+	require.Equal(t, now.Add(10*time.Second).Unix(), history[0].Time)
+}
+
+func TestMemberStatus(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	require.Equal(t, agent.ClusterMemberStatusAlive, memberStatus(serf.StatusAlive, now.Add(-time.Second), now, 5*time.Second))
+	require.Equal(t, agent.ClusterMemberStatusAlive, memberStatus(serf.StatusAlive, time.Time{}, now, 5*time.Second))
+	require.Equal(t, agent.ClusterMemberStatusSuspect, memberStatus(serf.StatusAlive, now.Add(-time.Minute), now, 5*time.Second))
+	require.Equal(t, agent.ClusterMemberStatusLeft, memberStatus(serf.StatusLeft, now, now, 5*time.Second))
+	require.Equal(t, agent.ClusterMemberStatusFailed, memberStatus(serf.StatusFailed, now, now, 5*time.Second))
+}
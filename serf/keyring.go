@@ -0,0 +1,194 @@
+package serf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/serf/serf"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// keyFileCheckInterval is the interval used to check if the gossip key file was modified
+	keyFileCheckInterval = 30 * time.Second
+	// secretKeyDerivationLabel is used to derive the gossip key from the shared secret,
+	// so that the key cannot be used to sign requests sent to the agents
+	secretKeyDerivationLabel = "portainer-agent-gossip-encryption"
+)
+
+// GossipKeys returns the keys used to encrypt the gossip between the agents, the first key being the primary key.
+// The keys are read from keyFile when specified, otherwise a key is derived from the shared secret.
+// No key is returned when neither are specified, the gossip is not encrypted in that case.
+func GossipKeys(keyFile, sharedSecret string) ([][]byte, error) {
+	if keyFile != "" {
+		return readKeyFile(keyFile)
+	}
+
+	if sharedSecret != "" {
+		return [][]byte{deriveKey(sharedSecret)}, nil
+	}
+
+	return nil, nil
+}
+
+// readKeyFile reads a file containing base64 encoded keys of 16, 24 or 32 bytes, one per line.
+// The first key is the primary key used to encrypt the messages, the others are only used to decrypt them.
+// Empty lines and lines starting with # are ignored.
+func readKeyFile(keyFile string) ([][]byte, error) {
+	content, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gossip key on line %q: %w", line, err)
+		}
+
+		if err := memberlist.ValidateKey(key); err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("the gossip key file does not contain any key")
+	}
+
+	return keys, nil
+}
+
+func deriveKey(sharedSecret string) []byte {
+	mac := hmac.New(sha256.New, []byte(sharedSecret))
+	mac.Write([]byte(secretKeyDerivationLabel))
+
+	return mac.Sum(nil)
+}
+
+// watchKeyFile rotates the keys of the cluster when the key file is modified, until the context is done
+func (service *ClusterService) watchKeyFile(ctx context.Context, keyFile string) {
+	stat, err := os.Stat(keyFile)
+	if err != nil {
+		log.Warn().Err(err).Str("key_file", keyFile).Msg("unable to watch the gossip key file")
+
+		return
+	}
+
+	modTime := stat.ModTime()
+
+	ticker := time.NewTicker(keyFileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stat, err := os.Stat(keyFile)
+		if err != nil || stat.ModTime().Equal(modTime) {
+			continue
+		}
+
+		modTime = stat.ModTime()
+
+		keys, err := readKeyFile(keyFile)
+		if err != nil {
+			log.Error().Err(err).Str("key_file", keyFile).Msg("unable to read the gossip key file, keeping the current keys")
+
+			continue
+		}
+
+		if err := service.RotateKeys(keys); err != nil {
+			log.Error().Err(err).Msg("unable to rotate the gossip keys")
+
+			continue
+		}
+
+		log.Info().Int("key_count", len(keys)).Msg("gossip keys rotated")
+	}
+}
+
+// RotateKeys installs the keys on every member of the cluster through the serf keyring manager, makes the first key
+// the primary key and removes the keys that are not part of the list anymore.
+// The new keys should be distributed before being used as primary key, so that the members that are not reachable
+// during the rotation can still join the cluster afterwards.
+func (service *ClusterService) RotateKeys(keys [][]byte) error {
+	if len(keys) == 0 {
+		return errors.New("at least one key is required")
+	}
+
+	if service.cluster == nil || !service.cluster.EncryptionEnabled() {
+		return errors.New("the gossip encryption is not enabled")
+	}
+
+	keyManager := service.cluster.KeyManager()
+
+	encodedKeys := make(map[string]bool, len(keys))
+
+	for _, key := range keys {
+		encodedKey := base64.StdEncoding.EncodeToString(key)
+		encodedKeys[encodedKey] = true
+
+		if err := keyResponseError(keyManager.InstallKey(encodedKey)); err != nil {
+			return fmt.Errorf("unable to install a gossip key: %w", err)
+		}
+	}
+
+	if err := keyResponseError(keyManager.UseKey(base64.StdEncoding.EncodeToString(keys[0]))); err != nil {
+		return fmt.Errorf("unable to change the primary gossip key: %w", err)
+	}
+
+	installedKeys, err := keyManager.ListKeys()
+	if err != nil {
+		return err
+	}
+
+	for installedKey := range installedKeys.Keys {
+		if encodedKeys[installedKey] {
+			continue
+		}
+
+		if err := keyResponseError(keyManager.RemoveKey(installedKey)); err != nil {
+			return fmt.Errorf("unable to remove a gossip key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// keyResponseError returns an error when a keyring operation failed on some members of the cluster
+func keyResponseError(response *serf.KeyResponse, err error) error {
+	if err != nil {
+		messages := make([]string, 0, len(response.Messages))
+		for node, message := range response.Messages {
+			messages = append(messages, fmt.Sprintf("%s: %s", node, message))
+		}
+
+		if len(messages) > 0 {
+			return fmt.Errorf("%w (%s)", err, strings.Join(messages, ", "))
+		}
+
+		return err
+	}
+
+	return nil
+}
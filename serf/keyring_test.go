@@ -0,0 +1,157 @@
+package serf
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/portainer/agent"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGossipKeys(t *testing.T) {
+	keys, err := GossipKeys("", "")
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	keys, err = GossipKeys("", "secret")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Len(t, keys[0], 32)
+
+	otherKeys, err := GossipKeys("", "other secret")
+	require.NoError(t, err)
+	require.NotEqual(t, keys[0], otherKeys[0])
+
+	primary := make([]byte, 32)
+	secondary := make([]byte, 16)
+	secondary[0] = 1
+
+	keyFile := filepath.Join(t.TempDir(), "gossip.keys")
+	content := "# rotated on 2024-01-01\n" + base64.StdEncoding.EncodeToString(primary) + "\n\n" + base64.StdEncoding.EncodeToString(secondary) + "\n"
+	require.NoError(t, os.WriteFile(keyFile, []byte(content), 0600))
+
+	keys, err = GossipKeys(keyFile, "secret")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{primary, secondary}, keys)
+
+	require.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0600))
+
+	_, err = GossipKeys(keyFile, "secret")
+	require.Error(t, err)
+}
+
+func TestMemberValidatorFilter(t *testing.T) {
+	calls := 0
+	validator := newMemberValidator(func() (*agent.SwarmTopology, error) {
+		calls++
+
+		return &agent.SwarmTopology{
+			TaskHosts: map[string]string{
+				"10.0.0.1": "192.168.0.1",
+				"10.0.0.2": "192.168.0.2",
+				"10.0.0.3": "192.168.0.2",
+			},
+			Nodes: map[string]agent.SwarmNode{
+				"manager-1": {Hostname: "manager-1", Role: agent.NodeRoleManager, Address: "192.168.0.1"},
+				"worker-1":  {Hostname: "worker-1", Role: agent.NodeRoleWorker, Address: "192.168.0.2"},
+			},
+		}, nil
+	})
+
+	members := []agent.ClusterMember{
+		{IPAddress: "10.0.0.1", NodeName: "manager-1", NodeRole: memberTagValueNodeRoleManager},
+		{IPAddress: "10.0.0.2", NodeName: "worker-1", NodeRole: memberTagValueNodeRoleWorker},
+		{IPAddress: "10.0.0.3", NodeName: "worker-1", NodeRole: memberTagValueNodeRoleManager},
+		{IPAddress: "10.0.0.4", NodeName: "unknown", NodeRole: memberTagValueNodeRoleWorker},
+	}
+
+	require.Equal(t, members[:2], validator.filter(members, true))
+	// The unknown node does not trigger a refresh right after the first retrieval
+	require.Equal(t, 1, calls)
+}
+
+func TestMemberValidatorAcceptsMembersWhenDockerIsUnreachable(t *testing.T) {
+	validator := newMemberValidator(func() (*agent.SwarmTopology, error) {
+		return nil, errors.New("unreachable")
+	})
+
+	members := []agent.ClusterMember{
+		{IPAddress: "10.0.0.1", NodeName: "manager-1", NodeRole: memberTagValueNodeRoleManager},
+	}
+
+	require.Equal(t, members, validator.filter(members, true))
+
+	var nilValidator *memberValidator
+	require.Equal(t, members, nilValidator.filter(members, true))
+}
+
+func newTestValidator(topology *agent.SwarmTopology) *memberValidator {
+	return newMemberValidator(func() (*agent.SwarmTopology, error) {
+		return topology, nil
+	})
+}
+
+func TestMemberValidatorOnManager(t *testing.T) {
+	validator := newTestValidator(&agent.SwarmTopology{
+		TaskHosts: map[string]string{
+			"10.0.1.2": "192.168.0.1",
+			"10.0.1.3": "192.168.0.2",
+			"10.0.1.4": "192.168.0.2",
+		},
+		Nodes: map[string]agent.SwarmNode{
+			"manager1": {Hostname: "manager1", Role: agent.NodeRoleManager, Address: "192.168.0.1"},
+			"worker1":  {Hostname: "worker1", Role: agent.NodeRoleWorker, Address: "192.168.0.2"},
+		},
+	})
+
+	manager := agent.ClusterMember{IPAddress: "10.0.1.2", NodeName: "manager1", NodeRole: memberTagValueNodeRoleManager}
+	worker := agent.ClusterMember{IPAddress: "10.0.1.3", NodeName: "worker1", NodeRole: memberTagValueNodeRoleWorker}
+
+	require.Equal(t, []agent.ClusterMember{manager, worker}, validator.filter([]agent.ClusterMember{
+		manager,
+		worker,
+		// A container that is not a task of the agent service
+		{IPAddress: "10.0.1.9", NodeName: "worker1", NodeRole: memberTagValueNodeRoleWorker},
+		// A task claiming the node of another task
+		{IPAddress: "10.0.1.4", NodeName: "manager1", NodeRole: memberTagValueNodeRoleManager},
+		// A task claiming the manager role
+		{IPAddress: "10.0.1.4", NodeName: "worker1", NodeRole: memberTagValueNodeRoleManager},
+	}, false))
+
+	// Only one member can claim a node
+	duplicate := agent.ClusterMember{IPAddress: "10.0.1.4", NodeName: "worker1", NodeRole: memberTagValueNodeRoleWorker}
+	require.Equal(t, []agent.ClusterMember{manager}, validator.filter([]agent.ClusterMember{manager, worker, duplicate}, true))
+	require.Len(t, validator.filter([]agent.ClusterMember{manager, worker, duplicate}, false), 3)
+}
+
+func TestMemberValidatorOnWorker(t *testing.T) {
+	validator := newTestValidator(&agent.SwarmTopology{
+		TaskHosts: map[string]string{
+			"10.0.1.2": "192.168.0.1",
+			"10.0.1.3": "192.168.0.2",
+			"10.0.1.4": "192.168.0.3",
+		},
+		ManagerAddresses: []string{"192.168.0.1"},
+		LocalNode:        agent.SwarmNode{Hostname: "worker1", Role: agent.NodeRoleWorker, Address: "192.168.0.2"},
+	})
+
+	manager := agent.ClusterMember{IPAddress: "10.0.1.2", NodeName: "manager1", NodeRole: memberTagValueNodeRoleManager}
+	local := agent.ClusterMember{IPAddress: "10.0.1.3", NodeName: "worker1", NodeRole: memberTagValueNodeRoleWorker}
+	worker := agent.ClusterMember{IPAddress: "10.0.1.4", NodeName: "worker2", NodeRole: memberTagValueNodeRoleWorker}
+
+	require.Equal(t, []agent.ClusterMember{manager, local, worker}, validator.filter([]agent.ClusterMember{
+		manager,
+		local,
+		worker,
+		// A task of a worker claiming the manager role
+		{IPAddress: "10.0.1.4", NodeName: "worker2", NodeRole: memberTagValueNodeRoleManager},
+		// A task of another node claiming the local node
+		{IPAddress: "10.0.1.4", NodeName: "worker1", NodeRole: memberTagValueNodeRoleWorker},
+		// The local task claiming another node
+		{IPAddress: "10.0.1.3", NodeName: "worker3", NodeRole: memberTagValueNodeRoleWorker},
+	}, false))
+}
@@ -0,0 +1,184 @@
+package serf
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/portainer/agent"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// topologyCacheDuration is the duration during which the Swarm topology reported by Docker is cached
+	topologyCacheDuration = 30 * time.Second
+	// topologyMinRefreshInterval is the minimum interval between two refreshes triggered by an unknown member
+	topologyMinRefreshInterval = 5 * time.Second
+)
+
+// TopologyFunc returns the Swarm topology reported by Docker
+type TopologyFunc func() (*agent.SwarmTopology, error)
+
+// memberValidator rejects the members that are not tasks of the agent service running on the node they claim,
+// so that a container joining the cluster cannot impersonate a node or a manager
+type memberValidator struct {
+	topologyFunc TopologyFunc
+	topology     *agent.SwarmTopology
+	updatedAt    time.Time
+	// refreshError is the last error returned when retrieving the topology, so that it is only logged once
+	refreshError string
+	// rejected contains the reason why each member was rejected, so that a rejection is only logged once
+	rejected map[string]string
+	mu       sync.Mutex
+}
+
+func newMemberValidator(topologyFunc TopologyFunc) *memberValidator {
+	return &memberValidator{
+		topologyFunc: topologyFunc,
+		rejected:     make(map[string]string),
+	}
+}
+
+// filter returns the members that are consistent with the Swarm topology reported by Docker. When rejectDuplicates
+// is set, the members claiming the same node are rejected as only one agent runs on each node.
+// All the members are accepted when the topology could never be retrieved.
+func (validator *memberValidator) filter(members []agent.ClusterMember, rejectDuplicates bool) []agent.ClusterMember {
+	if validator == nil {
+		return members
+	}
+
+	validator.mu.Lock()
+	defer validator.mu.Unlock()
+
+	validator.refresh(false)
+
+	if validator.topology == nil {
+		return members
+	}
+
+	errs := make([]error, len(members))
+	nodeMembers := make(map[string]int, len(members))
+
+	for i, member := range members {
+		errs[i] = validator.validate(member)
+		if errs[i] == nil {
+			nodeMembers[member.NodeName]++
+		}
+	}
+
+	validMembers := make([]agent.ClusterMember, 0, len(members))
+
+	for i, member := range members {
+		err := errs[i]
+		if err == nil && rejectDuplicates && nodeMembers[member.NodeName] > 1 {
+			err = fmt.Errorf("%d members claim the node %s", nodeMembers[member.NodeName], member.NodeName)
+		}
+
+		if err == nil {
+			delete(validator.rejected, member.IPAddress)
+			validMembers = append(validMembers, member)
+
+			continue
+		}
+
+		if validator.rejected[member.IPAddress] != err.Error() {
+			validator.rejected[member.IPAddress] = err.Error()
+
+			log.Warn().
+				Str("node_name", member.NodeName).
+				Str("ip_address", member.IPAddress).
+				Err(err).
+				Msg("rejecting agent cluster member")
+		}
+	}
+
+	return validMembers
+}
+
+func (validator *memberValidator) validate(member agent.ClusterMember) error {
+	hostAddress, ok := validator.topology.TaskHosts[member.IPAddress]
+	if !ok && validator.refresh(true) {
+		hostAddress, ok = validator.topology.TaskHosts[member.IPAddress]
+	}
+
+	if !ok {
+		return fmt.Errorf("the address %s is not the address of a task of the agent service", member.IPAddress)
+	}
+
+	role, err := validator.nodeRole(member.NodeName, hostAddress)
+	if err != nil {
+		return err
+	}
+
+	expectedRole := memberTagValueNodeRoleManager
+	if role == agent.NodeRoleWorker {
+		expectedRole = memberTagValueNodeRoleWorker
+	}
+
+	if member.NodeRole != expectedRole {
+		return fmt.Errorf("the member claims the %s role while the node is a %s", member.NodeRole, expectedRole)
+	}
+
+	return nil
+}
+
+// nodeRole returns the role of the node claimed by a member, after checking that the task of the member runs on it.
+// The workers cannot list the nodes, the role is deduced from the addresses of the managers and only the claims
+// involving the local node can be checked.
+func (validator *memberValidator) nodeRole(nodeName, hostAddress string) (agent.DockerNodeRole, error) {
+	topology := validator.topology
+
+	if topology.Nodes != nil {
+		node, ok := topology.Nodes[nodeName]
+		if !ok {
+			return 0, fmt.Errorf("the node %s is not part of the cluster", nodeName)
+		}
+
+		if node.Address != hostAddress {
+			return 0, fmt.Errorf("the member runs on %s while the node %s has the address %s", hostAddress, nodeName, node.Address)
+		}
+
+		return node.Role, nil
+	}
+
+	localNode := topology.LocalNode
+	if (nodeName == localNode.Hostname) != (hostAddress == localNode.Address) {
+		return 0, fmt.Errorf("the member claims the node %s while running on %s", nodeName, hostAddress)
+	}
+
+	if slices.Contains(topology.ManagerAddresses, hostAddress) {
+		return agent.NodeRoleManager, nil
+	}
+
+	return agent.NodeRoleWorker, nil
+}
+
+// refresh retrieves the topology when the cache expired, or when force is set and the minimum refresh interval
+// is elapsed. It returns true when the topology was retrieved.
+func (validator *memberValidator) refresh(force bool) bool {
+	elapsed := time.Since(validator.updatedAt)
+	if elapsed < topologyCacheDuration && (!force || elapsed < topologyMinRefreshInterval) {
+		return false
+	}
+
+	// Do not retry right away when Docker is not reachable
+	validator.updatedAt = time.Now()
+
+	topology, err := validator.topologyFunc()
+	if err != nil {
+		if validator.refreshError != err.Error() {
+			validator.refreshError = err.Error()
+
+			log.Warn().Err(err).Msg("unable to retrieve the Swarm topology from Docker, using the last known topology to validate the agent cluster members")
+		}
+
+		return false
+	}
+
+	validator.refreshError = ""
+	validator.topology = topology
+
+	return true
+}